@@ -0,0 +1,326 @@
+// Package abi implements the Solidity contract ABI: parsing of the JSON
+// interface description, encoding of call data and decoding of return
+// values, revert data and event logs.
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/model"
+	"io"
+	"reflect"
+)
+
+// The ABI holds information about a contract's context and available
+// invokable methods. It will allow you to type check function calls and
+// packs data accordingly.
+type ABI struct {
+	Constructor Method
+	Methods     map[string]Method
+	Events      map[string]Event
+	Errors      map[string]Error
+
+	// Additional "special" functions introduced in solidity v0.6.0.
+	// It's separated from the original default fallback. Each contract
+	// can only define one fallback and receive function.
+	Fallback Method // Note it's also used to represent legacy fallback before v0.6.0
+	Receive  Method
+}
+
+// JSON returns a parsed ABI interface and error if it failed.
+func JSON(reader io.Reader) (ABI, error) {
+	dec := json.NewDecoder(reader)
+
+	var abi ABI
+	if err := dec.Decode(&abi); err != nil {
+		return ABI{}, err
+	}
+	return abi, nil
+}
+
+// Pack the given method name to conform the ABI. Method call's data will
+// consist of method_id, args0, arg1, ... argN. Method id consists of 4 bytes
+// and arguments are all 32 bytes. The empty name packs the arguments of the
+// constructor, without a selector.
+func (abi ABI) Pack(name string, args ...interface{}) ([]byte, error) {
+	if name == "" {
+		arguments, err := abi.Constructor.Inputs.Pack(args...)
+		if err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	}
+	method, exist := abi.Methods[name]
+	if !exist {
+		return nil, fmt.Errorf("abi: method '%s' not found", name)
+	}
+	arguments, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("abi: method '%s': %w", name, err)
+	}
+	// Pack up the method ID too if not a constructor and return
+	return append(common.CopyBytes(method.ID), arguments...), nil
+}
+
+// getArguments returns the arguments decoded by Unpack for the given name:
+// the outputs of a method or the non-indexed inputs of an event.
+func (abi ABI) getArguments(name string, data []byte) (Arguments, error) {
+	// since there can't be naming collisions with contracts and events,
+	// we need to decide whether we're calling a method or an event
+	if method, ok := abi.Methods[name]; ok {
+		if len(data)%32 != 0 {
+			return nil, fmt.Errorf("abi: improperly formatted output: %q - Bytes: %+v", data, data)
+		}
+		return method.Outputs, nil
+	}
+	if event, ok := abi.Events[name]; ok {
+		return event.Inputs, nil
+	}
+	return nil, fmt.Errorf("abi: could not locate named method or event: %s", name)
+}
+
+// Unpack unpacks the output according to the abi specification.
+func (abi ABI) Unpack(name string, data []byte) ([]interface{}, error) {
+	args, err := abi.getArguments(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return args.Unpack(data)
+}
+
+// UnpackIntoInterface unpacks the output in v according to the abi
+// specification. It performs an additional copy. Please only use, if you
+// want to unpack into a structure that does not strictly conform to the abi
+// structure (e.g. has additional arguments).
+func (abi ABI) UnpackIntoInterface(v interface{}, name string, data []byte) error {
+	args, err := abi.getArguments(name, data)
+	if err != nil {
+		return err
+	}
+	unpacked, err := args.Unpack(data)
+	if err != nil {
+		return err
+	}
+	return args.Copy(v, unpacked)
+}
+
+// UnpackIntoMap unpacks the output into the provided map[string]interface{},
+// keyed by the argument names.
+func (abi ABI) UnpackIntoMap(v map[string]interface{}, name string, data []byte) (err error) {
+	args, err := abi.getArguments(name, data)
+	if err != nil {
+		return err
+	}
+	return args.UnpackIntoMap(v, data)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (abi *ABI) UnmarshalJSON(data []byte) error {
+	var fields []struct {
+		Type    string
+		Name    string
+		Inputs  []Argument
+		Outputs []Argument
+
+		// StateMutability is the mutability of the method, one of "pure",
+		// "view", "nonpayable" or "payable".
+		StateMutability string
+
+		// Deprecated fields of legacy compilers, superseded by
+		// StateMutability
+		Constant bool
+		Payable  bool
+
+		// Event relevant indicator represents the event is
+		// declared as anonymous.
+		Anonymous bool
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	abi.Methods = make(map[string]Method)
+	abi.Events = make(map[string]Event)
+	abi.Errors = make(map[string]Error)
+	for _, field := range fields {
+		mutability := field.StateMutability
+		if mutability == "" {
+			if field.Constant {
+				mutability = "view"
+			} else if field.Payable {
+				mutability = "payable"
+			}
+		}
+		switch field.Type {
+		case "constructor":
+			abi.Constructor = NewMethod("", "", Constructor, mutability, field.Inputs, nil)
+		case "function", "":
+			name := overloadedName(field.Name, func(s string) bool { _, ok := abi.Methods[s]; return ok })
+			abi.Methods[name] = NewMethod(name, field.Name, Function, mutability, field.Inputs, field.Outputs)
+		case "fallback":
+			// New introduced function type in v0.6.0, check more detail
+			// here https://solidity.readthedocs.io/en/v0.6.0/contracts.html#fallback-function
+			if abi.HasFallback() {
+				return errors.New("only single fallback is allowed")
+			}
+			abi.Fallback = NewMethod("", "", Fallback, mutability, nil, nil)
+		case "receive":
+			// New introduced function type in v0.6.0, check more detail
+			// here https://solidity.readthedocs.io/en/v0.6.0/contracts.html#fallback-function
+			if abi.HasReceive() {
+				return errors.New("only single receive is allowed")
+			}
+			if mutability != "payable" {
+				return errors.New("the statemutability of receive can only be payable")
+			}
+			abi.Receive = NewMethod("", "", Receive, mutability, nil, nil)
+		case "event":
+			name := overloadedName(field.Name, func(s string) bool { _, ok := abi.Events[s]; return ok })
+			abi.Events[name] = NewEvent(name, field.Name, field.Anonymous, field.Inputs)
+		case "error":
+			// Errors cannot be overloaded or overridden but are inherited,
+			// no need to resolve the name conflict here.
+			abi.Errors[field.Name] = NewError(field.Name, field.Inputs)
+		default:
+			return fmt.Errorf("abi: could not recognize type %v of field %v", field.Type, field.Name)
+		}
+	}
+	return nil
+}
+
+// MethodById looks up a method by the 4-byte id, returns nil if none found.
+func (abi *ABI) MethodById(sigdata []byte) (*Method, error) {
+	if len(sigdata) < 4 {
+		return nil, fmt.Errorf("data too short (%d bytes) for abi method lookup", len(sigdata))
+	}
+	for _, method := range abi.Methods {
+		if bytes.Equal(method.ID, sigdata[:4]) {
+			return &method, nil
+		}
+	}
+	return nil, fmt.Errorf("no method with id: %#x", sigdata[:4])
+}
+
+// EventByID looks an event up by its topic hash in the ABI and returns nil
+// if none found.
+func (abi *ABI) EventByID(topic common.Hash) (*Event, error) {
+	for _, event := range abi.Events {
+		if event.ID == topic {
+			return &event, nil
+		}
+	}
+	return nil, fmt.Errorf("no event with id: %#x", topic)
+}
+
+// ErrorByID looks up an error by the 4-byte id, returns nil if none found.
+func (abi *ABI) ErrorByID(sigdata [4]byte) (*Error, error) {
+	for _, errABI := range abi.Errors {
+		if errABI.ID == sigdata {
+			return &errABI, nil
+		}
+	}
+	return nil, fmt.Errorf("no error with id: %#x", sigdata[:])
+}
+
+// HasFallback returns an indicator whether a fallback function is included.
+func (abi *ABI) HasFallback() bool {
+	return abi.Fallback.Type == Fallback
+}
+
+// HasReceive returns an indicator whether a receive function is included.
+func (abi *ABI) HasReceive() bool {
+	return abi.Receive.Type == Receive
+}
+
+// UnpackLog decodes a log of the named event into out, a pointer to a struct
+// holding a field for every input: the non-indexed inputs are decoded from
+// the data, the indexed ones from the topics.
+func (abi ABI) UnpackLog(out interface{}, event string, log model.Log) error {
+	e, values, err := abi.unpackLog(event, log)
+	if err != nil {
+		return err
+	}
+	dst := reflect.ValueOf(out)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || dst.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("abi: UnpackLog expects a pointer to a struct, got %T", out)
+	}
+	return e.Inputs.copyInto(dst.Elem(), values)
+}
+
+// UnpackLogIntoMap decodes a log of the named event into a map keyed by the
+// input names.
+func (abi ABI) UnpackLogIntoMap(out map[string]interface{}, event string, log model.Log) error {
+	e, values, err := abi.unpackLog(event, log)
+	if err != nil {
+		return err
+	}
+	for i, arg := range e.Inputs {
+		out[arg.Name] = values[i]
+	}
+	return nil
+}
+
+// unpackLog decodes the inputs of a log of the named event, in order.
+// Indexed inputs of reference types are only available as the hash of
+// their encoding, which is returned as a common.Hash.
+func (abi ABI) unpackLog(name string, log model.Log) (Event, []interface{}, error) {
+	event, ok := abi.Events[name]
+	if !ok {
+		return Event{}, nil, fmt.Errorf("abi: could not locate named event: %s", name)
+	}
+	topics := log.Topics
+	if !event.Anonymous {
+		if len(topics) == 0 || topics[0] != event.ID {
+			return Event{}, nil, fmt.Errorf("abi: log is not event %s", name)
+		}
+		topics = topics[1:]
+	}
+	data, err := event.Inputs.Unpack(log.Data)
+	if err != nil {
+		return Event{}, nil, err
+	}
+	values := make([]interface{}, 0, len(event.Inputs))
+	for _, arg := range event.Inputs {
+		if !arg.Indexed {
+			values, data = append(values, data[0]), data[1:]
+			continue
+		}
+		if len(topics) == 0 {
+			return Event{}, nil, fmt.Errorf("abi: topic count mismatch for event %s", name)
+		}
+		topic := topics[0]
+		topics = topics[1:]
+
+		switch arg.Type.T {
+		case StringTy, BytesTy, SliceTy, ArrayTy, TupleTy:
+			values = append(values, topic)
+		default:
+			value, err := arg.Type.unpackWord(topic[:])
+			if err != nil {
+				return Event{}, nil, err
+			}
+			values = append(values, value.Interface())
+		}
+	}
+	if len(topics) != 0 {
+		return Event{}, nil, fmt.Errorf("abi: topic count mismatch for event %s", name)
+	}
+	return event, values, nil
+}
+
+// overloadedName returns the next available name for a given thing.
+// Needed since solidity allows for overloading.
+//
+// e.g. if the abi contains Methods send, send0
+// overloadedName would return send1 for input send.
+func overloadedName(rawName string, isTaken func(string) bool) string {
+	name := rawName
+	taken := isTaken(name)
+	for idx := 0; taken; idx++ {
+		name = fmt.Sprintf("%s%d", rawName, idx)
+		taken = isTaken(name)
+	}
+	return name
+}
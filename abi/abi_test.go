@@ -0,0 +1,231 @@
+package abi
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/model"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testABI = `[
+	{"type": "constructor", "inputs": [{"name": "owner", "type": "address"}]},
+	{"type": "function", "name": "multiply", "stateMutability": "pure", "inputs": [{"name": "a", "type": "uint256"}], "outputs": [{"name": "d", "type": "uint256"}]},
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}], "outputs": [{"name": "", "type": "bool"}]},
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}], "outputs": []},
+	{"type": "function", "name": "balance", "constant": true, "inputs": [], "outputs": [{"name": "amount", "type": "uint256"}, {"name": "last_update", "type": "uint64"}]},
+	{"type": "function", "name": "position", "stateMutability": "view", "inputs": [], "outputs": [{"name": "pos", "type": "tuple", "components": [{"name": "x", "type": "int32"}, {"name": "y", "type": "int32"}]}]},
+	{"type": "event", "name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "to", "type": "address", "indexed": true}, {"name": "value", "type": "uint256", "indexed": false}]},
+	{"type": "event", "name": "Named", "anonymous": true, "inputs": [{"name": "name", "type": "string", "indexed": true}, {"name": "id", "type": "int8", "indexed": true}, {"name": "tags", "type": "bytes32[]"}]},
+	{"type": "error", "name": "InsufficientBalance", "inputs": [{"name": "available", "type": "uint256"}, {"name": "required", "type": "uint256"}]},
+	{"type": "receive", "stateMutability": "payable"}
+]`
+
+func mustJSON(t *testing.T, def string) ABI {
+	t.Helper()
+	parsed, err := JSON(strings.NewReader(def))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	return parsed
+}
+
+func TestJSON(t *testing.T) {
+	parsed := mustJSON(t, testABI)
+
+	sigs := map[string]string{
+		"multiply":  "multiply(uint256)",
+		"transfer":  "transfer(address,uint256)",
+		"transfer0": "transfer(address)",
+		"balance":   "balance()",
+		"position":  "position()",
+	}
+	if len(parsed.Methods) != len(sigs) {
+		t.Fatalf("method count mismatch: have %d, want %d", len(parsed.Methods), len(sigs))
+	}
+	for name, sig := range sigs {
+		method := parsed.Methods[name]
+		if method.Sig != sig {
+			t.Errorf("%s: signature mismatch: have %s, want %s", name, method.Sig, sig)
+		}
+		if !bytes.Equal(method.ID, crypto.Keccak256([]byte(sig))[:4]) {
+			t.Errorf("%s: selector mismatch: have %x", name, method.ID)
+		}
+		if found, err := parsed.MethodById(method.ID); err != nil || found.Name != name {
+			t.Errorf("%s: lookup by selector failed: %v", name, err)
+		}
+	}
+	if !parsed.Methods["balance"].IsConstant() || parsed.Methods["transfer"].IsConstant() {
+		t.Errorf("mutability mismatch")
+	}
+	if !parsed.HasReceive() || parsed.HasFallback() {
+		t.Errorf("special functions mismatch")
+	}
+	if have := parsed.Events["Transfer"].ID.Hex(); have != "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" {
+		t.Errorf("event ID mismatch: have %s", have)
+	}
+	if _, err := JSON(strings.NewReader(`[{"type": "function", "name": "f", "inputs": [{"name": "a", "type": "fixed128x18"}]}]`)); err == nil {
+		t.Errorf("expected error parsing unsupported type")
+	}
+}
+
+func TestPackMethod(t *testing.T) {
+	parsed := mustJSON(t, testABI)
+
+	// The call data of multiply(12) the EVM tests used to hard-code
+	input, err := parsed.Pack("multiply", big.NewInt(12))
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	if want := common.Hex2Bytes("c6888fa1000000000000000000000000000000000000000000000000000000000000000c"); !bytes.Equal(input, want) {
+		t.Errorf("call data mismatch: have %x, want %x", input, want)
+	}
+	input, err = parsed.Pack("", common.BytesToAddress([]byte("owner")))
+	if err != nil || len(input) != 32 {
+		t.Errorf("constructor arguments mismatch: %x, %v", input, err)
+	}
+	if _, err := parsed.Pack("multiply", "12"); err == nil {
+		t.Errorf("expected error packing invalid argument")
+	}
+	if _, err := parsed.Pack("multiply"); err == nil {
+		t.Errorf("expected error packing missing argument")
+	}
+	if _, err := parsed.Pack("divide", big.NewInt(12)); err == nil {
+		t.Errorf("expected error packing unknown method")
+	}
+}
+
+func TestUnpackIntoInterface(t *testing.T) {
+	parsed := mustJSON(t, testABI)
+	output := words(
+		"00000000000000000000000000000000000000000000000000000000000003e8",
+		"0000000000000000000000000000000000000000000000000000000000000007",
+	)
+	var balance struct {
+		Amount     *big.Int
+		LastUpdate uint64 `abi:"last_update"`
+		Unrelated  string
+	}
+	if err := parsed.UnpackIntoInterface(&balance, "balance", output); err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	if balance.Amount.Int64() != 1000 || balance.LastUpdate != 7 {
+		t.Errorf("unpacked values mismatch: %+v", balance)
+	}
+	// Single values can be unpacked directly
+	var product *big.Int
+	if err := parsed.UnpackIntoInterface(&product, "multiply", output[32:]); err != nil || product.Int64() != 7 {
+		t.Errorf("single value mismatch: %v, %v", product, err)
+	}
+	// Single tuples into the matching struct
+	type point struct{ X, Y int32 }
+	var pos point
+	if err := parsed.UnpackIntoInterface(&pos, "position", append(output[32:], packInt(big.NewInt(-2))...)); err != nil || pos != (point{7, -2}) {
+		t.Errorf("tuple mismatch: %+v, %v", pos, err)
+	}
+	values := make(map[string]interface{})
+	if err := parsed.UnpackIntoMap(values, "balance", output); err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	if values["last_update"] != uint64(7) {
+		t.Errorf("unpacked map mismatch: %v", values)
+	}
+	if _, err := parsed.Unpack("balance", output[:32]); err == nil {
+		t.Errorf("expected error unpacking truncated output")
+	}
+	if _, err := parsed.Unpack("balance", nil); err == nil {
+		t.Errorf("expected error unpacking empty output")
+	}
+}
+
+func TestUnpackLog(t *testing.T) {
+	parsed := mustJSON(t, testABI)
+
+	var (
+		from = common.BytesToAddress([]byte("from"))
+		to   = common.BytesToAddress([]byte("to"))
+	)
+	log := model.Log{
+		Topics: []common.Hash{parsed.Events["Transfer"].ID, from.Hash(), to.Hash()},
+		Data:   packInt(big.NewInt(42)),
+	}
+	var transfer struct {
+		From  common.Address
+		To    common.Address
+		Value *big.Int
+	}
+	if err := parsed.UnpackLog(&transfer, "Transfer", log); err != nil {
+		t.Fatalf("failed to unpack log: %v", err)
+	}
+	if transfer.From != from || transfer.To != to || transfer.Value.Int64() != 42 {
+		t.Errorf("unpacked log mismatch: %+v", transfer)
+	}
+	if event, err := parsed.EventByID(log.Topics[0]); err != nil || event.Name != "Transfer" {
+		t.Errorf("lookup by ID failed: %v", err)
+	}
+	// Logs of other events are rejected
+	log.Topics[0] = common.Hash{}
+	if err := parsed.UnpackLog(&transfer, "Transfer", log); err == nil {
+		t.Errorf("expected error unpacking log of another event")
+	}
+
+	// Indexed reference types are only available as hashes
+	var (
+		nameHash = crypto.Keccak256Hash([]byte("name"))
+		tags     = [][32]byte{{1}, {2}}
+	)
+	data, err := parsed.Events["Named"].Inputs.NonIndexed().Pack(tags)
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	log = model.Log{
+		Topics: []common.Hash{nameHash, common.BytesToHash(packInt(big.NewInt(-3)))},
+		Data:   data,
+	}
+	values := make(map[string]interface{})
+	if err := parsed.UnpackLogIntoMap(values, "Named", log); err != nil {
+		t.Fatalf("failed to unpack log: %v", err)
+	}
+	want := map[string]interface{}{"name": nameHash, "id": int8(-3), "tags": tags}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("unpacked log mismatch: have %v, want %v", values, want)
+	}
+	log.Topics = log.Topics[:1]
+	if err := parsed.UnpackLogIntoMap(values, "Named", log); err == nil {
+		t.Errorf("expected error unpacking log with missing topics")
+	}
+}
+
+func TestError(t *testing.T) {
+	parsed := mustJSON(t, testABI)
+
+	custom := parsed.Errors["InsufficientBalance"]
+	if custom.Sig != "InsufficientBalance(uint256,uint256)" {
+		t.Errorf("signature mismatch: have %s", custom.Sig)
+	}
+	args, err := custom.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	data := append(custom.ID[:], args...)
+
+	var id [4]byte
+	copy(id[:], data)
+	found, err := parsed.ErrorByID(id)
+	if err != nil || found.Name != custom.Name {
+		t.Fatalf("lookup by selector failed: %v", err)
+	}
+	values, err := found.Unpack(data)
+	if err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{big.NewInt(1), big.NewInt(2)}) {
+		t.Errorf("unpacked values mismatch: %v", values)
+	}
+	if _, err := found.Unpack(args); err == nil {
+		t.Errorf("expected error unpacking data without selector")
+	}
+}
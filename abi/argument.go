@@ -0,0 +1,153 @@
+package abi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ArgumentMarshaling is the JSON representation of an argument, also used
+// for the fields of tuples.
+type ArgumentMarshaling struct {
+	Name         string               `json:"name"`
+	Type         string               `json:"type"`
+	InternalType string               `json:"internalType,omitempty"`
+	Components   []ArgumentMarshaling `json:"components,omitempty"`
+	Indexed      bool                 `json:"indexed,omitempty"`
+}
+
+// Argument holds the name of the argument and the corresponding type.
+// Types are used when packing and testing arguments.
+type Argument struct {
+	Name    string
+	Type    Type
+	Indexed bool // indexed is only used by events
+}
+
+// Arguments is the list of inputs or outputs of a method or event.
+type Arguments []Argument
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (argument *Argument) UnmarshalJSON(data []byte) error {
+	var arg ArgumentMarshaling
+	if err := json.Unmarshal(data, &arg); err != nil {
+		return fmt.Errorf("abi: failed to unmarshal argument: %v", err)
+	}
+	typ, err := NewType(arg.Type, arg.Components)
+	if err != nil {
+		return err
+	}
+	argument.Name = arg.Name
+	argument.Type = typ
+	argument.Indexed = arg.Indexed
+	return nil
+}
+
+// NonIndexed returns the arguments with indexed arguments filtered out.
+func (arguments Arguments) NonIndexed() Arguments {
+	var ret []Argument
+	for _, arg := range arguments {
+		if !arg.Indexed {
+			ret = append(ret, arg)
+		}
+	}
+	return ret
+}
+
+// types returns the types of the arguments.
+func (arguments Arguments) types() []*Type {
+	types := make([]*Type, len(arguments))
+	for i := range arguments {
+		types[i] = &arguments[i].Type
+	}
+	return types
+}
+
+// Pack encodes the given values as the arguments.
+func (arguments Arguments) Pack(args ...interface{}) ([]byte, error) {
+	if len(args) != len(arguments) {
+		return nil, fmt.Errorf("abi: argument count mismatch: got %d for %d", len(args), len(arguments))
+	}
+	values := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		values[i] = reflect.ValueOf(arg)
+	}
+	return packSequence(arguments.types(), values)
+}
+
+// Unpack decodes the arguments from data, returning the values in the Go
+// types of Type.GetType. Indexed arguments are skipped: they are not part of
+// the data of event logs.
+func (arguments Arguments) Unpack(data []byte) ([]interface{}, error) {
+	nonIndexed := arguments.NonIndexed()
+	if len(data) == 0 && len(nonIndexed) > 0 {
+		return nil, errEmptyOutput
+	}
+	values, err := unpackSequence(nonIndexed.types(), data)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = value.Interface()
+	}
+	return ret, nil
+}
+
+// UnpackIntoMap decodes the arguments from data into a map keyed by the
+// argument names.
+func (arguments Arguments) UnpackIntoMap(v map[string]interface{}, data []byte) error {
+	values, err := arguments.Unpack(data)
+	if err != nil {
+		return err
+	}
+	for i, arg := range arguments.NonIndexed() {
+		v[arg.Name] = values[i]
+	}
+	return nil
+}
+
+// Copy copies the values returned by Unpack into v, which must be a pointer
+// to a struct holding a field for every argument, or a pointer to a single
+// value if there is only one argument.
+func (arguments Arguments) Copy(v interface{}, values []interface{}) error {
+	dst := reflect.ValueOf(v)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return fmt.Errorf("abi: Copy expects a non-nil pointer, got %T", v)
+	}
+	return arguments.NonIndexed().copyInto(dst.Elem(), values)
+}
+
+// copyInto copies the values of the arguments into dst: into the fields
+// holding the arguments if dst is a struct, or into dst itself if there is
+// a single argument of another type.
+func (arguments Arguments) copyInto(dst reflect.Value, values []interface{}) error {
+	if len(values) != len(arguments) {
+		return fmt.Errorf("abi: value count mismatch: got %d for %d", len(values), len(arguments))
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if dst.Kind() != reflect.Struct {
+		if len(values) != 1 {
+			return fmt.Errorf("abi: cannot copy %d values into %v", len(values), dst.Type())
+		}
+		return set(dst, reflect.ValueOf(values[0]))
+	}
+	if len(values) == 1 && arguments[0].Type.T == TupleTy {
+		// A single tuple may be copied into the struct itself
+		if _, err := fieldByArgName(dst, arguments[0].Name); err != nil {
+			return set(dst, reflect.ValueOf(values[0]))
+		}
+	}
+	for i, arg := range arguments {
+		field, err := fieldByArgName(dst, arg.Name)
+		if err != nil {
+			return err
+		}
+		if err := set(field, reflect.ValueOf(values[i])); err != nil {
+			return fmt.Errorf("abi: field %s: %w", arg.Name, err)
+		}
+	}
+	return nil
+}
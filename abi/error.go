@@ -0,0 +1,45 @@
+package abi
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/entropyio/go-evm/common/crypto"
+)
+
+// Error is a custom error declared by a contract, returned as revert data
+// made of its selector followed by the encoded inputs.
+type Error struct {
+	Name   string
+	Inputs Arguments
+
+	// Sig is the canonical signature, e.g. "InsufficientBalance(uint256)"
+	Sig string
+	// ID is the selector: the first 4 bytes of the Keccak256 hash of Sig
+	ID [4]byte
+}
+
+// NewError creates a new Error, deriving the signature and selector.
+func NewError(name string, inputs Arguments) Error {
+	sig := signature(name, inputs)
+
+	var id [4]byte
+	copy(id[:], crypto.Keccak256([]byte(sig)))
+	return Error{
+		Name:   name,
+		Inputs: inputs,
+		Sig:    sig,
+		ID:     id,
+	}
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("error %v(%v)", e.Name, argumentList(e.Inputs))
+}
+
+// Unpack decodes the inputs of the error from revert data.
+func (e Error) Unpack(data []byte) ([]interface{}, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], e.ID[:]) {
+		return nil, fmt.Errorf("abi: revert data is not error %v", e.Name)
+	}
+	return e.Inputs.Unpack(data[4:])
+}
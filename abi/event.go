@@ -0,0 +1,47 @@
+package abi
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+)
+
+// Event is an event potentially triggered by the EVM's LOG mechanism. The
+// Event holds type information (inputs) about the yielded output. Anonymous
+// events don't get the signature canonical representation as the first LOG
+// topic.
+type Event struct {
+	// Name is the event name used for internal representation. It's derived
+	// from the raw name and a suffix will be added in the case of event
+	// overloading.
+	Name      string
+	RawName   string // RawName is the raw event name parsed from ABI
+	Anonymous bool
+	Inputs    Arguments
+
+	// Sig is the canonical signature, e.g. "Transfer(address,address,uint256)"
+	Sig string
+	// ID is the first topic of the logs of the event: the Keccak256 hash of Sig
+	ID common.Hash
+}
+
+// NewEvent creates a new Event, deriving the signature and ID.
+func NewEvent(name, rawName string, anonymous bool, inputs Arguments) Event {
+	sig := signature(rawName, inputs)
+	return Event{
+		Name:      name,
+		RawName:   rawName,
+		Anonymous: anonymous,
+		Inputs:    inputs,
+		Sig:       sig,
+		ID:        common.BytesToHash(crypto.Keccak256([]byte(sig))),
+	}
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("event %v(%v)", e.RawName, argumentList(e.Inputs))
+	if e.Anonymous {
+		s += " anonymous"
+	}
+	return s
+}
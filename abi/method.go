@@ -0,0 +1,137 @@
+package abi
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common/crypto"
+	"strings"
+)
+
+// FunctionType represents the different types of functions a contract might
+// have.
+type FunctionType int
+
+const (
+	// Constructor represents the constructor of the contract, called when
+	// deploying it.
+	Constructor FunctionType = iota
+	// Fallback represents the fallback function, called when no other
+	// function matches the call data.
+	Fallback
+	// Receive represents the receive function, called on plain transfers.
+	Receive
+	// Function represents a normal function.
+	Function
+)
+
+// Method represents a callable given a `Name` and whether the method is a
+// constant. If the method is `Const` no transaction needs to be created for
+// this particular Method call. It can easily be simulated using a local VM.
+type Method struct {
+	// Name is the method name used for internal representation. It's derived
+	// from the raw name and a suffix will be added in the case of a function
+	// overload.
+	//
+	// e.g. there are two functions have same name: foo(int,int) and
+	// foo(uint,uint). The method name of the first one will be resolved as
+	// foo while the second one will be resolved as foo0.
+	Name    string
+	RawName string // RawName is the raw method name parsed from ABI
+	Type    FunctionType
+
+	// StateMutability indicates the mutability state of method, the default
+	// value is nonpayable. It can be empty if the abi is generated by legacy
+	// compilers.
+	StateMutability string
+
+	Inputs  Arguments
+	Outputs Arguments
+
+	// Sig is the canonical signature, e.g. "transfer(address,uint256)"
+	Sig string
+	// ID is the selector: the first 4 bytes of the Keccak256 hash of Sig
+	ID []byte
+}
+
+// NewMethod creates a new Method. A method should always be created using
+// NewMethod, which derives the signature and selector.
+func NewMethod(name string, rawName string, funType FunctionType, mutability string, inputs Arguments, outputs Arguments) Method {
+	var sig string
+	var id []byte
+	if funType == Function {
+		sig = signature(rawName, inputs)
+		id = crypto.Keccak256([]byte(sig))[:4]
+	}
+	if mutability == "" {
+		mutability = "nonpayable"
+	}
+	return Method{
+		Name:            name,
+		RawName:         rawName,
+		Type:            funType,
+		StateMutability: mutability,
+		Inputs:          inputs,
+		Outputs:         outputs,
+		Sig:             sig,
+		ID:              id,
+	}
+}
+
+// IsConstant returns whether the method doesn't modify the state.
+func (method Method) IsConstant() bool {
+	return method.StateMutability == "view" || method.StateMutability == "pure"
+}
+
+// IsPayable returns whether the method accepts value.
+func (method Method) IsPayable() bool {
+	return method.StateMutability == "payable"
+}
+
+func (method Method) String() string {
+	outputs := make([]string, len(method.Outputs))
+	for i, output := range method.Outputs {
+		outputs[i] = output.Type.String()
+		if output.Name != "" {
+			outputs[i] += " " + output.Name
+		}
+	}
+	var name string
+	switch method.Type {
+	case Constructor:
+		name = "constructor"
+	case Fallback:
+		name = "fallback"
+	case Receive:
+		name = "receive"
+	default:
+		name = "function " + method.Name
+	}
+	s := fmt.Sprintf("%v(%v) %v", name, argumentList(method.Inputs), method.StateMutability)
+	if len(outputs) > 0 {
+		s += " returns(" + strings.Join(outputs, ", ") + ")"
+	}
+	return s
+}
+
+// signature returns the canonical signature of a method, event or error.
+func signature(name string, args Arguments) string {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = arg.Type.String()
+	}
+	return fmt.Sprintf("%v(%v)", name, strings.Join(types, ","))
+}
+
+// argumentList returns the human-readable list of arguments.
+func argumentList(args Arguments) string {
+	list := make([]string, len(args))
+	for i, arg := range args {
+		list[i] = arg.Type.String()
+		if arg.Indexed {
+			list[i] += " indexed"
+		}
+		if arg.Name != "" {
+			list[i] += " " + arg.Name
+		}
+	}
+	return strings.Join(list, ", ")
+}
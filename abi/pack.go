@@ -0,0 +1,164 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+var tt256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// packSequence encodes the values as a tuple of the given types: the heads
+// of the values in order, followed by the tails of the dynamic ones.
+func packSequence(types []*Type, values []reflect.Value) ([]byte, error) {
+	headSize := 0
+	for _, t := range types {
+		headSize += t.headSize()
+	}
+	var head, tail []byte
+	for i, t := range types {
+		enc, err := t.pack(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.isDynamic() {
+			head = append(head, packNum(headSize+len(tail))...)
+			tail = append(tail, enc...)
+		} else {
+			head = append(head, enc...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// pack encodes the value v as the type t.
+func (t Type) pack(v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return nil, fmt.Errorf("abi: cannot use nil as type %v", t)
+	}
+	v = indirect(v)
+
+	switch t.T {
+	case IntTy, UintTy:
+		n, ok := toBig(v)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		if !intFits(t, n) {
+			return nil, fmt.Errorf("abi: %v overflows type %v", n, t)
+		}
+		return packInt(n), nil
+	case BoolTy:
+		if v.Kind() != reflect.Bool {
+			return nil, typeError(t, v)
+		}
+		if v.Bool() {
+			return packNum(1), nil
+		}
+		return packNum(0), nil
+	case AddressTy:
+		if v.Kind() != reflect.Array {
+			return nil, typeError(t, v)
+		}
+		fallthrough
+	case FixedBytesTy, FunctionTy:
+		b, ok := byteArray(v)
+		if !ok || len(b) != t.Size {
+			return nil, typeError(t, v)
+		}
+		if t.T == AddressTy {
+			return leftPad(b), nil
+		}
+		return rightPad(b), nil
+	case BytesTy:
+		if v.Kind() != reflect.Slice {
+			return nil, typeError(t, v)
+		}
+		b, ok := byteArray(v)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		return append(packNum(len(b)), rightPad(b)...), nil
+	case StringTy:
+		if v.Kind() != reflect.String {
+			return nil, typeError(t, v)
+		}
+		return append(packNum(v.Len()), rightPad([]byte(v.String()))...), nil
+	case SliceTy, ArrayTy:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, typeError(t, v)
+		}
+		if t.T == ArrayTy && v.Len() != t.Size {
+			return nil, fmt.Errorf("abi: cannot use %d elements as type %v", v.Len(), t)
+		}
+		types := make([]*Type, v.Len())
+		values := make([]reflect.Value, v.Len())
+		for i := range types {
+			types[i], values[i] = t.Elem, v.Index(i)
+		}
+		enc, err := packSequence(types, values)
+		if err != nil {
+			return nil, err
+		}
+		if t.T == SliceTy {
+			enc = append(packNum(v.Len()), enc...)
+		}
+		return enc, nil
+	case TupleTy:
+		if v.Kind() != reflect.Struct {
+			return nil, typeError(t, v)
+		}
+		values := make([]reflect.Value, len(t.TupleElems))
+		for i := range values {
+			field, err := tupleField(v, t, i)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = field
+		}
+		return packSequence(t.TupleElems, values)
+	}
+	return nil, fmt.Errorf("abi: cannot pack type %v", t)
+}
+
+func typeError(t Type, v reflect.Value) error {
+	return fmt.Errorf("abi: cannot use %v as type %v", v.Type(), t)
+}
+
+// intFits returns whether n is in the range of the integer type t.
+func intFits(t Type, n *big.Int) bool {
+	if t.T == UintTy {
+		return n.Sign() >= 0 && n.BitLen() <= t.Size
+	}
+	if n.Sign() >= 0 {
+		return n.BitLen() < t.Size
+	}
+	return new(big.Int).Not(n).BitLen() < t.Size
+}
+
+// packInt encodes n as a word, in two's complement if negative.
+func packInt(n *big.Int) []byte {
+	if n.Sign() < 0 {
+		n = new(big.Int).Add(n, tt256)
+	}
+	return n.FillBytes(make([]byte, 32))
+}
+
+// packNum encodes a length or offset as a word.
+func packNum(n int) []byte {
+	return packInt(big.NewInt(int64(n)))
+}
+
+// leftPad pads b with zeroes to a word, on the left.
+func leftPad(b []byte) []byte {
+	padded := make([]byte, 32)
+	copy(padded[32-len(b):], b)
+	return padded
+}
+
+// rightPad pads b with zeroes to a multiple of the word size, on the right.
+func rightPad(b []byte) []byte {
+	padded := make([]byte, (len(b)+31)/32*32)
+	copy(padded, b)
+	return padded
+}
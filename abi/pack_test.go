@@ -0,0 +1,318 @@
+package abi
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustArguments parses the arguments of the given types.
+func mustArguments(t *testing.T, types ...string) Arguments {
+	t.Helper()
+	args := make(Arguments, len(types))
+	for i, typ := range types {
+		parsed, err := NewType(typ, nil)
+		if err != nil {
+			t.Fatalf("failed to parse type %q: %v", typ, err)
+		}
+		args[i] = Argument{Type: parsed}
+	}
+	return args
+}
+
+func words(ws ...string) []byte {
+	return common.Hex2Bytes(strings.Join(ws, ""))
+}
+
+// Examples of the Solidity ABI specification.
+func TestPackSpecExamples(t *testing.T) {
+	tests := []struct {
+		sig  string
+		args []interface{}
+		want []byte
+	}{
+		{
+			sig:  "baz(uint32,bool)",
+			args: []interface{}{uint32(69), true},
+			want: words(
+				"cdcd77c0",
+				"0000000000000000000000000000000000000000000000000000000000000045",
+				"0000000000000000000000000000000000000000000000000000000000000001",
+			),
+		},
+		{
+			sig:  "bar(bytes3[2])",
+			args: []interface{}{[2][3]byte{{'a', 'b', 'c'}, {'d', 'e', 'f'}}},
+			want: words(
+				"fce353f6",
+				"6162630000000000000000000000000000000000000000000000000000000000",
+				"6465660000000000000000000000000000000000000000000000000000000000",
+			),
+		},
+		{
+			sig:  "sam(bytes,bool,uint256[])",
+			args: []interface{}{[]byte("dave"), true, []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}},
+			want: words(
+				"a5643bf2",
+				"0000000000000000000000000000000000000000000000000000000000000060",
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"00000000000000000000000000000000000000000000000000000000000000a0",
+				"0000000000000000000000000000000000000000000000000000000000000004",
+				"6461766500000000000000000000000000000000000000000000000000000000",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"0000000000000000000000000000000000000000000000000000000000000002",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+			),
+		},
+		{
+			sig:  "f(uint256,uint32[],bytes10,bytes)",
+			args: []interface{}{big.NewInt(0x123), []uint32{0x456, 0x789}, [10]byte{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0'}, []byte("Hello, world!")},
+			want: words(
+				"8be65246",
+				"0000000000000000000000000000000000000000000000000000000000000123",
+				"0000000000000000000000000000000000000000000000000000000000000080",
+				"3132333435363738393000000000000000000000000000000000000000000000",
+				"00000000000000000000000000000000000000000000000000000000000000e0",
+				"0000000000000000000000000000000000000000000000000000000000000002",
+				"0000000000000000000000000000000000000000000000000000000000000456",
+				"0000000000000000000000000000000000000000000000000000000000000789",
+				"000000000000000000000000000000000000000000000000000000000000000d",
+				"48656c6c6f2c20776f726c642100000000000000000000000000000000000000",
+			),
+		},
+		{
+			sig:  "g(uint256[][],string[])",
+			args: []interface{}{[][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3)}}, []string{"one", "two", "three"}},
+			want: words(
+				"2289b18c",
+				"0000000000000000000000000000000000000000000000000000000000000040",
+				"0000000000000000000000000000000000000000000000000000000000000140",
+				"0000000000000000000000000000000000000000000000000000000000000002",
+				"0000000000000000000000000000000000000000000000000000000000000040",
+				"00000000000000000000000000000000000000000000000000000000000000a0",
+				"0000000000000000000000000000000000000000000000000000000000000002",
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"0000000000000000000000000000000000000000000000000000000000000002",
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+				"0000000000000000000000000000000000000000000000000000000000000060",
+				"00000000000000000000000000000000000000000000000000000000000000a0",
+				"00000000000000000000000000000000000000000000000000000000000000e0",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+				"6f6e650000000000000000000000000000000000000000000000000000000000",
+				"0000000000000000000000000000000000000000000000000000000000000003",
+				"74776f0000000000000000000000000000000000000000000000000000000000",
+				"0000000000000000000000000000000000000000000000000000000000000005",
+				"7468726565000000000000000000000000000000000000000000000000000000",
+			),
+		},
+	}
+	for _, tt := range tests {
+		var (
+			name  = tt.sig[:strings.Index(tt.sig, "(")]
+			types = strings.Split(tt.sig[len(name)+1:len(tt.sig)-1], ",")
+			args  = mustArguments(t, types...)
+		)
+		method := NewMethod(name, name, Function, "", args, nil)
+		if method.Sig != tt.sig {
+			t.Errorf("%s: signature mismatch: have %s", tt.sig, method.Sig)
+		}
+		packed, err := args.Pack(tt.args...)
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", tt.sig, err)
+		}
+		if have := append(method.ID, packed...); !bytes.Equal(have, tt.want) {
+			t.Errorf("%s: encoding mismatch:\nhave %x\nwant %x", tt.sig, have, tt.want)
+		}
+		// Decoding the arguments gives back the values
+		values, err := args.Unpack(packed)
+		if err != nil {
+			t.Fatalf("%s: failed to unpack: %v", tt.sig, err)
+		}
+		if !reflect.DeepEqual(values, tt.args) {
+			t.Errorf("%s: decoded values mismatch: have %v, want %v", tt.sig, values, tt.args)
+		}
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	type pair struct {
+		A *big.Int
+		B string
+	}
+	components := []ArgumentMarshaling{
+		{Name: "a", Type: "uint256"},
+		{Name: "b", Type: "string"},
+	}
+	tests := []struct {
+		typ   string
+		value interface{}
+	}{
+		{"uint8", uint8(255)},
+		{"uint16", uint16(65535)},
+		{"uint24", big.NewInt(1<<24 - 1)},
+		{"uint32", uint32(1<<32 - 1)},
+		{"uint64", uint64(1<<64 - 1)},
+		{"uint128", new(big.Int).Lsh(big.NewInt(1), 127)},
+		{"uint256", new(big.Int).Sub(tt256, big.NewInt(1))},
+		{"int8", int8(-128)},
+		{"int16", int16(-1)},
+		{"int32", int32(1<<31 - 1)},
+		{"int64", int64(-1 << 63)},
+		{"int72", big.NewInt(-1)},
+		{"int256", new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))},
+		{"bool", false},
+		{"address", common.BytesToAddress([]byte("address"))},
+		{"bytes1", [1]byte{0xff}},
+		{"bytes32", [32]byte{1, 2, 3}},
+		{"function", [24]byte{0xaa}},
+		{"bytes", []byte{}},
+		{"bytes", bytes.Repeat([]byte{0xab}, 33)},
+		{"string", "hello"},
+		{"address[]", []common.Address{{1}, {2}}},
+		{"int8[3]", [3]int8{-1, 0, 1}},
+		{"string[2]", [2]string{"", "dynamic"}},
+		{"bytes[][]", [][][]byte{{{1}, {}}, {}}},
+		{"uint64[2][]", [][2]uint64{{1, 2}, {3, 4}}},
+		{"bool[][2]", [2][]bool{{true}, {false, true}}},
+	}
+	for _, tt := range tests {
+		args := mustArguments(t, tt.typ, "uint8")
+		packed, err := args.Pack(tt.value, uint8(7))
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", tt.typ, err)
+		}
+		values, err := args.Unpack(packed)
+		if err != nil {
+			t.Fatalf("%s: failed to unpack: %v", tt.typ, err)
+		}
+		if !reflect.DeepEqual(values[0], tt.value) || values[1] != uint8(7) {
+			t.Errorf("%s: round trip mismatch: have %v, want %v", tt.typ, values[0], tt.value)
+		}
+	}
+	// Tuples are decoded into anonymous structs, which can be copied into
+	// the equivalent Go structs
+	for _, typ := range []string{"tuple", "tuple[]", "tuple[2]"} {
+		tupleType, err := NewType(typ, components)
+		if err != nil {
+			t.Fatalf("failed to parse type %q: %v", typ, err)
+		}
+		var (
+			args  = Arguments{{Name: "value", Type: tupleType}}
+			value interface{}
+		)
+		switch typ {
+		case "tuple":
+			value = pair{big.NewInt(1), "one"}
+		case "tuple[]":
+			value = []pair{{big.NewInt(1), "one"}, {big.NewInt(2), "two"}}
+		case "tuple[2]":
+			value = [2]*pair{{big.NewInt(1), "one"}, {big.NewInt(2), "two"}}
+		}
+		packed, err := args.Pack(value)
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", typ, err)
+		}
+		values, err := args.Unpack(packed)
+		if err != nil {
+			t.Fatalf("%s: failed to unpack: %v", typ, err)
+		}
+		out := reflect.New(reflect.TypeOf(value))
+		if err := args.Copy(out.Interface(), values); err != nil {
+			t.Fatalf("%s: failed to copy: %v", typ, err)
+		}
+		if !reflect.DeepEqual(out.Elem().Interface(), value) {
+			t.Errorf("%s: round trip mismatch: have %v, want %v", typ, out.Elem().Interface(), value)
+		}
+	}
+	if have := components[0].Type; have != "uint256" {
+		t.Fatalf("components modified: %v", have)
+	}
+}
+
+func TestPackInvalid(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+	}{
+		{"uint8", uint16(256)},
+		{"uint256", big.NewInt(-1)},
+		{"uint256", new(big.Int).Set(tt256)},
+		{"int8", int16(128)},
+		{"int8", int16(-129)},
+		{"address", []byte{1}},
+		{"bytes4", [3]byte{}},
+		{"bytes", "string"},
+		{"string", []byte{}},
+		{"uint8[2]", []uint8{1}},
+		{"bool", nil},
+	}
+	for _, tt := range tests {
+		if _, err := mustArguments(t, tt.typ).Pack(tt.value); err == nil {
+			t.Errorf("%s: expected error packing %v", tt.typ, tt.value)
+		}
+	}
+}
+
+func TestUnpackInvalid(t *testing.T) {
+	tests := []struct {
+		typ  string
+		data []byte
+	}{
+		// Dirty high bits
+		{"uint8", words("0000000000000000000000000000000000000000000000000000000000000100")},
+		{"int8", words("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f")},
+		{"bool", words("0000000000000000000000000000000000000000000000000000000000000002")},
+		{"address", words("0000000000000000000000010000000000000000000000000000000000000000")},
+		{"bytes1", words("0001000000000000000000000000000000000000000000000000000000000000")},
+		// Truncated data
+		{"uint256", words("00")},
+		{"bytes", words("0000000000000000000000000000000000000000000000000000000000000020")},
+		{"bytes", words(
+			"0000000000000000000000000000000000000000000000000000000000000020",
+			"0000000000000000000000000000000000000000000000000000000000000021",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+		)},
+		// Huge offsets and lengths
+		{"string", words("1000000000000000000000000000000000000000000000000000000000000000")},
+		{"uint256[]", words(
+			"0000000000000000000000000000000000000000000000000000000000000020",
+			"00000000000000000000000000000000000000000000000000000000ffffffff",
+		)},
+	}
+	for _, tt := range tests {
+		if _, err := mustArguments(t, tt.typ).Unpack(tt.data); err == nil {
+			t.Errorf("%s: expected error unpacking %x", tt.typ, tt.data)
+		}
+	}
+}
+
+func TestNewType(t *testing.T) {
+	tests := map[string]string{
+		"uint":           "uint256",
+		"int":            "int256",
+		"uint[]":         "uint256[]",
+		"int8[2][]":      "int8[2][]",
+		"bytes32[3]":     "bytes32[3]",
+		"address[][4][]": "address[][4][]",
+	}
+	for typ, want := range tests {
+		parsed, err := NewType(typ, nil)
+		if err != nil {
+			t.Fatalf("failed to parse type %q: %v", typ, err)
+		}
+		if parsed.String() != want {
+			t.Errorf("%s: canonical type mismatch: have %s, want %s", typ, parsed, want)
+		}
+	}
+	for _, typ := range []string{"uint7", "uint264", "int0", "bytes0", "bytes33", "fixed128x18", "uint[", "uint[a]", "tuple2"} {
+		if _, err := NewType(typ, nil); err == nil {
+			t.Errorf("%s: expected error", typ)
+		}
+	}
+}
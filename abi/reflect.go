@@ -0,0 +1,162 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var (
+	bigT    = reflect.TypeOf(&big.Int{})
+	derefbT = bigT.Elem()
+)
+
+// ToCamelCase converts an under-score separated argument name to the name of
+// the Go field it's copied into, e.g. "_from" to "From".
+func ToCamelCase(input string) string {
+	parts := strings.Split(input, "_")
+	for i, s := range parts {
+		if len(s) > 0 {
+			parts[i] = strings.ToUpper(s[:1]) + s[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// fieldByArgName returns the field of the struct v holding the argument of
+// the given name: the field tagged `abi:"name"`, or else the field named
+// after the camel-cased argument name.
+func fieldByArgName(v reflect.Value, name string) (reflect.Value, error) {
+	if name == "" {
+		return reflect.Value{}, fmt.Errorf("abi: unnamed argument cannot be matched with a field of %v", v.Type())
+	}
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("abi") == name {
+			return v.Field(i), nil
+		}
+	}
+	field, ok := typ.FieldByName(ToCamelCase(name))
+	if !ok || field.PkgPath != "" || len(field.Index) > 1 {
+		return reflect.Value{}, fmt.Errorf("abi: field %s can't be found in %v", ToCamelCase(name), typ)
+	}
+	return v.FieldByIndex(field.Index), nil
+}
+
+// tupleField returns the field of the struct v holding the i'th field of the
+// tuple t. Unnamed tuple fields are matched by position.
+func tupleField(v reflect.Value, t Type, i int) (reflect.Value, error) {
+	if t.TupleRawNames[i] == "" {
+		if i >= v.NumField() {
+			return reflect.Value{}, fmt.Errorf("abi: field %d can't be found in %v", i, v.Type())
+		}
+		return v.Field(i), nil
+	}
+	return fieldByArgName(v, t.TupleRawNames[i])
+}
+
+// set assigns the decoded value src to dst, converting between equivalent
+// types: structs are copied field by field, slices and arrays element by
+// element.
+func set(dst, src reflect.Value) error {
+	dstType, srcType := dst.Type(), src.Type()
+	switch {
+	case srcType.AssignableTo(dstType):
+		dst.Set(src)
+		return nil
+	case dstType == derefbT && srcType == bigT:
+		dst.Set(src.Elem())
+		return nil
+	case dst.Kind() == reflect.Ptr && dst.IsNil() && dstType != bigT:
+		dst.Set(reflect.New(dstType.Elem()))
+		return set(dst.Elem(), src)
+	case dst.Kind() == reflect.Ptr && dstType != bigT:
+		return set(dst.Elem(), src)
+	case dst.Kind() == reflect.Struct && src.Kind() == reflect.Struct:
+		for i := 0; i < srcType.NumField(); i++ {
+			var (
+				field reflect.Value
+				err   error
+			)
+			if name := srcType.Field(i).Tag.Get("json"); name != "" {
+				field, err = fieldByArgName(dst, name)
+			} else if i < dst.NumField() {
+				field = dst.Field(i)
+			} else {
+				err = fmt.Errorf("abi: field %d can't be found in %v", i, dstType)
+			}
+			if err != nil {
+				return err
+			}
+			if err := set(field, src.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case dst.Kind() == reflect.Slice && src.Kind() == reflect.Slice:
+		slice := reflect.MakeSlice(dstType, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := set(slice.Index(i), src.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+	case dst.Kind() == reflect.Array && src.Kind() == reflect.Array && dst.Len() == src.Len():
+		for i := 0; i < src.Len(); i++ {
+			if err := set(dst.Index(i), src.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case dst.Kind() == src.Kind() && srcType.ConvertibleTo(dstType):
+		dst.Set(src.Convert(dstType))
+		return nil
+	}
+	return fmt.Errorf("abi: cannot unmarshal %v into %v", srcType, dstType)
+}
+
+// indirect returns the value v points to, following interfaces and pointers
+// other than *big.Int.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && v.Type() != bigT && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// toBig returns the integer held by v.
+func toBig(v reflect.Value) (*big.Int, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(v.Uint()), true
+	}
+	switch v.Type() {
+	case bigT:
+		if !v.IsNil() {
+			return v.Interface().(*big.Int), true
+		}
+	case derefbT:
+		n := v.Interface().(big.Int)
+		return &n, true
+	}
+	return nil, false
+}
+
+// byteArray returns the content of v if it's an array or slice of bytes.
+func byteArray(v reflect.Value) ([]byte, bool) {
+	if (v.Kind() != reflect.Array && v.Kind() != reflect.Slice) || v.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+	if v.Kind() == reflect.Slice {
+		return v.Bytes(), true
+	}
+	b := make([]byte, v.Len())
+	for i := range b {
+		b[i] = byte(v.Index(i).Uint())
+	}
+	return b, true
+}
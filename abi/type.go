@@ -0,0 +1,239 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Type enumerator
+const (
+	IntTy byte = iota
+	UintTy
+	BoolTy
+	StringTy
+	SliceTy
+	ArrayTy
+	TupleTy
+	AddressTy
+	FixedBytesTy
+	BytesTy
+	FunctionTy
+)
+
+// Type is the reflection of the supported argument type.
+type Type struct {
+	Elem *Type // Element type of slices and arrays
+	Size int   // Bit size of integers, byte size of fixed bytes, length of arrays
+	T    byte  // Our own type checking
+
+	stringKind string // holds the unparsed string for deriving signatures
+
+	// Tuple relative fields
+	TupleElems    []*Type  // Type information of all tuple fields
+	TupleRawNames []string // Raw field name of all tuple fields
+	TupleType     reflect.Type
+}
+
+var errInvalidType = errors.New("abi: invalid type")
+
+// NewType creates a new reflection type of abi type given in t. Components
+// describe the fields of tuples.
+func NewType(t string, components []ArgumentMarshaling) (typ Type, err error) {
+	// Arrays and slices are parsed from the outermost dimension inwards
+	if strings.HasSuffix(t, "]") {
+		i := strings.LastIndex(t, "[")
+		if i < 0 {
+			return Type{}, fmt.Errorf("%w: %q", errInvalidType, t)
+		}
+		elem, err := NewType(t[:i], components)
+		if err != nil {
+			return Type{}, err
+		}
+		typ.Elem = &elem
+		if size := t[i+1 : len(t)-1]; size == "" {
+			typ.T = SliceTy
+		} else {
+			if typ.Size, err = strconv.Atoi(size); err != nil || typ.Size < 0 {
+				return Type{}, fmt.Errorf("%w: array size of %q", errInvalidType, t)
+			}
+			typ.T = ArrayTy
+		}
+		typ.stringKind = elem.stringKind + t[i:]
+		return typ, nil
+	}
+	switch {
+	case t == "tuple":
+		return newTupleType(components)
+	case t == "address":
+		typ.T, typ.Size = AddressTy, 20
+	case t == "bool":
+		typ.T = BoolTy
+	case t == "string":
+		typ.T = StringTy
+	case t == "bytes":
+		typ.T = BytesTy
+	case t == "function":
+		typ.T, typ.Size = FunctionTy, 24
+	case strings.HasPrefix(t, "bytes"):
+		typ.T = FixedBytesTy
+		if typ.Size, err = strconv.Atoi(t[len("bytes"):]); err != nil || typ.Size < 1 || typ.Size > 32 {
+			return Type{}, fmt.Errorf("%w: %q", errInvalidType, t)
+		}
+	case strings.HasPrefix(t, "uint"), strings.HasPrefix(t, "int"):
+		typ.T, typ.Size = IntTy, 256
+		size := t[len("int"):]
+		if t[0] == 'u' {
+			typ.T, size = UintTy, t[len("uint"):]
+		}
+		if size != "" {
+			if typ.Size, err = strconv.Atoi(size); err != nil || typ.Size < 8 || typ.Size > 256 || typ.Size%8 != 0 {
+				return Type{}, fmt.Errorf("%w: %q", errInvalidType, t)
+			}
+		}
+		// int and uint are aliases of the 256 bit types
+		t = t[:len(t)-len(size)] + strconv.Itoa(typ.Size)
+	default:
+		return Type{}, fmt.Errorf("%w: unsupported %q", errInvalidType, t)
+	}
+	typ.stringKind = t
+	return typ, nil
+}
+
+// newTupleType creates the type of a tuple with the given fields.
+func newTupleType(components []ArgumentMarshaling) (Type, error) {
+	var (
+		typ    = Type{T: TupleTy}
+		kinds  = make([]string, len(components))
+		fields = make([]reflect.StructField, len(components))
+		used   = make(map[string]bool)
+	)
+	for i, c := range components {
+		elem, err := NewType(c.Type, c.Components)
+		if err != nil {
+			return Type{}, err
+		}
+		name := ToCamelCase(c.Name)
+		if name == "" || used[name] {
+			name = fmt.Sprintf("Field%d", i)
+		}
+		used[name] = true
+
+		fields[i] = reflect.StructField{
+			Name: name,
+			Type: elem.GetType(),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, c.Name)),
+		}
+		kinds[i] = elem.stringKind
+		typ.TupleElems = append(typ.TupleElems, &elem)
+		typ.TupleRawNames = append(typ.TupleRawNames, c.Name)
+	}
+	typ.TupleType = reflect.StructOf(fields)
+	typ.stringKind = "(" + strings.Join(kinds, ",") + ")"
+	return typ, nil
+}
+
+// String implements Stringer, returning the canonical type used in
+// signatures.
+func (t Type) String() string {
+	return t.stringKind
+}
+
+// GetType returns the Go type values of the type are decoded into.
+func (t Type) GetType() reflect.Type {
+	switch t.T {
+	case IntTy:
+		return reflectIntType(false, t.Size)
+	case UintTy:
+		return reflectIntType(true, t.Size)
+	case BoolTy:
+		return reflect.TypeOf(false)
+	case StringTy:
+		return reflect.TypeOf("")
+	case SliceTy:
+		return reflect.SliceOf(t.Elem.GetType())
+	case ArrayTy:
+		return reflect.ArrayOf(t.Size, t.Elem.GetType())
+	case TupleTy:
+		return t.TupleType
+	case AddressTy:
+		return reflect.TypeOf(common.Address{})
+	case FixedBytesTy:
+		return reflect.ArrayOf(t.Size, reflect.TypeOf(byte(0)))
+	case BytesTy:
+		return reflect.SliceOf(reflect.TypeOf(byte(0)))
+	case FunctionTy:
+		return reflect.ArrayOf(24, reflect.TypeOf(byte(0)))
+	default:
+		panic("abi: invalid type")
+	}
+}
+
+// reflectIntType returns the Go type of integers of the given bit size:
+// native integers up to 64 bits, *big.Int above.
+func reflectIntType(unsigned bool, size int) reflect.Type {
+	if unsigned {
+		switch size {
+		case 8:
+			return reflect.TypeOf(uint8(0))
+		case 16:
+			return reflect.TypeOf(uint16(0))
+		case 32:
+			return reflect.TypeOf(uint32(0))
+		case 64:
+			return reflect.TypeOf(uint64(0))
+		}
+	}
+	switch size {
+	case 8:
+		return reflect.TypeOf(int8(0))
+	case 16:
+		return reflect.TypeOf(int16(0))
+	case 32:
+		return reflect.TypeOf(int32(0))
+	case 64:
+		return reflect.TypeOf(int64(0))
+	}
+	return reflect.TypeOf(&big.Int{})
+}
+
+// isDynamic returns whether the encoding of the type has a variable size,
+// in which case it's referenced by offset.
+func (t Type) isDynamic() bool {
+	switch t.T {
+	case StringTy, BytesTy, SliceTy:
+		return true
+	case ArrayTy:
+		return t.Elem.isDynamic()
+	case TupleTy:
+		for _, elem := range t.TupleElems {
+			if elem.isDynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize returns the size of the type in the head of an encoding: static
+// arrays and tuples are encoded in place, everything else takes a word.
+func (t Type) headSize() int {
+	if t.isDynamic() {
+		return 32
+	}
+	switch t.T {
+	case ArrayTy:
+		return t.Size * t.Elem.headSize()
+	case TupleTy:
+		size := 0
+		for _, elem := range t.TupleElems {
+			size += elem.headSize()
+		}
+		return size
+	}
+	return 32
+}
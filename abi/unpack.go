@@ -0,0 +1,185 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+	"reflect"
+)
+
+var (
+	errEmptyOutput = errors.New("abi: attempting to unmarshal an empty output")
+	errShortData   = errors.New("abi: data too short")
+	errBadOffset   = errors.New("abi: offset or length out of bounds")
+)
+
+// unpackSequence decodes a tuple of the given types from data.
+func unpackSequence(types []*Type, data []byte) ([]reflect.Value, error) {
+	var (
+		values = make([]reflect.Value, len(types))
+		pos    = 0
+	)
+	for i, t := range types {
+		value, err := t.unpackAt(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+		pos += t.headSize()
+	}
+	return values, nil
+}
+
+// unpackAt decodes a value of type t whose head is at pos in the encoding of
+// the enclosing tuple, which dynamic values are referenced from.
+func (t Type) unpackAt(data []byte, pos int) (reflect.Value, error) {
+	if !t.isDynamic() {
+		if pos+t.headSize() > len(data) {
+			return reflect.Value{}, fmt.Errorf("%w: cannot unmarshal %v", errShortData, t)
+		}
+		return t.unpack(data[pos:])
+	}
+	offset, err := readNum(data, pos)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if offset > len(data) {
+		return reflect.Value{}, errBadOffset
+	}
+	return t.unpack(data[offset:])
+}
+
+// unpack decodes a value of type t encoded at the start of data.
+func (t Type) unpack(data []byte) (reflect.Value, error) {
+	switch t.T {
+	case IntTy, UintTy, BoolTy, AddressTy, FixedBytesTy, FunctionTy:
+		if len(data) < 32 {
+			return reflect.Value{}, fmt.Errorf("%w: cannot unmarshal %v", errShortData, t)
+		}
+		return t.unpackWord(data[:32])
+	case BytesTy, StringTy:
+		size, err := readNum(data, 0)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if size > len(data)-32 {
+			return reflect.Value{}, errBadOffset
+		}
+		content := common.CopyBytes(data[32 : 32+size])
+		if t.T == StringTy {
+			return reflect.ValueOf(string(content)), nil
+		}
+		return reflect.ValueOf(content), nil
+	case SliceTy, ArrayTy:
+		size := t.Size
+		if t.T == SliceTy {
+			var err error
+			if size, err = readNum(data, 0); err != nil {
+				return reflect.Value{}, err
+			}
+			data = data[32:]
+			// Reject lengths which can't be backed by data before allocating
+			if head := t.Elem.headSize(); size > len(data) || (head > 0 && size > len(data)/head) {
+				return reflect.Value{}, errBadOffset
+			}
+		}
+		types := make([]*Type, size)
+		for i := range types {
+			types[i] = t.Elem
+		}
+		elems, err := unpackSequence(types, data)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		var value reflect.Value
+		if t.T == SliceTy {
+			value = reflect.MakeSlice(t.GetType(), size, size)
+		} else {
+			value = reflect.New(t.GetType()).Elem()
+		}
+		for i, elem := range elems {
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+	case TupleTy:
+		fields, err := unpackSequence(t.TupleElems, data)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value := reflect.New(t.TupleType).Elem()
+		for i, field := range fields {
+			value.Field(i).Set(field)
+		}
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("abi: cannot unmarshal type %v", t)
+}
+
+// unpackWord decodes a value of the static elementary type t, rejecting
+// words which are not the canonical encoding of a value.
+func (t Type) unpackWord(word []byte) (reflect.Value, error) {
+	switch t.T {
+	case IntTy, UintTy:
+		n := new(big.Int).SetBytes(word)
+		if t.T == IntTy && word[0]&0x80 != 0 {
+			n.Sub(n, tt256)
+		}
+		if !intFits(t, n) {
+			return reflect.Value{}, fmt.Errorf("abi: improperly encoded %v value", t)
+		}
+		typ := t.GetType()
+		if typ == bigT {
+			return reflect.ValueOf(n), nil
+		}
+		value := reflect.New(typ).Elem()
+		if t.T == IntTy {
+			value.SetInt(n.Int64())
+		} else {
+			value.SetUint(n.Uint64())
+		}
+		return value, nil
+	case BoolTy:
+		if !allZero(word[:31]) || word[31] > 1 {
+			return reflect.Value{}, fmt.Errorf("abi: improperly encoded %v value", t)
+		}
+		return reflect.ValueOf(word[31] == 1), nil
+	case AddressTy:
+		if !allZero(word[:12]) {
+			return reflect.Value{}, fmt.Errorf("abi: improperly encoded %v value", t)
+		}
+		return reflect.ValueOf(common.BytesToAddress(word[12:])), nil
+	default:
+		if !allZero(word[t.Size:]) {
+			return reflect.Value{}, fmt.Errorf("abi: improperly encoded %v value", t)
+		}
+		value := reflect.New(t.GetType()).Elem()
+		reflect.Copy(value, reflect.ValueOf(word[:t.Size]))
+		return value, nil
+	}
+}
+
+// readNum reads the length or offset encoded in the word at pos.
+func readNum(data []byte, pos int) (int, error) {
+	if pos+32 > len(data) {
+		return 0, errShortData
+	}
+	word := data[pos : pos+32]
+	if !allZero(word[:24]) {
+		return 0, errBadOffset
+	}
+	n := new(big.Int).SetBytes(word[24:])
+	if !n.IsInt64() || n.Int64() > int64(len(data)) {
+		return 0, errBadOffset
+	}
+	return int(n.Int64()), nil
+}
+
+func allZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/entropyio/go-evm/evm"
+	"strings"
 )
 
 // Iterator for disassembled EVM instructions
@@ -15,6 +16,7 @@ type instructionIterator struct {
 	op      evm.OpCode
 	error   error
 	started bool
+	eof     bool
 }
 
 // NewInstructionIterator create a new instruction iterator.
@@ -24,6 +26,15 @@ func NewInstructionIterator(code []byte) *instructionIterator {
 	return it
 }
 
+// NewEOFInstructionIterator creates a new instruction iterator for the code
+// section of an EOF container, which also decodes the immediates of the EOF
+// instructions.
+func NewEOFInstructionIterator(code []byte) *instructionIterator {
+	it := NewInstructionIterator(code)
+	it.eof = true
+	return it
+}
+
 // Next returns true if there is a next instruction and moves on.
 func (it *instructionIterator) Next() bool {
 	if it.error != nil || uint64(len(it.code)) <= it.pc {
@@ -56,12 +67,37 @@ func (it *instructionIterator) Next() bool {
 			return false
 		}
 		it.arg = it.code[it.pc+1 : u]
+	} else if size := it.eofImmediateSize(); size > 0 {
+		u := it.pc + 1 + size
+		if uint64(len(it.code)) < u {
+			it.error = fmt.Errorf("incomplete %v instruction at %v", it.op, it.pc)
+			return false
+		}
+		it.arg = it.code[it.pc+1 : u]
 	} else {
 		it.arg = nil
 	}
 	return true
 }
 
+// eofImmediateSize returns the size of the immediate of the current EOF
+// instruction, zero when iterating legacy code.
+func (it *instructionIterator) eofImmediateSize() uint64 {
+	if !it.eof {
+		return 0
+	}
+	switch it.op {
+	case evm.RJUMP, evm.RJUMPI, evm.CALLF, evm.DATALOADN:
+		return 2
+	case evm.RJUMPV:
+		if it.pc+1 >= uint64(len(it.code)) {
+			return 1
+		}
+		return 1 + 2*(uint64(it.code[it.pc+1])+1)
+	}
+	return 0
+}
+
 // Error returns any error that may have been encountered.
 func (it *instructionIterator) Error() error {
 	return it.error
@@ -117,3 +153,53 @@ func Disassemble(script []byte) ([]string, error) {
 	}
 	return instrs, nil
 }
+
+// PrintDisassembledEOF pretty-print all sections of a disassembled EOF container
+// to stdout.
+func PrintDisassembledEOF(code string) error {
+	script, err := hex.DecodeString(code)
+	if err != nil {
+		return err
+	}
+	instrs, err := DisassembleEOF(script)
+	if err != nil {
+		return err
+	}
+	for _, instr := range instrs {
+		fmt.Print(instr)
+	}
+	return nil
+}
+
+// DisassembleEOF returns the layout of an EOF container followed by the
+// disassembled instructions of each code section and the data section in
+// human-readable format. The container is decoded but its code is not
+// validated.
+func DisassembleEOF(script []byte) ([]string, error) {
+	var container evm.Container
+	if err := container.UnmarshalBinary(script); err != nil {
+		return nil, err
+	}
+	instrs := strings.SplitAfter(container.String(), "\n")
+	instrs = instrs[:len(instrs)-1]
+
+	for i := 0; i < container.NumCodeSections(); i++ {
+		instrs = append(instrs, fmt.Sprintf("code section %d:\n", i))
+
+		it := NewEOFInstructionIterator(container.CodeSection(i))
+		for it.Next() {
+			if it.Arg() != nil && 0 < len(it.Arg()) {
+				instrs = append(instrs, fmt.Sprintf("%05x: %v 0x%x\n", it.PC(), it.Op(), it.Arg()))
+			} else {
+				instrs = append(instrs, fmt.Sprintf("%05x: %v\n", it.PC(), it.Op()))
+			}
+		}
+		if err := it.Error(); err != nil {
+			return nil, fmt.Errorf("code section %d: %v", i, err)
+		}
+	}
+	if data := container.Data(); len(data) > 0 {
+		instrs = append(instrs, fmt.Sprintf("data section:\n0x%x\n", data))
+	}
+	return instrs, nil
+}
@@ -55,3 +55,46 @@ func TestInstructionIteratorEmpty(t *testing.T) {
 		t.Errorf("Expected 0, but got %v instead.", cnt)
 	}
 }
+
+// Tests disassembling the code sections of an EOF container
+func TestDisassembleEOF(t *testing.T) {
+	// Two code sections: section 0 calls section 1 and branches with RJUMPV
+	// and RJUMP, section 1 returns the first data word.
+	script, _ := hex.DecodeString("ef000101000802000200100004040020000080000200010001" +
+		"e30001e2010000000150e000005f5000" + "d10000e4" +
+		"000000000000000000000000000000000000000000000000000000000000002a")
+
+	instrs, err := DisassembleEOF(script)
+	if err != nil {
+		t.Fatalf("Failed to disassemble: %v", err)
+	}
+	want := []string{
+		"EOF container, version 1\n",
+		"  code section 0: 16 bytes, inputs 0, outputs non-returning, max stack height 2\n",
+		"  code section 1: 4 bytes, inputs 0, outputs 1, max stack height 1\n",
+		"  data section: 32 bytes\n",
+		"code section 0:\n",
+		"00000: CALLF 0x0001\n",
+		"00003: RJUMPV 0x0100000001\n",
+		"00009: POP\n",
+		"0000a: RJUMP 0x0000\n",
+		"0000d: PUSH0\n",
+		"0000e: POP\n",
+		"0000f: STOP\n",
+		"code section 1:\n",
+		"00000: DATALOADN 0x0000\n",
+		"00003: RETF\n",
+		"data section:\n0x000000000000000000000000000000000000000000000000000000000000002a\n",
+	}
+	if len(instrs) != len(want) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(want), len(instrs), instrs)
+	}
+	for i := range want {
+		if instrs[i] != want[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, want[i], instrs[i])
+		}
+	}
+	if _, err := DisassembleEOF(script[:20]); err == nil {
+		t.Errorf("Expected an error for a truncated container")
+	}
+}
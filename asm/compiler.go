@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"os"
 	"strings"
+	"unicode"
 )
 
 // Compiler contains information about the parsed source
@@ -239,6 +240,22 @@ func toBinary(text string) evm.OpCode {
 	return evm.StringToOp(strings.ToUpper(text))
 }
 
+// RegisterOpCode names a custom opcode so that it can be compiled and
+// disassembled. The name must be an upper case identifier which is not in use
+// yet, see evm.RegisterOpCode. Lower case names are rejected as the source is
+// upper cased before opcodes are looked up.
+func RegisterOpCode(op evm.OpCode, name string) error {
+	for i, r := range name {
+		if !isLetter(r) && r != '_' && (i == 0 || !isNumber(r)) {
+			return fmt.Errorf("opcode name %q is not an identifier", name)
+		}
+		if unicode.ToUpper(r) != r {
+			return fmt.Errorf("opcode name %q is not upper case", name)
+		}
+	}
+	return evm.RegisterOpCode(op, name)
+}
+
 type compileError struct {
 	got  string
 	want string
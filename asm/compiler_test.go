@@ -1,6 +1,8 @@
 package asm
 
 import (
+	"encoding/hex"
+	"github.com/entropyio/go-evm/evm"
 	"testing"
 )
 
@@ -53,3 +55,43 @@ func TestCompiler(t *testing.T) {
 		}
 	}
 }
+
+func TestCompileCustomOpCode(t *testing.T) {
+	const op = evm.OpCode(0x0c)
+	// Registration is global, so it only succeeds on the first run
+	if evm.StringToOp("L1BLOCK") != op {
+		if err := RegisterOpCode(op, "L1BLOCK"); err != nil {
+			t.Fatalf("failed to register opcode: %v", err)
+		}
+	}
+	for _, name := range []string{"", "l1block", "L1Block", "1BLOCK", "L1-BLOCK", "ADD"} {
+		if err := RegisterOpCode(0x0d, name); err == nil {
+			t.Errorf("invalid name %q accepted", name)
+		}
+	}
+	// Lower case names could never be compiled, the source being upper cased
+	want := `opcode name "L1Block" is not upper case`
+	if err := RegisterOpCode(0x0d, "L1Block"); err == nil || err.Error() != want {
+		t.Errorf("lower case name: have %v, want %s", err, want)
+	}
+	if err := RegisterOpCode(op, "L1BLOCKNUMBER"); err == nil {
+		t.Errorf("opcode registered twice")
+	}
+	c := NewCompiler(false)
+	c.Feed(Lex([]byte("L1BLOCK\nPOP\n"), false))
+	output, errs := c.Compile()
+	if len(errs) != 0 {
+		t.Fatalf("compile error: %v", errs)
+	}
+	if output != "0c50" {
+		t.Fatalf("incorrect output: have %s, want 0c50", output)
+	}
+	code, _ := hex.DecodeString(output)
+	instrs, err := Disassemble(code)
+	if err != nil {
+		t.Fatalf("disassembly error: %v", err)
+	}
+	if len(instrs) != 2 || instrs[0] != "00000: L1BLOCK\n" {
+		t.Errorf("incorrect disassembly: %q", instrs)
+	}
+}
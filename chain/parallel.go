@@ -0,0 +1,298 @@
+package chain
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/model"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// ProcessParallel applies the messages of a block like Process, executing
+// them optimistically in parallel on the given number of workers. The
+// post-state, the receipts and the logs are the same as those of Process.
+//
+// Every message executes on a state layered on a multi-version view of the
+// block, which provides the state as left by the latest executions of the
+// messages before it and records the values read. The executions are then
+// validated in order: an execution is final if the messages before it are and
+// the values it read are still current, otherwise the message is executed
+// again in the next round. Every round finalises at least one message.
+//
+// Transaction fees are accounted for separately, so that messages don't
+// conflict on the coinbase unless they access it.
+//
+// newEVM returns the EVM of a worker, all for the same block. The EVMs must
+// not share a tracer.
+func ProcessParallel(newEVM func() *evm.EVM, statedb *state.StateDB, msgs []*Message, workers int) ([]*Receipt, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	envs := make([]*evm.EVM, workers)
+	for i := range envs {
+		envs[i] = newEVM()
+	}
+	var (
+		mv       = newMultiVersionState(statedb, envs[0].Coinbase, len(msgs))
+		receipts = make([]*Receipt, 0, len(msgs))
+		gasUsed  uint64
+		pending  = make([]int, len(msgs))
+	)
+	for i := range pending {
+		pending[i] = i
+	}
+	for len(receipts) < len(msgs) {
+		mv.execute(envs, msgs, pending)
+
+		// Finalise the valid executions following the final ones, and
+		// execute the invalid ones again
+		pending = pending[:0]
+		for i := len(receipts); i < len(msgs); i++ {
+			res := mv.results[i]
+			if !res.reads.valid() {
+				pending = append(pending, i)
+				continue
+			}
+			if len(pending) > 0 {
+				continue
+			}
+			if msgs[i].Gas > envs[0].GasLimit-gasUsed {
+				mv.commit(len(receipts))
+				return receipts, fmt.Errorf("could not apply tx %d: %w", i, ErrGasLimitReached)
+			}
+			if res.err != nil {
+				mv.commit(len(receipts))
+				return receipts, fmt.Errorf("could not apply tx %d: %w", i, res.err)
+			}
+			gasUsed += res.receipt.GasUsed
+			finaliseReceipt(res.receipt, i, gasUsed, res.logs)
+			receipts = append(receipts, res.receipt)
+		}
+	}
+	mv.commit(len(receipts))
+	return receipts, nil
+}
+
+// txResult is the outcome of the execution of a message.
+type txResult struct {
+	reads *versionedReader
+
+	err       error
+	receipt   *Receipt
+	fee       *big.Int // Owed to the coinbase, nil if the message is invalid
+	writes    map[common.Address]*state.AccountDiff
+	logs      []*model.Log
+	preimages map[common.Hash][]byte
+}
+
+// multiVersionState holds the results of the latest execution of each
+// message of a block, from which it provides the state as seen by any of them.
+// It is only modified between rounds of executions.
+type multiVersionState struct {
+	base     *state.StateDB
+	coinbase common.Address
+	results  []*txResult
+	writers  map[common.Address][]int // Messages writing each account, in order
+}
+
+func newMultiVersionState(base *state.StateDB, coinbase common.Address, size int) *multiVersionState {
+	return &multiVersionState{
+		base:     base,
+		coinbase: coinbase,
+		results:  make([]*txResult, size),
+		writers:  make(map[common.Address][]int),
+	}
+}
+
+// execute executes the given messages on the workers and records the results.
+func (mv *multiVersionState) execute(envs []*evm.EVM, msgs []*Message, indices []int) {
+	var (
+		results = make([]*txResult, len(indices))
+		next    = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for _, env := range envs {
+		wg.Add(1)
+		go func(env *evm.EVM) {
+			defer wg.Done()
+			for k := range next {
+				results[k] = mv.executeMessage(env, msgs[indices[k]], indices[k])
+			}
+		}(env)
+	}
+	for k := range indices {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+
+	for k, i := range indices {
+		mv.results[i] = results[k]
+	}
+	mv.writers = make(map[common.Address][]int)
+	for i, res := range mv.results {
+		if res == nil {
+			continue
+		}
+		for addr := range res.writes {
+			mv.writers[addr] = append(mv.writers[addr], i)
+		}
+	}
+}
+
+// executeMessage executes the i'th message on the state as seen by it.
+func (mv *multiVersionState) executeMessage(env *evm.EVM, msg *Message, i int) *txResult {
+	var (
+		reads   = &versionedReader{mv: mv, index: i, accounts: make(map[common.Address]*state.Account), storage: make(map[storageKey]common.Hash)}
+		statedb = state.NewWithReader(reads)
+		res     = &txResult{reads: reads}
+	)
+	res.receipt, res.fee, res.err = applyMessage(env, statedb, msg)
+	if res.err == nil {
+		res.writes = statedb.Diff()
+		res.logs = statedb.Logs()
+		res.preimages = statedb.Preimages()
+	}
+	return res
+}
+
+// latestWriter returns the last message before the i'th one writing the
+// account, or -1 if there is none.
+func (mv *multiVersionState) latestWriter(addr common.Address, i int) int {
+	writers := mv.writers[addr]
+	if k := sort.SearchInts(writers, i); k > 0 {
+		return writers[k-1]
+	}
+	return -1
+}
+
+// account returns the account at addr as seen by the i'th message, nil if it
+// doesn't exist.
+func (mv *multiVersionState) account(addr common.Address, i int) *state.Account {
+	var acct *state.Account
+
+	j := mv.latestWriter(addr, i)
+	if j >= 0 {
+		if diff := mv.results[j].writes[addr]; !diff.Deleted {
+			acct = &diff.Account
+		}
+	} else if mv.base.Exist(addr) {
+		acct = &state.Account{
+			Nonce:    mv.base.GetNonce(addr),
+			Balance:  mv.base.GetBalance(addr),
+			Code:     mv.base.GetCode(addr),
+			CodeHash: mv.base.GetCodeHash(addr),
+		}
+	}
+	if addr != mv.coinbase {
+		return acct
+	}
+	// The coinbase is paid the fees of the messages since the last write,
+	// which is made before the fee of its message. Paying the coinbase
+	// creates it, unless it self-destructed in the message.
+	if j < 0 {
+		j = 0
+	}
+	for k := j; k < i; k++ {
+		res := mv.results[k]
+		if res == nil || res.fee == nil {
+			continue
+		}
+		if diff := res.writes[addr]; diff != nil && diff.Suicided {
+			continue
+		}
+		paid := state.Account{Balance: new(big.Int), CodeHash: emptyCodeHash}
+		if acct != nil {
+			paid = *acct
+		}
+		paid.Balance = new(big.Int).Add(paid.Balance, res.fee)
+		acct = &paid
+	}
+	return acct
+}
+
+// storage returns a storage slot of the account at addr as seen by the i'th
+// message.
+func (mv *multiVersionState) storage(addr common.Address, key common.Hash, i int) common.Hash {
+	writers := mv.writers[addr]
+	for k := sort.SearchInts(writers, i) - 1; k >= 0; k-- {
+		diff := mv.results[writers[k]].writes[addr]
+		if value, ok := diff.Storage[key]; ok {
+			return value
+		}
+		if diff.Deleted || diff.Reset {
+			return common.Hash{}
+		}
+	}
+	return mv.base.GetState(addr, key)
+}
+
+// commit applies the results of the first n messages to the base state,
+// finalising it after each message.
+func (mv *multiVersionState) commit(n int) {
+	for _, res := range mv.results[:n] {
+		mv.base.ApplyDiff(res.writes)
+		if diff := res.writes[mv.coinbase]; diff == nil || !diff.Suicided {
+			mv.base.AddBalance(mv.coinbase, res.fee)
+		}
+		for hash, preimage := range res.preimages {
+			mv.base.AddPreimage(hash, preimage)
+		}
+		mv.base.Finalise()
+	}
+}
+
+type storageKey struct {
+	addr common.Address
+	key  common.Hash
+}
+
+// versionedReader provides the state of the multi-version view to the
+// execution of the i'th message, recording the values read.
+type versionedReader struct {
+	mv    *multiVersionState
+	index int
+
+	accounts map[common.Address]*state.Account
+	storage  map[storageKey]common.Hash
+}
+
+func (r *versionedReader) Account(addr common.Address) *state.Account {
+	acct := r.mv.account(addr, r.index)
+	r.accounts[addr] = acct
+	return acct
+}
+
+func (r *versionedReader) Storage(addr common.Address, key common.Hash) common.Hash {
+	value := r.mv.storage(addr, key, r.index)
+	r.storage[storageKey{addr, key}] = value
+	return value
+}
+
+// valid returns whether the values read are still those seen by the message.
+func (r *versionedReader) valid() bool {
+	for addr, acct := range r.accounts {
+		if !equalAccounts(acct, r.mv.account(addr, r.index)) {
+			return false
+		}
+	}
+	for slot, value := range r.storage {
+		if r.mv.storage(slot.addr, slot.key, r.index) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func equalAccounts(a, b *state.Account) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce && a.Balance.Cmp(b.Balance) == 0 && a.CodeHash == b.CodeHash
+}
@@ -0,0 +1,244 @@
+package chain
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var (
+	parallelCoinbase = common.BytesToAddress([]byte("coinbase"))
+	counterAddr      = common.BytesToAddress([]byte("counter"))
+	balanceAddr      = common.BytesToAddress([]byte("balance"))
+	registryAddr     = common.BytesToAddress([]byte("registry"))
+
+	// sstore(0, sload(0)+1), logging the new value
+	counterCode = common.Hex2Bytes("600054600101" + "80600055" + "600052" + "60206000a0" + "00")
+	// sstore(0, balance(coinbase))
+	balanceCode = common.Hex2Bytes("4131600055" + "00")
+	// sstore(caller, 1)
+	registryCode = common.Hex2Bytes("60013355" + "00")
+	// selfdestruct(caller), run by the coinbase until it's destructed
+	coinbaseCode = common.Hex2Bytes("33ff")
+	// sstore(0, 1), deploying no code
+	initCode = common.Hex2Bytes("6001600055" + "00")
+)
+
+// newParallelTestEVM returns an EVM executing messages in a test block.
+func newParallelTestEVM() *evm.EVM {
+	vmenv := evm.NewEVM(evm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		Coinbase:    parallelCoinbase,
+		BlockNumber: big.NewInt(1),
+		GasLimit:    30000000,
+		BaseFee:     big.NewInt(1),
+	}, evm.TxContext{}, evm.EVMConfig{})
+	vmenv.Context = vmenv.BlockContext
+	return vmenv
+}
+
+// newParallelTestState returns a state holding the test contracts and funded
+// senders.
+func newParallelTestState(senders []common.Address) *state.StateDB {
+	statedb := state.New()
+	statedb.SetCode(counterAddr, counterCode)
+	statedb.SetCode(balanceAddr, balanceCode)
+	statedb.SetCode(registryAddr, registryCode)
+	statedb.SetCode(parallelCoinbase, coinbaseCode)
+	statedb.AddBalance(parallelCoinbase, big.NewInt(1000))
+	for _, sender := range senders {
+		statedb.AddBalance(sender, big.NewInt(1000000000))
+	}
+	statedb.Finalise()
+	return statedb
+}
+
+// randomMessages returns n valid messages sent by the given accounts, a mix
+// of transfers, contract calls conflicting more or less often, and contract
+// creations.
+func randomMessages(rng *rand.Rand, senders []common.Address, n int) []*Message {
+	var (
+		msgs   = make([]*Message, n)
+		nonces = make(map[common.Address]uint64)
+	)
+	for i := range msgs {
+		from := senders[rng.Intn(len(senders))]
+		msg := &Message{
+			From:     from,
+			Nonce:    nonces[from],
+			Value:    new(big.Int),
+			Gas:      100000,
+			GasPrice: big.NewInt(1 + rng.Int63n(3)),
+		}
+		nonces[from]++
+
+		var to common.Address
+		switch rng.Intn(7) {
+		case 0, 1:
+			to = senders[rng.Intn(len(senders))]
+			msg.Value = big.NewInt(rng.Int63n(1000))
+		case 2:
+			to = counterAddr
+		case 3:
+			to = balanceAddr
+		case 4:
+			to = registryAddr
+		case 5:
+			to = parallelCoinbase
+			msg.Value = big.NewInt(rng.Int63n(1000))
+		case 6:
+			msg.Data = initCode
+		}
+		if msg.Data == nil {
+			msg.To = &to
+		}
+		msgs[i] = msg
+	}
+	return msgs
+}
+
+// checkSameState checks whether the accounts at the given addresses are the
+// same in both states.
+func checkSameState(t *testing.T, have, want *state.StateDB, addrs []common.Address) {
+	t.Helper()
+	storage := func(s *state.StateDB, addr common.Address) map[common.Hash]common.Hash {
+		slots := make(map[common.Hash]common.Hash)
+		s.ForEachStorage(addr, func(key, value common.Hash) bool {
+			slots[key] = value
+			return true
+		})
+		return slots
+	}
+	for _, addr := range addrs {
+		if have.Exist(addr) != want.Exist(addr) {
+			t.Errorf("account %x existence mismatch: have %v, want %v", addr, have.Exist(addr), want.Exist(addr))
+			continue
+		}
+		if h, w := have.GetBalance(addr), want.GetBalance(addr); h.Cmp(w) != 0 {
+			t.Errorf("account %x balance mismatch: have %v, want %v", addr, h, w)
+		}
+		if h, w := have.GetNonce(addr), want.GetNonce(addr); h != w {
+			t.Errorf("account %x nonce mismatch: have %d, want %d", addr, h, w)
+		}
+		if h, w := have.GetCodeHash(addr), want.GetCodeHash(addr); h != w {
+			t.Errorf("account %x code hash mismatch: have %x, want %x", addr, h, w)
+		}
+		if h, w := storage(have, addr), storage(want, addr); !reflect.DeepEqual(h, w) {
+			t.Errorf("account %x storage mismatch: have %v, want %v", addr, h, w)
+		}
+	}
+}
+
+// checkParallel processes the messages sequentially and in parallel with
+// various numbers of workers, and checks whether the results are the same.
+func checkParallel(t *testing.T, senders []common.Address, msgs []*Message) {
+	t.Helper()
+
+	want := newParallelTestState(senders)
+	wantReceipts, wantErr := Process(newParallelTestEVM(), want, msgs)
+
+	addrs := append([]common.Address{parallelCoinbase, counterAddr, balanceAddr, registryAddr}, senders...)
+	for _, receipt := range wantReceipts {
+		if receipt.ContractAddress != (common.Address{}) {
+			addrs = append(addrs, receipt.ContractAddress)
+		}
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		have := newParallelTestState(senders)
+		receipts, err := ProcessParallel(newParallelTestEVM, have, msgs, workers)
+		if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+			t.Fatalf("%d workers: error mismatch: have %v, want %v", workers, err, wantErr)
+		}
+		if !reflect.DeepEqual(receipts, wantReceipts) {
+			t.Fatalf("%d workers: receipts mismatch", workers)
+		}
+		checkSameState(t, have, want, addrs)
+	}
+}
+
+func TestProcessParallelDeterminism(t *testing.T) {
+	senders := make([]common.Address, 8)
+	for i := range senders {
+		senders[i] = common.BytesToAddress([]byte{0x5e, byte(i)})
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		msgs := randomMessages(rand.New(rand.NewSource(seed)), senders, 64)
+		checkParallel(t, senders, msgs)
+	}
+}
+
+func TestProcessParallelInvalid(t *testing.T) {
+	var (
+		senders = []common.Address{common.BytesToAddress([]byte("sender"))}
+		msgs    = randomMessages(rand.New(rand.NewSource(1)), senders, 16)
+	)
+	// A nonce gap invalidates the block from the 10th message on
+	for _, msg := range msgs[9:] {
+		msg.Nonce++
+	}
+	checkParallel(t, senders, msgs)
+
+	// So does running out of block gas
+	msgs = randomMessages(rand.New(rand.NewSource(2)), senders, 16)
+	msgs[12].Gas = 30000000
+	checkParallel(t, senders, msgs)
+}
+
+func TestProcess(t *testing.T) {
+	var (
+		sender  = common.BytesToAddress([]byte("sender"))
+		statedb = newParallelTestState([]common.Address{sender})
+		msgs    = make([]*Message, 3)
+	)
+	for i := range msgs {
+		msgs[i] = &Message{From: sender, To: &counterAddr, Nonce: uint64(i), Value: new(big.Int), Gas: 100000, GasPrice: big.NewInt(2)}
+	}
+	receipts, err := Process(newParallelTestEVM(), statedb, msgs)
+	if err != nil {
+		t.Fatalf("processing failed: %v", err)
+	}
+	if have := statedb.GetState(counterAddr, common.Hash{}); have != common.BigToHash(big.NewInt(3)) {
+		t.Errorf("counter mismatch: have %x, want 3", have)
+	}
+	var fees uint64
+	for i, receipt := range receipts {
+		if receipt.Status != ReceiptStatusSuccessful || len(receipt.Logs) != 1 || receipt.Logs[0].TxIndex != uint(i) {
+			t.Errorf("receipt %d mismatch: %+v", i, receipt)
+		}
+		fees += receipt.GasUsed
+	}
+	// The coinbase earns the gas price above the base fee
+	if have, want := statedb.GetBalance(parallelCoinbase), new(big.Int).SetUint64(1000+fees); have.Cmp(want) != 0 {
+		t.Errorf("coinbase balance mismatch: have %v, want %v", have, want)
+	}
+	spent := new(big.Int).SetUint64(2 * fees)
+	if have, want := statedb.GetBalance(sender), new(big.Int).Sub(big.NewInt(1000000000), spent); have.Cmp(want) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, want)
+	}
+}
+
+func BenchmarkProcessParallel(b *testing.B) {
+	// Independent messages, registering distinct senders
+	senders := make([]common.Address, 256)
+	msgs := make([]*Message, len(senders))
+	for i := range senders {
+		senders[i] = common.BytesToAddress([]byte{0x5e, byte(i)})
+		msgs[i] = &Message{From: senders[i], To: &registryAddr, Value: new(big.Int), Gas: 100000, GasPrice: big.NewInt(1)}
+	}
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Process(newParallelTestEVM(), newParallelTestState(senders), msgs)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ProcessParallel(newParallelTestEVM, newParallelTestState(senders), msgs, 8)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/model"
+	"math/big"
+)
+
+// List of EIP-7702 authorization validation errors. An authorization failing
+// validation is skipped, it does not invalidate the transaction.
+var (
+	ErrAuthorizationWrongChainID       = errors.New("EIP-7702 authorization chain ID mismatch")
+	ErrAuthorizationNonceOverflow      = errors.New("EIP-7702 authorization nonce > 64 bit")
+	ErrAuthorizationInvalidSignature   = errors.New("EIP-7702 authorization has invalid signature")
+	ErrAuthorizationDestinationHasCode = errors.New("EIP-7702 authorization destination is a contract")
+	ErrAuthorizationNonceMismatch      = errors.New("EIP-7702 authorization nonce does not match current account nonce")
+)
+
+// ApplySetCodeAuthorizations applies the authorization list of an EIP-7702 set
+// code transaction to the state, installing a delegation designator at each
+// valid authority. It must be called after the sender's nonce was incremented
+// and before the message is executed.
+//
+// The intrinsic gas of the transaction is expected to have been charged with
+// CallNewAccountGas per authorization; for authorities which already exist in
+// the state the difference to TxAuthTupleGas is added to the refund counter.
+//
+// The returned slice holds the validation error of every authorization, nil
+// for the ones which have been applied.
+func ApplySetCodeAuthorizations(db evm.StateDB, chainID *big.Int, authList []model.SetCodeAuthorization) []error {
+	errs := make([]error, len(authList))
+	for i := range authList {
+		errs[i] = applyAuthorization(db, chainID, &authList[i])
+	}
+	return errs
+}
+
+// validateAuthorization validates an EIP-7702 authorization against the state
+// and returns the authority on success.
+func validateAuthorization(db evm.StateDB, chainID *big.Int, auth *model.SetCodeAuthorization) (authority common.Address, err error) {
+	// Verify chain ID is null or equal to current chain ID.
+	if auth.ChainID != nil && auth.ChainID.Sign() != 0 && auth.ChainID.Cmp(chainID) != 0 {
+		return authority, ErrAuthorizationWrongChainID
+	}
+	// Limit nonce to 2^64-1 per EIP-2681.
+	if auth.Nonce+1 < auth.Nonce {
+		return authority, ErrAuthorizationNonceOverflow
+	}
+	// Validate signature values and recover authority.
+	authority, err = auth.Authority()
+	if err != nil {
+		return authority, fmt.Errorf("%w: %v", ErrAuthorizationInvalidSignature, err)
+	}
+	// Check the authority account
+	//  1) doesn't have code or has existing delegation
+	//  2) matches the auth's nonce
+	//
+	// Note it is added to the access list even if the authorization is invalid.
+	db.AddAddressToAccessList(authority)
+	code := db.GetCode(authority)
+	if _, ok := model.ParseDelegation(code); len(code) != 0 && !ok {
+		return authority, ErrAuthorizationDestinationHasCode
+	}
+	if have := db.GetNonce(authority); have != auth.Nonce {
+		return authority, ErrAuthorizationNonceMismatch
+	}
+	return authority, nil
+}
+
+// applyAuthorization applies an EIP-7702 code delegation to the state.
+func applyAuthorization(db evm.StateDB, chainID *big.Int, auth *model.SetCodeAuthorization) error {
+	authority, err := validateAuthorization(db, chainID, auth)
+	if err != nil {
+		return err
+	}
+	// If the account already exists in state, refund the new account cost
+	// charged in the intrinsic calculation.
+	if db.Exist(authority) {
+		db.AddRefund(config.CallNewAccountGas - config.TxAuthTupleGas)
+	}
+	// Update nonce and account code.
+	db.SetNonce(authority, auth.Nonce+1)
+	if auth.Address == (common.Address{}) {
+		// Delegation to zero address means clear.
+		db.SetCode(authority, nil)
+		return nil
+	}
+	// Otherwise install delegation to auth.Address.
+	db.SetCode(authority, model.AddressToDelegation(auth.Address))
+	return nil
+}
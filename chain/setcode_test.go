@@ -0,0 +1,157 @@
+package chain
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/model"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+func TestApplySetCodeAuthorizations(t *testing.T) {
+	var (
+		chainID   = big.NewInt(1)
+		key, _    = crypto.GenerateKey()
+		authority = crypto.PubkeyToAddress(key.PublicKey)
+		target    = common.Address{0xaa}
+		statedb   = state.New()
+	)
+	sign := func(chain int64, addr common.Address, nonce uint64) model.SetCodeAuthorization {
+		auth, err := model.SignSetCode(key, model.SetCodeAuthorization{ChainID: big.NewInt(chain), Address: addr, Nonce: nonce})
+		if err != nil {
+			t.Fatalf("failed to sign authorization: %v", err)
+		}
+		return auth
+	}
+	errs := ApplySetCodeAuthorizations(statedb, chainID, []model.SetCodeAuthorization{
+		sign(2, target, 0), // wrong chain
+		sign(1, target, 1), // wrong nonce
+		sign(0, target, 0), // valid on any chain
+		sign(1, target, 0), // nonce already bumped by the previous one
+	})
+	want := []error{ErrAuthorizationWrongChainID, ErrAuthorizationNonceMismatch, nil, ErrAuthorizationNonceMismatch}
+	for i := range want {
+		if !errors.Is(errs[i], want[i]) {
+			t.Errorf("authorization %d: error mismatch: have %v, want %v", i, errs[i], want[i])
+		}
+	}
+	if have, ok := model.ParseDelegation(statedb.GetCode(authority)); !ok || have != target {
+		t.Fatalf("delegation not installed: have %x", statedb.GetCode(authority))
+	}
+	if have := statedb.GetNonce(authority); have != 1 {
+		t.Fatalf("nonce mismatch: have %d, want 1", have)
+	}
+	if !statedb.AddressInAccessList(authority) {
+		t.Fatalf("authority not warmed")
+	}
+	// Delegating to the zero address clears the designator
+	ApplySetCodeAuthorizations(statedb, chainID, []model.SetCodeAuthorization{sign(1, common.Address{}, 1)})
+	if code := statedb.GetCode(authority); len(code) != 0 {
+		t.Fatalf("delegation not cleared: %x", code)
+	}
+	// Accounts with real code cannot be delegated
+	statedb.SetCode(authority, []byte{0x60, 0x00})
+	errs = ApplySetCodeAuthorizations(statedb, chainID, []model.SetCodeAuthorization{sign(1, target, 2)})
+	if !errors.Is(errs[0], ErrAuthorizationDestinationHasCode) {
+		t.Fatalf("error mismatch: have %v, want %v", errs[0], ErrAuthorizationDestinationHasCode)
+	}
+}
+
+func TestApplyMessageAuthorizations(t *testing.T) {
+	var (
+		key, _       = crypto.GenerateKey()
+		authority    = crypto.PubkeyToAddress(key.PublicKey)
+		senderKey, _ = crypto.GenerateKey()
+		sender       = crypto.PubkeyToAddress(senderKey.PublicKey)
+		to           = common.BytesToAddress([]byte("to"))
+		target       = common.Address{0xaa}
+		vmenv        = newPragueTestEVM()
+		statedb      = newParallelTestState([]common.Address{sender})
+	)
+	// The authority exists, the new account cost is refunded
+	statedb.AddBalance(authority, big.NewInt(1))
+	auth, err := model.SignSetCode(key, model.SetCodeAuthorization{Address: target})
+	if err != nil {
+		t.Fatalf("failed to sign authorization: %v", err)
+	}
+	tx, err := model.SignSetCodeTx(senderKey, &model.SetCodeTx{
+		ChainID:   big.NewInt(1),
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       100000,
+		To:        to,
+		Value:     new(big.Int),
+		AuthList:  []model.SetCodeAuthorization{auth},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	msg, err := SetCodeTxMessage(tx)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if msg.From != sender {
+		t.Fatalf("sender mismatch: have %x, want %x", msg.From, sender)
+	}
+	receipt, err := ApplyMessage(vmenv, statedb, msg)
+	if err != nil {
+		t.Fatalf("failed to apply message: %v", err)
+	}
+	if receipt.Status != ReceiptStatusSuccessful {
+		t.Fatalf("execution failed")
+	}
+	// The new account cost refund is capped at a fifth of the gas used
+	used := config.TxGas + config.CallNewAccountGas
+	if want := used - used/config.RefundQuotientEIP3529; receipt.GasUsed != want {
+		t.Errorf("gas used mismatch: have %d, want %d", receipt.GasUsed, want)
+	}
+	if have, ok := model.ParseDelegation(statedb.GetCode(authority)); !ok || have != target {
+		t.Errorf("delegation not installed: have %x", statedb.GetCode(authority))
+	}
+	if have := statedb.GetNonce(authority); have != 1 {
+		t.Errorf("authority nonce mismatch: have %d, want 1", have)
+	}
+	// Set code transactions cannot create contracts
+	msg = &Message{
+		From:     sender,
+		Nonce:    1,
+		Value:    new(big.Int),
+		Gas:      100000,
+		GasPrice: big.NewInt(1),
+		AuthList: []model.SetCodeAuthorization{auth},
+	}
+	if _, err := ApplyMessage(vmenv, statedb, msg); !errors.Is(err, ErrSetCodeTxCreate) {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrSetCodeTxCreate)
+	}
+	// Authorizations are rejected before prague
+	msg.To = &to
+	if _, err := ApplyMessage(newParallelTestEVM(), statedb, msg); !errors.Is(err, ErrSetCodeTxFork) {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrSetCodeTxFork)
+	}
+}
+
+// newPragueTestEVM returns an EVM executing the first block of a chain
+// running the prague rules from genesis.
+func newPragueTestEVM() *evm.EVM {
+	vmenv := evm.NewEVMWithChainConfig(evm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		Coinbase:    parallelCoinbase,
+		BlockNumber: big.NewInt(1),
+		GasLimit:    30000000,
+		BaseFee:     big.NewInt(1),
+	}, evm.TxContext{}, &config.ChainConfig{
+		ChainID:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(0),
+		LondonBlock:    big.NewInt(0),
+		CancunBlock:    big.NewInt(0),
+		PragueBlock:    big.NewInt(0),
+	}, evm.EVMConfig{})
+	vmenv.Context = vmenv.BlockContext
+	return vmenv
+}
@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"math/big"
+)
+
+// ProcessBeaconBlockRoot applies the EIP-4788 system call, storing the parent
+// beacon block root carried by the block context of vmenv in the beacon roots
+// contract. It must be called before the transactions of a block are executed,
+// from the Cancun fork on. Nothing is done if the block context carries no
+// beacon root.
+func ProcessBeaconBlockRoot(vmenv *evm.EVM, statedb evm.StateDB) error {
+	if vmenv.BeaconRoot == nil {
+		return nil
+	}
+	return systemCall(vmenv, statedb, config.BeaconRootsAddress, vmenv.BeaconRoot.Bytes())
+}
+
+// ProcessParentBlockHash applies the EIP-2935 system call, storing the parent
+// block hash in the history contract. It must be called before the
+// transactions of a block are executed, from the Prague fork on.
+func ProcessParentBlockHash(prevHash common.Hash, vmenv *evm.EVM, statedb evm.StateDB) error {
+	return systemCall(vmenv, statedb, config.HistoryStorageAddress, prevHash.Bytes())
+}
+
+// systemCall executes a call to a system contract from the system address.
+// The call runs with a fixed gas allowance which is not charged to anyone and
+// does not count against the block gas limit. The system address transfers no
+// value, it is neither created nor touched, and the transaction context of
+// vmenv is restored afterwards. Like after any transaction, the caller is
+// expected to finalise the state afterwards.
+func systemCall(vmenv *evm.EVM, statedb evm.StateDB, contract common.Address, input []byte) error {
+	txCtx, transfer := vmenv.TxContext, vmenv.Context.Transfer
+	defer func() {
+		vmenv.TxContext, vmenv.Context.Transfer = txCtx, transfer
+	}()
+	vmenv.Reset(evm.TxContext{
+		Origin:   config.SystemAddress,
+		GasPrice: new(big.Int),
+	}, statedb)
+	vmenv.Context.Transfer = func(evm.StateDB, common.Address, common.Address, *big.Int) {}
+
+	statedb.AddAddressToAccessList(contract)
+	_, _, err := vmenv.Call(evm.AccountRef(config.SystemAddress), contract, input, config.SystemCallGasLimit, new(big.Int))
+	return err
+}
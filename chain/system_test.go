@@ -0,0 +1,109 @@
+package chain
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+// newSystemTestEnv returns an EVM on a state holding the system contracts.
+func newSystemTestEnv(number, time int64, beaconRoot *common.Hash) (*evm.EVM, *state.StateDB) {
+	statedb := state.New()
+	statedb.SetCode(config.BeaconRootsAddress, config.BeaconRootsCode)
+	statedb.SetCode(config.HistoryStorageAddress, config.HistoryStorageCode)
+
+	chainConfig := &config.ChainConfig{
+		ChainID:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(0),
+		LondonBlock:    big.NewInt(0),
+		CancunBlock:    big.NewInt(0),
+		PragueBlock:    big.NewInt(0),
+	}
+	vmenv := evm.NewEVMWithChainConfig(evm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		BlockNumber: big.NewInt(number),
+		Time:        big.NewInt(time),
+		BeaconRoot:  beaconRoot,
+	}, evm.TxContext{}, chainConfig, evm.EVMConfig{})
+	vmenv.Context = vmenv.BlockContext
+	return vmenv, statedb
+}
+
+func TestProcessBeaconBlockRoot(t *testing.T) {
+	var (
+		root           = common.HexToHash("0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+		vmenv, statedb = newSystemTestEnv(1, 12345, &root)
+	)
+	txCtx := evm.TxContext{Origin: common.Address{0x01}, GasPrice: big.NewInt(7)}
+	vmenv.TxContext = txCtx
+	if err := ProcessBeaconBlockRoot(vmenv, statedb); err != nil {
+		t.Fatalf("system call failed: %v", err)
+	}
+	// The system address is left untouched, the transaction context restored
+	if statedb.Exist(config.SystemAddress) {
+		t.Fatalf("system address created")
+	}
+	if vmenv.Origin != txCtx.Origin || vmenv.GasPrice != txCtx.GasPrice {
+		t.Fatalf("transaction context not restored: %+v", vmenv.TxContext)
+	}
+	timestamp := common.BigToHash(big.NewInt(12345))
+	if have := statedb.GetState(config.BeaconRootsAddress, common.BigToHash(big.NewInt(12345%8191))); have != timestamp {
+		t.Fatalf("timestamp slot mismatch: have %x, want %x", have, timestamp)
+	}
+	// Query the root as a regular user
+	ret, _, err := vmenv.Call(evm.AccountRef(common.Address{0x01}), config.BeaconRootsAddress, timestamp.Bytes(), 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to query beacon root: %v", err)
+	}
+	if common.BytesToHash(ret) != root {
+		t.Fatalf("beacon root mismatch: have %x, want %x", ret, root)
+	}
+	// Unknown timestamps are rejected
+	if _, _, err := vmenv.Call(evm.AccountRef(common.Address{0x01}), config.BeaconRootsAddress, common.BigToHash(big.NewInt(12346)).Bytes(), 100000, new(big.Int)); err == nil {
+		t.Fatalf("query of unknown timestamp succeeded")
+	}
+}
+
+func TestProcessBeaconBlockRootMissing(t *testing.T) {
+	vmenv, statedb := newSystemTestEnv(1, 12345, nil)
+	if err := ProcessBeaconBlockRoot(vmenv, statedb); err != nil {
+		t.Fatalf("system call failed: %v", err)
+	}
+	if have := statedb.GetState(config.BeaconRootsAddress, common.BigToHash(big.NewInt(12345))); have != (common.Hash{}) {
+		t.Fatalf("unexpected storage write: %x", have)
+	}
+}
+
+func TestProcessParentBlockHash(t *testing.T) {
+	var (
+		hash           = common.HexToHash("0xdeadbeef")
+		vmenv, statedb = newSystemTestEnv(100, 0, nil)
+	)
+	if err := ProcessParentBlockHash(hash, vmenv, statedb); err != nil {
+		t.Fatalf("system call failed: %v", err)
+	}
+	if statedb.Exist(config.SystemAddress) {
+		t.Fatalf("system address created")
+	}
+	if have := statedb.GetState(config.HistoryStorageAddress, common.BigToHash(big.NewInt(99))); have != hash {
+		t.Fatalf("history slot mismatch: have %x, want %x", have, hash)
+	}
+	// Query the hash as a regular user from the next block
+	vmenv.Context.BlockNumber = big.NewInt(101)
+	ret, _, err := vmenv.Call(evm.AccountRef(common.Address{0x01}), config.HistoryStorageAddress, common.BigToHash(big.NewInt(99)).Bytes(), 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to query block hash: %v", err)
+	}
+	if common.BytesToHash(ret) != hash {
+		t.Fatalf("block hash mismatch: have %x, want %x", ret, hash)
+	}
+	// Future blocks are rejected
+	if _, _, err := vmenv.Call(evm.AccountRef(common.Address{0x01}), config.HistoryStorageAddress, common.BigToHash(big.NewInt(101)).Bytes(), 100000, new(big.Int)); err == nil {
+		t.Fatalf("query of future block succeeded")
+	}
+}
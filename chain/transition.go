@@ -0,0 +1,249 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/model"
+	"github.com/entropyio/go-evm/state"
+	"math"
+	"math/big"
+)
+
+// List of transaction validation errors. A transaction failing validation
+// can't be included in a block.
+var (
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrNonceTooHigh      = errors.New("nonce too high")
+	ErrFeeCapTooLow      = errors.New("gas price less than block base fee")
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+	ErrIntrinsicGas      = errors.New("intrinsic gas too low")
+	ErrGasUintOverflow   = errors.New("gas uint64 overflow")
+	ErrGasLimitReached   = errors.New("gas limit reached")
+	ErrSetCodeTxCreate   = errors.New("set code transaction must not be a create transaction")
+	ErrSetCodeTxFork     = errors.New("set code transaction not supported before prague")
+)
+
+const (
+	// ReceiptStatusFailed is the status of a transaction whose execution failed.
+	ReceiptStatusFailed = uint64(0)
+	// ReceiptStatusSuccessful is the status of a transaction whose execution
+	// succeeded.
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Message is a transaction to execute, with its sender recovered.
+type Message struct {
+	From       common.Address
+	To         *common.Address // nil for contract creation
+	Nonce      uint64
+	Value      *big.Int
+	Gas        uint64
+	GasPrice   *big.Int
+	Data       []byte
+	AccessList model.AccessList
+
+	// AuthList holds the EIP-7702 authorizations of a set code transaction,
+	// as set by SetCodeTxMessage, applied before the message is executed.
+	// Messages carrying authorizations must only be applied from the Prague
+	// fork on.
+	AuthList []model.SetCodeAuthorization
+}
+
+// SetCodeTxMessage returns the message of a signed set code transaction.
+func SetCodeTxMessage(tx *model.SetCodeTx) (*Message, error) {
+	from, err := tx.Sender()
+	if err != nil {
+		return nil, err
+	}
+	to := tx.To
+	return &Message{
+		From:       from,
+		To:         &to,
+		Nonce:      tx.Nonce,
+		Value:      tx.Value,
+		Gas:        tx.Gas,
+		GasPrice:   tx.GasFeeCap,
+		Data:       tx.Data,
+		AccessList: tx.AccessList,
+		AuthList:   tx.AuthList,
+	}, nil
+}
+
+// Receipt is the outcome of the execution of a transaction.
+type Receipt struct {
+	Status            uint64
+	CumulativeGasUsed uint64 // Gas used by the block up to and including the transaction
+	GasUsed           uint64
+	ContractAddress   common.Address // Address of the created contract, if any
+	Logs              []*model.Log
+}
+
+// IntrinsicGas computes the gas charged for a transaction before its
+// execution.
+func IntrinsicGas(data []byte, accessList model.AccessList, authList []model.SetCodeAuthorization, isContractCreation bool) (uint64, error) {
+	gas := config.TxGas
+	if isContractCreation {
+		gas = config.TxGasContractCreation
+	}
+	if len(data) > 0 {
+		var nz uint64
+		for _, b := range data {
+			if b != 0 {
+				nz++
+			}
+		}
+		if (math.MaxUint64-gas)/config.TxDataNonZeroGasEIP2028 < nz {
+			return 0, ErrGasUintOverflow
+		}
+		gas += nz * config.TxDataNonZeroGasEIP2028
+
+		z := uint64(len(data)) - nz
+		if (math.MaxUint64-gas)/config.TxDataZeroGas < z {
+			return 0, ErrGasUintOverflow
+		}
+		gas += z * config.TxDataZeroGas
+	}
+	gas += uint64(len(accessList)) * config.TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * config.TxAccessListStorageKeyGas
+	gas += uint64(len(authList)) * config.CallNewAccountGas
+	return gas, nil
+}
+
+// ApplyMessage executes the message on the state and pays the transaction
+// fee to the coinbase of the block. The returned error is the validation
+// error of the message, execution failures are reported through the receipt
+// status. The cumulative gas used isn't filled in.
+//
+// The state is expected to be finalised afterwards, before the next message
+// is applied.
+func ApplyMessage(vmenv *evm.EVM, statedb *state.StateDB, msg *Message) (*Receipt, error) {
+	receipt, fee, err := applyMessage(vmenv, statedb, msg)
+	if err != nil {
+		return nil, err
+	}
+	statedb.AddBalance(vmenv.Coinbase, fee)
+	return receipt, nil
+}
+
+// applyMessage executes the message on the state and returns the receipt and
+// the fee owed to the coinbase, without paying it.
+func applyMessage(vmenv *evm.EVM, statedb *state.StateDB, msg *Message) (*Receipt, *big.Int, error) {
+	// Validate the message against the state
+	nonce := statedb.GetNonce(msg.From)
+	if msg.Nonce < nonce {
+		return nil, nil, fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooLow, msg.From, msg.Nonce, nonce)
+	} else if msg.Nonce > nonce {
+		return nil, nil, fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooHigh, msg.From, msg.Nonce, nonce)
+	}
+	tip := new(big.Int).Set(msg.GasPrice)
+	if vmenv.BaseFee != nil {
+		if msg.GasPrice.Cmp(vmenv.BaseFee) < 0 {
+			return nil, nil, fmt.Errorf("%w: address %v, gasPrice: %s baseFee: %s", ErrFeeCapTooLow, msg.From, msg.GasPrice, vmenv.BaseFee)
+		}
+		tip.Sub(tip, vmenv.BaseFee)
+	}
+	gasCost := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas), msg.GasPrice)
+	if have, want := statedb.GetBalance(msg.From), new(big.Int).Add(gasCost, msg.Value); have.Cmp(want) < 0 {
+		return nil, nil, fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, msg.From, have, want)
+	}
+	rules := vmenv.Rules()
+	if !rules.IsPrague && len(msg.AuthList) > 0 {
+		return nil, nil, fmt.Errorf("%w: address %v", ErrSetCodeTxFork, msg.From)
+	}
+	contractCreation := msg.To == nil
+	if contractCreation && len(msg.AuthList) > 0 {
+		return nil, nil, fmt.Errorf("%w: address %v", ErrSetCodeTxCreate, msg.From)
+	}
+	intrinsic, err := IntrinsicGas(msg.Data, msg.AccessList, msg.AuthList, contractCreation)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.Gas < intrinsic {
+		return nil, nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, msg.Gas, intrinsic)
+	}
+	// Buy the gas and execute the message
+	vmenv.Reset(evm.TxContext{Origin: msg.From, GasPrice: new(big.Int).Set(msg.GasPrice)}, statedb)
+	statedb.SubBalance(msg.From, gasCost)
+
+	if rules.IsLondon {
+		statedb.PrepareAccessList(msg.From, msg.To, vmenv.ActivePrecompiles(), msg.AccessList)
+	}
+	var (
+		receipt = new(Receipt)
+		gas     = msg.Gas - intrinsic
+		vmerr   error
+	)
+	if contractCreation {
+		_, receipt.ContractAddress, gas, vmerr = vmenv.Create(evm.AccountRef(msg.From), msg.Data, gas, msg.Value)
+	} else {
+		statedb.SetNonce(msg.From, nonce+1)
+		if len(msg.AuthList) > 0 {
+			ApplySetCodeAuthorizations(statedb, chainID(vmenv), msg.AuthList)
+		}
+		_, gas, vmerr = vmenv.Call(evm.AccountRef(msg.From), *msg.To, msg.Data, gas, msg.Value)
+	}
+	// Refund the unused gas and part of the refund counter
+	quotient := config.RefundQuotient
+	if rules.IsLondon {
+		quotient = config.RefundQuotientEIP3529
+	}
+	refund := (msg.Gas - gas) / quotient
+	if have := statedb.GetRefund(); have < refund {
+		refund = have
+	}
+	gas += refund
+	statedb.AddBalance(msg.From, new(big.Int).Mul(new(big.Int).SetUint64(gas), msg.GasPrice))
+
+	receipt.GasUsed = msg.Gas - gas
+	receipt.Status = ReceiptStatusSuccessful
+	if vmerr != nil {
+		receipt.Status = ReceiptStatusFailed
+	}
+	return receipt, new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), tip), nil
+}
+
+// chainID returns the chain ID authorizations are validated against.
+func chainID(vmenv *evm.EVM) *big.Int {
+	if cc := vmenv.ChainConfig(); cc != nil && cc.ChainID != nil {
+		return cc.ChainID
+	}
+	return new(big.Int)
+}
+
+// Process applies the messages of a block in order and finalises the state
+// after each of them. It stops at the first message failing validation, the
+// state then holds the changes of the messages before it.
+func Process(vmenv *evm.EVM, statedb *state.StateDB, msgs []*Message) ([]*Receipt, error) {
+	var (
+		receipts = make([]*Receipt, 0, len(msgs))
+		gasUsed  uint64
+	)
+	for i, msg := range msgs {
+		if msg.Gas > vmenv.GasLimit-gasUsed {
+			return receipts, fmt.Errorf("could not apply tx %d: %w", i, ErrGasLimitReached)
+		}
+		receipt, err := ApplyMessage(vmenv, statedb, msg)
+		if err != nil {
+			return receipts, fmt.Errorf("could not apply tx %d: %w", i, err)
+		}
+		gasUsed += receipt.GasUsed
+		finaliseReceipt(receipt, i, gasUsed, statedb.Logs())
+		statedb.Finalise()
+
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// finaliseReceipt fills in the block related fields of the receipt of the
+// i'th transaction of a block.
+func finaliseReceipt(receipt *Receipt, i int, gasUsed uint64, logs []*model.Log) {
+	receipt.CumulativeGasUsed = gasUsed
+	receipt.Logs = logs
+	for _, log := range logs {
+		log.TxIndex = uint(i)
+	}
+}
@@ -0,0 +1,25 @@
+// Package secp256r1 implements signature verification over the NIST P-256
+// (secp256r1) elliptic curve, as used by the RIP-7212 precompile.
+package secp256r1
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+)
+
+// Verify checks whether (r, s) is a valid signature of hash by the public key
+// (x, y). Signatures with scalars outside of [1, n-1] and public keys which
+// are not a point on the curve are rejected.
+func Verify(hash []byte, r, s, x, y *big.Int) bool {
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(params.N) >= 0 || s.Cmp(params.N) >= 0 {
+		return false
+	}
+	if x.Cmp(params.P) >= 0 || y.Cmp(params.P) >= 0 || !curve.IsOnCurve(x, y) {
+		return false
+	}
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s)
+}
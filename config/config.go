@@ -123,6 +123,18 @@ type ChainConfig struct {
 	HomesteadBlock *big.Int `json:"homesteadBlock,omitempty"` // Homestead switch block (nil = no fork, 0 = already homestead)
 	EIP150Block    *big.Int `json:"eip150Block,omitempty"`    // EIP150 HF block (nil = no fork)
 	LondonBlock    *big.Int `json:"londonBlock,omitempty"`    // London switch block (nil = no fork, 0 = already on london)
+	CancunBlock    *big.Int `json:"cancunBlock,omitempty"`    // Cancun switch block (nil = no fork, 0 = already on cancun)
+	PragueBlock    *big.Int `json:"pragueBlock,omitempty"`    // Prague switch block (nil = no fork, 0 = already on prague)
+	OsakaBlock     *big.Int `json:"osakaBlock,omitempty"`     // Osaka switch block (nil = no fork, 0 = already on osaka)
+
+	// P256VerifyBlock enables the RIP-7212 secp256r1 signature verification
+	// precompile. It is not part of any fork and may be enabled by any chain
+	// independently (nil = disabled, 0 = enabled from genesis).
+	P256VerifyBlock *big.Int `json:"p256VerifyBlock,omitempty"`
+
+	// ProtocolParams customises the gas prices and execution limits of the
+	// chain (nil = defaults).
+	ProtocolParams *ProtocolParams `json:"protocolParams,omitempty"`
 
 	// TerminalTotalDifficulty is the amount of total difficulty reached by
 	// the network that triggers the consensus upgrade.
@@ -205,6 +217,18 @@ func (cc *ChainConfig) String() string {
 	banner += fmt.Sprintf(" - London:                      %-8v (https://github.com/entropy/execution-specs/blob/master/network-upgrades/mainnet-upgrades/london.md)\n", cc.LondonBlock)
 	banner += "\n"
 
+	banner += "Post-Merge hard forks:\n"
+	banner += fmt.Sprintf(" - Cancun:                      %-8v (https://github.com/entropy/execution-specs/blob/master/network-upgrades/mainnet-upgrades/cancun.md)\n", cc.CancunBlock)
+	banner += fmt.Sprintf(" - Prague:                      %-8v (https://github.com/entropy/execution-specs/blob/master/network-upgrades/mainnet-upgrades/prague.md)\n", cc.PragueBlock)
+	banner += fmt.Sprintf(" - Osaka:                       %-8v (https://github.com/entropy/execution-specs/blob/master/network-upgrades/mainnet-upgrades/osaka.md)\n", cc.OsakaBlock)
+	banner += "\n"
+
+	if cc.P256VerifyBlock != nil {
+		banner += "Opt-in precompiles:\n"
+		banner += fmt.Sprintf(" - P256VERIFY (RIP-7212):       %-8v (https://github.com/ethereum/RIPs/blob/master/RIPS/rip-7212.md)\n", cc.P256VerifyBlock)
+		banner += "\n"
+	}
+
 	// Add a special section for the merge as it's non-obvious
 	if cc.TerminalTotalDifficulty == nil {
 		banner += "Merge not configured!\n"
@@ -232,6 +256,36 @@ func (cc *ChainConfig) IsLondon(num *big.Int) bool {
 	return isForked(cc.LondonBlock, num)
 }
 
+// IsCancun returns whether num is either equal to the Cancun fork block or greater.
+func (cc *ChainConfig) IsCancun(num *big.Int) bool {
+	return isForked(cc.CancunBlock, num)
+}
+
+// IsPrague returns whether num is either equal to the Prague fork block or greater.
+func (cc *ChainConfig) IsPrague(num *big.Int) bool {
+	return isForked(cc.PragueBlock, num)
+}
+
+// IsOsaka returns whether num is either equal to the Osaka fork block or greater.
+func (cc *ChainConfig) IsOsaka(num *big.Int) bool {
+	return isForked(cc.OsakaBlock, num)
+}
+
+// Params returns the protocol parameters of the chain, the defaults unless
+// customised. It is safe to call on a nil config.
+func (cc *ChainConfig) Params() *ProtocolParams {
+	if cc == nil || cc.ProtocolParams == nil {
+		return &DefaultProtocolParams
+	}
+	return cc.ProtocolParams
+}
+
+// IsP256Verify returns whether num is either equal to the block enabling the
+// P256VERIFY precompile or greater.
+func (cc *ChainConfig) IsP256Verify(num *big.Int) bool {
+	return isForked(cc.P256VerifyBlock, num)
+}
+
 // IsTerminalPoWBlock returns whether the given block is the last block of PoW stage.
 func (cc *ChainConfig) IsTerminalPoWBlock(parentTotalDiff *big.Int, totalDiff *big.Int) bool {
 	if cc.TerminalTotalDifficulty == nil {
@@ -271,6 +325,9 @@ func (cc *ChainConfig) CheckConfigForkOrder() error {
 		{name: "homesteadBlock", block: cc.HomesteadBlock},
 		{name: "eip150Block", block: cc.EIP150Block},
 		{name: "londonBlock", block: cc.LondonBlock},
+		{name: "cancunBlock", block: cc.CancunBlock, optional: true},
+		{name: "pragueBlock", block: cc.PragueBlock, optional: true},
+		{name: "osakaBlock", block: cc.OsakaBlock, optional: true},
 	} {
 		if lastFork.name != "" {
 			// Next one must be higher number
@@ -303,6 +360,18 @@ func (cc *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Comp
 	if isForkIncompatible(cc.LondonBlock, newcfg.LondonBlock, head) {
 		return newCompatError("London fork block", cc.LondonBlock, newcfg.LondonBlock)
 	}
+	if isForkIncompatible(cc.CancunBlock, newcfg.CancunBlock, head) {
+		return newCompatError("Cancun fork block", cc.CancunBlock, newcfg.CancunBlock)
+	}
+	if isForkIncompatible(cc.PragueBlock, newcfg.PragueBlock, head) {
+		return newCompatError("Prague fork block", cc.PragueBlock, newcfg.PragueBlock)
+	}
+	if isForkIncompatible(cc.OsakaBlock, newcfg.OsakaBlock, head) {
+		return newCompatError("Osaka fork block", cc.OsakaBlock, newcfg.OsakaBlock)
+	}
+	if isForkIncompatible(cc.P256VerifyBlock, newcfg.P256VerifyBlock, head) {
+		return newCompatError("P256VERIFY activation block", cc.P256VerifyBlock, newcfg.P256VerifyBlock)
+	}
 	return nil
 }
 
@@ -369,7 +438,9 @@ func (err *CompatError) Error() string {
 type Rules struct {
 	ChainID                         *big.Int
 	IsHomestead, IsEIP150, IsLondon bool
-	IsMerge                         bool
+	IsMerge, IsCancun, IsPrague     bool
+	IsOsaka                         bool
+	IsP256Verify                    bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -379,10 +450,14 @@ func (cc *ChainConfig) Rules(num *big.Int, isMerge bool) Rules {
 		chainID = new(big.Int)
 	}
 	return Rules{
-		ChainID:     new(big.Int).Set(chainID),
-		IsHomestead: cc.IsHomestead(num),
-		IsEIP150:    cc.IsEIP150(num),
-		IsLondon:    cc.IsLondon(num),
-		IsMerge:     isMerge,
+		ChainID:      new(big.Int).Set(chainID),
+		IsHomestead:  cc.IsHomestead(num),
+		IsEIP150:     cc.IsEIP150(num),
+		IsLondon:     cc.IsLondon(num),
+		IsMerge:      isMerge,
+		IsCancun:     cc.IsCancun(num),
+		IsPrague:     cc.IsPrague(num),
+		IsOsaka:      cc.IsOsaka(num),
+		IsP256Verify: cc.IsP256Verify(num),
 	}
 }
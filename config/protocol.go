@@ -1,5 +1,7 @@
 package config
 
+import "github.com/entropyio/go-evm/common"
+
 const (
 	CallValueTransferGas uint64 = 9000  // Paid for CALL when the value transfer is non-zero.
 	CallNewAccountGas    uint64 = 25000 // Paid for CALL when the destination address didn't exist prior.
@@ -42,13 +44,23 @@ const (
 	LogGas                uint64 = 375   // Per LOG* operation.
 	CopyGas               uint64 = 3     //
 	StackLimit            uint64 = 1024  // Maximum size of VM stack allowed.
+	ReturnStackLimit      uint64 = 1024  // Maximum depth of the EOF function return stack (EIP-4750).
 	LogTopicGas           uint64 = 375   // Multiplied by the * of the LOG*, per LOG transaction. e.g. LOG0 incurs 0 * c_txLogTopicGas, LOG4 incurs 4 * c_txLogTopicGas.
 	CreateGas             uint64 = 32000 // Once per CREATE operation & contract-creation transaction.
 	Create2Gas            uint64 = 32000 // Once per CREATE2 operation
 	SelfdestructRefundGas uint64 = 24000 // Refunded following a selfdestruct operation.
 	MemoryGas             uint64 = 3     // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
 
-	TxAccessListStorageKeyGas uint64 = 1900 // Per storage key specified in EIP 2930 access list
+	TxGas                     uint64 = 21000 // Per transaction not creating a contract. NOTE: Not payable on data of calls between transactions.
+	TxGasContractCreation     uint64 = 53000 // Per transaction that creates a contract. NOTE: Not payable on data of calls between transactions.
+	TxDataZeroGas             uint64 = 4     // Per byte of data attached to a transaction that equals zero. NOTE: Not payable on data of calls between transactions.
+	TxDataNonZeroGasEIP2028   uint64 = 16    // Per byte of non zero data attached to a transaction after EIP 2028 (part in Istanbul)
+	TxAccessListAddressGas    uint64 = 2400  // Per address specified in EIP 2930 access list
+	TxAccessListStorageKeyGas uint64 = 1900  // Per storage key specified in EIP 2930 access list
+	TxAuthTupleGas            uint64 = 12500 // Per auth tuple code specified in EIP-7702
+
+	RefundQuotient        uint64 = 2 // Maximum refund quotient; max gas refund is gas used divided by this
+	RefundQuotientEIP3529 uint64 = 5 // Maximum refund quotient after EIP-3529
 
 	// These have been changed during the course of the chain
 	CallGasFrontier              uint64 = 40  // Once per CALL operation & message call transaction.
@@ -82,6 +94,9 @@ const (
 	InitialBaseFee                 = 1000000000 // Initial base fee for EIP-1559 blocks.
 	MaxCodeSize                    = 24576      // Maximum bytecode to permit for a contract
 
+	SystemCallGasLimit uint64 = 30000000 // Gas available to system calls, not charged to anyone.
+	HistoryServeWindow uint64 = 8191     // Number of blocks served by the EIP-2935 history contract.
+
 	// Precompiled contract gas prices
 	EcrecoverGas        uint64 = 3000 // Elliptic curve sender recovery gas price
 	Sha256BaseGas       uint64 = 60   // Base price for a SHA256 operation
@@ -108,6 +123,21 @@ const (
 	Bls12381PairingPerPairGas uint64 = 23000  // Per-point pair gas price for BLS12-381 elliptic curve pairing check
 	Bls12381MapG1Gas          uint64 = 5500   // Gas price for BLS12-381 mapping field element to G1 operation
 	Bls12381MapG2Gas          uint64 = 110000 // Gas price for BLS12-381 mapping field element to G2 operation
+
+	P256VerifyGas uint64 = 3450 // secp256r1 elliptic curve signature verifier gas price
+)
+
+var (
+	// SystemAddress is where the system-transaction is sent from as per EIP-4788
+	SystemAddress = common.HexToAddress("0xfffffffffffffffffffffffffffffffffffffffe")
+
+	// EIP-4788 - Beacon block root in the EVM
+	BeaconRootsAddress = common.HexToAddress("0x000F3df6D732807Ef1319fB7B8bB8522d0Beac02")
+	BeaconRootsCode    = common.FromHex("3373fffffffffffffffffffffffffffffffffffffffe14604d57602036146024575f5ffd5b5f35801560495762001fff810690815414603c575f5ffd5b62001fff01545f5260205ff35b5f5ffd5b62001fff42064281555f359062001fff015500")
+
+	// EIP-2935 - Serve historical block hashes from state
+	HistoryStorageAddress = common.HexToAddress("0x0000F90827F1C53a10cb7A02335B175320002935")
+	HistoryStorageCode    = common.FromHex("3373fffffffffffffffffffffffffffffffffffffffe14604657602036036042575f35600143038111604257611fff81430311604257611fff9006545f5260205ff35b5f5ffd5b5f35611fff60014303065500")
 )
 
 // Gas discount table for BLS12-381 G1 and G2 multi exponentiation operations
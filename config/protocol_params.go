@@ -0,0 +1,238 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ProtocolParams holds the gas prices and execution limits of a chain.
+//
+// Every parameter defaults to the respective constant of this package, a chain
+// only needs to specify the ones it prices differently. Parameters which were
+// changed by a fork have one field per fork, the active one being picked by
+// the rules of the block.
+type ProtocolParams struct {
+	// Execution limits
+	CallCreateDepth uint64 `json:"callCreateDepth"` // Maximum depth of call/create stack.
+	StackLimit      uint64 `json:"stackLimit"`      // Maximum size of VM stack allowed.
+	MaxCodeSize     uint64 `json:"maxCodeSize"`     // Maximum bytecode to permit for a contract
+
+	// Memory expansion
+	MemoryGas    uint64 `json:"memoryGas"`
+	QuadCoeffDiv uint64 `json:"quadCoeffDiv"`
+
+	// Opcode prices
+	Keccak256Gas     uint64 `json:"keccak256Gas"`
+	Keccak256WordGas uint64 `json:"keccak256WordGas"`
+	CopyGas          uint64 `json:"copyGas"`
+	JumpdestGas      uint64 `json:"jumpdestGas"`
+	ExpGas           uint64 `json:"expGas"`
+	ExpByteFrontier  uint64 `json:"expByteFrontier"`
+	ExpByteEIP158    uint64 `json:"expByteEIP158"`
+	LogGas           uint64 `json:"logGas"`
+	LogTopicGas      uint64 `json:"logTopicGas"`
+	LogDataGas       uint64 `json:"logDataGas"`
+
+	// Account access
+	BalanceGasFrontier           uint64 `json:"balanceGasFrontier"`
+	BalanceGasEIP150             uint64 `json:"balanceGasEIP150"`
+	BalanceGasEIP1884            uint64 `json:"balanceGasEIP1884"`
+	ExtcodeSizeGasFrontier       uint64 `json:"extcodeSizeGasFrontier"`
+	ExtcodeSizeGasEIP150         uint64 `json:"extcodeSizeGasEIP150"`
+	ExtcodeCopyBaseFrontier      uint64 `json:"extcodeCopyBaseFrontier"`
+	ExtcodeCopyBaseEIP150        uint64 `json:"extcodeCopyBaseEIP150"`
+	ExtcodeHashGasConstantinople uint64 `json:"extcodeHashGasConstantinople"`
+	ExtcodeHashGasEIP1884        uint64 `json:"extcodeHashGasEIP1884"`
+	ColdAccountAccessCostEIP2929 uint64 `json:"coldAccountAccessCostEIP2929"`
+	ColdSloadCostEIP2929         uint64 `json:"coldSloadCostEIP2929"`
+	WarmStorageReadCostEIP2929   uint64 `json:"warmStorageReadCostEIP2929"`
+
+	// Storage
+	SloadGasFrontier                  uint64 `json:"sloadGasFrontier"`
+	SloadGasEIP150                    uint64 `json:"sloadGasEIP150"`
+	SloadGasEIP1884                   uint64 `json:"sloadGasEIP1884"`
+	SloadGasEIP2200                   uint64 `json:"sloadGasEIP2200"`
+	NetSstoreNoopGas                  uint64 `json:"netSstoreNoopGas"`
+	NetSstoreInitGas                  uint64 `json:"netSstoreInitGas"`
+	NetSstoreCleanGas                 uint64 `json:"netSstoreCleanGas"`
+	NetSstoreDirtyGas                 uint64 `json:"netSstoreDirtyGas"`
+	NetSstoreClearRefund              uint64 `json:"netSstoreClearRefund"`
+	NetSstoreResetRefund              uint64 `json:"netSstoreResetRefund"`
+	NetSstoreResetClearRefund         uint64 `json:"netSstoreResetClearRefund"`
+	SstoreSentryGasEIP2200            uint64 `json:"sstoreSentryGasEIP2200"`
+	SstoreSetGasEIP2200               uint64 `json:"sstoreSetGasEIP2200"`
+	SstoreResetGasEIP2200             uint64 `json:"sstoreResetGasEIP2200"`
+	SstoreClearsScheduleRefundEIP2200 uint64 `json:"sstoreClearsScheduleRefundEIP2200"`
+	SstoreClearsScheduleRefundEIP3529 uint64 `json:"sstoreClearsScheduleRefundEIP3529"`
+
+	// Calls
+	CallGasFrontier      uint64 `json:"callGasFrontier"`
+	CallGasEIP150        uint64 `json:"callGasEIP150"`
+	CallValueTransferGas uint64 `json:"callValueTransferGas"`
+	CallNewAccountGas    uint64 `json:"callNewAccountGas"`
+	CallStipend          uint64 `json:"callStipend"`
+
+	// Contract creation and destruction
+	CreateGas               uint64 `json:"createGas"`
+	Create2Gas              uint64 `json:"create2Gas"`
+	CreateDataGas           uint64 `json:"createDataGas"`
+	SelfdestructGasEIP150   uint64 `json:"selfdestructGasEIP150"`
+	CreateBySelfdestructGas uint64 `json:"createBySelfdestructGas"`
+	SelfdestructRefundGas   uint64 `json:"selfdestructRefundGas"`
+
+	// Precompiled contracts
+	EcrecoverGas                     uint64 `json:"ecrecoverGas"`
+	Sha256BaseGas                    uint64 `json:"sha256BaseGas"`
+	Sha256PerWordGas                 uint64 `json:"sha256PerWordGas"`
+	Ripemd160BaseGas                 uint64 `json:"ripemd160BaseGas"`
+	Ripemd160PerWordGas              uint64 `json:"ripemd160PerWordGas"`
+	IdentityBaseGas                  uint64 `json:"identityBaseGas"`
+	IdentityPerWordGas               uint64 `json:"identityPerWordGas"`
+	Bn256AddGasByzantium             uint64 `json:"bn256AddGasByzantium"`
+	Bn256AddGasIstanbul              uint64 `json:"bn256AddGasIstanbul"`
+	Bn256ScalarMulGasByzantium       uint64 `json:"bn256ScalarMulGasByzantium"`
+	Bn256ScalarMulGasIstanbul        uint64 `json:"bn256ScalarMulGasIstanbul"`
+	Bn256PairingBaseGasByzantium     uint64 `json:"bn256PairingBaseGasByzantium"`
+	Bn256PairingBaseGasIstanbul      uint64 `json:"bn256PairingBaseGasIstanbul"`
+	Bn256PairingPerPointGasByzantium uint64 `json:"bn256PairingPerPointGasByzantium"`
+	Bn256PairingPerPointGasIstanbul  uint64 `json:"bn256PairingPerPointGasIstanbul"`
+	Bls12381G1AddGas                 uint64 `json:"bls12381G1AddGas"`
+	Bls12381G1MulGas                 uint64 `json:"bls12381G1MulGas"`
+	Bls12381G2AddGas                 uint64 `json:"bls12381G2AddGas"`
+	Bls12381G2MulGas                 uint64 `json:"bls12381G2MulGas"`
+	Bls12381PairingBaseGas           uint64 `json:"bls12381PairingBaseGas"`
+	Bls12381PairingPerPairGas        uint64 `json:"bls12381PairingPerPairGas"`
+	Bls12381MapG1Gas                 uint64 `json:"bls12381MapG1Gas"`
+	Bls12381MapG2Gas                 uint64 `json:"bls12381MapG2Gas"`
+	P256VerifyGas                    uint64 `json:"p256VerifyGas"`
+}
+
+// DefaultProtocolParams are the protocol parameters of chains which don't
+// customise them.
+//
+// They are the defaults of every fork. Prices changed by a fork, such as the
+// SLOAD and SSTORE pricing of EIP-2200, EIP-2929 and EIP-3529, are kept in
+// fields of their own, and the instruction set of a fork reads the fields of
+// the pricing it runs. A schedule per fork would hold the same values, and
+// customising a price would then mean repeating it for every fork using it.
+var DefaultProtocolParams = ProtocolParams{
+	CallCreateDepth: CallCreateDepth,
+	StackLimit:      StackLimit,
+	MaxCodeSize:     MaxCodeSize,
+
+	MemoryGas:    MemoryGas,
+	QuadCoeffDiv: QuadCoeffDiv,
+
+	Keccak256Gas:     Keccak256Gas,
+	Keccak256WordGas: Keccak256WordGas,
+	CopyGas:          CopyGas,
+	JumpdestGas:      JumpdestGas,
+	ExpGas:           ExpGas,
+	ExpByteFrontier:  ExpByteFrontier,
+	ExpByteEIP158:    ExpByteEIP158,
+	LogGas:           LogGas,
+	LogTopicGas:      LogTopicGas,
+	LogDataGas:       LogDataGas,
+
+	BalanceGasFrontier:           BalanceGasFrontier,
+	BalanceGasEIP150:             BalanceGasEIP150,
+	BalanceGasEIP1884:            BalanceGasEIP1884,
+	ExtcodeSizeGasFrontier:       ExtcodeSizeGasFrontier,
+	ExtcodeSizeGasEIP150:         ExtcodeSizeGasEIP150,
+	ExtcodeCopyBaseFrontier:      ExtcodeCopyBaseFrontier,
+	ExtcodeCopyBaseEIP150:        ExtcodeCopyBaseEIP150,
+	ExtcodeHashGasConstantinople: ExtcodeHashGasConstantinople,
+	ExtcodeHashGasEIP1884:        ExtcodeHashGasEIP1884,
+	ColdAccountAccessCostEIP2929: ColdAccountAccessCostEIP2929,
+	ColdSloadCostEIP2929:         ColdSloadCostEIP2929,
+	WarmStorageReadCostEIP2929:   WarmStorageReadCostEIP2929,
+
+	SloadGasFrontier:                  SloadGasFrontier,
+	SloadGasEIP150:                    SloadGasEIP150,
+	SloadGasEIP1884:                   SloadGasEIP1884,
+	SloadGasEIP2200:                   SloadGasEIP2200,
+	NetSstoreNoopGas:                  NetSstoreNoopGas,
+	NetSstoreInitGas:                  NetSstoreInitGas,
+	NetSstoreCleanGas:                 NetSstoreCleanGas,
+	NetSstoreDirtyGas:                 NetSstoreDirtyGas,
+	NetSstoreClearRefund:              NetSstoreClearRefund,
+	NetSstoreResetRefund:              NetSstoreResetRefund,
+	NetSstoreResetClearRefund:         NetSstoreResetClearRefund,
+	SstoreSentryGasEIP2200:            SstoreSentryGasEIP2200,
+	SstoreSetGasEIP2200:               SstoreSetGasEIP2200,
+	SstoreResetGasEIP2200:             SstoreResetGasEIP2200,
+	SstoreClearsScheduleRefundEIP2200: SstoreClearsScheduleRefundEIP2200,
+	SstoreClearsScheduleRefundEIP3529: SstoreClearsScheduleRefundEIP3529,
+
+	CallGasFrontier:      CallGasFrontier,
+	CallGasEIP150:        CallGasEIP150,
+	CallValueTransferGas: CallValueTransferGas,
+	CallNewAccountGas:    CallNewAccountGas,
+	CallStipend:          CallStipend,
+
+	CreateGas:               CreateGas,
+	Create2Gas:              Create2Gas,
+	CreateDataGas:           CreateDataGas,
+	SelfdestructGasEIP150:   SelfdestructGasEIP150,
+	CreateBySelfdestructGas: CreateBySelfdestructGas,
+	SelfdestructRefundGas:   SelfdestructRefundGas,
+
+	EcrecoverGas:                     EcrecoverGas,
+	Sha256BaseGas:                    Sha256BaseGas,
+	Sha256PerWordGas:                 Sha256PerWordGas,
+	Ripemd160BaseGas:                 Ripemd160BaseGas,
+	Ripemd160PerWordGas:              Ripemd160PerWordGas,
+	IdentityBaseGas:                  IdentityBaseGas,
+	IdentityPerWordGas:               IdentityPerWordGas,
+	Bn256AddGasByzantium:             Bn256AddGasByzantium,
+	Bn256AddGasIstanbul:              Bn256AddGasIstanbul,
+	Bn256ScalarMulGasByzantium:       Bn256ScalarMulGasByzantium,
+	Bn256ScalarMulGasIstanbul:        Bn256ScalarMulGasIstanbul,
+	Bn256PairingBaseGasByzantium:     Bn256PairingBaseGasByzantium,
+	Bn256PairingBaseGasIstanbul:      Bn256PairingBaseGasIstanbul,
+	Bn256PairingPerPointGasByzantium: Bn256PairingPerPointGasByzantium,
+	Bn256PairingPerPointGasIstanbul:  Bn256PairingPerPointGasIstanbul,
+	Bls12381G1AddGas:                 Bls12381G1AddGas,
+	Bls12381G1MulGas:                 Bls12381G1MulGas,
+	Bls12381G2AddGas:                 Bls12381G2AddGas,
+	Bls12381G2MulGas:                 Bls12381G2MulGas,
+	Bls12381PairingBaseGas:           Bls12381PairingBaseGas,
+	Bls12381PairingPerPairGas:        Bls12381PairingPerPairGas,
+	Bls12381MapG1Gas:                 Bls12381MapG1Gas,
+	Bls12381MapG2Gas:                 Bls12381MapG2Gas,
+	P256VerifyGas:                    P256VerifyGas,
+}
+
+var (
+	errZeroStackLimit   = errors.New("stack limit must be positive")
+	errZeroQuadCoeffDiv = errors.New("memory quadratic coefficient divisor must be positive")
+)
+
+// UnmarshalJSON decodes protocol parameters, starting off the defaults so
+// that only the customised parameters need to be specified.
+func (p *ProtocolParams) UnmarshalJSON(input []byte) error {
+	type params ProtocolParams
+	dec := params(DefaultProtocolParams)
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.StackLimit == 0 {
+		return errZeroStackLimit
+	}
+	if dec.QuadCoeffDiv == 0 {
+		return errZeroQuadCoeffDiv
+	}
+	*p = ProtocolParams(dec)
+	return nil
+}
+
+// LoadProtocolParams decodes the given JSON encoded protocol parameters on
+// top of the defaults. The result applies to every fork of the chain, a
+// customised price affecting the forks whose pricing uses it.
+func LoadProtocolParams(input []byte) (*ProtocolParams, error) {
+	p := new(ProtocolParams)
+	if err := json.Unmarshal(input, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,329 @@
+// Package coverage implements a tracer recording the instructions and the
+// branches executions cover, exporting LCOV reports.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/entropyio/go-evm/asm"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/sourcemap"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Config configures a coverage tracer.
+type Config struct {
+	// SourceMap returns the source map of a code, nil if unknown. It's
+	// called once per code, creation codes included.
+	SourceMap func(codeHash common.Hash, code []byte) *sourcemap.SourceMap
+}
+
+// codeCoverage is the coverage of a code.
+type codeCoverage struct {
+	hash      common.Hash
+	code      []byte
+	sourceMap *sourcemap.SourceMap
+	hits      []uint64              // Executions by pc
+	branches  map[uint64]*[2]uint64 // Taken and not taken JUMPIs by pc
+}
+
+// instruction is an instruction of a code.
+type instruction struct {
+	pc uint64
+	op evm.OpCode
+}
+
+// instructions returns the instructions of the code, up to the first
+// malformed one, such as a push truncated by the metadata appended by solc.
+func (c *codeCoverage) instructions() []instruction {
+	var (
+		instrs []instruction
+		it     = asm.NewInstructionIterator(c.code)
+	)
+	for it.Next() {
+		instrs = append(instrs, instruction{pc: it.PC(), op: it.Op()})
+	}
+	return instrs
+}
+
+// Coverage is an EVMLogger recording, per code hash, the instructions
+// executed and the outcomes of the JUMPI instructions, across all the
+// executions it traces.
+//
+// The tracer must be set as tracer of the EVM with debugging enabled. It is
+// not thread safe.
+type Coverage struct {
+	cfg   Config
+	codes map[common.Hash]*codeCoverage
+
+	// Code of the last contract executed
+	contract *evm.Contract
+	last     *codeCoverage
+}
+
+// New returns an empty coverage tracer.
+func New(cfg Config) *Coverage {
+	return &Coverage{cfg: cfg, codes: make(map[common.Hash]*codeCoverage)}
+}
+
+// coverage returns the coverage of the code of a contract.
+func (c *Coverage) coverage(contract *evm.Contract) *codeCoverage {
+	if contract == c.contract {
+		return c.last
+	}
+	hash := contract.CodeHash
+	if hash == (common.Hash{}) {
+		hash = crypto.Keccak256Hash(contract.Code)
+	}
+	cov, ok := c.codes[hash]
+	if !ok {
+		cov = &codeCoverage{
+			hash:     hash,
+			code:     common.CopyBytes(contract.Code),
+			hits:     make([]uint64, len(contract.Code)),
+			branches: make(map[uint64]*[2]uint64),
+		}
+		if c.cfg.SourceMap != nil {
+			cov.sourceMap = c.cfg.SourceMap(hash, cov.code)
+		}
+		c.codes[hash] = cov
+	}
+	c.contract, c.last = contract, cov
+	return cov
+}
+
+// Codes returns the hashes of the codes executed, sorted.
+func (c *Coverage) Codes() []common.Hash {
+	hashes := make([]common.Hash, 0, len(c.codes))
+	for hash := range c.codes {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return string(hashes[i][:]) < string(hashes[j][:])
+	})
+	return hashes
+}
+
+// Hits returns how many times the instruction at pc of a code was executed.
+func (c *Coverage) Hits(codeHash common.Hash, pc uint64) uint64 {
+	cov, ok := c.codes[codeHash]
+	if !ok || pc >= uint64(len(cov.hits)) {
+		return 0
+	}
+	return cov.hits[pc]
+}
+
+// Branches returns how many times the JUMPI at pc of a code jumped, and
+// how many times it didn't.
+func (c *Coverage) Branches(codeHash common.Hash, pc uint64) (taken, notTaken uint64) {
+	if cov, ok := c.codes[codeHash]; ok {
+		if branch := cov.branches[pc]; branch != nil {
+			return branch[0], branch[1]
+		}
+	}
+	return 0, 0
+}
+
+func (c *Coverage) CaptureTxStart(gasLimit uint64) {}
+
+func (c *Coverage) CaptureTxEnd(restGas uint64) {}
+
+func (c *Coverage) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (c *Coverage) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	c.contract, c.last = nil, nil
+}
+
+func (c *Coverage) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (c *Coverage) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (c *Coverage) CaptureState(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, rData []byte, depth int, err error) {
+	cov := c.coverage(scope.Contract)
+	if pc >= uint64(len(cov.hits)) {
+		return // Implicit STOP past the end of the code
+	}
+	cov.hits[pc]++
+	if op == evm.JUMPI && err == nil && scope.Stack.Len() >= 2 {
+		branch := cov.branches[pc]
+		if branch == nil {
+			branch = new([2]uint64)
+			cov.branches[pc] = branch
+		}
+		if scope.Stack.Back(1).IsZero() {
+			branch[1]++
+		} else {
+			branch[0]++
+		}
+	}
+}
+
+func (c *Coverage) CaptureFault(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, depth int, err error) {
+}
+
+// ListingFile returns the name of the listing of a code, the source file of
+// its bytecode level coverage.
+func ListingFile(codeHash common.Hash) string {
+	return codeHash.Hex() + ".asm"
+}
+
+// WriteListing writes the listing of a code executed, an instruction per
+// line as disassembled by the asm package, for LCOV tools to render the
+// bytecode level coverage with.
+func (c *Coverage) WriteListing(w io.Writer, codeHash common.Hash) error {
+	cov, ok := c.codes[codeHash]
+	if !ok {
+		return fmt.Errorf("unknown code %s", codeHash.Hex())
+	}
+	bw := bufio.NewWriter(w)
+	it := asm.NewInstructionIterator(cov.code)
+	for it.Next() {
+		if len(it.Arg()) > 0 {
+			fmt.Fprintf(bw, "%05x: %v 0x%x\n", it.PC(), it.Op(), it.Arg())
+		} else {
+			fmt.Fprintf(bw, "%05x: %v\n", it.PC(), it.Op())
+		}
+	}
+	return bw.Flush()
+}
+
+// branchRecords writes the LCOV records of a JUMPI: its block and the
+// counts of its taken and not taken branches, unknown if never executed.
+func branchRecords(w io.Writer, line, block int, hits uint64, branch *[2]uint64) (found, hit int) {
+	for i := 0; i < 2; i++ {
+		switch {
+		case hits == 0:
+			fmt.Fprintf(w, "BRDA:%d,%d,%d,-\n", line, block, i)
+		case branch == nil:
+			fmt.Fprintf(w, "BRDA:%d,%d,%d,0\n", line, block, i)
+		default:
+			fmt.Fprintf(w, "BRDA:%d,%d,%d,%d\n", line, block, i, branch[i])
+			if branch[i] > 0 {
+				hit++
+			}
+		}
+	}
+	return 2, hit
+}
+
+// WriteLCOV writes the bytecode level coverage as an LCOV tracefile, with a
+// source file per code, named by ListingFile, whose lines are its
+// instructions and whose branches are its JUMPIs.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "TN:")
+	for _, hash := range c.Codes() {
+		cov := c.codes[hash]
+		fmt.Fprintf(bw, "SF:%s\n", ListingFile(hash))
+
+		var linesFound, linesHit, branchesFound, branchesHit int
+		for i, instr := range cov.instructions() {
+			line, hits := i+1, cov.hits[instr.pc]
+			if instr.op == evm.JUMPI {
+				found, hit := branchRecords(bw, line, i, hits, cov.branches[instr.pc])
+				branchesFound, branchesHit = branchesFound+found, branchesHit+hit
+			}
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, hits)
+			linesFound++
+			if hits > 0 {
+				linesHit++
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\nLF:%d\nLH:%d\nend_of_record\n", branchesFound, branchesHit, linesFound, linesHit)
+	}
+	return bw.Flush()
+}
+
+// sourceBranch is a JUMPI compiled from a source line.
+type sourceBranch struct {
+	hits   uint64
+	branch *[2]uint64
+}
+
+// sourceFile is the coverage of a source file.
+type sourceFile struct {
+	lines    map[int]uint64 // Executions by line
+	branches map[int][]sourceBranch
+}
+
+// WriteSourceLCOV writes the source level coverage of the codes with source
+// maps as an LCOV tracefile. A line is executed as many times as its most
+// executed instruction of a code, its branches are the JUMPIs compiled from
+// it. Instructions generated by the compiler are not covered.
+func (c *Coverage) WriteSourceLCOV(w io.Writer) error {
+	files := make(map[string]*sourceFile)
+	for _, hash := range c.Codes() {
+		cov := c.codes[hash]
+		if cov.sourceMap == nil {
+			continue
+		}
+		lines := make(map[string]map[int]uint64)
+		for _, instr := range cov.instructions() {
+			pos, ok := cov.sourceMap.Position(instr.pc)
+			if !ok {
+				continue
+			}
+			file, ok := files[pos.File]
+			if !ok {
+				file = &sourceFile{lines: make(map[int]uint64), branches: make(map[int][]sourceBranch)}
+				files[pos.File] = file
+			}
+			if lines[pos.File] == nil {
+				lines[pos.File] = make(map[int]uint64)
+			}
+			hits := cov.hits[instr.pc]
+			if prev, ok := lines[pos.File][pos.Line]; !ok || hits > prev {
+				lines[pos.File][pos.Line] = hits
+			}
+			if instr.op == evm.JUMPI {
+				file.branches[pos.Line] = append(file.branches[pos.Line], sourceBranch{hits: hits, branch: cov.branches[instr.pc]})
+			}
+		}
+		for name, counts := range lines {
+			for line, hits := range counts {
+				files[name].lines[line] += hits
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "TN:")
+	for _, name := range names {
+		file := files[name]
+		fmt.Fprintf(bw, "SF:%s\n", name)
+
+		lines := make([]int, 0, len(file.lines))
+		for line := range file.lines {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+
+		var linesHit, branchesFound, branchesHit int
+		for _, line := range lines {
+			for block, b := range file.branches[line] {
+				found, hit := branchRecords(bw, line, block, b.hits, b.branch)
+				branchesFound, branchesHit = branchesFound+found, branchesHit+hit
+			}
+		}
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, file.lines[line])
+			if file.lines[line] > 0 {
+				linesHit++
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\nLF:%d\nLH:%d\nend_of_record\n", branchesFound, branchesHit, len(lines), linesHit)
+	}
+	return bw.Flush()
+}
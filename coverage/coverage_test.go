@@ -0,0 +1,133 @@
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/runtime"
+	"github.com/entropyio/go-evm/sourcemap"
+	"github.com/entropyio/go-evm/state"
+	"strings"
+	"testing"
+)
+
+const branchSource = `contract Branch {
+    fallback() external {
+        if (msg.data[0] != 0) {
+            return;
+        }
+    }
+}
+`
+
+var (
+	branchAddress = common.BytesToAddress([]byte("branch"))
+
+	// jumpi(7, calldataload(0)), stop, jumpdest, stop:
+	//
+	//	0 PUSH1 0x00, 2 CALLDATALOAD, 3 PUSH1 0x07, 5 JUMPI, 6 STOP, 7 JUMPDEST, 8 STOP
+	branchCode = common.Hex2Bytes("600035600757005b00")
+	branchHash = crypto.Keccak256Hash(branchCode)
+)
+
+// newBranchSourceMap returns the source map of branchCode: the condition
+// on line 3 up to the JUMPI, the first STOP generated by the compiler and
+// the rest the return on line 4.
+func newBranchSourceMap(t *testing.T) *sourcemap.SourceMap {
+	t.Helper()
+	rng := func(text string) string {
+		return fmt.Sprintf("%d:%d:0", strings.Index(branchSource, text), len(text))
+	}
+	cond, ret := rng("if (msg.data[0] != 0)"), rng("return;")
+	sourceMap := strings.Join([]string{cond, cond, cond, cond, "0:0:-1", ret, ret}, ";")
+	m, err := sourcemap.New(branchCode, sourceMap, []*sourcemap.Source{sourcemap.NewSource("Branch.sol", branchSource)})
+	if err != nil {
+		t.Fatalf("invalid source map: %v", err)
+	}
+	return m
+}
+
+// cover executes branchCode with a coverage tracer, once per input.
+func cover(t *testing.T, c *Coverage, inputs ...[]byte) {
+	t.Helper()
+	statedb := state.New()
+	statedb.SetCode(branchAddress, branchCode)
+
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	cfg := &runtime.Config{
+		GasLimit:  100000,
+		State:     statedb,
+		EVMConfig: evm.EVMConfig{Debug: true, Tracer: c, JumpTable: &jt},
+	}
+	for _, input := range inputs {
+		if _, _, err := runtime.Call(branchAddress, input, cfg); err != nil {
+			t.Fatalf("execution failed: %v", err)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	c := New(Config{})
+	cover(t, c, common.LeftPadBytes([]byte{1}, 32))
+
+	if codes := c.Codes(); len(codes) != 1 || codes[0] != branchHash {
+		t.Fatalf("codes mismatch: %x", codes)
+	}
+	for pc, want := range []uint64{1, 0, 1, 1, 0, 1, 0, 1, 1} {
+		if have := c.Hits(branchHash, uint64(pc)); have != want {
+			t.Errorf("pc %d: hits mismatch: have %d, want %d", pc, have, want)
+		}
+	}
+	if taken, notTaken := c.Branches(branchHash, 5); taken != 1 || notTaken != 0 {
+		t.Errorf("branches mismatch: have %d/%d, want 1/0", taken, notTaken)
+	}
+	var lcov bytes.Buffer
+	if err := c.WriteLCOV(&lcov); err != nil {
+		t.Fatalf("failed to write lcov: %v", err)
+	}
+	want := "TN:\nSF:" + ListingFile(branchHash) + "\n" +
+		"DA:1,1\nDA:2,1\nDA:3,1\n" +
+		"BRDA:4,3,0,1\nBRDA:4,3,1,0\nDA:4,1\n" +
+		"DA:5,0\nDA:6,1\nDA:7,1\n" +
+		"BRF:2\nBRH:1\nLF:7\nLH:6\nend_of_record\n"
+	if lcov.String() != want {
+		t.Errorf("lcov mismatch:\nhave\n%s\nwant\n%s", lcov.String(), want)
+	}
+	var listing bytes.Buffer
+	if err := c.WriteListing(&listing, branchHash); err != nil {
+		t.Fatalf("failed to write listing: %v", err)
+	}
+	if lines := strings.Split(listing.String(), "\n"); len(lines) != 8 || lines[3] != "00005: JUMPI" {
+		t.Errorf("listing mismatch:\n%s", listing.String())
+	}
+	if err := c.WriteListing(&listing, common.Hash{}); err == nil {
+		t.Errorf("listing of unknown code succeeded")
+	}
+}
+
+func TestSourceCoverage(t *testing.T) {
+	m := newBranchSourceMap(t)
+	c := New(Config{SourceMap: func(codeHash common.Hash, code []byte) *sourcemap.SourceMap {
+		if codeHash == branchHash {
+			return m
+		}
+		return nil
+	}})
+	cover(t, c, common.LeftPadBytes([]byte{1}, 32), nil, nil)
+
+	var lcov bytes.Buffer
+	if err := c.WriteSourceLCOV(&lcov); err != nil {
+		t.Fatalf("failed to write lcov: %v", err)
+	}
+	// Line 3 runs three times and branches both ways, the return once
+	want := "TN:\nSF:Branch.sol\n" +
+		"BRDA:3,0,0,1\nBRDA:3,0,1,2\n" +
+		"DA:3,3\nDA:4,1\n" +
+		"BRF:2\nBRH:2\nLF:2\nLH:2\nend_of_record\n"
+	if lcov.String() != want {
+		t.Errorf("lcov mismatch:\nhave\n%s\nwant\n%s", lcov.String(), want)
+	}
+}
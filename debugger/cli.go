@@ -0,0 +1,226 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const cliHelp = `Commands:
+  s, step              execute the next instruction, entering calls
+  n, next              execute the next instruction, stepping over calls
+  o, out               run until the current call frame returns
+  c, continue          run until a breakpoint is hit or an instruction fails
+  b, break <cond>...   add a breakpoint on all of pc <n>, op <name>,
+                       addr <address> and slot <hash>
+  d, delete <id>       remove a breakpoint
+  breakpoints          list the breakpoints
+  stack                print the stack, its top first
+  mem, memory          print the memory
+  storage <slot>       print a storage slot of the executing contract
+  ret, returndata      print the return data of the last call
+  gas                  print the gas left
+  q, quit              abort the execution
+  h, help              print this help`
+
+// RunCLI controls the execution from commands read line by line from in,
+// writing the execution state to out, until the execution ends. The reader
+// ending aborts the execution.
+func (d *Debugger) RunCLI(in io.Reader, out io.Writer) error {
+	printStop(out, d.Wait())
+
+	scanner := bufio.NewScanner(in)
+	for d.last.Reason != StopDone {
+		fmt.Fprint(out, "(evm) ")
+		if !scanner.Scan() {
+			printStop(out, d.Abort())
+			break
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := d.runCommand(out, fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// runCommand executes a command of the CLI.
+func (d *Debugger) runCommand(out io.Writer, cmd string, args []string) error {
+	switch cmd {
+	case "s", "step":
+		printStop(out, d.Step())
+	case "n", "next":
+		printStop(out, d.StepOver())
+	case "o", "out":
+		printStop(out, d.StepOut())
+	case "c", "continue":
+		printStop(out, d.Continue())
+	case "q", "quit":
+		printStop(out, d.Abort())
+
+	case "b", "break":
+		b, err := parseBreakpoint(args)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "breakpoint %d\n", d.AddBreakpoint(b))
+	case "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete <id>")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil || !d.RemoveBreakpoint(id) {
+			return fmt.Errorf("unknown breakpoint %s", args[0])
+		}
+	case "breakpoints":
+		breakpoints := d.Breakpoints()
+		ids := make([]int, 0, len(breakpoints))
+		for id := range breakpoints {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			b := breakpoints[id]
+			fmt.Fprintf(out, "%d: %s\n", id, describeBreakpoint(&b))
+		}
+
+	case "stack":
+		stack := d.Stack()
+		for i := len(stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(out, "%3d: %#x\n", len(stack)-1-i, stack[i].ToBig())
+		}
+	case "mem", "memory":
+		mem := d.Memory()
+		for i := 0; i < len(mem); i += 32 {
+			fmt.Fprintf(out, "%#06x: %x\n", i, mem[i:i+32])
+		}
+	case "storage":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: storage <slot>")
+		}
+		slot, err := parseHash(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", d.Storage(slot).Hex())
+	case "ret", "returndata":
+		fmt.Fprintf(out, "%x\n", d.ReturnData())
+	case "gas":
+		fmt.Fprintf(out, "%d\n", d.last.Gas)
+	case "h", "help":
+		fmt.Fprintln(out, cliHelp)
+	default:
+		return fmt.Errorf("unknown command %q, see help", cmd)
+	}
+	return nil
+}
+
+// printStop prints where the execution paused, or how it ended.
+func printStop(out io.Writer, stop *Stop) {
+	switch stop.Reason {
+	case StopDone:
+		if stop.Err != nil {
+			fmt.Fprintf(out, "execution failed: %v\n", stop.Err)
+		} else {
+			fmt.Fprintf(out, "execution done, output %x\n", stop.Output)
+		}
+		return
+	case StopBreakpoint:
+		fmt.Fprintf(out, "breakpoint %d: ", stop.Breakpoint)
+	case StopFault:
+		fmt.Fprintf(out, "fault %v: ", stop.Err)
+	}
+	fmt.Fprintf(out, "%s pc %d %v (gas %d, cost %d, depth %d)\n", stop.Address.Hex(), stop.PC, stop.Op, stop.Gas, stop.Cost, stop.Depth)
+}
+
+// parseBreakpoint parses the conditions of a breakpoint, pairs of pc, op,
+// addr or slot and their value.
+func parseBreakpoint(args []string) (Breakpoint, error) {
+	var b Breakpoint
+	if len(args) == 0 || len(args)%2 != 0 {
+		return b, fmt.Errorf("usage: break [pc <n>] [op <name>] [addr <address>] [slot <hash>]")
+	}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch args[i] {
+		case "pc":
+			pc, err := strconv.ParseUint(value, 0, 64)
+			if err != nil {
+				return b, fmt.Errorf("invalid pc %q", value)
+			}
+			b.PC = &pc
+		case "op":
+			op := evm.StringToOp(strings.ToUpper(value))
+			if op.String() != strings.ToUpper(value) {
+				return b, fmt.Errorf("unknown opcode %q", value)
+			}
+			b.Op = &op
+		case "addr":
+			if hex := trimHex(value); len(hex) != 2*common.AddressLength || !isHex(hex) {
+				return b, fmt.Errorf("invalid address %q", value)
+			}
+			address := common.HexToAddress(value)
+			b.Address = &address
+		case "slot":
+			slot, err := parseHash(value)
+			if err != nil {
+				return b, err
+			}
+			b.Slot = &slot
+		default:
+			return b, fmt.Errorf("unknown breakpoint condition %q", args[i])
+		}
+	}
+	return b, nil
+}
+
+// parseHash parses a storage slot, a hex number of up to 32 bytes.
+func parseHash(s string) (common.Hash, error) {
+	hex := trimHex(s)
+	if len(hex) == 0 || len(hex) > 2*common.HashLength || !isHex(hex) {
+		return common.Hash{}, fmt.Errorf("invalid slot %q", s)
+	}
+	if len(hex)%2 != 0 {
+		hex = "0" + hex
+	}
+	return common.BytesToHash(common.Hex2Bytes(hex)), nil
+}
+
+func trimHex(s string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeBreakpoint renders the conditions of a breakpoint.
+func describeBreakpoint(b *Breakpoint) string {
+	var conds []string
+	if b.Address != nil {
+		conds = append(conds, "addr "+b.Address.Hex())
+	}
+	if b.PC != nil {
+		conds = append(conds, fmt.Sprintf("pc %d", *b.PC))
+	}
+	if b.Op != nil {
+		conds = append(conds, "op "+b.Op.String())
+	}
+	if b.Slot != nil {
+		conds = append(conds, "slot "+b.Slot.Hex())
+	}
+	return strings.Join(conds, " ")
+}
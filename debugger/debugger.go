@@ -0,0 +1,360 @@
+// Package debugger implements an interactive step debugger for the EVM
+// interpreter, pausing the execution between instructions.
+package debugger
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/holiman/uint256"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// StopReason is the reason the execution paused.
+type StopReason int
+
+const (
+	StopEntry      StopReason = iota // Paused on the first instruction
+	StopStep                         // A step completed
+	StopBreakpoint                   // A breakpoint was hit
+	StopFault                        // An instruction failed
+	StopDone                         // The execution ended
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopEntry:
+		return "entry"
+	case StopStep:
+		return "step"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopFault:
+		return "fault"
+	case StopDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Stop describes where the execution paused, or how it ended. The
+// instruction the execution paused on is not executed yet, except for
+// faults.
+type Stop struct {
+	Reason     StopReason
+	Breakpoint int // Breakpoint hit, if stopped at one
+
+	Address common.Address // Contract executing the instruction
+	PC      uint64
+	Op      evm.OpCode
+	Gas     uint64 // Gas left before the instruction
+	Cost    uint64 // Gas cost of the instruction
+	Depth   int
+
+	Output []byte // Output of the execution, once done
+	Err    error  // Fault of the instruction, or error of the execution once done
+}
+
+// Breakpoint pauses the execution on the instructions matching all of its
+// set conditions. Breakpoints on an address alone pause on entering the
+// call frames executing the contract.
+type Breakpoint struct {
+	Address *common.Address // Contract executing the instruction
+	PC      *uint64
+	Op      *evm.OpCode
+	Slot    *common.Hash // Storage slot read by SLOAD or written by SSTORE
+}
+
+// matches reports whether the breakpoint matches an instruction.
+func (b *Breakpoint) matches(pc uint64, op evm.OpCode, scope *evm.ScopeContext, entered bool) bool {
+	if b.Address != nil && *b.Address != scope.Contract.Address() {
+		return false
+	}
+	if b.PC == nil && b.Op == nil && b.Slot == nil && !entered {
+		return false
+	}
+	if b.PC != nil && *b.PC != pc {
+		return false
+	}
+	if b.Op != nil && *b.Op != op {
+		return false
+	}
+	if b.Slot != nil {
+		if op != evm.SLOAD && op != evm.SSTORE || len(scope.Stack.Data()) == 0 {
+			return false
+		}
+		if slot := scope.Stack.Back(0).Bytes32(); common.Hash(slot) != *b.Slot {
+			return false
+		}
+	}
+	return true
+}
+
+// Inspector inspects the state of an execution at an instruction, paused
+// in a live session or replayed from a recording.
+type Inspector interface {
+	// Current returns the instruction inspected.
+	Current() *Stop
+	// Stack returns a copy of the stack of the call frame, its top last.
+	Stack() []uint256.Int
+	// Memory returns a copy of the memory of the call frame.
+	Memory() []byte
+	// ReturnData returns a copy of the return data of the last call of the
+	// call frame.
+	ReturnData() []byte
+	// Storage returns the value of a storage slot of the contract executing
+	// the call frame.
+	Storage(slot common.Hash) common.Hash
+}
+
+// mode is the way an execution is resumed.
+type mode int
+
+const (
+	modeStep     mode = iota // Pause on the next instruction
+	modeOver                 // Pause on the next instruction of the frame or its callers
+	modeOut                  // Pause on the next instruction of a caller
+	modeContinue             // Pause on breakpoints and faults only
+	modeDetach               // Never pause
+)
+
+// Debugger is an EVMLogger pausing the execution it traces between
+// instructions, for it to be stepped through and inspected from another
+// goroutine. The execution pauses on its first instruction, it blocks until
+// resumed by one of Step, StepOver, StepOut or Continue.
+//
+// The debugger must be set as tracer of the EVM with debugging enabled. The
+// execution state is only to be inspected while paused.
+type Debugger struct {
+	env    *evm.EVM
+	stops  chan *Stop
+	resume chan mode
+
+	// State of the execution, owned by the EVM while running and by the
+	// controller while paused
+	mode    mode
+	depth   int  // Depth the execution was resumed at
+	entered bool // Whether a call frame was entered since the last instruction
+	scope   *evm.ScopeContext
+	rData   []byte
+	last    *Stop
+
+	lock        sync.Mutex
+	breakpoints map[int]*Breakpoint
+	nextID      int
+}
+
+// New returns a debugger pausing on the first instruction of the execution.
+func New() *Debugger {
+	return &Debugger{
+		stops:       make(chan *Stop),
+		resume:      make(chan mode),
+		breakpoints: make(map[int]*Breakpoint),
+		nextID:      1,
+	}
+}
+
+// AddBreakpoint adds a breakpoint and returns its ID.
+func (d *Debugger) AddBreakpoint(b Breakpoint) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	id := d.nextID
+	d.nextID++
+	d.breakpoints[id] = &b
+	return id
+}
+
+// RemoveBreakpoint removes a breakpoint, reporting whether it existed.
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	_, ok := d.breakpoints[id]
+	delete(d.breakpoints, id)
+	return ok
+}
+
+// Breakpoints returns the breakpoints by ID.
+func (d *Debugger) Breakpoints() map[int]Breakpoint {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	breakpoints := make(map[int]Breakpoint, len(d.breakpoints))
+	for id, b := range d.breakpoints {
+		breakpoints[id] = *b
+	}
+	return breakpoints
+}
+
+// breakpoint returns the ID of the first breakpoint matching an instruction,
+// zero if none.
+func (d *Debugger) breakpoint(pc uint64, op evm.OpCode, scope *evm.ScopeContext, entered bool) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	found := 0
+	for id, b := range d.breakpoints {
+		if (found == 0 || id < found) && b.matches(pc, op, scope, entered) {
+			found = id
+		}
+	}
+	return found
+}
+
+// Wait blocks until the execution pauses or ends, and returns where.
+func (d *Debugger) Wait() *Stop {
+	d.last = <-d.stops
+	return d.last
+}
+
+// Step resumes the execution until the next instruction, entering calls.
+func (d *Debugger) Step() *Stop {
+	return d.resumeWith(modeStep)
+}
+
+// StepOver resumes the execution until the next instruction of the current
+// call frame, stepping over calls, or of its caller once it returns.
+func (d *Debugger) StepOver() *Stop {
+	return d.resumeWith(modeOver)
+}
+
+// StepOut resumes the execution until the current call frame returns to its
+// caller.
+func (d *Debugger) StepOut() *Stop {
+	return d.resumeWith(modeOut)
+}
+
+// Continue resumes the execution until a breakpoint is hit or an
+// instruction fails.
+func (d *Debugger) Continue() *Stop {
+	return d.resumeWith(modeContinue)
+}
+
+// Abort cancels the execution, which ends without pausing again.
+func (d *Debugger) Abort() *Stop {
+	if d.env != nil {
+		d.env.Cancel()
+	}
+	return d.resumeWith(modeDetach)
+}
+
+// resumeWith resumes the paused execution and waits for it to pause again.
+// The stop it ended with is returned if the execution is over.
+func (d *Debugger) resumeWith(m mode) *Stop {
+	if d.last == nil || d.last.Reason == StopDone {
+		return d.last
+	}
+	d.resume <- m
+	return d.Wait()
+}
+
+// Current returns where the execution paused, or how it ended.
+func (d *Debugger) Current() *Stop {
+	return d.last
+}
+
+// Stack returns a copy of the stack of the paused call frame, its top last.
+func (d *Debugger) Stack() []uint256.Int {
+	if !d.paused() {
+		return nil
+	}
+	return append([]uint256.Int(nil), d.scope.Stack.Data()...)
+}
+
+// Memory returns a copy of the memory of the paused call frame.
+func (d *Debugger) Memory() []byte {
+	if !d.paused() {
+		return nil
+	}
+	return common.CopyBytes(d.scope.Memory.Data())
+}
+
+// ReturnData returns a copy of the return data of the last call of the
+// paused call frame.
+func (d *Debugger) ReturnData() []byte {
+	if !d.paused() {
+		return nil
+	}
+	return common.CopyBytes(d.rData)
+}
+
+// Storage returns the value of a storage slot of the contract executing
+// the paused call frame.
+func (d *Debugger) Storage(slot common.Hash) common.Hash {
+	if !d.paused() {
+		return common.Hash{}
+	}
+	return d.env.StateDB.GetState(d.scope.Contract.Address(), slot)
+}
+
+func (d *Debugger) paused() bool {
+	return d.last != nil && d.last.Reason != StopDone && d.scope != nil
+}
+
+// pause hands the paused execution over to the controller, and blocks
+// until it's resumed.
+func (d *Debugger) pause(stop *Stop, scope *evm.ScopeContext, rData []byte) {
+	d.scope, d.rData = scope, rData
+	d.stops <- stop
+	d.mode = <-d.resume
+	d.depth = stop.Depth
+	d.scope, d.rData = nil, nil
+}
+
+func (d *Debugger) CaptureTxStart(gasLimit uint64) {}
+
+func (d *Debugger) CaptureTxEnd(restGas uint64) {}
+
+func (d *Debugger) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	d.env = env
+	d.mode = modeStep
+	d.depth = 0
+}
+
+func (d *Debugger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	d.stops <- &Stop{Reason: StopDone, Output: common.CopyBytes(output), Err: err}
+}
+
+func (d *Debugger) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	d.entered = true
+}
+
+func (d *Debugger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (d *Debugger) CaptureState(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		d.CaptureFault(pc, op, gas, cost, scope, depth, err)
+		return
+	}
+	entered := d.entered
+	d.entered = false
+
+	stop := &Stop{Address: scope.Contract.Address(), PC: pc, Op: op, Gas: gas, Cost: cost, Depth: depth}
+	switch {
+	case d.mode == modeDetach:
+		return
+	case d.depth == 0:
+		stop.Reason = StopEntry
+	default:
+		if stop.Breakpoint = d.breakpoint(pc, op, scope, entered); stop.Breakpoint != 0 {
+			stop.Reason = StopBreakpoint
+			break
+		}
+		stop.Reason = StopStep
+		if d.mode == modeContinue || (d.mode == modeOver && depth > d.depth) || (d.mode == modeOut && depth >= d.depth) {
+			return
+		}
+	}
+	d.pause(stop, scope, rData)
+}
+
+func (d *Debugger) CaptureFault(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, depth int, err error) {
+	if d.mode == modeDetach || errors.Is(err, evm.ErrExecutionReverted) {
+		return
+	}
+	stop := &Stop{Reason: StopFault, Address: scope.Contract.Address(), PC: pc, Op: op, Gas: gas, Cost: cost, Depth: depth, Err: err}
+	d.pause(stop, scope, nil)
+}
@@ -0,0 +1,217 @@
+package debugger
+
+import (
+	"bytes"
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/runtime"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+var (
+	callee = common.BytesToAddress([]byte("callee"))
+
+	// sstore(0, 42), call(0xffff, callee, 0, 0, 0, 0, 0), pop, stop. The
+	// call is at pc 39.
+	callerCode = common.Hex2Bytes("602a600055" + "60006000600060006000" + "73" + common.Bytes2Hex(callee[:]) + "61fffff1" + "5000")
+	// add(1, 1), pop, stop
+	calleeCode = common.Hex2Bytes("600160010150" + "00")
+)
+
+// debug executes the code with the debugger in the background, returning a
+// channel of the execution error.
+func debug(code []byte, d *Debugger) chan error {
+	statedb := state.New()
+	statedb.SetCode(callee, calleeCode)
+
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	cfg := &runtime.Config{
+		GasLimit:  100000,
+		State:     statedb,
+		EVMConfig: evm.EVMConfig{Debug: true, Tracer: d, JumpTable: &jt},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := runtime.Execute(code, nil, cfg)
+		done <- err
+	}()
+	return done
+}
+
+// checkStop checks where the execution paused.
+func checkStop(t *testing.T, stop *Stop, reason StopReason, pc uint64, op evm.OpCode, depth int) {
+	t.Helper()
+	if stop.Reason != reason || stop.PC != pc || stop.Op != op || stop.Depth != depth {
+		t.Fatalf("stop mismatch: have %v at pc %d %v depth %d, want %v at pc %d %v depth %d",
+			stop.Reason, stop.PC, stop.Op, stop.Depth, reason, pc, op, depth)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	d := New()
+	done := debug(callerCode, d)
+
+	checkStop(t, d.Wait(), StopEntry, 0, evm.PUSH1, 1)
+	d.Step()
+	checkStop(t, d.Step(), StopStep, 4, evm.SSTORE, 1)
+	if stack := d.Stack(); len(stack) != 2 || stack[0].Uint64() != 42 || stack[1].Uint64() != 0 {
+		t.Errorf("stack mismatch: %v", stack)
+	}
+
+	call := evm.CALL
+	d.AddBreakpoint(Breakpoint{Op: &call})
+	stop := d.Continue()
+	checkStop(t, stop, StopBreakpoint, 39, evm.CALL, 1)
+	if stop.Breakpoint != 1 || stop.Gas == 0 {
+		t.Errorf("breakpoint mismatch: %+v", stop)
+	}
+	if have := d.Storage(common.Hash{}); have != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("storage mismatch: %x", have)
+	}
+
+	// Stepping into the call and out of it
+	stop = d.Step()
+	checkStop(t, stop, StopStep, 0, evm.PUSH1, 2)
+	if stop.Address != callee {
+		t.Errorf("address mismatch: %x", stop.Address)
+	}
+	checkStop(t, d.Step(), StopStep, 2, evm.PUSH1, 2)
+	checkStop(t, d.StepOut(), StopStep, 40, evm.POP, 1)
+
+	stop = d.Continue()
+	if stop.Reason != StopDone || stop.Err != nil {
+		t.Fatalf("execution result mismatch: %+v", stop)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	// The execution is over
+	if stop := d.Step(); stop.Reason != StopDone {
+		t.Errorf("stepping ended execution: %+v", stop)
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	d := New()
+	done := debug(callerCode, d)
+
+	pc := uint64(39)
+	d.AddBreakpoint(Breakpoint{PC: &pc})
+	d.Wait()
+	checkStop(t, d.Continue(), StopBreakpoint, 39, evm.CALL, 1)
+	checkStop(t, d.StepOver(), StopStep, 40, evm.POP, 1)
+	d.Continue()
+	if err := <-done; err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := New()
+	done := debug(callerCode, d)
+
+	var (
+		slot     = common.Hash{}
+		other    = common.BigToHash(big.NewInt(1))
+		contract = callee
+	)
+	d.AddBreakpoint(Breakpoint{Slot: &other})
+	d.AddBreakpoint(Breakpoint{Slot: &slot})
+	d.AddBreakpoint(Breakpoint{Address: &contract})
+
+	d.Wait()
+	stop := d.Continue()
+	checkStop(t, stop, StopBreakpoint, 4, evm.SSTORE, 1)
+	if stop.Breakpoint != 2 {
+		t.Errorf("breakpoint mismatch: have %d, want 2", stop.Breakpoint)
+	}
+	// Address breakpoints pause on entering the contract only
+	stop = d.Continue()
+	checkStop(t, stop, StopBreakpoint, 0, evm.PUSH1, 2)
+	if stop.Breakpoint != 3 {
+		t.Errorf("breakpoint mismatch: have %d, want 3", stop.Breakpoint)
+	}
+	if !d.RemoveBreakpoint(3) || d.RemoveBreakpoint(3) || len(d.Breakpoints()) != 2 {
+		t.Errorf("breakpoint removal mismatch: %v", d.Breakpoints())
+	}
+	if stop := d.Continue(); stop.Reason != StopDone {
+		t.Errorf("execution result mismatch: %+v", stop)
+	}
+	<-done
+}
+
+func TestFault(t *testing.T) {
+	d := New()
+	// jump(4)
+	done := debug(common.Hex2Bytes("600456"), d)
+
+	d.Wait()
+	stop := d.Continue()
+	checkStop(t, stop, StopFault, 2, evm.JUMP, 1)
+	if stop.Err != evm.ErrInvalidJump {
+		t.Errorf("fault mismatch: %v", stop.Err)
+	}
+	if stop := d.Continue(); stop.Reason != StopDone || stop.Err != evm.ErrInvalidJump {
+		t.Errorf("execution result mismatch: %+v", stop)
+	}
+	if err := <-done; !errors.Is(err, evm.ErrInvalidJump) {
+		t.Errorf("execution error mismatch: %v", err)
+	}
+}
+
+func TestCLI(t *testing.T) {
+	d := New()
+	done := debug(callerCode, d)
+
+	var (
+		in  = strings.NewReader("s\nstack\nb op call\nbreak pc x\nbreakpoints\nc\nstorage 0\ns\no\ngas\nfoo\nc\n")
+		out = new(bytes.Buffer)
+	)
+	if err := d.RunCLI(in, out); err != nil {
+		t.Fatalf("cli failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	for _, want := range []string{
+		"pc 0 PUSH1 (gas 100000, cost 3, depth 1)",
+		"  0: 0x2a\n",
+		"breakpoint 1\n",
+		`error: invalid pc "x"`,
+		"1: op CALL\n",
+		"breakpoint 1: ",
+		"pc 39 CALL (gas",
+		"0x000000000000000000000000000000000000000000000000000000000000002a\n",
+		"pc 0 PUSH1 (gas",
+		"pc 40 POP",
+		`error: unknown command "foo"`,
+		"execution done, output \n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCLIQuit(t *testing.T) {
+	d := New()
+	// jumpdest, jump(0)
+	done := debug(common.Hex2Bytes("5b600056"), d)
+
+	out := new(bytes.Buffer)
+	if err := d.RunCLI(strings.NewReader("s\n"), out); err != nil {
+		t.Fatalf("cli failed: %v", err)
+	}
+	// Input ending aborts the endless loop
+	if err := <-done; !errors.Is(err, evm.ErrExecutionAborted) {
+		t.Errorf("execution error mismatch: %v", err)
+	}
+	if !strings.Contains(out.String(), "execution failed: execution aborted") {
+		t.Errorf("output mismatch:\n%s", out)
+	}
+}
@@ -0,0 +1,332 @@
+package debugger
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/holiman/uint256"
+	"math/big"
+	"time"
+)
+
+// memoryDelta is the change of the memory of a call frame since its
+// previous step.
+type memoryDelta struct {
+	size   int    // Size of the memory
+	offset int    // Offset of the changed range
+	data   []byte // Content of the changed range
+}
+
+// storageWrite is a write of a storage slot, or its restoration when the
+// call frame writing it failed.
+type storageWrite struct {
+	step    int // Step the write is visible from
+	address common.Address
+	slot    common.Hash
+	prev    common.Hash
+	value   common.Hash
+}
+
+// record is a recorded step of an execution.
+type record struct {
+	stop   Stop
+	prev   int // Previous step of the call frame, -1 if the first
+	stack  []uint256.Int
+	memory *memoryDelta // Memory change since the previous step, nil if none
+	rData  []byte       // Return data, shared with the previous steps if unchanged
+}
+
+// recordedFrame is a call frame being recorded.
+type recordedFrame struct {
+	last   int    // Last step of the frame
+	memory []byte // Memory as of the last step
+}
+
+// Recorder is an EVMLogger recording the steps of an execution, so that it
+// can be replayed backwards and forwards once finished, through the same
+// inspection API as a live session. Memory is recorded as the changes of
+// each step, storage as the writes of the execution.
+//
+// The recorder must be set as tracer of the EVM with debugging enabled. It
+// records the last top-level call or creation, and must only be replayed
+// once it ended.
+type Recorder struct {
+	env    *evm.EVM
+	steps  []record
+	writes []storageWrite
+	output []byte
+	err    error
+	pos    int
+
+	// State of the recording
+	frames []*recordedFrame // Call frames executing, by depth
+	calls  []int            // Writes before each call being executed
+	rData  []byte
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return new(Recorder)
+}
+
+// Len returns the number of steps recorded.
+func (r *Recorder) Len() int {
+	return len(r.steps)
+}
+
+// Result returns the output and error of the execution recorded.
+func (r *Recorder) Result() ([]byte, error) {
+	return r.output, r.err
+}
+
+// Position returns the index of the step replayed.
+func (r *Recorder) Position() int {
+	return r.pos
+}
+
+// Seek moves the replay to a step, and returns it. It returns nil if there
+// is no such step.
+func (r *Recorder) Seek(step int) *Stop {
+	if step < 0 || step >= len(r.steps) {
+		return nil
+	}
+	r.pos = step
+	return r.Current()
+}
+
+// Next moves the replay to the next step, and returns it. It returns nil at
+// the end of the execution.
+func (r *Recorder) Next() *Stop {
+	return r.Seek(r.pos + 1)
+}
+
+// Prev moves the replay to the previous step, and returns it. It returns nil
+// at the start of the execution.
+func (r *Recorder) Prev() *Stop {
+	return r.Seek(r.pos - 1)
+}
+
+// NextOver moves the replay to the next step of the current call frame or
+// of its callers, stepping over calls. It returns nil at the end of the
+// execution.
+func (r *Recorder) NextOver() *Stop {
+	return r.seekDepth(1)
+}
+
+// PrevOver moves the replay to the previous step of the current call frame
+// or of its callers, stepping back over calls. It returns nil at the start
+// of the execution.
+func (r *Recorder) PrevOver() *Stop {
+	return r.seekDepth(-1)
+}
+
+// seekDepth moves the replay in a direction to the closest step not deeper
+// than the current one.
+func (r *Recorder) seekDepth(dir int) *Stop {
+	if r.pos >= len(r.steps) {
+		return nil
+	}
+	depth := r.steps[r.pos].stop.Depth
+	for i := r.pos + dir; i >= 0 && i < len(r.steps); i += dir {
+		if r.steps[i].stop.Depth <= depth {
+			return r.Seek(i)
+		}
+	}
+	return nil
+}
+
+// Current returns the step replayed, nil if none was recorded.
+func (r *Recorder) Current() *Stop {
+	if r.pos >= len(r.steps) {
+		return nil
+	}
+	stop := r.steps[r.pos].stop
+	return &stop
+}
+
+// Stack returns a copy of the stack at the step replayed, its top last.
+func (r *Recorder) Stack() []uint256.Int {
+	if r.pos >= len(r.steps) {
+		return nil
+	}
+	return append([]uint256.Int(nil), r.steps[r.pos].stack...)
+}
+
+// Memory returns the memory at the step replayed, rebuilt from the changes
+// of the steps of its call frame.
+func (r *Recorder) Memory() []byte {
+	if r.pos >= len(r.steps) {
+		return nil
+	}
+	var deltas []*memoryDelta
+	for i := r.pos; i >= 0; i = r.steps[i].prev {
+		if delta := r.steps[i].memory; delta != nil {
+			deltas = append(deltas, delta)
+		}
+	}
+	var memory []byte
+	for i := len(deltas) - 1; i >= 0; i-- {
+		memory = applyDelta(memory, deltas[i])
+	}
+	return memory
+}
+
+// ReturnData returns a copy of the return data at the step replayed.
+func (r *Recorder) ReturnData() []byte {
+	if r.pos >= len(r.steps) {
+		return nil
+	}
+	return common.CopyBytes(r.steps[r.pos].rData)
+}
+
+// Storage returns the value of a storage slot of the contract executing the
+// step replayed, before its execution.
+func (r *Recorder) Storage(slot common.Hash) common.Hash {
+	if r.pos >= len(r.steps) {
+		return common.Hash{}
+	}
+	address := r.steps[r.pos].stop.Address
+
+	// The value is the last one written before the step, or the one the
+	// next write overwrote, or else the current one.
+	var next *storageWrite
+	for i := len(r.writes) - 1; i >= 0; i-- {
+		w := &r.writes[i]
+		if w.address != address || w.slot != slot {
+			continue
+		}
+		if w.step <= r.pos {
+			return w.value
+		}
+		next = w
+	}
+	if next != nil {
+		return next.prev
+	}
+	return r.env.StateDB.GetState(address, slot)
+}
+
+// applyDelta applies a memory change.
+func applyDelta(memory []byte, delta *memoryDelta) []byte {
+	if len(memory) < delta.size {
+		memory = append(memory, make([]byte, delta.size-len(memory))...)
+	}
+	copy(memory[delta.offset:], delta.data)
+	return memory
+}
+
+// diffMemory returns the change of a memory, nil if unchanged.
+func diffMemory(prev, memory []byte) *memoryDelta {
+	n := len(prev)
+	if len(memory) < n {
+		n = len(memory) // Memory doesn't shrink, but don't rely on it
+	}
+	start := 0
+	for start < n && prev[start] == memory[start] {
+		start++
+	}
+	if start == n && len(memory) == len(prev) {
+		return nil
+	}
+	end := n
+	for end > start && prev[end-1] == memory[end-1] {
+		end--
+	}
+	// Growth is zero-filled, only non-zero bytes need recording
+	tail := len(memory)
+	for tail > n && memory[tail-1] == 0 {
+		tail--
+	}
+	if tail > n {
+		end = tail
+	}
+	return &memoryDelta{size: len(memory), offset: start, data: common.CopyBytes(memory[start:end])}
+}
+
+func (r *Recorder) CaptureTxStart(gasLimit uint64) {}
+
+func (r *Recorder) CaptureTxEnd(restGas uint64) {}
+
+func (r *Recorder) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	*r = Recorder{env: env, calls: []int{0}}
+}
+
+func (r *Recorder) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	r.exit(err)
+	r.output, r.err = common.CopyBytes(output), err
+	r.frames, r.calls, r.rData = nil, nil, nil
+}
+
+func (r *Recorder) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	r.calls = append(r.calls, len(r.writes))
+}
+
+func (r *Recorder) CaptureExit(output []byte, gasUsed uint64, err error) {
+	r.exit(err)
+}
+
+// exit records the end of a call, restoring the slots it wrote if it
+// failed.
+func (r *Recorder) exit(err error) {
+	start := r.calls[len(r.calls)-1]
+	r.calls = r.calls[:len(r.calls)-1]
+	if err == nil {
+		return
+	}
+	for i := len(r.writes) - 1; i >= start; i-- {
+		w := r.writes[i]
+		r.writes = append(r.writes, storageWrite{step: len(r.steps), address: w.address, slot: w.slot, prev: w.value, value: w.prev})
+	}
+}
+
+func (r *Recorder) CaptureState(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, rData []byte, depth int, err error) {
+	reason := StopStep
+	if err != nil {
+		reason = StopFault
+	}
+	r.record(Stop{Reason: reason, Address: scope.Contract.Address(), PC: pc, Op: op, Gas: gas, Cost: cost, Depth: depth, Err: err}, scope, rData)
+}
+
+func (r *Recorder) CaptureFault(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, depth int, err error) {
+	r.record(Stop{Reason: StopFault, Address: scope.Contract.Address(), PC: pc, Op: op, Gas: gas, Cost: cost, Depth: depth, Err: err}, scope, r.rData)
+}
+
+// record records a step.
+func (r *Recorder) record(stop Stop, scope *evm.ScopeContext, rData []byte) {
+	// Frames are entered and left around the steps of their callers
+	for len(r.frames) > stop.Depth {
+		r.frames = r.frames[:len(r.frames)-1]
+	}
+	for len(r.frames) < stop.Depth {
+		r.frames = append(r.frames, &recordedFrame{last: -1})
+	}
+	frame := r.frames[len(r.frames)-1]
+
+	step := record{stop: stop, prev: frame.last}
+	step.stack = append([]uint256.Int(nil), scope.Stack.Data()...)
+	if delta := diffMemory(frame.memory, scope.Memory.Data()); delta != nil {
+		step.memory = delta
+		frame.memory = applyDelta(frame.memory, delta)
+	}
+	if !bytes.Equal(rData, r.rData) {
+		r.rData = common.CopyBytes(rData)
+	}
+	step.rData = r.rData
+
+	if stop.Op == evm.SSTORE && stop.Err == nil && len(step.stack) >= 2 {
+		var (
+			slot  = common.Hash(scope.Stack.Back(0).Bytes32())
+			value = common.Hash(scope.Stack.Back(1).Bytes32())
+		)
+		// The write is visible from the next step
+		r.writes = append(r.writes, storageWrite{
+			step:    len(r.steps) + 1,
+			address: stop.Address,
+			slot:    slot,
+			prev:    r.env.StateDB.GetState(stop.Address, slot),
+			value:   value,
+		})
+	}
+	frame.last = len(r.steps)
+	r.steps = append(r.steps, step)
+}
@@ -0,0 +1,143 @@
+package debugger
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/runtime"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+var (
+	_ Inspector = (*Debugger)(nil)
+	_ Inspector = (*Recorder)(nil)
+)
+
+var (
+	reverter = common.BytesToAddress([]byte("reverter"))
+
+	// mstore(0x20, 0xff), sstore(0, 42), delegatecall(0xffff, reverter, 0,
+	// 0, 0, 0), pop, stop. The call is at pc 42.
+	recordedCode = common.Hex2Bytes("60ff602052" + "602a600055" + "6000600060006000" + "73" + common.Bytes2Hex(reverter[:]) + "61fffff4" + "5000")
+	// sstore(0, 7), revert(0, 32)
+	reverterCode = common.Hex2Bytes("6007600055" + "60206000fd")
+)
+
+// findStep returns the first recorded step at a pc and depth.
+func findStep(t *testing.T, r *Recorder, pc uint64, depth int) int {
+	t.Helper()
+	for i := 0; i < r.Len(); i++ {
+		if stop := r.Seek(i); stop.PC == pc && stop.Depth == depth {
+			return i
+		}
+	}
+	t.Fatalf("no step at pc %d depth %d", pc, depth)
+	return 0
+}
+
+func TestRecorder(t *testing.T) {
+	statedb := state.New()
+	statedb.SetCode(reverter, reverterCode)
+
+	r := NewRecorder()
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	_, err := runtime.Execute(recordedCode, nil, &runtime.Config{
+		GasLimit:  100000,
+		State:     statedb,
+		EVMConfig: evm.EVMConfig{Debug: true, Tracer: r, JumpTable: &jt},
+	})
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	if _, err := r.Result(); err != nil || r.Len() == 0 {
+		t.Fatalf("recording mismatch: %d steps, %v", r.Len(), err)
+	}
+
+	// Stack and memory are replayed in both directions
+	mstore := findStep(t, r, 4, 1)
+	if stack := r.Stack(); len(stack) != 2 || stack[0].Uint64() != 0xff || stack[1].Uint64() != 0x20 {
+		t.Errorf("stack mismatch: %v", stack)
+	}
+	if memory := r.Memory(); len(memory) != 0 {
+		t.Errorf("memory before mstore mismatch: %x", memory)
+	}
+	r.Next()
+	memory := r.Memory()
+	if len(memory) != 64 || memory[63] != 0xff || !bytes.Equal(memory[:63], make([]byte, 63)) {
+		t.Errorf("memory after mstore mismatch: %x", memory)
+	}
+	if stop := r.Prev(); r.Position() != mstore || stop.Op != evm.MSTORE || len(r.Memory()) != 0 {
+		t.Errorf("stepping back mismatch: %+v", stop)
+	}
+
+	// Storage as of each step, writes of failed frames being reverted
+	slot := common.Hash{}
+	findStep(t, r, 9, 1)
+	if value := r.Storage(slot); value != (common.Hash{}) {
+		t.Errorf("storage before sstore mismatch: %x", value)
+	}
+	findStep(t, r, 10, 1)
+	if value := r.Storage(slot); value != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("storage after sstore mismatch: %x", value)
+	}
+	findStep(t, r, 5, 2)
+	if value := r.Storage(slot); value != common.BigToHash(big.NewInt(7)) {
+		t.Errorf("storage written by the call mismatch: %x", value)
+	}
+	if memory := r.Memory(); len(memory) != 0 {
+		t.Errorf("memory of the call mismatch: %x", memory)
+	}
+	pop := findStep(t, r, 43, 1)
+	if value := r.Storage(slot); value != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("storage after revert mismatch: %x", value)
+	}
+	if memory := r.Memory(); len(memory) != 64 || memory[63] != 0xff {
+		t.Errorf("memory after call mismatch: %x", memory)
+	}
+	if rData := r.ReturnData(); len(rData) != 32 {
+		t.Errorf("return data mismatch: %x", rData)
+	}
+
+	// Stepping over the call in both directions
+	call := findStep(t, r, 42, 1)
+	if stop := r.NextOver(); stop == nil || r.Position() != pop {
+		t.Errorf("step over mismatch: %+v", stop)
+	}
+	if stop := r.PrevOver(); stop == nil || r.Position() != call || stop.Op != evm.DELEGATECALL {
+		t.Errorf("step back over mismatch: %+v", stop)
+	}
+	r.Seek(0)
+	if r.Prev() != nil || r.Seek(r.Len()) != nil || r.Position() != 0 {
+		t.Errorf("seeking out of the recording")
+	}
+}
+
+func TestDiffMemory(t *testing.T) {
+	tests := []struct {
+		prev, memory []byte
+		delta        *memoryDelta
+	}{
+		{nil, nil, nil},
+		{[]byte{1, 2}, []byte{1, 2}, nil},
+		{[]byte{1, 2, 3, 4}, []byte{1, 5, 6, 4}, &memoryDelta{size: 4, offset: 1, data: []byte{5, 6}}},
+		{[]byte{1, 2}, []byte{1, 2, 0, 0}, &memoryDelta{size: 4, offset: 2, data: []byte{}}},
+		{[]byte{1, 2}, []byte{1, 2, 0, 3, 0}, &memoryDelta{size: 5, offset: 2, data: []byte{0, 3}}},
+		{[]byte{1, 2}, []byte{7, 2, 0, 3}, &memoryDelta{size: 4, offset: 0, data: []byte{7, 2, 0, 3}}},
+	}
+	for i, tt := range tests {
+		delta := diffMemory(tt.prev, tt.memory)
+		if (delta == nil) != (tt.delta == nil) || (delta != nil && (delta.size != tt.delta.size || delta.offset != tt.delta.offset || !bytes.Equal(delta.data, tt.delta.data))) {
+			t.Errorf("test %d: delta mismatch: have %+v, want %+v", i, delta, tt.delta)
+			continue
+		}
+		if delta == nil {
+			continue
+		}
+		if have := applyDelta(common.CopyBytes(tt.prev), delta); !bytes.Equal(have, tt.memory) {
+			t.Errorf("test %d: applied delta mismatch: have %x, want %x", i, have, tt.memory)
+		}
+	}
+}
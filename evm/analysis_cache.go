@@ -0,0 +1,153 @@
+package evm
+
+import (
+	"container/list"
+	"github.com/entropyio/go-evm/common"
+	"sync"
+)
+
+// defaultJumpDestCacheSize is the default memory allowance of the shared
+// JUMPDEST analysis cache, enough for a few thousand maximum sized contracts.
+const defaultJumpDestCacheSize = 16 * 1024 * 1024
+
+// cacheEntryOverhead approximates the memory used by a cache entry beyond its
+// value.
+const cacheEntryOverhead = 96
+
+// SharedJumpDestCache holds the JUMPDEST analyses of the contracts executed by
+// all EVMs of the process, so that hot contracts are only analysed once.
+var SharedJumpDestCache = NewJumpDestCache(defaultJumpDestCacheSize)
+
+// JumpDestCacheStats are the usage statistics of a JumpDestCache.
+type JumpDestCacheStats struct {
+	Hits    uint64 // Lookups which found an analysis
+	Misses  uint64 // Lookups which found none
+	Entries int    // Number of cached analyses
+	Size    int    // Approximate memory used by the cached analyses in bytes
+}
+
+// JumpDestCache is a concurrency-safe LRU cache of JUMPDEST analyses keyed by
+// code hash, bounded by the memory the analyses use. The cached analyses must
+// not be modified.
+type JumpDestCache struct {
+	cache *lruCache
+}
+
+// NewJumpDestCache returns a cache holding analyses using up to limit bytes.
+// A zero limit disables caching.
+func NewJumpDestCache(limit int) *JumpDestCache {
+	return &JumpDestCache{cache: newLRUCache(limit)}
+}
+
+// get returns the analysis of the code with the given hash, if cached.
+func (c *JumpDestCache) get(hash common.Hash) (bitvec, bool) {
+	if value, ok := c.cache.get(hash); ok {
+		return value.(bitvec), true
+	}
+	return nil, false
+}
+
+// add caches the analysis of the code with the given hash, evicting the least
+// recently used analyses if the cache is full.
+func (c *JumpDestCache) add(hash common.Hash, analysis bitvec) {
+	c.cache.add(hash, analysis, len(analysis))
+}
+
+// Resize changes the memory allowance of the cache, evicting analyses if it
+// shrinks. A zero limit disables caching.
+func (c *JumpDestCache) Resize(limit int) {
+	c.cache.resize(limit)
+}
+
+// Stats returns the usage statistics of the cache.
+func (c *JumpDestCache) Stats() JumpDestCacheStats {
+	return c.cache.stats()
+}
+
+// lruCache is a concurrency-safe LRU cache of values derived from code, keyed
+// by code hash and bounded by the memory the values use.
+type lruCache struct {
+	mu      sync.Mutex
+	limit   int
+	size    int
+	entries map[common.Hash]*list.Element
+	lru     *list.List // Most recently used first
+
+	hits, misses uint64
+}
+
+type lruEntry struct {
+	hash  common.Hash
+	value interface{}
+	size  int
+}
+
+func newLRUCache(limit int) *lruCache {
+	return &lruCache{
+		limit:   limit,
+		entries: make(map[common.Hash]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the value cached for the given hash, if any.
+func (c *lruCache) get(hash common.Hash) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// add caches a value of the given size in bytes, evicting the least recently
+// used values if the cache is full.
+func (c *lruCache) add(hash common.Hash, value interface{}, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[hash]; ok {
+		return
+	}
+	size += cacheEntryOverhead
+	if size > c.limit {
+		return
+	}
+	c.entries[hash] = c.lru.PushFront(&lruEntry{hash: hash, value: value, size: size})
+	c.size += size
+	c.evict()
+}
+
+// evict drops the least recently used values until the cache fits its limit.
+func (c *lruCache) evict() {
+	for c.size > c.limit {
+		entry := c.lru.Remove(c.lru.Back()).(*lruEntry)
+		delete(c.entries, entry.hash)
+		c.size -= entry.size
+	}
+}
+
+func (c *lruCache) resize(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.limit = limit
+	c.evict()
+}
+
+func (c *lruCache) stats() JumpDestCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return JumpDestCacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: len(c.entries),
+		Size:    c.size,
+	}
+}
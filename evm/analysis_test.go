@@ -1,8 +1,13 @@
 package evm
 
 import (
+	"github.com/entropyio/go-evm/common"
 	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/config"
+	"github.com/holiman/uint256"
+	"math/big"
 	"math/bits"
+	"sync"
 	"testing"
 )
 
@@ -90,3 +95,94 @@ func BenchmarkJumpdestOpAnalysis(bench *testing.B) {
 	op = STOP
 	bench.Run(op.String(), bencher)
 }
+
+func TestJumpDestCache(t *testing.T) {
+	var (
+		hashes = []common.Hash{{1}, {2}, {3}}
+		bitmap = make(bitvec, 100)
+		cache  = NewJumpDestCache(2 * (len(bitmap) + cacheEntryOverhead))
+	)
+	cache.add(hashes[0], bitmap)
+	cache.add(hashes[1], bitmap)
+	if _, ok := cache.get(hashes[0]); !ok {
+		t.Fatalf("analysis missing")
+	}
+	// The least recently used analysis is evicted
+	cache.add(hashes[2], bitmap)
+	if _, ok := cache.get(hashes[1]); ok {
+		t.Errorf("least recently used analysis not evicted")
+	}
+	if _, ok := cache.get(hashes[0]); !ok {
+		t.Errorf("recently used analysis evicted")
+	}
+	want := JumpDestCacheStats{Hits: 2, Misses: 1, Entries: 2, Size: 2 * (len(bitmap) + cacheEntryOverhead)}
+	if stats := cache.Stats(); stats != want {
+		t.Errorf("stats mismatch: have %+v, want %+v", stats, want)
+	}
+	// Shrinking evicts, a zero limit disables the cache
+	cache.Resize(0)
+	cache.add(hashes[1], bitmap)
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Size != 0 {
+		t.Errorf("disabled cache not empty: %+v", stats)
+	}
+}
+
+func TestJumpDestCacheSharing(t *testing.T) {
+	var (
+		code = []byte{byte(PUSH1), byte(JUMPDEST), byte(JUMPDEST)}
+		hash = crypto.Keccak256Hash(code)
+		addr = common.BytesToAddress([]byte("contract"))
+	)
+	// Contracts in unrelated contexts share the analysis, concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+			contract.SetCallCode(&addr, hash, code)
+			if contract.validJumpdest(uint256.NewInt(1)) || !contract.validJumpdest(uint256.NewInt(2)) {
+				t.Errorf("jumpdest analysis mismatch")
+			}
+		}()
+	}
+	wg.Wait()
+
+	before := SharedJumpDestCache.Stats()
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+	contract.SetCallCode(&addr, hash, code)
+	if contract.analysis == nil {
+		t.Fatalf("analysis not loaded from the shared cache")
+	}
+	if after := SharedJumpDestCache.Stats(); after.Hits != before.Hits+1 {
+		t.Errorf("hits mismatch: have %d, want %d", after.Hits, before.Hits+1)
+	}
+}
+
+// BenchmarkJumpdestRepeatedCalls measures the JUMPDEST validation of a hot
+// contract called once per transaction, with and without the shared cache.
+func BenchmarkJumpdestRepeatedCalls(bench *testing.B) {
+	code := make([]byte, config.MaxCodeSize)
+	for i := range code {
+		code[i] = byte(i)
+	}
+	code[len(code)-1] = byte(JUMPDEST)
+
+	var (
+		hash = crypto.Keccak256Hash(code)
+		addr = common.BytesToAddress([]byte("contract"))
+		dest = uint256.NewInt(uint64(len(code) - 1))
+	)
+	bencher := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+			contract.SetCallCode(&addr, hash, code)
+			contract.validJumpdest(dest)
+		}
+	}
+	bench.Run("cached", bencher)
+
+	SharedJumpDestCache.Resize(0)
+	defer SharedJumpDestCache.Resize(defaultJumpDestCacheSize)
+	bench.Run("uncached", bencher)
+}
@@ -41,6 +41,11 @@ type Contract struct {
 	CodeAddr *common.Address
 	Input    []byte
 
+	// Container is the parsed EOF container of the code, nil for legacy code.
+	// While executing a container, Code holds the current code section.
+	Container   *Container
+	CodeSection uint64
+
 	Gas   uint64
 	value *big.Int
 }
@@ -93,10 +98,11 @@ func (c *Contract) isCode(udest uint64) bool {
 		// Does parent context have the analysis?
 		analysis, exist := c.jumpdests[c.CodeHash]
 		if !exist {
-			// Do the analysis and save in parent context
+			// Do the analysis and save in parent context and the shared cache
 			// We do not need to store it in c.analysis
 			analysis = codeBitmap(c.Code)
 			c.jumpdests[c.CodeHash] = analysis
+			SharedJumpDestCache.add(c.CodeHash, analysis)
 		}
 		// Also stash it in current contract for faster access
 		c.analysis = analysis
@@ -166,6 +172,21 @@ func (c *Contract) SetCallCode(addr *common.Address, hash common.Hash, code []by
 	c.Code = code
 	c.CodeHash = hash
 	c.CodeAddr = addr
+	c.loadAnalysis()
+}
+
+// setContainer attaches a parsed EOF container to the contract and switches
+// execution to its first code section.
+func (c *Contract) setContainer(container *Container) {
+	c.Container = container
+	c.setCodeSection(0)
+}
+
+// setCodeSection switches execution to the given code section of the EOF
+// container.
+func (c *Contract) setCodeSection(section uint64) {
+	c.CodeSection = section
+	c.Code = c.Container.codeSections[section]
 }
 
 // SetCodeOptionalHash can be used to provide code, but it's optional to provide hash.
@@ -174,4 +195,24 @@ func (c *Contract) SetCodeOptionalHash(addr *common.Address, codeAndHash *codeAn
 	c.Code = codeAndHash.code
 	c.CodeHash = codeAndHash.hash
 	c.CodeAddr = addr
+	c.loadAnalysis()
+}
+
+// loadAnalysis picks up the JUMPDEST analysis of the code from the parent
+// context or the shared cache, if the code has a hash and was analysed before.
+func (c *Contract) loadAnalysis() {
+	c.analysis = nil
+	if c.CodeHash == (common.Hash{}) {
+		return
+	}
+	if analysis, ok := c.jumpdests[c.CodeHash]; ok {
+		c.analysis = analysis
+		return
+	}
+	if analysis, ok := SharedJumpDestCache.get(c.CodeHash); ok {
+		c.analysis = analysis
+		if c.jumpdests != nil {
+			c.jumpdests[c.CodeHash] = analysis
+		}
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/entropyio/go-evm/common/crypto/blake2b"
 	"github.com/entropyio/go-evm/common/crypto/bls12381"
 	"github.com/entropyio/go-evm/common/crypto/bn256"
+	"github.com/entropyio/go-evm/common/crypto/secp256r1"
 	"github.com/entropyio/go-evm/common/mathutil"
 	"github.com/entropyio/go-evm/config"
 	"golang.org/x/crypto/ripemd160"
@@ -26,21 +27,80 @@ type PrecompiledContract interface {
 
 // PrecompiledContractsHomestead contains the default set of pre-compiled Entropy
 // contracts used in the Frontier and Homestead releases.
-var PrecompiledContractsHomestead = map[common.Address]PrecompiledContract{
-	common.BytesToAddress([]byte{1}): &ecrecover{},
-	common.BytesToAddress([]byte{2}): &sha256hash{},
-	common.BytesToAddress([]byte{3}): &ripemd160hash{},
-	common.BytesToAddress([]byte{4}): &dataCopy{},
-}
+var PrecompiledContractsHomestead = precompiledContractsHomestead(nil)
+
+// PrecompiledContractsP256Verify contains the default set of pre-compiled
+// Entropy contracts extended with the RIP-7212 secp256r1 signature verifier,
+// used by chains opting into it.
+var PrecompiledContractsP256Verify = precompiledContractsP256Verify(nil)
 
 var (
-	PrecompiledAddressesHomestead []common.Address
+	PrecompiledAddressesHomestead  []common.Address
+	PrecompiledAddressesP256Verify []common.Address
 )
 
 func init() {
 	for k := range PrecompiledContractsHomestead {
 		PrecompiledAddressesHomestead = append(PrecompiledAddressesHomestead, k)
 	}
+	for k := range PrecompiledContractsP256Verify {
+		PrecompiledAddressesP256Verify = append(PrecompiledAddressesP256Verify, k)
+	}
+}
+
+// gasParams is embedded by the built-in precompiled contracts to price their
+// execution with the protocol parameters of a chain, the defaults if unset.
+type gasParams struct {
+	p *config.ProtocolParams
+}
+
+func (g gasParams) params() *config.ProtocolParams {
+	if g.p == nil {
+		return &config.DefaultProtocolParams
+	}
+	return g.p
+}
+
+func precompiledContractsHomestead(p *config.ProtocolParams) map[common.Address]PrecompiledContract {
+	return map[common.Address]PrecompiledContract{
+		common.BytesToAddress([]byte{1}): &ecrecover{gasParams{p}},
+		common.BytesToAddress([]byte{2}): &sha256hash{gasParams{p}},
+		common.BytesToAddress([]byte{3}): &ripemd160hash{gasParams{p}},
+		common.BytesToAddress([]byte{4}): &dataCopy{gasParams{p}},
+	}
+}
+
+func precompiledContractsP256Verify(p *config.ProtocolParams) map[common.Address]PrecompiledContract {
+	contracts := precompiledContractsHomestead(p)
+	contracts[common.BytesToAddress([]byte{0x01, 0x00})] = &p256Verify{gasParams{p}}
+	return contracts
+}
+
+// activePrecompiledContracts returns the precompiled contracts enabled with
+// the given rules.
+func activePrecompiledContracts(rules config.Rules) map[common.Address]PrecompiledContract {
+	if rules.IsP256Verify {
+		return PrecompiledContractsP256Verify
+	}
+	return PrecompiledContractsHomestead
+}
+
+// newPrecompiledContracts returns a new set of the precompiled contracts
+// enabled with the given rules, priced with the given protocol parameters.
+func newPrecompiledContracts(rules config.Rules, p *config.ProtocolParams) map[common.Address]PrecompiledContract {
+	if rules.IsP256Verify {
+		return precompiledContractsP256Verify(p)
+	}
+	return precompiledContractsHomestead(p)
+}
+
+// ActivePrecompiles returns the addresses of the precompiled contracts
+// enabled with the given rules.
+func ActivePrecompiles(rules config.Rules) []common.Address {
+	if rules.IsP256Verify {
+		return PrecompiledAddressesP256Verify
+	}
+	return PrecompiledAddressesHomestead
 }
 
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
@@ -59,10 +119,10 @@ func RunPrecompiledContract(p PrecompiledContract, input []byte, suppliedGas uin
 }
 
 // ECRECOVER implemented as a native contract.
-type ecrecover struct{}
+type ecrecover struct{ gasParams }
 
 func (c *ecrecover) RequiredGas(input []byte) uint64 {
-	return config.EcrecoverGas
+	return c.params().EcrecoverGas
 }
 
 func (c *ecrecover) Run(input []byte) ([]byte, error) {
@@ -97,14 +157,14 @@ func (c *ecrecover) Run(input []byte) ([]byte, error) {
 }
 
 // SHA256 implemented as a native contract.
-type sha256hash struct{}
+type sha256hash struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
 func (c *sha256hash) RequiredGas(input []byte) uint64 {
-	return uint64(len(input)+31)/32*config.Sha256PerWordGas + config.Sha256BaseGas
+	return uint64(len(input)+31)/32*c.params().Sha256PerWordGas + c.params().Sha256BaseGas
 }
 func (c *sha256hash) Run(input []byte) ([]byte, error) {
 	h := sha256.Sum256(input)
@@ -112,14 +172,14 @@ func (c *sha256hash) Run(input []byte) ([]byte, error) {
 }
 
 // RIPEMD160 implemented as a native contract.
-type ripemd160hash struct{}
+type ripemd160hash struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
 func (c *ripemd160hash) RequiredGas(input []byte) uint64 {
-	return uint64(len(input)+31)/32*config.Ripemd160PerWordGas + config.Ripemd160BaseGas
+	return uint64(len(input)+31)/32*c.params().Ripemd160PerWordGas + c.params().Ripemd160BaseGas
 }
 func (c *ripemd160hash) Run(input []byte) ([]byte, error) {
 	ripemd := ripemd160.New()
@@ -128,17 +188,19 @@ func (c *ripemd160hash) Run(input []byte) ([]byte, error) {
 }
 
 // data copy implemented as a native contract.
-type dataCopy struct{}
+type dataCopy struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
 func (c *dataCopy) RequiredGas(input []byte) uint64 {
-	return uint64(len(input)+31)/32*config.IdentityPerWordGas + config.IdentityBaseGas
+	return uint64(len(input)+31)/32*c.params().IdentityPerWordGas + c.params().IdentityBaseGas
 }
 func (c *dataCopy) Run(in []byte) ([]byte, error) {
-	return in, nil
+	// The input may be the memory of the caller, which must not be aliased
+	// by the return data
+	return common.CopyBytes(in), nil
 }
 
 // bigModExp implements a native big integer exponential modular operation.
@@ -329,11 +391,11 @@ func runBn256Add(input []byte) ([]byte, error) {
 
 // bn256Add implements a native elliptic curve point addition conforming to
 // Istanbul consensus rules.
-type bn256AddIstanbul struct{}
+type bn256AddIstanbul struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256AddIstanbul) RequiredGas(input []byte) uint64 {
-	return config.Bn256AddGasIstanbul
+	return c.params().Bn256AddGasIstanbul
 }
 
 func (c *bn256AddIstanbul) Run(input []byte) ([]byte, error) {
@@ -342,11 +404,11 @@ func (c *bn256AddIstanbul) Run(input []byte) ([]byte, error) {
 
 // bn256AddByzantium implements a native elliptic curve point addition
 // conforming to Byzantium consensus rules.
-type bn256AddByzantium struct{}
+type bn256AddByzantium struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256AddByzantium) RequiredGas(input []byte) uint64 {
-	return config.Bn256AddGasByzantium
+	return c.params().Bn256AddGasByzantium
 }
 
 func (c *bn256AddByzantium) Run(input []byte) ([]byte, error) {
@@ -367,11 +429,11 @@ func runBn256ScalarMul(input []byte) ([]byte, error) {
 
 // bn256ScalarMulIstanbul implements a native elliptic curve scalar
 // multiplication conforming to Istanbul consensus rules.
-type bn256ScalarMulIstanbul struct{}
+type bn256ScalarMulIstanbul struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256ScalarMulIstanbul) RequiredGas(input []byte) uint64 {
-	return config.Bn256ScalarMulGasIstanbul
+	return c.params().Bn256ScalarMulGasIstanbul
 }
 
 func (c *bn256ScalarMulIstanbul) Run(input []byte) ([]byte, error) {
@@ -380,11 +442,11 @@ func (c *bn256ScalarMulIstanbul) Run(input []byte) ([]byte, error) {
 
 // bn256ScalarMulByzantium implements a native elliptic curve scalar
 // multiplication conforming to Byzantium consensus rules.
-type bn256ScalarMulByzantium struct{}
+type bn256ScalarMulByzantium struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256ScalarMulByzantium) RequiredGas(input []byte) uint64 {
-	return config.Bn256ScalarMulGasByzantium
+	return c.params().Bn256ScalarMulGasByzantium
 }
 
 func (c *bn256ScalarMulByzantium) Run(input []byte) ([]byte, error) {
@@ -435,11 +497,11 @@ func runBn256Pairing(input []byte) ([]byte, error) {
 
 // bn256PairingIstanbul implements a pairing pre-compile for the bn256 curve
 // conforming to Istanbul consensus rules.
-type bn256PairingIstanbul struct{}
+type bn256PairingIstanbul struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256PairingIstanbul) RequiredGas(input []byte) uint64 {
-	return config.Bn256PairingBaseGasIstanbul + uint64(len(input)/192)*config.Bn256PairingPerPointGasIstanbul
+	return c.params().Bn256PairingBaseGasIstanbul + uint64(len(input)/192)*c.params().Bn256PairingPerPointGasIstanbul
 }
 
 func (c *bn256PairingIstanbul) Run(input []byte) ([]byte, error) {
@@ -448,11 +510,11 @@ func (c *bn256PairingIstanbul) Run(input []byte) ([]byte, error) {
 
 // bn256PairingByzantium implements a pairing pre-compile for the bn256 curve
 // conforming to Byzantium consensus rules.
-type bn256PairingByzantium struct{}
+type bn256PairingByzantium struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bn256PairingByzantium) RequiredGas(input []byte) uint64 {
-	return config.Bn256PairingBaseGasByzantium + uint64(len(input)/192)*config.Bn256PairingPerPointGasByzantium
+	return c.params().Bn256PairingBaseGasByzantium + uint64(len(input)/192)*c.params().Bn256PairingPerPointGasByzantium
 }
 
 func (c *bn256PairingByzantium) Run(input []byte) ([]byte, error) {
@@ -528,11 +590,11 @@ var (
 )
 
 // bls12381G1Add implements EIP-2537 G1Add precompile.
-type bls12381G1Add struct{}
+type bls12381G1Add struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G1Add) RequiredGas(input []byte) uint64 {
-	return config.Bls12381G1AddGas
+	return c.params().Bls12381G1AddGas
 }
 
 func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
@@ -566,11 +628,11 @@ func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381G1Mul implements EIP-2537 G1Mul precompile.
-type bls12381G1Mul struct{}
+type bls12381G1Mul struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G1Mul) RequiredGas(input []byte) uint64 {
-	return config.Bls12381G1MulGas
+	return c.params().Bls12381G1MulGas
 }
 
 func (c *bls12381G1Mul) Run(input []byte) ([]byte, error) {
@@ -602,7 +664,7 @@ func (c *bls12381G1Mul) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381G1MultiExp implements EIP-2537 G1MultiExp precompile.
-type bls12381G1MultiExp struct{}
+type bls12381G1MultiExp struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G1MultiExp) RequiredGas(input []byte) uint64 {
@@ -620,7 +682,7 @@ func (c *bls12381G1MultiExp) RequiredGas(input []byte) uint64 {
 		discount = config.Bls12381MultiExpDiscountTable[dLen-1]
 	}
 	// Calculate gas and return the result
-	return (uint64(k) * config.Bls12381G1MulGas * discount) / 1000
+	return (uint64(k) * c.params().Bls12381G1MulGas * discount) / 1000
 }
 
 func (c *bls12381G1MultiExp) Run(input []byte) ([]byte, error) {
@@ -659,11 +721,11 @@ func (c *bls12381G1MultiExp) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381G2Add implements EIP-2537 G2Add precompile.
-type bls12381G2Add struct{}
+type bls12381G2Add struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G2Add) RequiredGas(input []byte) uint64 {
-	return config.Bls12381G2AddGas
+	return c.params().Bls12381G2AddGas
 }
 
 func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
@@ -697,11 +759,11 @@ func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381G2Mul implements EIP-2537 G2Mul precompile.
-type bls12381G2Mul struct{}
+type bls12381G2Mul struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G2Mul) RequiredGas(input []byte) uint64 {
-	return config.Bls12381G2MulGas
+	return c.params().Bls12381G2MulGas
 }
 
 func (c *bls12381G2Mul) Run(input []byte) ([]byte, error) {
@@ -733,7 +795,7 @@ func (c *bls12381G2Mul) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381G2MultiExp implements EIP-2537 G2MultiExp precompile.
-type bls12381G2MultiExp struct{}
+type bls12381G2MultiExp struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381G2MultiExp) RequiredGas(input []byte) uint64 {
@@ -751,7 +813,7 @@ func (c *bls12381G2MultiExp) RequiredGas(input []byte) uint64 {
 		discount = config.Bls12381MultiExpDiscountTable[dLen-1]
 	}
 	// Calculate gas and return the result
-	return (uint64(k) * config.Bls12381G2MulGas * discount) / 1000
+	return (uint64(k) * c.params().Bls12381G2MulGas * discount) / 1000
 }
 
 func (c *bls12381G2MultiExp) Run(input []byte) ([]byte, error) {
@@ -790,11 +852,11 @@ func (c *bls12381G2MultiExp) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381Pairing implements EIP-2537 Pairing precompile.
-type bls12381Pairing struct{}
+type bls12381Pairing struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381Pairing) RequiredGas(input []byte) uint64 {
-	return config.Bls12381PairingBaseGas + uint64(len(input)/384)*config.Bls12381PairingPerPairGas
+	return c.params().Bls12381PairingBaseGas + uint64(len(input)/384)*c.params().Bls12381PairingPerPairGas
 }
 
 func (c *bls12381Pairing) Run(input []byte) ([]byte, error) {
@@ -869,11 +931,11 @@ func decodeBLS12381FieldElement(in []byte) ([]byte, error) {
 }
 
 // bls12381MapG1 implements EIP-2537 MapG1 precompile.
-type bls12381MapG1 struct{}
+type bls12381MapG1 struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381MapG1) RequiredGas(input []byte) uint64 {
-	return config.Bls12381MapG1Gas
+	return c.params().Bls12381MapG1Gas
 }
 
 func (c *bls12381MapG1) Run(input []byte) ([]byte, error) {
@@ -904,11 +966,11 @@ func (c *bls12381MapG1) Run(input []byte) ([]byte, error) {
 }
 
 // bls12381MapG2 implements EIP-2537 MapG2 precompile.
-type bls12381MapG2 struct{}
+type bls12381MapG2 struct{ gasParams }
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
 func (c *bls12381MapG2) RequiredGas(input []byte) uint64 {
-	return config.Bls12381MapG2Gas
+	return c.params().Bls12381MapG2Gas
 }
 
 func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
@@ -944,3 +1006,33 @@ func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
 	// Encode the G2 point to 256 bytes
 	return g.EncodePoint(r), nil
 }
+
+// P256VERIFY (secp256r1 signature verification) implemented as a native
+// contract, as specified by RIP-7212.
+type p256Verify struct{ gasParams }
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *p256Verify) RequiredGas(input []byte) uint64 {
+	return c.params().P256VerifyGas
+}
+
+func (c *p256Verify) Run(input []byte) ([]byte, error) {
+	const p256VerifyInputLength = 160
+
+	// "input" is (hash, r, s, x, y), each 32 bytes. Malformed input is not an
+	// error, the verification simply fails and nothing is returned.
+	if len(input) != p256VerifyInputLength {
+		return nil, nil
+	}
+	var (
+		hash = input[:32]
+		r    = new(big.Int).SetBytes(input[32:64])
+		s    = new(big.Int).SetBytes(input[64:96])
+		x    = new(big.Int).SetBytes(input[96:128])
+		y    = new(big.Int).SetBytes(input[128:160])
+	)
+	if secp256r1.Verify(hash, r, s, x, y) {
+		return true32Byte, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,99 @@
+package evm
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/model"
+	"math/big"
+)
+
+// StatefulPrecompiledContract is a precompiled contract which, beyond its
+// input, has access to the context of the call: the caller, the transferred
+// value, the state and the remaining gas.
+//
+// The gas returned by RequiredGas is charged before RunStateful is invoked,
+// additional dynamic gas can be charged through the context. State changes
+// are reverted like those of any other call if an error is returned. Run is
+// only used when the contract is executed outside of the EVM, for example
+// through RunPrecompiledContract.
+type StatefulPrecompiledContract interface {
+	PrecompiledContract
+	RunStateful(ctx *PrecompileContext, input []byte) ([]byte, error)
+}
+
+// PrecompileContext is the context of a call to a stateful precompiled contract.
+type PrecompileContext struct {
+	EVM      *EVM
+	Caller   common.Address // Sender of the call
+	Address  common.Address // Account whose storage and logs the call operates on
+	Value    *big.Int       // Value transferred with the call
+	ReadOnly bool           // Whether state modifications are refused
+	Gas      uint64         // Gas left for the call
+}
+
+// UseGas charges the given amount of gas, failing with ErrOutOfGas and using
+// up all remaining gas if there is not enough left.
+func (ctx *PrecompileContext) UseGas(gas uint64) error {
+	if ctx.Gas < gas {
+		ctx.Gas = 0
+		return ErrOutOfGas
+	}
+	ctx.Gas -= gas
+	return nil
+}
+
+// GetState returns the value of a storage slot of the contract.
+func (ctx *PrecompileContext) GetState(key common.Hash) common.Hash {
+	return ctx.EVM.StateDB.GetState(ctx.Address, key)
+}
+
+// SetState sets the value of a storage slot of the contract. It fails with
+// ErrWriteProtection within a static call.
+func (ctx *PrecompileContext) SetState(key, value common.Hash) error {
+	if ctx.ReadOnly {
+		return ErrWriteProtection
+	}
+	ctx.EVM.StateDB.SetState(ctx.Address, key, value)
+	return nil
+}
+
+// AddLog emits a log from the contract. It fails with ErrWriteProtection
+// within a static call. The topics and data are copied, they may alias the
+// input, which is backed by the caller's memory.
+func (ctx *PrecompileContext) AddLog(topics []common.Hash, data []byte) error {
+	if ctx.ReadOnly {
+		return ErrWriteProtection
+	}
+	ctx.EVM.StateDB.AddLog(&model.Log{
+		Address: ctx.Address,
+		Topics:  append([]common.Hash(nil), topics...),
+		Data:    common.CopyBytes(data),
+		// This is a non-consensus field, but assigned here because
+		// core/state doesn't know the current block number.
+		BlockNumber: ctx.EVM.Context.BlockNumber.Uint64(),
+	})
+	return nil
+}
+
+// runPrecompiledContract runs a precompiled contract as part of a call. The
+// call context is handed over to stateful contracts, other contracts are run
+// by RunPrecompiledContract.
+func (evm *EVM) runPrecompiledContract(p PrecompiledContract, caller, address common.Address, value *big.Int, readOnly bool, input []byte, suppliedGas uint64) (ret []byte, remainingGas uint64, err error) {
+	sp, ok := p.(StatefulPrecompiledContract)
+	if !ok {
+		return RunPrecompiledContract(p, input, suppliedGas)
+	}
+	gasCost := sp.RequiredGas(input)
+	if suppliedGas < gasCost {
+		return nil, 0, ErrOutOfGas
+	}
+	ctx := &PrecompileContext{
+		EVM:      evm,
+		Caller:   caller,
+		Address:  address,
+		Value:    value,
+		ReadOnly: readOnly || evm.interpreter.readOnly,
+		Gas:      suppliedGas - gasCost,
+	}
+	ret, err = sp.RunStateful(ctx, input)
+	return ret, ctx.Gas, err
+}
@@ -0,0 +1,146 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+// counter is a stateful precompiled contract counting its invocations. Each
+// call stores the new count and the caller, and emits a log. An input of 0xff
+// makes it revert after updating the state.
+type counter struct{}
+
+const counterDynamicGas = 5000
+
+func (c *counter) RequiredGas(input []byte) uint64 { return 100 }
+
+func (c *counter) Run(input []byte) ([]byte, error) { return nil, errors.New("stateless call") }
+
+func (c *counter) RunStateful(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	if err := ctx.UseGas(counterDynamicGas); err != nil {
+		return nil, err
+	}
+	count := new(big.Int).SetBytes(ctx.GetState(common.Hash{}).Bytes())
+	count.Add(count, big1)
+	if err := ctx.SetState(common.Hash{}, common.BigToHash(count)); err != nil {
+		return nil, err
+	}
+	if err := ctx.SetState(common.BytesToHash([]byte{1}), common.BytesToHash(ctx.Caller.Bytes())); err != nil {
+		return nil, err
+	}
+	if err := ctx.AddLog([]common.Hash{common.BigToHash(ctx.Value)}, count.Bytes()); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(input, []byte{0xff}) {
+		return nil, ErrExecutionReverted
+	}
+	return common.BigToHash(count).Bytes(), nil
+}
+
+func TestStatefulPrecompile(t *testing.T) {
+	var (
+		addr    = common.BytesToAddress([]byte{0x0c, 0x00})
+		caller  = common.BytesToAddress([]byte("caller"))
+		statedb = state.New()
+	)
+	env := newTestEVM(statedb, config.Rules{}, EVMConfig{
+		Precompiles: map[common.Address]PrecompiledContract{addr: &counter{}},
+	})
+
+	// A regular call updates the state and charges the dynamic gas
+	ret, gas, err := env.Call(AccountRef(caller), addr, nil, 10000, big.NewInt(7))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if want := common.BytesToHash([]byte{1}).Bytes(); !bytes.Equal(ret, want) {
+		t.Errorf("output mismatch: have %x, want %x", ret, want)
+	}
+	if want := uint64(10000 - 100 - counterDynamicGas); gas != want {
+		t.Errorf("gas mismatch: have %d, want %d", gas, want)
+	}
+	if have := statedb.GetState(addr, common.BytesToHash([]byte{1})); have != common.BytesToHash(caller.Bytes()) {
+		t.Errorf("caller mismatch: have %x, want %x", have, caller)
+	}
+	logs := statedb.Logs()
+	if len(logs) != 1 || logs[0].Address != addr || logs[0].Topics[0] != common.BigToHash(big.NewInt(7)) {
+		t.Fatalf("log mismatch: %v", logs)
+	}
+	// Running out of the dynamic gas fails the call
+	if _, gas, err := env.Call(AccountRef(caller), addr, nil, 1000, new(big.Int)); !errors.Is(err, ErrOutOfGas) || gas != 0 {
+		t.Errorf("short on gas: have (%d, %v), want (0, %v)", gas, err, ErrOutOfGas)
+	}
+	// Reverting discards the state changes, but not the remaining gas
+	if _, gas, err := env.Call(AccountRef(caller), addr, []byte{0xff}, 10000, new(big.Int)); !errors.Is(err, ErrExecutionReverted) || gas == 0 {
+		t.Errorf("revert: have (%d, %v), want remaining gas and %v", gas, err, ErrExecutionReverted)
+	}
+	// Static calls refuse to modify the state
+	if _, _, err := env.StaticCall(AccountRef(caller), addr, nil, 10000); !errors.Is(err, ErrWriteProtection) {
+		t.Errorf("static call: have %v, want %v", err, ErrWriteProtection)
+	}
+	if have := statedb.GetState(addr, common.Hash{}); have != common.BytesToHash([]byte{1}) {
+		t.Errorf("count mismatch: have %x, want 1", have)
+	}
+	if len(statedb.Logs()) != 1 {
+		t.Errorf("failed calls left %d logs", len(statedb.Logs())-1)
+	}
+	// Delegated calls from an account which isn't a contract run on behalf of
+	// the account, without value
+	if _, _, err := env.DelegateCall(AccountRef(caller), addr, nil, 10000); err != nil {
+		t.Fatalf("delegate call failed: %v", err)
+	}
+	if have := statedb.GetState(caller, common.BytesToHash([]byte{1})); have != common.BytesToHash(caller.Bytes()) {
+		t.Errorf("delegate caller mismatch: have %x, want %x", have, caller)
+	}
+	if logs := statedb.Logs(); len(logs) != 2 || logs[1].Address != caller || logs[1].Topics[0] != (common.Hash{}) {
+		t.Errorf("delegate log mismatch: %v", logs)
+	}
+}
+
+// inputLogger is a stateful precompiled contract emitting its input as log
+// data, reusing its topics slice afterwards.
+type inputLogger struct{}
+
+func (l *inputLogger) RequiredGas(input []byte) uint64 { return 0 }
+
+func (l *inputLogger) Run(input []byte) ([]byte, error) { return nil, errors.New("stateless call") }
+
+func (l *inputLogger) RunStateful(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	topics := []common.Hash{{0x01}}
+	err := ctx.AddLog(topics, input)
+	topics[0] = common.Hash{}
+	return nil, err
+}
+
+func TestStatefulPrecompileLogCopied(t *testing.T) {
+	var (
+		addr     = common.BytesToAddress([]byte{0x0c, 0x01})
+		contract = common.BytesToAddress([]byte("contract"))
+		statedb  = state.New()
+	)
+	// calldatacopy(0, 0, calldatasize)
+	// call(gas, 0x0c01, 0, 0, calldatasize, 0, 0) stop
+	statedb.SetCode(contract, common.Hex2Bytes("3660006000"+"37"+"60006000"+"36"+"6000"+"6000"+"610c01"+"5a"+"f1"+"50"+"00"))
+	env := newTestEVM(statedb, londonTestRules, EVMConfig{
+		Precompiles: map[common.Address]PrecompiledContract{addr: &inputLogger{}},
+	})
+	input := bytes.Repeat([]byte{0xaa}, 32)
+	if _, _, err := env.Call(AccountRef(common.Address{}), contract, input, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	// The memory of the caller's frame has been zeroed and pooled by now
+	logs := statedb.Logs()
+	if len(logs) != 1 {
+		t.Fatalf("log count mismatch: have %d, want 1", len(logs))
+	}
+	if !bytes.Equal(logs[0].Data, input) {
+		t.Errorf("log data mismatch: have %x, want %x", logs[0].Data, input)
+	}
+	if len(logs[0].Topics) != 1 || logs[0].Topics[0] != (common.Hash{0x01}) {
+		t.Errorf("log topics mismatch: have %x, want [01]", logs[0].Topics)
+	}
+}
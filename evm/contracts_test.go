@@ -2,10 +2,15 @@ package evm
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -29,25 +34,26 @@ type precompiledFailureTest struct {
 // allPrecompiles does not map to the actual set of precompiles, as it also contains
 // repriced versions of precompiles at certain slots
 var allPrecompiles = map[common.Address]PrecompiledContract{
-	common.BytesToAddress([]byte{1}):    &ecrecover{},
-	common.BytesToAddress([]byte{2}):    &sha256hash{},
-	common.BytesToAddress([]byte{3}):    &ripemd160hash{},
-	common.BytesToAddress([]byte{4}):    &dataCopy{},
-	common.BytesToAddress([]byte{5}):    &bigModExp{eip2565: false},
-	common.BytesToAddress([]byte{0xf5}): &bigModExp{eip2565: true},
-	common.BytesToAddress([]byte{6}):    &bn256AddIstanbul{},
-	common.BytesToAddress([]byte{7}):    &bn256ScalarMulIstanbul{},
-	common.BytesToAddress([]byte{8}):    &bn256PairingIstanbul{},
-	common.BytesToAddress([]byte{9}):    &blake2F{},
-	common.BytesToAddress([]byte{10}):   &bls12381G1Add{},
-	common.BytesToAddress([]byte{11}):   &bls12381G1Mul{},
-	common.BytesToAddress([]byte{12}):   &bls12381G1MultiExp{},
-	common.BytesToAddress([]byte{13}):   &bls12381G2Add{},
-	common.BytesToAddress([]byte{14}):   &bls12381G2Mul{},
-	common.BytesToAddress([]byte{15}):   &bls12381G2MultiExp{},
-	common.BytesToAddress([]byte{16}):   &bls12381Pairing{},
-	common.BytesToAddress([]byte{17}):   &bls12381MapG1{},
-	common.BytesToAddress([]byte{18}):   &bls12381MapG2{},
+	common.BytesToAddress([]byte{1}):          &ecrecover{},
+	common.BytesToAddress([]byte{2}):          &sha256hash{},
+	common.BytesToAddress([]byte{3}):          &ripemd160hash{},
+	common.BytesToAddress([]byte{4}):          &dataCopy{},
+	common.BytesToAddress([]byte{5}):          &bigModExp{eip2565: false},
+	common.BytesToAddress([]byte{0xf5}):       &bigModExp{eip2565: true},
+	common.BytesToAddress([]byte{6}):          &bn256AddIstanbul{},
+	common.BytesToAddress([]byte{7}):          &bn256ScalarMulIstanbul{},
+	common.BytesToAddress([]byte{8}):          &bn256PairingIstanbul{},
+	common.BytesToAddress([]byte{9}):          &blake2F{},
+	common.BytesToAddress([]byte{10}):         &bls12381G1Add{},
+	common.BytesToAddress([]byte{11}):         &bls12381G1Mul{},
+	common.BytesToAddress([]byte{12}):         &bls12381G1MultiExp{},
+	common.BytesToAddress([]byte{13}):         &bls12381G2Add{},
+	common.BytesToAddress([]byte{14}):         &bls12381G2Mul{},
+	common.BytesToAddress([]byte{15}):         &bls12381G2MultiExp{},
+	common.BytesToAddress([]byte{16}):         &bls12381Pairing{},
+	common.BytesToAddress([]byte{17}):         &bls12381MapG1{},
+	common.BytesToAddress([]byte{18}):         &bls12381MapG2{},
+	common.BytesToAddress([]byte{0x01, 0x00}): &p256Verify{},
 }
 
 // EIP-152 test vectors
@@ -255,6 +261,88 @@ func TestPrecompileBlake2FMalformedInput(t *testing.T) {
 
 func TestPrecompiledEcrecover(t *testing.T) { testJson("ecRecover", "01", t) }
 
+// Tests the secp256r1 signature verifier of RIP-7212 against a Wycheproof
+// vector, labelled with its tcId, and edge cases derived from it.
+func TestPrecompiledP256Verify(t *testing.T)      { testJson("p256Verify", "0100", t) }
+func BenchmarkPrecompiledP256Verify(b *testing.B) { benchJson("p256Verify", "0100", b) }
+
+// p256WycheproofFile holds Wycheproof vectors of raw (IEEE P1363) P-256
+// signatures over SHA-256 hashes, in the format of testvectors_v1 of
+// github.com/C2SP/wycheproof.
+const p256WycheproofFile = "testdata/wycheproof/ecdsa_secp256r1_sha256_p1363_test.json"
+
+// Tests the secp256r1 signature verifier of RIP-7212 against the Wycheproof
+// vector set.
+func TestPrecompiledP256VerifyWycheproof(t *testing.T) {
+	data, err := os.ReadFile(p256WycheproofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		TestGroups []struct {
+			PublicKey struct {
+				Uncompressed string `json:"uncompressed"`
+			} `json:"publicKey"`
+			Sha   string `json:"sha"`
+			Tests []struct {
+				TcID    int    `json:"tcId"`
+				Comment string `json:"comment"`
+				Msg     string `json:"msg"`
+				Sig     string `json:"sig"`
+				Result  string `json:"result"`
+			} `json:"tests"`
+		} `json:"testGroups"`
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range vectors.TestGroups {
+		if group.Sha != "SHA-256" {
+			t.Fatalf("unexpected hash %s", group.Sha)
+		}
+		key := common.Hex2Bytes(group.PublicKey.Uncompressed)[1:] // Strip the 0x04 prefix
+		for _, tc := range group.Tests {
+			if tc.Result == "acceptable" {
+				continue
+			}
+			hash := sha256.Sum256(common.Hex2Bytes(tc.Msg))
+			test := precompiledTest{
+				Input: common.Bytes2Hex(hash[:]) + tc.Sig + common.Bytes2Hex(key),
+				Gas:   config.P256VerifyGas,
+				Name:  fmt.Sprintf("tcId %d: %s", tc.TcID, tc.Comment),
+			}
+			if tc.Result == "valid" {
+				test.Expected = common.Bytes2Hex(common.LeftPadBytes([]byte{1}, 32))
+			}
+			testPrecompiled("0100", test, t)
+		}
+	}
+}
+
+func TestP256VerifyActivation(t *testing.T) {
+	addr := common.BytesToAddress([]byte{0x01, 0x00})
+	contains := func(addrs []common.Address) bool {
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := activePrecompiledContracts(config.Rules{})[addr]; ok {
+		t.Error("P256VERIFY active without being enabled")
+	}
+	if contains(ActivePrecompiles(config.Rules{})) {
+		t.Error("P256VERIFY listed without being enabled")
+	}
+	if _, ok := activePrecompiledContracts(config.Rules{IsP256Verify: true})[addr]; !ok {
+		t.Error("P256VERIFY not active after being enabled")
+	}
+	if !contains(ActivePrecompiles(config.Rules{IsP256Verify: true})) {
+		t.Error("P256VERIFY not listed after being enabled")
+	}
+}
+
 func testJson(name, addr string, t *testing.T) {
 	tests, err := loadJson(name)
 	if err != nil {
@@ -374,3 +462,109 @@ func BenchmarkPrecompiledBLS12381G2MultiExpWorstCase(b *testing.B) {
 	}
 	benchmarkPrecompiled("0f", testcase, b)
 }
+
+// doubler is a custom precompiled contract returning its input twice.
+type doubler struct{}
+
+func (d *doubler) RequiredGas(input []byte) uint64 { return 100 }
+
+func (d *doubler) Run(input []byte) ([]byte, error) {
+	return append(common.CopyBytes(input), input...), nil
+}
+
+// precompileTracer records the call frames entered by the EVM.
+type precompileTracer struct {
+	noopLogger
+
+	enters []common.Address
+	exits  [][]byte
+}
+
+func (t *precompileTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enters = append(t.enters, to)
+}
+
+func (t *precompileTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exits = append(t.exits, common.CopyBytes(output))
+}
+
+func TestCustomPrecompiles(t *testing.T) {
+	var (
+		custom   = common.BytesToAddress([]byte{0x0b, 0x00})
+		override = common.BytesToAddress([]byte{1})
+		caller   = common.BytesToAddress([]byte("caller"))
+		contract = common.BytesToAddress([]byte("contract"))
+		tracer   = new(precompileTracer)
+		statedb  = state.New()
+	)
+	env := newTestEVM(statedb, londonTestRules, EVMConfig{
+		Debug:     true,
+		Tracer:    tracer,
+		JumpTable: &londonInstructionSet,
+		Precompiles: map[common.Address]PrecompiledContract{
+			custom:   &doubler{},
+			override: &doubler{},
+		},
+	})
+
+	// The registered contracts are listed for access list warming, without
+	// duplicating the overridden built-in.
+	var found int
+	for _, addr := range env.ActivePrecompiles() {
+		if addr == custom || addr == override {
+			found++
+		}
+	}
+	if found != 2 || len(env.ActivePrecompiles()) != len(PrecompiledAddressesHomestead)+1 {
+		t.Fatalf("active precompiles mismatch: %v", env.ActivePrecompiles())
+	}
+	// Call the custom contract from a contract, so a call frame is entered.
+	for _, target := range []common.Address{custom, override} {
+		tracer.enters, tracer.exits = nil, nil
+		code := append([]byte{
+			byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(MSTORE8), // mem[0] = 0x2a
+			byte(PUSH1), 0x02, byte(PUSH1), 0x20, byte(PUSH1), 0x01, byte(PUSH1), 0x00, // ret (32, 2), args (0, 1)
+			byte(PUSH20),
+		}, target.Bytes()...)
+		code = append(code,
+			byte(GAS), byte(STATICCALL), byte(POP),
+			byte(PUSH1), 0x02, byte(PUSH1), 0x20, byte(RETURN),
+		)
+		statedb.SetCode(contract, code)
+		ret, _, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("call to %x failed: %v", target, err)
+		}
+		if !bytes.Equal(ret, []byte{0x2a, 0x2a}) {
+			t.Errorf("call to %x: output mismatch: have %x, want 2a2a", target, ret)
+		}
+		if len(tracer.enters) != 1 || tracer.enters[0] != target {
+			t.Errorf("call to %x: entered frames mismatch: %x", target, tracer.enters)
+		}
+		if len(tracer.exits) != 1 || !bytes.Equal(tracer.exits[0], []byte{0x2a, 0x2a}) {
+			t.Errorf("call to %x: exited frames mismatch: %x", target, tracer.exits)
+		}
+	}
+}
+
+func TestActivePrecompilesOrder(t *testing.T) {
+	precompiles := map[common.Address]PrecompiledContract{
+		common.BytesToAddress([]byte{1}): &doubler{}, // Overrides a built-in contract
+	}
+	var want []common.Address
+	want = append(want, PrecompiledAddressesHomestead...)
+	for i := byte(0); i < 16; i++ {
+		addr := common.BytesToAddress([]byte{0x0c, i})
+		precompiles[addr] = &doubler{}
+		want = append(want, addr)
+	}
+	env := newTestEVM(state.New(), config.Rules{}, EVMConfig{Precompiles: precompiles})
+
+	// Registered contracts are listed sorted after the built-in ones, the
+	// same way every time
+	for i := 0; i < 10; i++ {
+		if have := env.ActivePrecompiles(); !reflect.DeepEqual(have, want) {
+			t.Fatalf("active precompiles mismatch:\nhave %v\nwant %v", have, want)
+		}
+	}
+}
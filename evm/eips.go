@@ -7,7 +7,9 @@ import (
 	"sort"
 )
 
-var activators = map[int]func(*JumpTable){
+var activators = map[int]func(*JumpTable, *config.ProtocolParams){
+	7702: enable7702,
+	6780: enable6780,
 	3855: enable3855,
 	3529: enable3529,
 	3198: enable3198,
@@ -21,11 +23,17 @@ var activators = map[int]func(*JumpTable){
 // This operation writes in-place, and callers need to ensure that the globally
 // defined jump tables are not polluted.
 func EnableEIP(eipNum int, jt *JumpTable) error {
+	return enableEIP(eipNum, jt, &config.DefaultProtocolParams)
+}
+
+// enableEIP enables the given EIP on the config, pricing the affected
+// instructions with the given protocol parameters.
+func enableEIP(eipNum int, jt *JumpTable, p *config.ProtocolParams) error {
 	enablerFn, ok := activators[eipNum]
 	if !ok {
 		return fmt.Errorf("undefined eip %d", eipNum)
 	}
-	enablerFn(jt)
+	enablerFn(jt, p)
 	return nil
 }
 
@@ -47,11 +55,11 @@ func ActivateableEips() []string {
 // - Increase cost of EXTCODEHASH to 700
 // - Increase cost of SLOAD to 800
 // - Define SELFBALANCE, with cost GasFastStep (5)
-func enable1884(jt *JumpTable) {
+func enable1884(jt *JumpTable, p *config.ProtocolParams) {
 	// Gas cost changes
-	jt[SLOAD].constantGas = config.SloadGasEIP1884
-	jt[BALANCE].constantGas = config.BalanceGasEIP1884
-	jt[EXTCODEHASH].constantGas = config.ExtcodeHashGasEIP1884
+	jt[SLOAD].constantGas = p.SloadGasEIP1884
+	jt[BALANCE].constantGas = p.BalanceGasEIP1884
+	jt[EXTCODEHASH].constantGas = p.ExtcodeHashGasEIP1884
 
 	// New opcode
 	jt[SELFBALANCE] = &operation{
@@ -70,7 +78,7 @@ func opSelfBalance(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext)
 
 // enable1344 applies EIP-1344 (ChainID Opcode)
 // - Adds an opcode that returns the current chain’s EIP-155 unique identifier
-func enable1344(jt *JumpTable) {
+func enable1344(jt *JumpTable, p *config.ProtocolParams) {
 	// New opcode
 	jt[CHAINID] = &operation{
 		execute:     opChainID,
@@ -88,46 +96,46 @@ func opChainID(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 }
 
 // enable2200 applies EIP-2200 (Rebalance net-metered SSTORE)
-func enable2200(jt *JumpTable) {
-	jt[SLOAD].constantGas = config.SloadGasEIP2200
+func enable2200(jt *JumpTable, p *config.ProtocolParams) {
+	jt[SLOAD].constantGas = p.SloadGasEIP2200
 	jt[SSTORE].dynamicGas = gasSStoreEIP2200
 }
 
 // enable2929 enables "EIP-2929: Gas cost increases for state access opcodes"
 // https://eips.entropy.org/EIPS/eip-2929
-func enable2929(jt *JumpTable) {
+func enable2929(jt *JumpTable, p *config.ProtocolParams) {
 	jt[SSTORE].dynamicGas = gasSStoreEIP2929
 
 	jt[SLOAD].constantGas = 0
 	jt[SLOAD].dynamicGas = gasSLoadEIP2929
 
-	jt[EXTCODECOPY].constantGas = config.WarmStorageReadCostEIP2929
+	jt[EXTCODECOPY].constantGas = p.WarmStorageReadCostEIP2929
 	jt[EXTCODECOPY].dynamicGas = gasExtCodeCopyEIP2929
 
-	jt[EXTCODESIZE].constantGas = config.WarmStorageReadCostEIP2929
+	jt[EXTCODESIZE].constantGas = p.WarmStorageReadCostEIP2929
 	jt[EXTCODESIZE].dynamicGas = gasEip2929AccountCheck
 
-	jt[EXTCODEHASH].constantGas = config.WarmStorageReadCostEIP2929
+	jt[EXTCODEHASH].constantGas = p.WarmStorageReadCostEIP2929
 	jt[EXTCODEHASH].dynamicGas = gasEip2929AccountCheck
 
-	jt[BALANCE].constantGas = config.WarmStorageReadCostEIP2929
+	jt[BALANCE].constantGas = p.WarmStorageReadCostEIP2929
 	jt[BALANCE].dynamicGas = gasEip2929AccountCheck
 
-	jt[CALL].constantGas = config.WarmStorageReadCostEIP2929
+	jt[CALL].constantGas = p.WarmStorageReadCostEIP2929
 	jt[CALL].dynamicGas = gasCallEIP2929
 
-	jt[CALLCODE].constantGas = config.WarmStorageReadCostEIP2929
+	jt[CALLCODE].constantGas = p.WarmStorageReadCostEIP2929
 	jt[CALLCODE].dynamicGas = gasCallCodeEIP2929
 
-	jt[STATICCALL].constantGas = config.WarmStorageReadCostEIP2929
+	jt[STATICCALL].constantGas = p.WarmStorageReadCostEIP2929
 	jt[STATICCALL].dynamicGas = gasStaticCallEIP2929
 
-	jt[DELEGATECALL].constantGas = config.WarmStorageReadCostEIP2929
+	jt[DELEGATECALL].constantGas = p.WarmStorageReadCostEIP2929
 	jt[DELEGATECALL].dynamicGas = gasDelegateCallEIP2929
 
 	// This was previously part of the dynamic cost, but we're using it as a constantGas
 	// factor here
-	jt[SELFDESTRUCT].constantGas = config.SelfdestructGasEIP150
+	jt[SELFDESTRUCT].constantGas = p.SelfdestructGasEIP150
 	jt[SELFDESTRUCT].dynamicGas = gasSelfdestructEIP2929
 }
 
@@ -135,14 +143,14 @@ func enable2929(jt *JumpTable) {
 // - Removes refunds for selfdestructs
 // - Reduces refunds for SSTORE
 // - Reduces max refunds to 20% gas
-func enable3529(jt *JumpTable) {
+func enable3529(jt *JumpTable, p *config.ProtocolParams) {
 	jt[SSTORE].dynamicGas = gasSStoreEIP3529
 	jt[SELFDESTRUCT].dynamicGas = gasSelfdestructEIP3529
 }
 
 // enable3198 applies EIP-3198 (BASEFEE Opcode)
 // - Adds an opcode that returns the current block's base fee.
-func enable3198(jt *JumpTable) {
+func enable3198(jt *JumpTable, p *config.ProtocolParams) {
 	// New opcode
 	jt[BASEFEE] = &operation{
 		execute:     opBaseFee,
@@ -160,7 +168,7 @@ func opBaseFee(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 }
 
 // enable3855 applies EIP-3855 (PUSH0 opcode)
-func enable3855(jt *JumpTable) {
+func enable3855(jt *JumpTable, p *config.ProtocolParams) {
 	// New opcode
 	jt[PUSH0] = &operation{
 		execute:     opPush0,
@@ -175,3 +183,103 @@ func opPush0(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]by
 	scope.Stack.push(new(uint256.Int))
 	return nil, nil
 }
+
+// enable6780 applies EIP-6780 (SELFDESTRUCT only in same transaction)
+func enable6780(jt *JumpTable, p *config.ProtocolParams) {
+	jt[SELFDESTRUCT] = &operation{
+		execute:     opSelfdestruct6780,
+		dynamicGas:  gasSelfdestructEIP3529,
+		constantGas: p.SelfdestructGasEIP150,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+	}
+}
+
+// enable7702 applies EIP-7702 (set code transactions): the CALL-variants
+// additionally charge for resolving a delegation designator.
+func enable7702(jt *JumpTable, p *config.ProtocolParams) {
+	jt[CALL].dynamicGas = gasCallEIP7702
+	jt[CALLCODE].dynamicGas = gasCallCodeEIP7702
+	jt[STATICCALL].dynamicGas = gasStaticCallEIP7702
+	jt[DELEGATECALL].dynamicGas = gasDelegateCallEIP7702
+}
+
+// enableEOF applies the EOF code rules to the given jump table. It defines the
+// instructions of EIP-4200 (static relative jumps), EIP-4750 (functions) and
+// EIP-7480 (data section access), and undefines the legacy instructions which
+// are incompatible with the container format: dynamic jumps, code and gas
+// introspection, CALLCODE, SELFDESTRUCT and the legacy CREATE-variants.
+//
+// The resulting table is only meant for executing EOF containers, it must not
+// be used for legacy code.
+func enableEOF(jt *JumpTable, p *config.ProtocolParams) {
+	for _, op := range []OpCode{
+		JUMP, JUMPI, PC, GAS, CODESIZE, CODECOPY, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH,
+		CALLCODE, SELFDESTRUCT, CREATE, CREATE2,
+	} {
+		jt[op] = &operation{execute: opUndefined, maxStack: maxStack(0, 0), undefined: true}
+	}
+	// INVALID is the designated invalid instruction, a valid terminating
+	// instruction of EOF code aborting the execution.
+	jt[INVALID] = &operation{
+		execute:  opUndefined,
+		minStack: minStack(0, 0),
+		maxStack: maxStack(0, 0),
+	}
+	jt[RJUMP] = &operation{
+		execute:     opRjump,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+	}
+	jt[RJUMPI] = &operation{
+		execute:     opRjumpi,
+		constantGas: 4,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+	}
+	jt[RJUMPV] = &operation{
+		execute:     opRjumpv,
+		constantGas: 4,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+	}
+	jt[CALLF] = &operation{
+		execute:     opCallf,
+		constantGas: GasFastStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+	}
+	jt[RETF] = &operation{
+		execute:     opRetf,
+		constantGas: GasFastestStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+	}
+	jt[DATALOAD] = &operation{
+		execute:     opDataLoad,
+		constantGas: 4,
+		minStack:    minStack(1, 1),
+		maxStack:    maxStack(1, 1),
+	}
+	jt[DATALOADN] = &operation{
+		execute:     opDataLoadN,
+		constantGas: GasFastestStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+	}
+	jt[DATASIZE] = &operation{
+		execute:     opDataSize,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+	}
+	jt[DATACOPY] = &operation{
+		execute:     opDataCopy,
+		constantGas: GasFastestStep,
+		dynamicGas:  gasDataCopy,
+		minStack:    minStack(3, 0),
+		maxStack:    maxStack(3, 0),
+		memorySize:  memoryDataCopy,
+	}
+}
@@ -0,0 +1,261 @@
+package evm
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/model"
+	"github.com/entropyio/go-evm/state"
+	"github.com/holiman/uint256"
+	"math/big"
+	"testing"
+)
+
+func TestSelfdestructEIP6780(t *testing.T) {
+	var (
+		contract    = common.BytesToAddress([]byte("contract"))
+		beneficiary = common.BytesToAddress([]byte("beneficiary"))
+	)
+	tests := []struct {
+		createdInTx bool
+		beneficiary common.Address
+		suicided    bool
+		balance     int64 // remaining balance of the contract
+	}{
+		{createdInTx: false, beneficiary: beneficiary, suicided: false, balance: 0},
+		{createdInTx: false, beneficiary: contract, suicided: false, balance: 100},
+		{createdInTx: true, beneficiary: beneficiary, suicided: true, balance: 0},
+		{createdInTx: true, beneficiary: contract, suicided: true, balance: 0},
+	}
+	for i, tt := range tests {
+		statedb := state.New()
+		statedb.CreateAccount(contract)
+		statedb.SetCode(contract, []byte{byte(SELFDESTRUCT)})
+		statedb.AddBalance(contract, big.NewInt(100))
+		if !tt.createdInTx {
+			statedb.Finalise()
+		}
+		env := NewEVM(BlockContext{}, TxContext{}, EVMConfig{})
+		env.StateDB = statedb
+
+		var (
+			stack = newstack()
+			pc    = uint64(0)
+			scope = &ScopeContext{
+				Memory:   NewMemory(),
+				Stack:    stack,
+				Contract: NewContract(AccountRef(common.Address{}), AccountRef(contract), new(big.Int), 0),
+			}
+		)
+		stack.push(new(uint256.Int).SetBytes(tt.beneficiary.Bytes()))
+		if _, err := opSelfdestruct6780(&pc, env.interpreter, scope); err != errStopToken {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if have := statedb.HasSuicided(contract); have != tt.suicided {
+			t.Errorf("test %d: suicided mismatch: have %v, want %v", i, have, tt.suicided)
+		}
+		if have := statedb.GetBalance(contract); have.Cmp(big.NewInt(tt.balance)) != 0 {
+			t.Errorf("test %d: contract balance mismatch: have %v, want %v", i, have, tt.balance)
+		}
+		if tt.beneficiary != contract {
+			if have := statedb.GetBalance(beneficiary); have.Cmp(big.NewInt(100)) != 0 {
+				t.Errorf("test %d: beneficiary balance mismatch: have %v, want 100", i, have)
+			}
+		}
+		returnStack(stack)
+	}
+}
+
+func TestDelegationResolution(t *testing.T) {
+	var (
+		authority = common.BytesToAddress([]byte("authority"))
+		target    = common.BytesToAddress([]byte("target"))
+		caller    = common.BytesToAddress([]byte("caller"))
+	)
+	for i, prague := range []bool{false, true} {
+		statedb := state.New()
+		// PUSH1 0x2a PUSH1 0x00 SSTORE
+		statedb.SetCode(target, []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(SSTORE)})
+		statedb.SetCode(authority, model.AddressToDelegation(target))
+
+		env := newTestEVM(statedb, config.Rules{IsPrague: prague}, EVMConfig{})
+
+		_, _, err := env.Call(AccountRef(caller), authority, nil, 100000, new(big.Int))
+		stored := statedb.GetState(authority, common.Hash{})
+		if prague {
+			if err != nil {
+				t.Fatalf("test %d: call failed: %v", i, err)
+			}
+			if stored != common.BytesToHash([]byte{0x2a}) {
+				t.Fatalf("test %d: delegated code not executed in authority context: %x", i, stored)
+			}
+			if have := env.resolveCodeHash(authority); have != statedb.GetCodeHash(target) {
+				t.Fatalf("test %d: code hash not resolved: have %x", i, have)
+			}
+		} else {
+			if err == nil {
+				t.Fatalf("test %d: designator executed as code before Prague", i)
+			}
+			if stored != (common.Hash{}) {
+				t.Fatalf("test %d: unexpected storage write: %x", i, stored)
+			}
+		}
+	}
+}
+
+func TestDelegationCallGas(t *testing.T) {
+	var (
+		authority = common.BytesToAddress([]byte("authority"))
+		target    = common.BytesToAddress([]byte("target"))
+	)
+	tests := []struct {
+		warmCallee, warmTarget bool
+		want                   uint64
+	}{
+		{false, false, config.ColdAccountAccessCostEIP2929 - config.WarmStorageReadCostEIP2929 + config.ColdAccountAccessCostEIP2929},
+		{true, false, config.ColdAccountAccessCostEIP2929},
+		{false, true, config.ColdAccountAccessCostEIP2929 - config.WarmStorageReadCostEIP2929 + config.WarmStorageReadCostEIP2929},
+		{true, true, config.WarmStorageReadCostEIP2929},
+	}
+	for i, tt := range tests {
+		statedb := state.New()
+		statedb.SetCode(authority, model.AddressToDelegation(target))
+		if tt.warmCallee {
+			statedb.AddAddressToAccessList(authority)
+		}
+		if tt.warmTarget {
+			statedb.AddAddressToAccessList(target)
+		}
+		env := NewEVM(BlockContext{}, TxContext{}, EVMConfig{})
+		env.StateDB = statedb
+		env.chainRules.IsEIP150 = true
+
+		// STATICCALL operands: gas, addr, inOffset, inSize, retOffset, retSize
+		stack := newstack()
+		for _, v := range []uint64{0, 0, 0, 0} {
+			stack.push(new(uint256.Int).SetUint64(v))
+		}
+		stack.push(new(uint256.Int).SetBytes(authority.Bytes()))
+		stack.push(new(uint256.Int))
+		contract := NewContract(AccountRef(common.Address{}), AccountRef(common.Address{}), new(big.Int), 100000)
+
+		gas, err := gasStaticCallEIP7702(env, contract, stack, NewMemory(), 0)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if gas != tt.want {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, gas, tt.want)
+		}
+		if contract.Gas != 100000 {
+			t.Errorf("test %d: access charges not returned to the contract: %d", i, contract.Gas)
+		}
+		if !statedb.AddressInAccessList(authority) || !statedb.AddressInAccessList(target) {
+			t.Errorf("test %d: callee or delegation target not warmed", i)
+		}
+		returnStack(stack)
+	}
+}
+
+func TestBlockhashHistoryContract(t *testing.T) {
+	var (
+		stored   = common.BytesToHash([]byte("stored"))
+		callback = common.BytesToHash([]byte("callback"))
+		getHash  = func(uint64) common.Hash { return callback }
+		// The history contract serves the blocks from 94 on
+		pragueAt95 = &config.ChainConfig{PragueBlock: big.NewInt(95)}
+	)
+	tests := []struct {
+		prague      bool
+		chainConfig *config.ChainConfig
+		getHash     GetHashFunc
+		num         uint64
+		want        common.Hash
+	}{
+		{prague: false, getHash: getHash, num: 96, want: callback},
+		{prague: true, chainConfig: pragueAt95, getHash: getHash, num: 96, want: stored},
+		{prague: true, chainConfig: pragueAt95, getHash: getHash, num: 97, want: common.Hash{}}, // stored zero
+		{prague: true, chainConfig: pragueAt95, getHash: getHash, num: 90, want: callback},      // preceding the fork
+		{prague: true, chainConfig: pragueAt95, getHash: nil, num: 90, want: common.Hash{}},
+		{prague: true, getHash: getHash, num: 90, want: stored},         // prague from genesis
+		{prague: true, getHash: getHash, num: 100, want: common.Hash{}}, // not an ancestor
+	}
+	for i, tt := range tests {
+		statedb := state.New()
+		statedb.SetState(config.HistoryStorageAddress, common.BigToHash(big.NewInt(90)), stored)
+		statedb.SetState(config.HistoryStorageAddress, common.BigToHash(big.NewInt(96)), stored)
+
+		env := NewEVM(BlockContext{BlockNumber: big.NewInt(100), GetHash: tt.getHash}, TxContext{}, EVMConfig{})
+		env.StateDB = statedb
+		env.Context = env.BlockContext
+		env.chainConfig = tt.chainConfig
+		env.chainRules.IsPrague = tt.prague
+
+		var (
+			stack = newstack()
+			pc    = uint64(0)
+			scope = &ScopeContext{Memory: NewMemory(), Stack: stack}
+		)
+		stack.push(new(uint256.Int).SetUint64(tt.num))
+		opBlockhash(&pc, env.interpreter, scope)
+		if have := common.Hash(stack.peek().Bytes32()); have != tt.want {
+			t.Errorf("test %d: hash mismatch: have %x, want %x", i, have, tt.want)
+		}
+		returnStack(stack)
+	}
+}
+
+func TestExtCodeDelegation(t *testing.T) {
+	var (
+		authority = common.BytesToAddress([]byte("authority"))
+		plain     = common.BytesToAddress([]byte("plain"))
+		target    = common.BytesToAddress([]byte("target"))
+		caller    = common.BytesToAddress([]byte("caller"))
+		contract  = common.BytesToAddress([]byte("contract"))
+	)
+	// extcodesize(addr) at 0, extcodehash(addr) at 32, extcodecopy(addr, 64, 0, 23), return(0, 87)
+	inspect := func(addr common.Address) []byte {
+		push := append([]byte{byte(PUSH20)}, addr.Bytes()...)
+		code := append(common.CopyBytes(push), byte(EXTCODESIZE), byte(PUSH1), 0, byte(MSTORE))
+		code = append(append(code, push...), byte(EXTCODEHASH), byte(PUSH1), 32, byte(MSTORE))
+		code = append(code, byte(PUSH1), 23, byte(PUSH1), 0, byte(PUSH1), 64)
+		code = append(append(code, push...), byte(EXTCODECOPY))
+		return append(code, byte(PUSH1), 87, byte(PUSH1), 0, byte(RETURN))
+	}
+	designator := model.AddressToDelegation(target)
+	run := func(addr common.Address) ([]byte, uint64, *state.StateDB) {
+		statedb := state.New()
+		statedb.SetCode(target, []byte{byte(PUSH1), 0x2a, byte(STOP)})
+		statedb.SetCode(authority, designator)
+		statedb.SetCode(plain, append([]byte{0x60}, designator[1:]...)) // same size, not a delegation
+		statedb.SetCode(contract, inspect(addr))
+
+		rules := config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true, IsMerge: true, IsCancun: true, IsPrague: true}
+		env := newTestEVM(statedb, rules, EVMConfig{JumpTable: &pragueInstructionSet})
+
+		ret, gas, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		return ret, 100000 - gas, statedb
+	}
+	ret, used, statedb := run(authority)
+
+	// The designator is seen, not the code delegated to
+	if size := new(big.Int).SetBytes(ret[:32]); size.Uint64() != uint64(len(designator)) {
+		t.Errorf("extcodesize mismatch: have %v, want %d", size, len(designator))
+	}
+	if have, want := common.BytesToHash(ret[32:64]), crypto.Keccak256Hash(designator); have != want {
+		t.Errorf("extcodehash mismatch: have %x, want %x", have, want)
+	}
+	if !bytes.Equal(ret[64:], designator) {
+		t.Errorf("extcodecopy mismatch: have %x, want %x", ret[64:], designator)
+	}
+	// Only the delegating account is accessed and charged for, like any other
+	if statedb.AddressInAccessList(target) {
+		t.Errorf("delegation target accessed")
+	}
+	if _, plainUsed, _ := run(plain); used != plainUsed {
+		t.Errorf("gas mismatch: have %d, want %d as for an account without delegation", used, plainUsed)
+	}
+}
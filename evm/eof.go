@@ -0,0 +1,352 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"strings"
+)
+
+const (
+	offsetVersion   = 2
+	offsetTypesKind = 3
+	offsetCodeKind  = 6
+
+	kindTypes = 1
+	kindCode  = 2
+	kindData  = 4
+
+	eof1Version = 1
+
+	maxInputItems        = 127
+	maxOutputItems       = 127
+	maxStackHeight       = 1023
+	maxCodeSections      = 1024
+	nonReturningFunction = 0x80
+)
+
+var eofMagic = []byte{0xef, 0x00}
+
+// defaultContainerCacheSize is the memory allowance of the shared cache of
+// decoded EOF containers.
+const defaultContainerCacheSize = 16 * 1024 * 1024
+
+// containerCache holds the decoded EOF containers of the contracts executed by
+// all EVMs of the process, so that deployed code is only decoded once. The
+// cached containers must not be modified.
+var containerCache = newLRUCache(defaultContainerCacheSize)
+
+// List of EOF container format errors.
+var (
+	errInvalidMagic             = errors.New("invalid magic")
+	errInvalidVersion           = errors.New("invalid version")
+	errIncompleteContainer      = errors.New("incomplete container")
+	errMissingTypeHeader        = errors.New("missing type header")
+	errInvalidTypeSize          = errors.New("invalid type section size")
+	errMissingCodeHeader        = errors.New("missing code header")
+	errInvalidCodeHeader        = errors.New("invalid code header")
+	errInvalidCodeSize          = errors.New("invalid code size")
+	errMissingDataHeader        = errors.New("missing data header")
+	errMissingTerminator        = errors.New("missing header terminator")
+	errInvalidContainerSize     = errors.New("invalid container size")
+	errInvalidSection0Type      = errors.New("invalid section 0 type, input and output should be zero and non-returning (0x80)")
+	errTooManyInputs            = errors.New("invalid type content, too many inputs")
+	errTooManyOutputs           = errors.New("invalid type content, too many outputs")
+	errTooLargeMaxStackHeight   = errors.New("invalid type content, max stack height exceeds limit")
+	errUndefinedInstruction     = errors.New("undefined instruction")
+	errTruncatedImmediate       = errors.New("truncated immediate")
+	errInvalidJumpDest          = errors.New("invalid jump destination")
+	errInvalidSectionArgument   = errors.New("invalid section argument")
+	errInvalidCallArgument      = errors.New("callf into non-returning section")
+	errInvalidDataloadNArgument = errors.New("invalid dataloadN argument")
+	errInvalidNonReturning      = errors.New("invalid non-returning flag")
+	errUnreachableCode          = errors.New("unreachable code")
+	errUnreachableCodeSections  = errors.New("unreachable code sections")
+	errNoTerminalInstruction    = errors.New("expected terminal instruction")
+	errInvalidBackwardJump      = errors.New("invalid backward jump")
+	errInvalidOutputs           = errors.New("invalid number of outputs")
+	errInvalidMaxStackHeight    = errors.New("invalid max stack height")
+	errEOFStackUnderflow        = errors.New("stack underflow")
+	errEOFStackOverflow         = errors.New("stack overflow")
+)
+
+// hasEOFMagic returns whether the code starts with the EOF magic, i.e. it is
+// meant to be an EOF container rather than legacy code.
+func hasEOFMagic(code []byte) bool {
+	return len(code) >= len(eofMagic) && bytes.Equal(eofMagic, code[:len(eofMagic)])
+}
+
+// loadContainer returns the EOF container of the code of the contract, which
+// was validated upon deployment, decoding it if it isn't cached. Only code
+// with a hash is cached.
+func (c *Contract) loadContainer() (*Container, error) {
+	if c.CodeHash != (common.Hash{}) {
+		if value, ok := containerCache.get(c.CodeHash); ok {
+			return value.(*Container), nil
+		}
+	}
+	container := new(Container)
+	if err := container.UnmarshalBinary(c.Code); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEOFCode, err)
+	}
+	if c.CodeHash != (common.Hash{}) {
+		containerCache.add(c.CodeHash, container, len(c.Code))
+	}
+	return container, nil
+}
+
+// functionMetadata is an EOF function signature, as declared in the types
+// section of the container.
+type functionMetadata struct {
+	inputs         uint8
+	outputs        uint8
+	maxStackHeight uint16
+}
+
+// Container is an EOF container object.
+type Container struct {
+	types        []*functionMetadata
+	codeSections [][]byte
+	data         []byte
+}
+
+// NumCodeSections returns the number of code sections in the container.
+func (c *Container) NumCodeSections() int {
+	return len(c.codeSections)
+}
+
+// CodeSection returns the code of the i'th code section.
+func (c *Container) CodeSection(i int) []byte {
+	return c.codeSections[i]
+}
+
+// SectionType returns the declared signature of the i'th code section. The
+// outputs of a non-returning section are reported as 0x80.
+func (c *Container) SectionType(i int) (inputs, outputs uint8, maxStackHeight uint16) {
+	t := c.types[i]
+	return t.inputs, t.outputs, t.maxStackHeight
+}
+
+// Data returns the data section of the container.
+func (c *Container) Data() []byte {
+	return c.data
+}
+
+// MarshalBinary encodes an EOF container into binary format.
+func (c *Container) MarshalBinary() []byte {
+	// Build header.
+	b := make([]byte, 0, 15+2*len(c.codeSections))
+	b = append(b, eofMagic...)
+	b = append(b, eof1Version)
+	b = append(b, kindTypes)
+	b = appendUint16(b, len(c.types)*4)
+	b = append(b, kindCode)
+	b = appendUint16(b, len(c.codeSections))
+	for _, code := range c.codeSections {
+		b = appendUint16(b, len(code))
+	}
+	b = append(b, kindData)
+	b = appendUint16(b, len(c.data))
+	b = append(b, 0) // terminator
+
+	// Write section contents.
+	for _, ty := range c.types {
+		b = append(b, ty.inputs, ty.outputs)
+		b = appendUint16(b, int(ty.maxStackHeight))
+	}
+	for _, code := range c.codeSections {
+		b = append(b, code...)
+	}
+	b = append(b, c.data...)
+
+	return b
+}
+
+// UnmarshalBinary decodes an EOF container. Only the container format is
+// checked, the code sections are validated by ValidateCode.
+func (c *Container) UnmarshalBinary(b []byte) error {
+	if !hasEOFMagic(b) {
+		return fmt.Errorf("%w: want %x", errInvalidMagic, eofMagic)
+	}
+	if len(b) <= offsetVersion {
+		return fmt.Errorf("%w: missing version", errIncompleteContainer)
+	}
+	if b[offsetVersion] != eof1Version {
+		return fmt.Errorf("%w: have %d, want %d", errInvalidVersion, b[offsetVersion], eof1Version)
+	}
+	// Parse type section header.
+	kind, typesSize, err := parseSection(b, offsetTypesKind)
+	if err != nil {
+		return err
+	}
+	if kind != kindTypes {
+		return fmt.Errorf("%w: found section kind %x instead", errMissingTypeHeader, kind)
+	}
+	if typesSize < 4 || typesSize%4 != 0 {
+		return fmt.Errorf("%w: type section size must be divisible by 4, have %d", errInvalidTypeSize, typesSize)
+	}
+	if typesSize/4 > maxCodeSections {
+		return fmt.Errorf("%w: type section must not exceed 4*%d, have %d", errInvalidTypeSize, maxCodeSections, typesSize)
+	}
+	// Parse code section header.
+	kind, codeSizes, err := parseSectionList(b, offsetCodeKind)
+	if err != nil {
+		return err
+	}
+	if kind != kindCode {
+		return fmt.Errorf("%w: found section kind %x instead", errMissingCodeHeader, kind)
+	}
+	if len(codeSizes) != typesSize/4 {
+		return fmt.Errorf("%w: mismatch of code sections found and type signatures, types %d, code %d", errInvalidCodeHeader, typesSize/4, len(codeSizes))
+	}
+	// Parse data section header.
+	offsetDataKind := offsetCodeKind + 3 + 2*len(codeSizes)
+	kind, dataSize, err := parseSection(b, offsetDataKind)
+	if err != nil {
+		return err
+	}
+	if kind != kindData {
+		return fmt.Errorf("%w: found section kind %x instead", errMissingDataHeader, kind)
+	}
+	// Check for terminator.
+	offsetTerminator := offsetDataKind + 3
+	if len(b) <= offsetTerminator {
+		return fmt.Errorf("%w: missing header terminator", errIncompleteContainer)
+	}
+	if b[offsetTerminator] != 0 {
+		return fmt.Errorf("%w: have %x", errMissingTerminator, b[offsetTerminator])
+	}
+	// Verify overall container size.
+	expectedSize := offsetTerminator + 1 + typesSize + dataSize
+	for _, size := range codeSizes {
+		expectedSize += size
+	}
+	if len(b) != expectedSize {
+		return fmt.Errorf("%w: have %d, want %d", errInvalidContainerSize, len(b), expectedSize)
+	}
+	// Parse types section.
+	idx := offsetTerminator + 1
+	types := make([]*functionMetadata, 0, typesSize/4)
+	for i := 0; i < typesSize/4; i++ {
+		sig := &functionMetadata{
+			inputs:         b[idx+i*4],
+			outputs:        b[idx+i*4+1],
+			maxStackHeight: binary.BigEndian.Uint16(b[idx+i*4+2:]),
+		}
+		if sig.inputs > maxInputItems {
+			return fmt.Errorf("%w for section %d: have %d", errTooManyInputs, i, sig.inputs)
+		}
+		if sig.outputs > maxOutputItems && sig.outputs != nonReturningFunction {
+			return fmt.Errorf("%w for section %d: have %d", errTooManyOutputs, i, sig.outputs)
+		}
+		if sig.maxStackHeight > maxStackHeight {
+			return fmt.Errorf("%w for section %d: have %d", errTooLargeMaxStackHeight, i, sig.maxStackHeight)
+		}
+		types = append(types, sig)
+	}
+	if types[0].inputs != 0 || types[0].outputs != nonReturningFunction {
+		return fmt.Errorf("%w: have %d, %d", errInvalidSection0Type, types[0].inputs, types[0].outputs)
+	}
+	idx += typesSize
+
+	// Parse code sections.
+	codeSections := make([][]byte, len(codeSizes))
+	for i, size := range codeSizes {
+		codeSections[i] = b[idx : idx+size]
+		idx += size
+	}
+	c.types = types
+	c.codeSections = codeSections
+	c.data = b[idx : idx+dataSize]
+
+	return nil
+}
+
+// ValidateCode validates the code sections of the container against the
+// EOF code rules, with the given jump table defining the valid instructions.
+// All code sections must be reachable from the first one.
+func (c *Container) ValidateCode(jt *JumpTable) error {
+	var (
+		visited = make([]bool, len(c.codeSections))
+		queue   = []int{0}
+	)
+	visited[0] = true
+	for len(queue) > 0 {
+		section := queue[0]
+		queue = queue[1:]
+
+		callees, err := validateCode(c.codeSections[section], section, c, jt)
+		if err != nil {
+			return err
+		}
+		for _, callee := range callees {
+			if !visited[callee] {
+				visited[callee] = true
+				queue = append(queue, callee)
+			}
+		}
+	}
+	for i, ok := range visited {
+		if !ok {
+			return fmt.Errorf("%w: section %d", errUnreachableCodeSections, i)
+		}
+	}
+	return nil
+}
+
+// String returns a human readable summary of the container layout.
+func (c *Container) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "EOF container, version %d\n", eof1Version)
+	for i, ty := range c.types {
+		outputs := fmt.Sprint(ty.outputs)
+		if ty.outputs == nonReturningFunction {
+			outputs = "non-returning"
+		}
+		fmt.Fprintf(&b, "  code section %d: %d bytes, inputs %d, outputs %s, max stack height %d\n", i, len(c.codeSections[i]), ty.inputs, outputs, ty.maxStackHeight)
+	}
+	fmt.Fprintf(&b, "  data section: %d bytes\n", len(c.data))
+	return b.String()
+}
+
+// parseSection decodes a (kind, size) pair from an EOF header.
+func parseSection(b []byte, idx int) (kind, size int, err error) {
+	if idx+3 > len(b) {
+		return 0, 0, fmt.Errorf("%w: missing section header at %d", errIncompleteContainer, idx)
+	}
+	return int(b[idx]), int(binary.BigEndian.Uint16(b[idx+1:])), nil
+}
+
+// parseSectionList decodes a (kind, len, []codeSize) section list from an EOF
+// header.
+func parseSectionList(b []byte, idx int) (kind int, sizes []int, err error) {
+	if idx+3 > len(b) {
+		return 0, nil, fmt.Errorf("%w: missing section header at %d", errIncompleteContainer, idx)
+	}
+	kind = int(b[idx])
+	count := int(binary.BigEndian.Uint16(b[idx+1:]))
+	if count == 0 {
+		return 0, nil, fmt.Errorf("%w: no code sections", errInvalidCodeHeader)
+	}
+	if count > maxCodeSections {
+		return 0, nil, fmt.Errorf("%w: too many code sections, have %d", errInvalidCodeHeader, count)
+	}
+	idx += 3
+	if idx+2*count > len(b) {
+		return 0, nil, fmt.Errorf("%w: missing code section sizes", errIncompleteContainer)
+	}
+	sizes = make([]int, count)
+	for i := range sizes {
+		sizes[i] = int(binary.BigEndian.Uint16(b[idx+2*i:]))
+		if sizes[i] == 0 {
+			return 0, nil, fmt.Errorf("%w: code section %d is empty", errInvalidCodeSize, i)
+		}
+	}
+	return kind, sizes, nil
+}
+
+func appendUint16(b []byte, v int) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
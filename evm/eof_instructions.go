@@ -0,0 +1,142 @@
+package evm
+
+import (
+	"encoding/binary"
+	"github.com/entropyio/go-evm/config"
+	"github.com/holiman/uint256"
+	"math"
+	"sync/atomic"
+)
+
+// ReturnContext is an entry of the EOF return stack, pushed by CALLF and
+// popped by RETF.
+type ReturnContext struct {
+	Section uint64 // Code section to return to
+	Pc      uint64 // Instruction following the CALLF
+}
+
+// opRjump implements the RJUMP opcode.
+func opRjump(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	if atomic.LoadInt32(&interpreter.evm.abort) != 0 {
+		return nil, ErrExecutionAborted
+	}
+	offset := int16(binary.BigEndian.Uint16(scope.Contract.Code[*pc+1:]))
+	// Move past the opcode and the immediate, apply the relative offset and
+	// step back one to account for the increment of the interpreter loop.
+	*pc = uint64(int64(*pc+3) + int64(offset) - 1)
+	return nil, nil
+}
+
+// opRjumpi implements the RJUMPI opcode.
+func opRjumpi(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	if atomic.LoadInt32(&interpreter.evm.abort) != 0 {
+		return nil, ErrExecutionAborted
+	}
+	condition := scope.Stack.pop()
+	if condition.IsZero() {
+		// Not branching, just skip over the immediate.
+		*pc += 2
+		return nil, nil
+	}
+	return opRjump(pc, interpreter, scope)
+}
+
+// opRjumpv implements the RJUMPV opcode.
+func opRjumpv(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	if atomic.LoadInt32(&interpreter.evm.abort) != 0 {
+		return nil, ErrExecutionAborted
+	}
+	var (
+		code     = scope.Contract.Code
+		count    = uint64(code[*pc+1]) + 1
+		caseIdx  = scope.Stack.pop()
+		tableEnd = *pc + 2 + count*2
+	)
+	if !caseIdx.IsUint64() || caseIdx.Uint64() >= count {
+		// Index out of range, fall through past the jump table.
+		*pc = tableEnd - 1
+		return nil, nil
+	}
+	offset := int16(binary.BigEndian.Uint16(code[*pc+2+caseIdx.Uint64()*2:]))
+	*pc = uint64(int64(tableEnd) + int64(offset) - 1)
+	return nil, nil
+}
+
+// opCallf implements the CALLF opcode.
+func opCallf(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	var (
+		section = binary.BigEndian.Uint16(scope.Contract.Code[*pc+1:])
+		typ     = scope.Contract.Container.types[section]
+		params  = interpreter.evm.params()
+	)
+	if have := scope.Stack.len() + int(typ.maxStackHeight) - int(typ.inputs); have > int(params.StackLimit) {
+		return nil, &ErrStackOverflow{stackLen: have, limit: int(params.StackLimit)}
+	}
+	if len(scope.ReturnStack) >= int(config.ReturnStackLimit) {
+		return nil, ErrReturnStackExceeded
+	}
+	scope.ReturnStack = append(scope.ReturnStack, &ReturnContext{
+		Section: scope.Contract.CodeSection,
+		Pc:      *pc + 3,
+	})
+	scope.Contract.setCodeSection(uint64(section))
+	// Start at the first instruction of the callee, this wraps around to zero
+	// once the interpreter loop increments pc.
+	*pc = math.MaxUint64
+	return nil, nil
+}
+
+// opRetf implements the RETF opcode.
+func opRetf(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	// Code validation guarantees RETF is never executed by the outermost
+	// (non-returning) section, so the return stack cannot be empty.
+	last := len(scope.ReturnStack) - 1
+	retCtx := scope.ReturnStack[last]
+	scope.ReturnStack = scope.ReturnStack[:last]
+	scope.Contract.setCodeSection(retCtx.Section)
+	*pc = retCtx.Pc - 1
+	return nil, nil
+}
+
+// opDataLoad implements the DATALOAD opcode.
+func opDataLoad(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	offset := scope.Stack.peek()
+	offset64, overflow := offset.Uint64WithOverflow()
+	if overflow {
+		offset64 = math.MaxUint64
+	}
+	offset.SetBytes(getData(scope.Contract.Container.data, offset64, 32))
+	return nil, nil
+}
+
+// opDataLoadN implements the DATALOADN opcode.
+func opDataLoadN(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	// Code validation guarantees the word is within the data section.
+	offset := uint64(binary.BigEndian.Uint16(scope.Contract.Code[*pc+1:]))
+	scope.Stack.push(new(uint256.Int).SetBytes(scope.Contract.Container.data[offset : offset+32]))
+	*pc += 2
+	return nil, nil
+}
+
+// opDataSize implements the DATASIZE opcode.
+func opDataSize(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	scope.Stack.push(new(uint256.Int).SetUint64(uint64(len(scope.Contract.Container.data))))
+	return nil, nil
+}
+
+// opDataCopy implements the DATACOPY opcode.
+func opDataCopy(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	var (
+		memOffset = scope.Stack.pop()
+		offset    = scope.Stack.pop()
+		size      = scope.Stack.pop()
+	)
+	offset64, overflow := offset.Uint64WithOverflow()
+	if overflow {
+		offset64 = math.MaxUint64
+	}
+	// These values are checked for overflow during gas cost calculation
+	size64 := size.Uint64()
+	scope.Memory.Set(memOffset.Uint64(), size64, getData(scope.Contract.Container.data, offset64, size64))
+	return nil, nil
+}
@@ -0,0 +1,297 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+func TestEOFMarshaling(t *testing.T) {
+	for i, test := range []struct {
+		want Container
+		err  error
+	}{
+		{
+			want: Container{
+				types:        []*functionMetadata{{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 1}},
+				codeSections: [][]byte{common.Hex2Bytes("604200")},
+				data:         []byte{0x01, 0x02, 0x03},
+			},
+		},
+		{
+			want: Container{
+				types:        []*functionMetadata{{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 1}},
+				codeSections: [][]byte{common.Hex2Bytes("604200")},
+				data:         []byte{},
+			},
+		},
+		{
+			want: Container{
+				types: []*functionMetadata{
+					{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 1},
+					{inputs: 2, outputs: 3, maxStackHeight: 4},
+					{inputs: 1, outputs: 1, maxStackHeight: 1},
+				},
+				codeSections: [][]byte{
+					common.Hex2Bytes("604200"),
+					common.Hex2Bytes("6042604200"),
+					common.Hex2Bytes("00"),
+				},
+				data: []byte{},
+			},
+		},
+	} {
+		var (
+			b   = test.want.MarshalBinary()
+			got Container
+		)
+		if err := got.UnmarshalBinary(b); err != nil && err != test.err {
+			t.Fatalf("test %d: got error \"%v\", want \"%v\"", i, err, test.err)
+		}
+		if !bytes.Equal(got.MarshalBinary(), b) {
+			t.Fatalf("test %d: round trip mismatch: have %x, want %x", i, got.MarshalBinary(), b)
+		}
+		if len(got.types) != len(test.want.types) || !bytes.Equal(got.data, test.want.data) {
+			t.Fatalf("test %d: decoded container mismatch", i)
+		}
+	}
+}
+
+func TestEOFContainerErrors(t *testing.T) {
+	valid := (&Container{
+		types:        []*functionMetadata{{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 0}},
+		codeSections: [][]byte{{byte(STOP)}},
+	}).MarshalBinary()
+
+	mutate := func(i int, v byte) []byte {
+		b := common.CopyBytes(valid)
+		b[i] = v
+		return b
+	}
+	for i, test := range []struct {
+		code []byte
+		want error
+	}{
+		{valid, nil},
+		{mutate(1, 0x01), errInvalidMagic},
+		{mutate(2, 0x02), errInvalidVersion},
+		{valid[:3], errIncompleteContainer},
+		{valid[:9], errIncompleteContainer},
+		{mutate(3, kindCode), errMissingTypeHeader},
+		{mutate(5, 0x03), errInvalidTypeSize},
+		{mutate(6, kindData), errMissingCodeHeader},
+		{mutate(8, 0x00), errInvalidCodeHeader},
+		{mutate(8, 0x02), errInvalidCodeHeader},
+		{mutate(10, 0x00), errInvalidCodeSize},
+		{mutate(11, 0x03), errMissingDataHeader},
+		{mutate(14, 0x01), errMissingTerminator},
+		{append(common.CopyBytes(valid), 0x00), errInvalidContainerSize},
+		{valid[:len(valid)-1], errInvalidContainerSize},
+		{mutate(15, 0x01), errInvalidSection0Type},
+		{mutate(16, 0x00), errInvalidSection0Type},
+		{(&Container{
+			types:        []*functionMetadata{{outputs: nonReturningFunction}, {inputs: 128}},
+			codeSections: [][]byte{{byte(STOP)}, {byte(RETF)}},
+		}).MarshalBinary(), errTooManyInputs},
+		{(&Container{
+			types:        []*functionMetadata{{outputs: nonReturningFunction}, {outputs: 0x81}},
+			codeSections: [][]byte{{byte(STOP)}, {byte(RETF)}},
+		}).MarshalBinary(), errTooManyOutputs},
+		{(&Container{
+			types:        []*functionMetadata{{outputs: nonReturningFunction}, {maxStackHeight: 1024}},
+			codeSections: [][]byte{{byte(STOP)}, {byte(RETF)}},
+		}).MarshalBinary(), errTooLargeMaxStackHeight},
+	} {
+		var c Container
+		if err := c.UnmarshalBinary(test.code); !errors.Is(err, test.want) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.want)
+		}
+	}
+}
+
+// eofTestEnv returns an EVM with EOF enabled, operating on an empty state.
+func eofTestEnv() (*EVM, *state.StateDB) {
+	statedb := state.New()
+	return newTestEVM(statedb, config.Rules{IsHomestead: true, IsLondon: true, IsOsaka: true}, EVMConfig{}), statedb
+}
+
+// eofInitcode returns an EOF initcode container deploying the given code.
+func eofInitcode(code []byte) []byte {
+	size := []byte{byte(len(code) >> 8), byte(len(code))}
+	return (&Container{
+		types: []*functionMetadata{{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 3}},
+		codeSections: [][]byte{append(append(append(append(
+			[]byte{byte(PUSH2)}, size...), // size
+			byte(PUSH0), byte(PUSH0), byte(DATACOPY), // copy the data section to memory
+			byte(PUSH2)), size...),
+			byte(PUSH0), byte(RETURN), // return it as code
+		)},
+		data: code,
+	}).MarshalBinary()
+}
+
+func TestEOFExecution(t *testing.T) {
+	data := make([]byte, 32)
+	data[31] = 0x2a
+	runtime := (&Container{
+		types: []*functionMetadata{
+			{inputs: 0, outputs: nonReturningFunction, maxStackHeight: 2},
+			{inputs: 1, outputs: 1, maxStackHeight: 2},
+		},
+		codeSections: [][]byte{
+			{
+				byte(PUSH1), 0x05, byte(CALLF), 0x00, 0x01, // double 5 in section 1
+				byte(PUSH0), byte(SSTORE), // slot 0 = 10
+				byte(DATALOADN), 0x00, 0x00, byte(PUSH1), 0x01, byte(SSTORE), // slot 1 = data word
+				byte(PUSH1), 0x01, byte(RJUMPV), 0x01, 0x00, 0x00, 0x00, 0x06, // switch on 1
+				byte(PUSH1), 0x01, byte(PUSH1), 0x02, byte(SSTORE), byte(STOP), // case 0: slot 2 = 1
+				byte(PUSH1), 0x02, byte(PUSH1), 0x02, byte(SSTORE), byte(STOP), // case 1: slot 2 = 2
+			},
+			{byte(DUP1), byte(ADD), byte(RETF)},
+		},
+		data: data,
+	}).MarshalBinary()
+
+	env, statedb := eofTestEnv()
+	caller := AccountRef(common.BytesToAddress([]byte("caller")))
+
+	_, address, _, err := env.Create(caller, eofInitcode(runtime), 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to deploy EOF contract: %v", err)
+	}
+	if code := statedb.GetCode(address); !bytes.Equal(code, runtime) {
+		t.Fatalf("deployed code mismatch: have %x, want %x", code, runtime)
+	}
+	if _, _, err := env.Call(caller, address, nil, 1000000, new(big.Int)); err != nil {
+		t.Fatalf("failed to call EOF contract: %v", err)
+	}
+	for slot, want := range []common.Hash{
+		common.BytesToHash([]byte{10}),
+		common.BytesToHash(data),
+		common.BytesToHash([]byte{2}),
+	} {
+		if have := statedb.GetState(address, common.BytesToHash([]byte{byte(slot)})); have != want {
+			t.Errorf("slot %d mismatch: have %x, want %x", slot, have, want)
+		}
+	}
+}
+
+func TestEOFReturnStackLimit(t *testing.T) {
+	container := &Container{
+		types:        []*functionMetadata{{outputs: nonReturningFunction}, {outputs: 0}},
+		codeSections: [][]byte{{byte(CALLF), 0x00, 0x01, byte(STOP)}, {byte(RETF)}},
+	}
+	env, _ := eofTestEnv()
+
+	// The return stack limit is fixed, whatever the call depth of the chain
+	params := config.DefaultProtocolParams
+	params.CallCreateDepth = 1
+	env.chainConfig = &config.ChainConfig{ProtocolParams: &params}
+
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(common.Address{}), new(big.Int), 0)
+	contract.Container = container
+	scope := &ScopeContext{Stack: newstack(), Contract: contract}
+	for _, tt := range []struct {
+		depth uint64
+		want  error
+	}{
+		{1, nil},
+		{config.ReturnStackLimit - 1, nil},
+		{config.ReturnStackLimit, ErrReturnStackExceeded},
+	} {
+		contract.setCodeSection(0)
+		scope.ReturnStack = make([]*ReturnContext, tt.depth)
+		pc := uint64(0)
+		if _, err := opCallf(&pc, env.interpreter, scope); err != tt.want {
+			t.Errorf("depth %d: error mismatch: have %v, want %v", tt.depth, err, tt.want)
+		}
+	}
+}
+
+func TestEOFCreateValidation(t *testing.T) {
+	caller := AccountRef(common.BytesToAddress([]byte("caller")))
+	for i, test := range []struct {
+		initcode []byte
+		want     error
+	}{
+		// Invalid EOF initcode is rejected before execution
+		{eofInitcode([]byte{byte(JUMP)})[:10], ErrInvalidEOFInitcode},
+		{(&Container{
+			types:        []*functionMetadata{{outputs: nonReturningFunction}},
+			codeSections: [][]byte{{byte(JUMPDEST), byte(PC)}},
+		}).MarshalBinary(), ErrInvalidEOFInitcode},
+		// EOF initcode must deploy a valid container
+		{eofInitcode([]byte{byte(STOP)}), ErrInvalidEOFCode},
+		{eofInitcode((&Container{
+			types:        []*functionMetadata{{outputs: nonReturningFunction}},
+			codeSections: [][]byte{{byte(PUSH0), byte(STOP)}},
+		}).MarshalBinary()), ErrInvalidEOFCode},
+		// Legacy initcode must not deploy code starting with 0xEF
+		{[]byte{byte(PUSH1), 0xef, byte(PUSH1), 0x00, byte(MSTORE8), byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(RETURN)}, ErrInvalidCode},
+	} {
+		env, _ := eofTestEnv()
+		_, _, gas, err := env.Create(caller, test.initcode, 100000, new(big.Int))
+		if !errors.Is(err, test.want) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.want)
+		}
+		if gas != 0 {
+			t.Errorf("test %d: failed creation left %d gas", i, gas)
+		}
+	}
+}
+
+func TestEOFRun(t *testing.T) {
+	var (
+		caller  = AccountRef(common.BytesToAddress([]byte("caller")))
+		invalid = common.BytesToAddress([]byte("invalid"))
+		broken  = common.BytesToAddress([]byte("broken"))
+	)
+	// sstore(0, 1) if the input is empty, else abort with INVALID
+	code := (&Container{
+		types: []*functionMetadata{{outputs: nonReturningFunction, maxStackHeight: 2}},
+		codeSections: [][]byte{{
+			byte(CALLDATASIZE), byte(RJUMPI), 0x00, 0x05,
+			byte(PUSH1), 0x01, byte(PUSH0), byte(SSTORE), byte(STOP),
+			byte(INVALID),
+		}},
+	}).MarshalBinary()
+
+	env, statedb := eofTestEnv()
+	_, address, _, err := env.Create(caller, eofInitcode(code), 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to deploy EOF contract: %v", err)
+	}
+	// The container is decoded once, then served from the cache
+	if _, _, err := env.Call(caller, address, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	value, ok := containerCache.get(statedb.GetCodeHash(address))
+	if !ok {
+		t.Fatalf("container not cached")
+	}
+	if have := statedb.GetState(address, common.Hash{}); have != common.BytesToHash([]byte{1}) {
+		t.Fatalf("slot mismatch: have %x", have)
+	}
+	contract := NewContract(caller, AccountRef(address), new(big.Int), 0)
+	contract.SetCallCode(&address, statedb.GetCodeHash(address), code)
+	if container, err := contract.loadContainer(); err != nil || container != value.(*Container) {
+		t.Fatalf("cached container not reused: %v", err)
+	}
+	// INVALID aborts the execution, consuming all gas
+	_, gas, err := env.Call(caller, address, []byte{1}, 100000, new(big.Int))
+	if !errors.As(err, new(*ErrInvalidOpCode)) || gas != 0 {
+		t.Errorf("invalid: have (%d, %v), want (0, invalid opcode)", gas, err)
+	}
+	// Code which isn't a valid container can't be run as EOF code
+	statedb.SetCode(invalid, code[:len(code)-1])
+	statedb.SetCode(broken, eofMagic)
+	for _, addr := range []common.Address{invalid, broken} {
+		if _, _, err := env.Call(caller, addr, nil, 100000, new(big.Int)); !errors.Is(err, ErrInvalidEOFCode) {
+			t.Errorf("%x: error mismatch: have %v, want %v", addr, err, ErrInvalidEOFCode)
+		}
+	}
+}
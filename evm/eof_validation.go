@@ -0,0 +1,209 @@
+package evm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// validateCode validates a single code section of an EOF container (EIP-3670,
+// EIP-4200, EIP-4750) and its stack usage (EIP-5450). It returns the indices
+// of the code sections called from it.
+func validateCode(code []byte, section int, container *Container, jt *JumpTable) ([]int, error) {
+	var (
+		isInstruction = make([]bool, len(code))
+		targets       []int
+		callees       []int
+		hasRetf       bool
+		returning     = container.types[section].outputs != nonReturningFunction
+	)
+	for pos := 0; pos < len(code); {
+		op := OpCode(code[pos])
+		if jt[op].undefined {
+			return nil, fmt.Errorf("%w: op %s, pos %d", errUndefinedInstruction, op, pos)
+		}
+		isInstruction[pos] = true
+
+		size := immediateSize(op, code, pos)
+		if pos+size >= len(code) {
+			return nil, fmt.Errorf("%w: op %s, pos %d", errTruncatedImmediate, op, pos)
+		}
+		next := pos + 1 + size
+
+		switch op {
+		case RJUMP, RJUMPI:
+			targets = append(targets, next+int(int16(binary.BigEndian.Uint16(code[pos+1:]))))
+		case RJUMPV:
+			for i := pos + 2; i < next; i += 2 {
+				targets = append(targets, next+int(int16(binary.BigEndian.Uint16(code[i:]))))
+			}
+		case CALLF:
+			arg := int(binary.BigEndian.Uint16(code[pos+1:]))
+			if arg >= len(container.types) {
+				return nil, fmt.Errorf("%w: arg %d, last %d, pos %d", errInvalidSectionArgument, arg, len(container.types)-1, pos)
+			}
+			if container.types[arg].outputs == nonReturningFunction {
+				return nil, fmt.Errorf("%w: section %d, pos %d", errInvalidCallArgument, arg, pos)
+			}
+			callees = append(callees, arg)
+		case RETF:
+			if !returning {
+				return nil, fmt.Errorf("%w: RETF in non-returning section %d, pos %d", errInvalidNonReturning, section, pos)
+			}
+			hasRetf = true
+		case DATALOADN:
+			arg := int(binary.BigEndian.Uint16(code[pos+1:]))
+			if arg+32 > len(container.data) {
+				return nil, fmt.Errorf("%w: arg %d, data size %d, pos %d", errInvalidDataloadNArgument, arg, len(container.data), pos)
+			}
+		}
+		pos = next
+	}
+	if returning && !hasRetf {
+		return nil, fmt.Errorf("%w: returning section %d has no RETF", errInvalidNonReturning, section)
+	}
+	// Relative jumps must land on an instruction within the section.
+	for _, dest := range targets {
+		if dest < 0 || dest >= len(code) || !isInstruction[dest] {
+			return nil, fmt.Errorf("%w: dest %d, section %d", errInvalidJumpDest, dest, section)
+		}
+	}
+	if err := validateControlFlow(code, section, container.types, jt); err != nil {
+		return nil, err
+	}
+	return callees, nil
+}
+
+// validateControlFlow walks the instructions of a code section in order and
+// tracks the range of stack heights each of them can be reached with. Every
+// instruction must be reachable by a forward jump or by falling through, the
+// stack must not underflow or overflow, and backward jumps must not change the
+// stack height. The computed maximum must match the declared one.
+func validateControlFlow(code []byte, section int, types []*functionMetadata, jt *JumpTable) error {
+	var (
+		inputs  = int(types[section].inputs)
+		highest = inputs
+
+		// The stack limit the jump table was built for, STOP neither pops
+		// nor pushes so its max stack is the limit itself.
+		stackLimit = jt[STOP].maxStack
+
+		// Stack height bounds of every instruction, a max of -1 marks
+		// instructions not reached yet.
+		minHeights = make([]int, len(code))
+		maxHeights = make([]int, len(code))
+	)
+	for i := range maxHeights {
+		maxHeights[i] = -1
+	}
+	minHeights[0], maxHeights[0] = inputs, inputs
+
+	// visit merges the stack height bounds flowing from an instruction into
+	// one of its successors.
+	visit := func(from, to, lo, hi int) error {
+		if to >= len(code) {
+			return fmt.Errorf("%w: pos %d", errNoTerminalInstruction, from)
+		}
+		if to <= from {
+			if minHeights[to] != lo || maxHeights[to] != hi {
+				return fmt.Errorf("%w: from pos %d to pos %d, have [%d, %d], want [%d, %d]", errInvalidBackwardJump, from, to, lo, hi, minHeights[to], maxHeights[to])
+			}
+			return nil
+		}
+		if maxHeights[to] == -1 {
+			minHeights[to], maxHeights[to] = lo, hi
+			return nil
+		}
+		if lo < minHeights[to] {
+			minHeights[to] = lo
+		}
+		if hi > maxHeights[to] {
+			maxHeights[to] = hi
+		}
+		return nil
+	}
+	for pos := 0; pos < len(code); {
+		op := OpCode(code[pos])
+		lo, hi := minHeights[pos], maxHeights[pos]
+		if hi == -1 {
+			return fmt.Errorf("%w: pos %d", errUnreachableCode, pos)
+		}
+		var pops, pushes int
+		switch op {
+		case CALLF:
+			callee := types[binary.BigEndian.Uint16(code[pos+1:])]
+			pops, pushes = int(callee.inputs), int(callee.outputs)
+			if have := hi + int(callee.maxStackHeight) - int(callee.inputs); have > stackLimit {
+				return fmt.Errorf("%w: have %d, limit %d, pos %d", errEOFStackOverflow, have, stackLimit, pos)
+			}
+		case RETF:
+			if want := int(types[section].outputs); lo != hi || hi != want {
+				return fmt.Errorf("%w: have [%d, %d], want %d, pos %d", errInvalidOutputs, lo, hi, want, pos)
+			}
+		default:
+			pops = jt[op].minStack
+			pushes = pops + stackLimit - jt[op].maxStack
+			if hi > jt[op].maxStack {
+				return fmt.Errorf("%w: have %d, limit %d, pos %d", errEOFStackOverflow, hi, jt[op].maxStack, pos)
+			}
+		}
+		if lo < pops {
+			return fmt.Errorf("%w: have %d, want %d, pos %d", errEOFStackUnderflow, lo, pops, pos)
+		}
+		lo, hi = lo-pops+pushes, hi-pops+pushes
+		if hi > highest {
+			highest = hi
+		}
+
+		next := pos + 1 + immediateSize(op, code, pos)
+		switch op {
+		case RJUMP:
+			if err := visit(pos, next+int(int16(binary.BigEndian.Uint16(code[pos+1:]))), lo, hi); err != nil {
+				return err
+			}
+		case RJUMPI:
+			if err := visit(pos, next+int(int16(binary.BigEndian.Uint16(code[pos+1:]))), lo, hi); err != nil {
+				return err
+			}
+			if err := visit(pos, next, lo, hi); err != nil {
+				return err
+			}
+		case RJUMPV:
+			for i := pos + 2; i < next; i += 2 {
+				if err := visit(pos, next+int(int16(binary.BigEndian.Uint16(code[i:]))), lo, hi); err != nil {
+					return err
+				}
+			}
+			if err := visit(pos, next, lo, hi); err != nil {
+				return err
+			}
+		case STOP, RETURN, REVERT, INVALID, RETF:
+			// Terminating instructions have no successors.
+		default:
+			if err := visit(pos, next, lo, hi); err != nil {
+				return err
+			}
+		}
+		pos = next
+	}
+	if want := int(types[section].maxStackHeight); highest != want {
+		return fmt.Errorf("%w: have %d, want %d, section %d", errInvalidMaxStackHeight, highest, want, section)
+	}
+	return nil
+}
+
+// immediateSize returns the size of the immediate operand of the instruction
+// at pos. For a truncated RJUMPV the size of the table length is returned.
+func immediateSize(op OpCode, code []byte, pos int) int {
+	switch {
+	case op >= PUSH1 && op <= PUSH32:
+		return int(op - PUSH1 + 1)
+	case op == RJUMP, op == RJUMPI, op == CALLF, op == DATALOADN:
+		return 2
+	case op == RJUMPV:
+		if pos+1 >= len(code) {
+			return 1
+		}
+		return 1 + 2*(int(code[pos+1])+1)
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidateCode(t *testing.T) {
+	for i, test := range []struct {
+		code     []byte
+		maxStack uint16
+		data     []byte
+		want     error
+	}{
+		{
+			code: []byte{byte(STOP)},
+		},
+		{
+			code:     []byte{byte(CALLER), byte(POP), byte(STOP)},
+			maxStack: 1,
+		},
+		{
+			code: []byte{0x0c, byte(STOP)},
+			want: errUndefinedInstruction,
+		},
+		{
+			code:     []byte{byte(PUSH1), 0x00, byte(JUMP)},
+			maxStack: 1,
+			want:     errUndefinedInstruction,
+		},
+		{
+			code: []byte{byte(SELFDESTRUCT)},
+			want: errUndefinedInstruction,
+		},
+		{
+			code: []byte{byte(PUSH2), 0x00},
+			want: errTruncatedImmediate,
+		},
+		{
+			code: []byte{byte(RJUMPV), 0x01, 0x00, 0x00, 0x00},
+			want: errTruncatedImmediate,
+		},
+		{
+			code:     []byte{byte(RJUMP), 0x00, 0x01, byte(PUSH1), 0x00, byte(STOP)},
+			maxStack: 1,
+			want:     errInvalidJumpDest,
+		},
+		{
+			code: []byte{byte(RJUMP), 0x00, 0x05, byte(STOP)},
+			want: errInvalidJumpDest,
+		},
+		{
+			code: []byte{byte(RJUMP), 0xff, 0xf0, byte(STOP)},
+			want: errInvalidJumpDest,
+		},
+		{
+			code: []byte{byte(CALLF), 0x00, 0x01, byte(STOP)},
+			want: errInvalidSectionArgument,
+		},
+		{
+			code: []byte{byte(RETF)},
+			want: errInvalidNonReturning,
+		},
+		{
+			code:     []byte{byte(DATALOADN), 0x00, 0x00, byte(POP), byte(STOP)},
+			maxStack: 1,
+			data:     make([]byte, 32),
+		},
+		{
+			code:     []byte{byte(DATALOADN), 0x00, 0x01, byte(POP), byte(STOP)},
+			maxStack: 1,
+			data:     make([]byte, 32),
+			want:     errInvalidDataloadNArgument,
+		},
+		{
+			code: []byte{byte(INVALID)},
+		},
+		{
+			// Container ending in the designated invalid instruction
+			code:     []byte{byte(PUSH0), byte(RJUMPI), 0x00, 0x01, byte(STOP), byte(INVALID)},
+			maxStack: 1,
+		},
+		{
+			code: []byte{byte(STOP), byte(STOP)},
+			want: errUnreachableCode,
+		},
+		{
+			code:     []byte{byte(RJUMP), 0x00, 0x02, byte(PUSH0), byte(POP), byte(STOP)},
+			maxStack: 0,
+			want:     errUnreachableCode,
+		},
+		{
+			code:     []byte{byte(PUSH1), 0x01, byte(POP)},
+			maxStack: 1,
+			want:     errNoTerminalInstruction,
+		},
+		{
+			code: []byte{byte(POP), byte(STOP)},
+			want: errEOFStackUnderflow,
+		},
+		{
+			code: []byte{byte(CALLER), byte(POP), byte(STOP)},
+			want: errInvalidMaxStackHeight,
+		},
+		{
+			code:     []byte{byte(PUSH1), 0x01, byte(RJUMP), 0xff, 0xfb},
+			maxStack: 1,
+			want:     errInvalidBackwardJump,
+		},
+		{
+			// Loop with a conditional backward jump
+			code:     []byte{byte(PUSH0), byte(RJUMPI), 0xff, 0xfc, byte(STOP)},
+			maxStack: 1,
+		},
+		{
+			// Forward jumps merge into a range of stack heights
+			code:     []byte{byte(PUSH0), byte(RJUMPV), 0x00, 0x00, 0x01, byte(PUSH0), byte(STOP)},
+			maxStack: 1,
+		},
+		{
+			// Return data must not be read from a range of stack heights
+			code:     []byte{byte(PUSH0), byte(RJUMPI), 0x00, 0x01, byte(PUSH0), byte(PUSH0), byte(RETURN)},
+			maxStack: 2,
+			want:     errEOFStackUnderflow,
+		},
+	} {
+		container := &Container{
+			types:        []*functionMetadata{{inputs: 0, outputs: nonReturningFunction, maxStackHeight: test.maxStack}},
+			codeSections: [][]byte{test.code},
+			data:         test.data,
+		}
+		if err := container.ValidateCode(&eofInstructionSet); !errors.Is(err, test.want) {
+			t.Errorf("test %d (%x): error mismatch: have %v, want %v", i, test.code, err, test.want)
+		}
+	}
+}
+
+func TestValidateCodeSections(t *testing.T) {
+	for i, test := range []struct {
+		types []*functionMetadata
+		code  [][]byte
+		want  error
+	}{
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction, maxStackHeight: 2}, {inputs: 2, outputs: 1, maxStackHeight: 2}},
+			code:  [][]byte{{byte(PUSH0), byte(PUSH0), byte(CALLF), 0x00, 0x01, byte(POP), byte(STOP)}, {byte(ADD), byte(RETF)}},
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction, maxStackHeight: 1}, {inputs: 2, outputs: 1, maxStackHeight: 2}},
+			code:  [][]byte{{byte(PUSH0), byte(CALLF), 0x00, 0x01, byte(POP), byte(STOP)}, {byte(ADD), byte(RETF)}},
+			want:  errEOFStackUnderflow,
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction, maxStackHeight: 1}, {outputs: 1}},
+			code:  [][]byte{{byte(CALLF), 0x00, 0x01, byte(POP), byte(STOP)}, {byte(RETF)}},
+			want:  errInvalidOutputs,
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction}, {outputs: nonReturningFunction}},
+			code:  [][]byte{{byte(CALLF), 0x00, 0x01, byte(STOP)}, {byte(STOP)}},
+			want:  errInvalidCallArgument,
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction}, {}},
+			code:  [][]byte{{byte(CALLF), 0x00, 0x01, byte(STOP)}, {byte(STOP)}},
+			want:  errInvalidNonReturning,
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction}, {}},
+			code:  [][]byte{{byte(STOP)}, {byte(RETF)}},
+			want:  errUnreachableCodeSections,
+		},
+		{
+			types: []*functionMetadata{{outputs: nonReturningFunction, maxStackHeight: 1023}, {maxStackHeight: 2}},
+			code:  [][]byte{append(bytes.Repeat([]byte{byte(PUSH0)}, 1023), byte(CALLF), 0x00, 0x01, byte(STOP)), {byte(PUSH0), byte(PUSH0), byte(POP), byte(POP), byte(RETF)}},
+			want:  errEOFStackOverflow,
+		},
+	} {
+		container := &Container{types: test.types, codeSections: test.code}
+		if err := container.ValidateCode(&eofInstructionSet); !errors.Is(err, test.want) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.want)
+		}
+	}
+}
@@ -3,6 +3,10 @@ package evm
 import (
 	"errors"
 	"fmt"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+	"strings"
 )
 
 // List evm execution errors
@@ -20,6 +24,13 @@ var (
 	ErrGasUintOverflow          = errors.New("gas uint64 overflow")
 	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
 	ErrNonceUintOverflow        = errors.New("nonce uint64 overflow")
+	ErrInvalidEOFInitcode       = errors.New("invalid eof initcode")
+	ErrInvalidEOFCode           = errors.New("invalid eof code")
+	ErrReturnStackExceeded      = errors.New("return stack limit reached")
+	ErrCreateDenied             = errors.New("contract creation denied by policy")
+	ErrExecutionAborted         = errors.New("execution aborted")
+	ErrStepLimit                = errors.New("step limit reached")
+	ErrMemoryLimit              = errors.New("memory limit reached")
 
 	// errStopToken is an internal token indicating interpreter loop termination,
 	// never returned to outside callers.
@@ -54,3 +65,147 @@ type ErrInvalidOpCode struct {
 }
 
 func (e *ErrInvalidOpCode) Error() string { return fmt.Sprintf("invalid opcode: %s", e.opcode) }
+
+// ErrOpCodeDenied wraps an evm error when an instruction disabled by the
+// policy is encountered.
+type ErrOpCodeDenied struct {
+	opcode OpCode
+}
+
+func (e *ErrOpCodeDenied) Error() string { return fmt.Sprintf("opcode denied by policy: %s", e.opcode) }
+
+var (
+	// Errors the Solidity compiler reverts with: Error(string) for require
+	// and revert, Panic(uint256) for failed assertions and runtime errors.
+	revertReasonError = newBuiltinError("Error", "string")
+	revertPanicError  = newBuiltinError("Panic", "uint256")
+
+	// panicReasons describes the panic codes of the Solidity compiler.
+	panicReasons = map[uint64]string{
+		0x00: "generic panic",
+		0x01: "assert(false)",
+		0x11: "arithmetic underflow or overflow",
+		0x12: "division or modulo by zero",
+		0x21: "enum overflow",
+		0x22: "invalid encoded storage byte array accessed",
+		0x31: "out-of-bounds array access; popping on an empty array",
+		0x32: "out-of-bounds access of an array or bytesN",
+		0x41: "out of memory",
+		0x51: "uninitialized function",
+	}
+
+	// customErrors are the registered custom errors by selector.
+	customErrors = make(map[[4]byte]abi.Error)
+)
+
+func newBuiltinError(name, typ string) abi.Error {
+	t, err := abi.NewType(typ, nil)
+	if err != nil {
+		panic(err)
+	}
+	return abi.NewError(name, abi.Arguments{{Type: t}})
+}
+
+// RegisterErrors registers the custom errors of a contract ABI, so that the
+// revert data of these errors is decoded by RevertError. Registering an
+// error declared by several contracts is harmless, errors with conflicting
+// selectors are not registered. Registration is not safe for concurrent
+// use, it is meant to happen on startup.
+func RegisterErrors(contractABI abi.ABI) error {
+	for _, custom := range contractABI.Errors {
+		if custom.ID == revertReasonError.ID || custom.ID == revertPanicError.ID {
+			return fmt.Errorf("error %s conflicts with a builtin error", custom.Sig)
+		}
+		if known, ok := customErrors[custom.ID]; ok && known.Sig != custom.Sig {
+			return fmt.Errorf("error %s conflicts with registered error %s", custom.Sig, known.Sig)
+		}
+	}
+	for _, custom := range contractABI.Errors {
+		customErrors[custom.ID] = custom
+	}
+	return nil
+}
+
+// RevertError is returned by a call reverted by the REVERT instruction. It
+// holds the revert data, decoded if it's one of the errors of the Solidity
+// compiler or a registered custom error, and matches ErrExecutionReverted
+// with errors.Is.
+type RevertError struct {
+	Data []byte // Data returned by REVERT
+
+	// Reason is the message of Error(string), the description of the panic
+	// code of Panic(uint256), or the signature of a custom error. It's
+	// empty if the data is not of a known error.
+	Reason string
+	// PanicCode is the code of Panic(uint256), nil for other errors
+	PanicCode *big.Int
+	// Custom is the registered custom error, nil for other errors
+	Custom *abi.Error
+	// Args are the decoded arguments of the custom error
+	Args []interface{}
+}
+
+// NewRevertError returns the error of a call which reverted with the given
+// data, decoding it.
+func NewRevertError(data []byte) *RevertError {
+	e := &RevertError{Data: common.CopyBytes(data)}
+	if len(data) < 4 {
+		return e
+	}
+	var id [4]byte
+	copy(id[:], data)
+
+	switch id {
+	case revertReasonError.ID:
+		if args, err := revertReasonError.Unpack(data); err == nil {
+			e.Reason = args[0].(string)
+		}
+	case revertPanicError.ID:
+		if args, err := revertPanicError.Unpack(data); err == nil {
+			e.PanicCode = args[0].(*big.Int)
+			e.Reason = "unknown panic code"
+			if e.PanicCode.IsUint64() {
+				if reason, ok := panicReasons[e.PanicCode.Uint64()]; ok {
+					e.Reason = reason
+				}
+			}
+		}
+	default:
+		if custom, ok := customErrors[id]; ok {
+			if args, err := custom.Unpack(data); err == nil {
+				e.Custom, e.Args, e.Reason = &custom, args, custom.Sig
+			}
+		}
+	}
+	return e
+}
+
+func (e *RevertError) Error() string {
+	switch {
+	case e.PanicCode != nil:
+		return fmt.Sprintf("%v: panic: %s (%#x)", ErrExecutionReverted, e.Reason, e.PanicCode)
+	case e.Custom != nil:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = fmt.Sprint(arg)
+		}
+		return fmt.Sprintf("%v: %s(%s)", ErrExecutionReverted, e.Custom.Name, strings.Join(args, ", "))
+	case e.Reason != "":
+		return fmt.Sprintf("%v: %s", ErrExecutionReverted, e.Reason)
+	}
+	return ErrExecutionReverted.Error()
+}
+
+func (e *RevertError) Unwrap() error { return ErrExecutionReverted }
+
+// frameError returns the error of a call frame as reported to tracers, with
+// reverts reported as *RevertError.
+func frameError(err error, ret []byte) error {
+	if e, ok := err.(*ExecutionError); ok {
+		return &ExecutionError{Err: frameError(e.Err, ret), Frames: e.Frames}
+	}
+	if err == ErrExecutionReverted {
+		return NewRevertError(ret)
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package evm
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevertError(t *testing.T) {
+	reason, err := revertReasonError.Inputs.Pack("nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overflow, err := revertPanicError.Inputs.Pack(big.NewInt(0x11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := revertPanicError.Inputs.Pack(big.NewInt(0x99))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data   []byte
+		reason string
+		err    string
+	}{
+		{nil, "", "execution reverted"},
+		{[]byte("nope"), "", "execution reverted"},
+		{append(revertReasonError.ID[:], reason...), "nope", "execution reverted: nope"},
+		{append(revertReasonError.ID[:], reason[:32]...), "", "execution reverted"},
+		{append(revertPanicError.ID[:], overflow...), "arithmetic underflow or overflow", "execution reverted: panic: arithmetic underflow or overflow (0x11)"},
+		{append(revertPanicError.ID[:], unknown...), "unknown panic code", "execution reverted: panic: unknown panic code (0x99)"},
+	}
+	for i, tt := range tests {
+		revert := NewRevertError(tt.data)
+		if revert.Reason != tt.reason || revert.Error() != tt.err {
+			t.Errorf("test %d: revert error mismatch: have %q (%s), want %q (%s)", i, revert.Reason, revert, tt.reason, tt.err)
+		}
+		if !errors.Is(revert, ErrExecutionReverted) {
+			t.Errorf("test %d: revert error doesn't match ErrExecutionReverted", i)
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	defer func() { customErrors = make(map[[4]byte]abi.Error) }()
+
+	parsed, err := abi.JSON(strings.NewReader(`[
+		{"type": "error", "name": "InsufficientBalance", "inputs": [{"name": "available", "type": "uint256"}, {"name": "required", "type": "uint256"}]},
+		{"type": "error", "name": "Unauthorized", "inputs": []}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := parsed.Errors["InsufficientBalance"]
+	args, err := custom.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(custom.ID[:], args...)
+
+	// Unregistered errors are not decoded
+	if revert := NewRevertError(data); revert.Custom != nil || revert.Error() != "execution reverted" {
+		t.Errorf("unregistered error decoded: %v", revert)
+	}
+	if err := RegisterErrors(parsed); err != nil {
+		t.Fatalf("failed to register errors: %v", err)
+	}
+	if err := RegisterErrors(parsed); err != nil {
+		t.Fatalf("failed to register errors twice: %v", err)
+	}
+	revert := NewRevertError(data)
+	if revert.Custom == nil || revert.Custom.Name != "InsufficientBalance" || len(revert.Args) != 2 {
+		t.Fatalf("custom error mismatch: %+v", revert)
+	}
+	if have, want := revert.Error(), "execution reverted: InsufficientBalance(1, 2)"; have != want {
+		t.Errorf("error message mismatch: have %q, want %q", have, want)
+	}
+	unauthorized := parsed.Errors["Unauthorized"]
+	if revert := NewRevertError(unauthorized.ID[:]); revert.Reason != "Unauthorized()" {
+		t.Errorf("custom error without arguments mismatch: %+v", revert)
+	}
+
+	// Errors conflicting with the builtin ones are rejected
+	builtin, err := abi.JSON(strings.NewReader(`[{"type": "error", "name": "Error", "inputs": [{"name": "", "type": "string"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterErrors(builtin); err == nil {
+		t.Errorf("expected error registering builtin error")
+	}
+}
+
+// revertTracer records the errors of the call frames.
+type revertTracer struct {
+	noopLogger
+
+	errs []error
+}
+
+func (t *revertTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.errs = append(t.errs, err)
+}
+
+func (t *revertTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.errs = append(t.errs, err)
+}
+
+func TestRevertErrorTracing(t *testing.T) {
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		contract = common.BytesToAddress([]byte("contract"))
+		proxy    = common.BytesToAddress([]byte("proxy"))
+		tracer   = new(revertTracer)
+		statedb  = state.New()
+	)
+	// revert(Panic(0x11))
+	statedb.SetCode(contract, common.Hex2Bytes("634e487b71"+"60e01b600052"+"6011600452"+"60246000fd"))
+	// call(gas, contract, 0, 0, 0, 0, 0)
+	statedb.SetCode(proxy, common.Hex2Bytes("60006000600060006000"+"73"+common.Bytes2Hex(contract[:])+"5af1"+"00"))
+
+	env := newTestEVM(statedb, londonTestRules, EVMConfig{
+		Debug:     true,
+		Tracer:    tracer,
+		JumpTable: &londonInstructionSet,
+	})
+
+	ret, _, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+	if err != ErrExecutionReverted || len(ret) != 36 {
+		t.Fatalf("call result mismatch: %x, %v", ret, err)
+	}
+	if _, _, err := env.Call(AccountRef(caller), proxy, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("proxy call failed: %v", err)
+	}
+	// The reverted frames are reported with decoded errors, the top frame
+	// and the inner one
+	if len(tracer.errs) != 3 || tracer.errs[2] != nil {
+		t.Fatalf("frame errors mismatch: %v", tracer.errs)
+	}
+	for _, err := range tracer.errs[:2] {
+		var revert *RevertError
+		if !errors.As(err, &revert) || revert.PanicCode.Int64() != 0x11 {
+			t.Errorf("frame error mismatch: %v", err)
+		}
+	}
+}
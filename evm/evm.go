@@ -1,12 +1,17 @@
 package evm
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/entropyio/go-evm/common"
 	"github.com/entropyio/go-evm/common/crypto"
 	"github.com/entropyio/go-evm/config"
 	"github.com/entropyio/go-evm/logger"
+	"github.com/entropyio/go-evm/model"
 	"github.com/holiman/uint256"
 	"math/big"
+	"sort"
 	"sync/atomic"
 	"time"
 )
@@ -27,12 +32,47 @@ type (
 	GetHashFunc func(uint64) common.Hash
 )
 
+// precompile returns the precompiled contract at addr, if any. Contracts
+// registered through the configuration override the built-in ones.
 func (evm *EVM) precompile(addr common.Address) (PrecompiledContract, bool) {
-	preCompiles := PrecompiledContractsHomestead
-	p, ok := preCompiles[addr]
+	if p, ok := evm.Config.Precompiles[addr]; ok {
+		return p, true
+	}
+	if params := evm.params(); params != &config.DefaultProtocolParams {
+		if evm.precompiles == nil {
+			evm.precompiles = newPrecompiledContracts(evm.chainRules, params)
+		}
+		p, ok := evm.precompiles[addr]
+		return p, ok
+	}
+	p, ok := activePrecompiledContracts(evm.chainRules)[addr]
 	return p, ok
 }
 
+// ActivePrecompiles returns the addresses of all precompiled contracts
+// available to the EVM, both built-in and registered through the
+// configuration, the latter sorted after the former. These are to be warmed
+// in the access list of a transaction.
+func (evm *EVM) ActivePrecompiles() []common.Address {
+	builtin := ActivePrecompiles(evm.chainRules)
+	if len(evm.Config.Precompiles) == 0 {
+		return builtin
+	}
+	var (
+		active = activePrecompiledContracts(evm.chainRules)
+		custom = make([]common.Address, 0, len(evm.Config.Precompiles))
+	)
+	for addr := range evm.Config.Precompiles {
+		if _, ok := active[addr]; !ok {
+			custom = append(custom, addr)
+		}
+	}
+	sort.Slice(custom, func(i, j int) bool {
+		return bytes.Compare(custom[i][:], custom[j][:]) < 0
+	})
+	return append(append(make([]common.Address, 0, len(builtin)+len(custom)), builtin...), custom...)
+}
+
 // BlockContext provides the EVM with auxiliary information. Once provided
 // it shouldn't be modified.
 type BlockContext struct {
@@ -52,6 +92,7 @@ type BlockContext struct {
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
 	BaseFee     *big.Int       // Provides information for BASEFEE
 	Random      *common.Hash   // Provides information for RANDOM
+	BeaconRoot  *common.Hash   // Parent beacon block root, stored by the EIP-4788 system call
 }
 
 // TxContext provides the EVM with information about a transaction.
@@ -70,7 +111,10 @@ type TxContext struct {
 // specific errors should ever be performed. The interpreter makes
 // sure that any errors generated are to be considered faulty code.
 //
-// The EVM should never be reused and is not thread safe.
+// The EVM can be reused for further transactions once an execution has
+// returned, after a Reset for a transaction of the same block or a ResetBlock
+// for one of another block of the same fork. It is not thread safe and must
+// not be used by several goroutines at once.
 type EVM struct {
 	// Context provides auxiliary blockchain related information
 	BlockContext
@@ -90,10 +134,17 @@ type EVM struct {
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// precompiles holds the built-in precompiled contracts priced with the
+	// custom protocol parameters of the chain, if any. Populated on first use.
+	precompiles map[common.Address]PrecompiledContract
+	// traceFrames are the executing frames and failedFrames the failing ones
+	// of the top-level frame, tracked if stack traces are enabled.
+	traceFrames  []*traceFrame
+	failedFrames []Frame
 }
 
-// NewEVM returns a new EVM. The returned EVM is not thread safe and should
-// only ever be used *once*.
+// NewEVM returns a new EVM. The returned EVM is not thread safe, it may only be
+// reused for further transactions after a Reset or ResetBlock.
 func NewEVM(blockCtx BlockContext, txCtx TxContext, config EVMConfig) *EVM {
 	evm := &EVM{
 		BlockContext: blockCtx,
@@ -104,11 +155,44 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, config EVMConfig) *EVM {
 	return evm
 }
 
-// Reset resets the EVM with a new transaction context.Reset
+// NewEVMWithChainConfig returns a new EVM like NewEVM, executing with the rules
+// chainConfig defines at the block of blockCtx and with its protocol
+// parameters.
+func NewEVMWithChainConfig(blockCtx BlockContext, txCtx TxContext, chainConfig *config.ChainConfig, cfg EVMConfig) *EVM {
+	evm := &EVM{
+		BlockContext: blockCtx,
+		TxContext:    txCtx,
+		EVMConfig:    cfg,
+		chainConfig:  chainConfig,
+		chainRules:   chainConfig.Rules(blockCtx.BlockNumber, blockCtx.Random != nil),
+	}
+	evm.interpreter = NewEVMInterpreter(evm, cfg)
+	return evm
+}
+
+// Reset resets the EVM with a new transaction context and state, so that it
+// can execute another transaction of the same block. A cancellation of the
+// previous execution is cleared.
 // This is not threadsafe and should only be done very cautiously.
 func (evm *EVM) Reset(txCtx TxContext, statedb StateDB) {
 	evm.TxContext = txCtx
 	evm.StateDB = statedb
+	atomic.StoreInt32(&evm.abort, 0)
+	evm.callGasTemp = 0
+	evm.interpreter.readOnly = false
+	evm.interpreter.returnData = nil
+	evm.interpreter.steps = 0
+}
+
+// ResetBlock resets the EVM with a new block context, transaction context and
+// state, so that it can execute a transaction of another block. The chain
+// rules the EVM was created with are kept, the block must belong to the same
+// fork.
+// This is not threadsafe and should only be done very cautiously.
+func (evm *EVM) ResetBlock(blockCtx BlockContext, txCtx TxContext, statedb StateDB) {
+	evm.BlockContext = blockCtx
+	evm.Context = blockCtx
+	evm.Reset(txCtx, statedb)
 }
 
 // Cancel cancels any running EVM operation. This may be called concurrently and
@@ -122,6 +206,31 @@ func (evm *EVM) Cancelled() bool {
 	return atomic.LoadInt32(&evm.abort) == 1
 }
 
+// watchContext cancels the EVM once ctx is done. The returned function stops
+// watching, it must be called when the execution ends.
+func (evm *EVM) watchContext(ctx context.Context) func() {
+	if ctx.Err() != nil {
+		evm.Cancel()
+	}
+	if ctx.Done() == nil || evm.Cancelled() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// params returns the gas prices and execution limits of the chain.
+func (evm *EVM) params() *config.ProtocolParams {
+	return evm.chainConfig.Params()
+}
+
 // Interpreter returns the current interpreter
 func (evm *EVM) Interpreter() *EVMInterpreter {
 	return evm.interpreter
@@ -133,7 +242,7 @@ func (evm *EVM) Interpreter() *EVMInterpreter {
 // execution error or failed value transfer.
 func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
 	// Fail if we're trying to execute above the call depth limit
-	if evm.depth > int(config.CallCreateDepth) {
+	if evm.depth > int(evm.params().CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 	// Fail if we're trying to transfer more than the available balance
@@ -166,23 +275,23 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		if evm.depth == 0 {
 			evm.Config.Tracer.CaptureStart(evm, caller.Address(), addr, false, input, gas, value)
 			defer func(startGas uint64, startTime time.Time) { // Lazy evaluation of the parameters
-				evm.Config.Tracer.CaptureEnd(ret, startGas-gas, time.Since(startTime), err)
+				evm.Config.Tracer.CaptureEnd(ret, startGas-gas, time.Since(startTime), frameError(err, ret))
 			}(gas, time.Now())
 		} else {
 			// Handle tracer events for entering and exiting a call frame
 			evm.Config.Tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
 			defer func(startGas uint64) {
-				evm.Config.Tracer.CaptureExit(ret, startGas-gas, err)
+				evm.Config.Tracer.CaptureExit(ret, startGas-gas, frameError(err, ret))
 			}(gas)
 		}
 	}
 
 	if isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas)
+		ret, gas, err = evm.runPrecompiledContract(p, caller.Address(), addr, value, false, input, gas)
 	} else {
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		// The contract is a scoped environment for this execution context only.
-		code := evm.StateDB.GetCode(addr)
+		code := evm.resolveCode(addr)
 		if len(code) == 0 {
 			ret, err = nil, nil // gas is unchanged
 		} else {
@@ -190,8 +299,8 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 			// If the account has no code, we can abort here
 			// The depth-check is already done, and precompiles handled above
 			contract := NewContract(caller, AccountRef(addrCopy), value, gas)
-			contract.SetCallCode(&addrCopy, evm.StateDB.GetCodeHash(addrCopy), code)
-			ret, err = evm.interpreter.Run(contract, input, false)
+			contract.SetCallCode(&addrCopy, evm.resolveCodeHash(addrCopy), code)
+			ret, err = evm.run(CALL, contract, input, false)
 			gas = contract.Gas
 		}
 	}
@@ -208,7 +317,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	}
 
 	log.Warningf("contract run result=%x, gas=%d, err=", ret, gas, err)
-	return ret, gas, err
+	return ret, gas, evm.stackTrace(err)
 }
 
 // CallCode executes the contract associated with the addr with the given input
@@ -220,7 +329,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 // code with the caller as context.
 func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
 	// Fail if we're trying to execute above the call depth limit
-	if evm.depth > int(config.CallCreateDepth) {
+	if evm.depth > int(evm.params().CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 	// Fail if we're trying to transfer more than the available balance
@@ -236,20 +345,20 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	if evm.Config.Debug {
 		evm.Config.Tracer.CaptureEnter(CALLCODE, caller.Address(), addr, input, gas, value)
 		defer func(startGas uint64) {
-			evm.Config.Tracer.CaptureExit(ret, startGas-gas, err)
+			evm.Config.Tracer.CaptureExit(ret, startGas-gas, frameError(err, ret))
 		}(gas)
 	}
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas)
+		ret, gas, err = evm.runPrecompiledContract(p, caller.Address(), caller.Address(), value, false, input, gas)
 	} else {
 		addrCopy := addr
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		// The contract is a scoped environment for this execution context only.
 		contract := NewContract(caller, AccountRef(caller.Address()), value, gas)
-		contract.SetCallCode(&addrCopy, evm.StateDB.GetCodeHash(addrCopy), evm.StateDB.GetCode(addrCopy))
-		ret, err = evm.interpreter.Run(contract, input, false)
+		contract.SetCallCode(&addrCopy, evm.resolveCodeHash(addrCopy), evm.resolveCode(addrCopy))
+		ret, err = evm.run(CALLCODE, contract, input, false)
 		gas = contract.Gas
 	}
 	if err != nil {
@@ -258,7 +367,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 			gas = 0
 		}
 	}
-	return ret, gas, err
+	return ret, gas, evm.stackTrace(err)
 }
 
 // DelegateCall executes the contract associated with the addr with the given input
@@ -268,7 +377,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 // code with the caller as context and the caller is set to the caller of the caller.
 func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
 	// Fail if we're trying to execute above the call depth limit
-	if evm.depth > int(config.CallCreateDepth) {
+	if evm.depth > int(evm.params().CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 	var snapshot = evm.StateDB.Snapshot()
@@ -277,19 +386,26 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	if evm.Config.Debug {
 		evm.Config.Tracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, input, gas, nil)
 		defer func(startGas uint64) {
-			evm.Config.Tracer.CaptureExit(ret, startGas-gas, err)
+			evm.Config.Tracer.CaptureExit(ret, startGas-gas, frameError(err, ret))
 		}(gas)
 	}
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas)
+		// The sender and value of the delegated call are those of the caller's
+		// frame. Callers other than contracts have no frame, they are the
+		// sender and transfer no value.
+		sender, value := caller.Address(), new(big.Int)
+		if parent, ok := caller.(*Contract); ok {
+			sender, value = parent.CallerAddress, parent.value
+		}
+		ret, gas, err = evm.runPrecompiledContract(p, sender, caller.Address(), value, false, input, gas)
 	} else {
 		addrCopy := addr
 		// Initialise a new contract and make initialise the delegate values
 		contract := NewContract(caller, AccountRef(caller.Address()), nil, gas).AsDelegate()
-		contract.SetCallCode(&addrCopy, evm.StateDB.GetCodeHash(addrCopy), evm.StateDB.GetCode(addrCopy))
-		ret, err = evm.interpreter.Run(contract, input, false)
+		contract.SetCallCode(&addrCopy, evm.resolveCodeHash(addrCopy), evm.resolveCode(addrCopy))
+		ret, err = evm.run(DELEGATECALL, contract, input, false)
 		gas = contract.Gas
 	}
 	if err != nil {
@@ -298,7 +414,7 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 			gas = 0
 		}
 	}
-	return ret, gas, err
+	return ret, gas, evm.stackTrace(err)
 }
 
 // StaticCall executes the contract associated with the addr with the given input
@@ -307,7 +423,7 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 // instead of performing the modifications.
 func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
 	// Fail if we're trying to execute above the call depth limit
-	if evm.depth > int(config.CallCreateDepth) {
+	if evm.depth > int(evm.params().CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 	// We take a snapshot here. This is a bit counter-intuitive, and could probably be skipped.
@@ -327,12 +443,12 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	if evm.Config.Debug {
 		evm.Config.Tracer.CaptureEnter(STATICCALL, caller.Address(), addr, input, gas, nil)
 		defer func(startGas uint64) {
-			evm.Config.Tracer.CaptureExit(ret, startGas-gas, err)
+			evm.Config.Tracer.CaptureExit(ret, startGas-gas, frameError(err, ret))
 		}(gas)
 	}
 
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas)
+		ret, gas, err = evm.runPrecompiledContract(p, caller.Address(), addr, new(big.Int), true, input, gas)
 	} else {
 		// At this point, we use a copy of address. If we don't, the go compiler will
 		// leak the 'contract' to the outer scope, and make allocation for 'contract'
@@ -341,11 +457,11 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		// The contract is a scoped environment for this execution context only.
 		contract := NewContract(caller, AccountRef(addrCopy), new(big.Int), gas)
-		contract.SetCallCode(&addrCopy, evm.StateDB.GetCodeHash(addrCopy), evm.StateDB.GetCode(addrCopy))
+		contract.SetCallCode(&addrCopy, evm.resolveCodeHash(addrCopy), evm.resolveCode(addrCopy))
 		// When an error was returned by the EVM or when setting the creation code
 		// above we revert to the snapshot and consume any gas remaining. Additionally
 		// when we're in Homestead this also counts for code storage gas errors.
-		ret, err = evm.interpreter.Run(contract, input, true)
+		ret, err = evm.run(STATICCALL, contract, input, true)
 		gas = contract.Gas
 	}
 	if err != nil {
@@ -354,7 +470,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 			gas = 0
 		}
 	}
-	return ret, gas, err
+	return ret, gas, evm.stackTrace(err)
 }
 
 type codeAndHash struct {
@@ -373,9 +489,13 @@ func (c *codeAndHash) Hash() common.Hash {
 func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address, typ OpCode) ([]byte, common.Address, uint64, error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
-	if evm.depth > int(config.CallCreateDepth) {
+	if evm.depth > int(evm.params().CallCreateDepth) {
 		return nil, common.Address{}, gas, ErrDepth
 	}
+	if policy := evm.Config.Policy; policy != nil && !policy.AllowCreate(evm.Origin, caller.Address()) {
+		evm.capturePolicyDenial(typ, caller.Address(), ErrCreateDenied)
+		return nil, common.Address{}, gas, ErrCreateDenied
+	}
 	if !evm.Context.CanTransfer(evm.StateDB, caller.Address(), value) {
 		return nil, common.Address{}, gas, ErrInsufficientBalance
 	}
@@ -409,15 +529,29 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 
 	start := time.Now()
 
-	ret, err := evm.interpreter.Run(contract, nil, false)
+	var (
+		ret []byte
+		err error
+	)
+	// EOF initcode is validated before execution, an invalid container
+	// aborts the creation.
+	if evm.interpreter.eofTable != nil && hasEOFMagic(codeAndHash.code) {
+		err = evm.loadInitcodeContainer(contract, codeAndHash.code)
+	}
+	if err == nil {
+		ret, err = evm.run(typ, contract, nil, false)
+	}
 
 	// Check whether the max code size has been exceeded, assign err if the case.
-	if err == nil && len(ret) > config.MaxCodeSize {
+	if err == nil && uint64(len(ret)) > evm.params().MaxCodeSize {
 		err = ErrMaxCodeSizeExceeded
 	}
 
-	// Reject code starting with 0xEF if EIP-3541 is enabled.
-	if err == nil && len(ret) >= 1 && ret[0] == 0xEF && evm.chainRules.IsLondon {
+	// Reject code starting with 0xEF if EIP-3541 is enabled. EOF initcode
+	// must in turn deploy a valid EOF container.
+	if err == nil && contract.Container != nil {
+		err = evm.validateDeployedContainer(ret)
+	} else if err == nil && len(ret) >= 1 && ret[0] == 0xEF && evm.chainRules.IsLondon {
 		err = ErrInvalidCode
 	}
 
@@ -426,7 +560,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	// be stored due to not enough gas set an error and let it be handled
 	// by the error checking condition below.
 	if err == nil {
-		createDataGas := uint64(len(ret)) * config.CreateDataGas
+		createDataGas := uint64(len(ret)) * evm.params().CreateDataGas
 		if contract.UseGas(createDataGas) {
 			evm.StateDB.SetCode(address, ret)
 		} else {
@@ -446,12 +580,39 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 
 	if evm.Config.Debug {
 		if evm.depth == 0 {
-			evm.Config.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
+			evm.Config.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), frameError(err, ret))
 		} else {
-			evm.Config.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+			evm.Config.Tracer.CaptureExit(ret, gas-contract.Gas, frameError(err, ret))
 		}
 	}
-	return ret, address, contract.Gas, err
+	return ret, address, contract.Gas, evm.stackTrace(err)
+}
+
+// loadInitcodeContainer decodes and validates EOF initcode and attaches the
+// container to the contract executing it.
+func (evm *EVM) loadInitcodeContainer(contract *Contract, code []byte) error {
+	container := new(Container)
+	if err := container.UnmarshalBinary(code); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEOFInitcode, err)
+	}
+	if err := container.ValidateCode(evm.interpreter.eofTable); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEOFInitcode, err)
+	}
+	contract.setContainer(container)
+	return nil
+}
+
+// validateDeployedContainer checks that the code returned by EOF initcode is
+// a valid EOF container.
+func (evm *EVM) validateDeployedContainer(code []byte) error {
+	container := new(Container)
+	if err := container.UnmarshalBinary(code); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEOFCode, err)
+	}
+	if err := container.ValidateCode(evm.interpreter.eofTable); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEOFCode, err)
+	}
+	return nil
 }
 
 // Create creates a new contract using code as deployment code.
@@ -470,5 +631,52 @@ func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *
 	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CREATE2)
 }
 
+// resolveCode returns the code associated with the provided account. After
+// Prague, it can also resolve code pointed to by a delegation designator.
+func (evm *EVM) resolveCode(addr common.Address) []byte {
+	code := evm.StateDB.GetCode(addr)
+	if !evm.chainRules.IsPrague {
+		return code
+	}
+	if target, ok := model.ParseDelegation(code); ok {
+		// Note we only follow one level of delegation.
+		return evm.StateDB.GetCode(target)
+	}
+	return code
+}
+
+// resolveCodeHash returns the code hash associated with the provided address.
+// After Prague, it can also resolve code hash of the account pointed to by a
+// delegation designator. Although this is not accessible in the EVM it is used
+// internally to associate jumpdest analysis to code.
+func (evm *EVM) resolveCodeHash(addr common.Address) common.Hash {
+	if evm.chainRules.IsPrague {
+		code := evm.StateDB.GetCode(addr)
+		if target, ok := model.ParseDelegation(code); ok {
+			// Note we only follow one level of delegation.
+			return evm.StateDB.GetCodeHash(target)
+		}
+	}
+	return evm.StateDB.GetCodeHash(addr)
+}
+
+// blockHash returns the hash of the given ancestor block. From Prague on the
+// EIP-2935 history contract is read for the blocks it serves, the ones whose
+// child was processed from the fork on, even if the stored hash is zero. The
+// blocks preceding the fork are resolved with the GetHash callback.
+func (evm *EVM) blockHash(num uint64) common.Hash {
+	if evm.chainRules.IsPrague && (evm.chainConfig == nil || evm.chainConfig.IsPrague(new(big.Int).SetUint64(num+1))) {
+		slot := common.Hash(new(uint256.Int).SetUint64(num % config.HistoryServeWindow).Bytes32())
+		return evm.StateDB.GetState(config.HistoryStorageAddress, slot)
+	}
+	if evm.Context.GetHash == nil {
+		return common.Hash{}
+	}
+	return evm.Context.GetHash(num)
+}
+
 // ChainConfig returns the environment's chain configuration
 func (evm *EVM) ChainConfig() *config.ChainConfig { return evm.chainConfig }
+
+// Rules returns the chain rules the environment executes with
+func (evm *EVM) Rules() config.Rules { return evm.chainRules }
@@ -9,7 +9,7 @@ import (
 
 // memoryGasCost calculates the quadratic gas for memory expansion. It does so
 // only for the memory region that is expanded, not the total memory.
-func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
+func memoryGasCost(p *config.ProtocolParams, mem *Memory, newMemSize uint64) (uint64, error) {
 	if newMemSize == 0 {
 		return 0, nil
 	}
@@ -26,8 +26,8 @@ func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
 
 	if newMemSize > uint64(mem.Len()) {
 		square := newMemSizeWords * newMemSizeWords
-		linCoef := newMemSizeWords * config.MemoryGas
-		quadCoef := square / config.QuadCoeffDiv
+		linCoef := newMemSizeWords * p.MemoryGas
+		quadCoef := square / p.QuadCoeffDiv
 		newTotalFee := linCoef + quadCoef
 
 		fee := newTotalFee - mem.lastGasCost
@@ -48,17 +48,17 @@ func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
 func memoryCopierGas(stackpos int) gasFunc {
 	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 		// Gas for expanding the memory
-		gas, err := memoryGasCost(mem, memorySize)
+		gas, err := memoryGasCost(evm.params(), mem, memorySize)
 		if err != nil {
 			return 0, err
 		}
-		// And gas for copying data, charged per word at param.CopyGas
+		// And gas for copying data, charged per word at CopyGas
 		words, overflow := stack.Back(stackpos).Uint64WithOverflow()
 		if overflow {
 			return 0, ErrGasUintOverflow
 		}
 
-		if words, overflow = mathutil.SafeMul(toWordSize(words), config.CopyGas); overflow {
+		if words, overflow = mathutil.SafeMul(toWordSize(words), evm.params().CopyGas); overflow {
 			return 0, ErrGasUintOverflow
 		}
 
@@ -74,6 +74,7 @@ var (
 	gasCodeCopy       = memoryCopierGas(2)
 	gasExtCodeCopy    = memoryCopierGas(3)
 	gasReturnDataCopy = memoryCopierGas(2)
+	gasDataCopy       = memoryCopierGas(2)
 )
 
 func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
@@ -97,33 +98,33 @@ func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySi
 	// 	     2.2.2.2. Otherwise, add 4800 gas to refund counter.
 	value := common.Hash(y.Bytes32())
 	if current == value { // noop (1)
-		return config.NetSstoreNoopGas, nil
+		return evm.params().NetSstoreNoopGas, nil
 	}
 	original := evm.StateDB.GetCommittedState(contract.Address(), x.Bytes32())
 	if original == current {
 		if original == (common.Hash{}) { // create slot (2.1.1)
-			return config.NetSstoreInitGas, nil
+			return evm.params().NetSstoreInitGas, nil
 		}
 		if value == (common.Hash{}) { // delete slot (2.1.2b)
-			evm.StateDB.AddRefund(config.NetSstoreClearRefund)
+			evm.StateDB.AddRefund(evm.params().NetSstoreClearRefund)
 		}
-		return config.NetSstoreCleanGas, nil // write existing slot (2.1.2)
+		return evm.params().NetSstoreCleanGas, nil // write existing slot (2.1.2)
 	}
 	if original != (common.Hash{}) {
 		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
-			evm.StateDB.SubRefund(config.NetSstoreClearRefund)
+			evm.StateDB.SubRefund(evm.params().NetSstoreClearRefund)
 		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
-			evm.StateDB.AddRefund(config.NetSstoreClearRefund)
+			evm.StateDB.AddRefund(evm.params().NetSstoreClearRefund)
 		}
 	}
 	if original == value {
 		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
-			evm.StateDB.AddRefund(config.NetSstoreResetClearRefund)
+			evm.StateDB.AddRefund(evm.params().NetSstoreResetClearRefund)
 		} else { // reset to original existing slot (2.2.2.2)
-			evm.StateDB.AddRefund(config.NetSstoreResetRefund)
+			evm.StateDB.AddRefund(evm.params().NetSstoreResetRefund)
 		}
 	}
-	return config.NetSstoreDirtyGas, nil
+	return evm.params().NetSstoreDirtyGas, nil
 }
 
 // 0. If *gasleft* is less than or equal to 2300, fail the current call.
@@ -141,7 +142,7 @@ func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySi
 //       2.2.2.2. Otherwise, add SSTORE_RESET_GAS - SLOAD_GAS gas to refund counter.
 func gasSStoreEIP2200(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	// If we fail the minimum gas availability invariant, fail (0)
-	if contract.Gas <= config.SstoreSentryGasEIP2200 {
+	if contract.Gas <= evm.params().SstoreSentryGasEIP2200 {
 		return 0, errors.New("not enough gas for reentrancy sentry")
 	}
 	// Gas sentry honoured, do the actual gas calculation based on the stored value
@@ -152,33 +153,33 @@ func gasSStoreEIP2200(evm *EVM, contract *Contract, stack *Stack, mem *Memory, m
 	value := common.Hash(y.Bytes32())
 
 	if current == value { // noop (1)
-		return config.SloadGasEIP2200, nil
+		return evm.params().SloadGasEIP2200, nil
 	}
 	original := evm.StateDB.GetCommittedState(contract.Address(), x.Bytes32())
 	if original == current {
 		if original == (common.Hash{}) { // create slot (2.1.1)
-			return config.SstoreSetGasEIP2200, nil
+			return evm.params().SstoreSetGasEIP2200, nil
 		}
 		if value == (common.Hash{}) { // delete slot (2.1.2b)
-			evm.StateDB.AddRefund(config.SstoreClearsScheduleRefundEIP2200)
+			evm.StateDB.AddRefund(evm.params().SstoreClearsScheduleRefundEIP2200)
 		}
-		return config.SstoreResetGasEIP2200, nil // write existing slot (2.1.2)
+		return evm.params().SstoreResetGasEIP2200, nil // write existing slot (2.1.2)
 	}
 	if original != (common.Hash{}) {
 		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
-			evm.StateDB.SubRefund(config.SstoreClearsScheduleRefundEIP2200)
+			evm.StateDB.SubRefund(evm.params().SstoreClearsScheduleRefundEIP2200)
 		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
-			evm.StateDB.AddRefund(config.SstoreClearsScheduleRefundEIP2200)
+			evm.StateDB.AddRefund(evm.params().SstoreClearsScheduleRefundEIP2200)
 		}
 	}
 	if original == value {
 		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
-			evm.StateDB.AddRefund(config.SstoreSetGasEIP2200 - config.SloadGasEIP2200)
+			evm.StateDB.AddRefund(evm.params().SstoreSetGasEIP2200 - evm.params().SloadGasEIP2200)
 		} else { // reset to original existing slot (2.2.2.2)
-			evm.StateDB.AddRefund(config.SstoreResetGasEIP2200 - config.SloadGasEIP2200)
+			evm.StateDB.AddRefund(evm.params().SstoreResetGasEIP2200 - evm.params().SloadGasEIP2200)
 		}
 	}
-	return config.SloadGasEIP2200, nil // dirty update (2.2)
+	return evm.params().SloadGasEIP2200, nil // dirty update (2.2)
 }
 
 func makeGasLog(n uint64) gasFunc {
@@ -188,20 +189,20 @@ func makeGasLog(n uint64) gasFunc {
 			return 0, ErrGasUintOverflow
 		}
 
-		gas, err := memoryGasCost(mem, memorySize)
+		gas, err := memoryGasCost(evm.params(), mem, memorySize)
 		if err != nil {
 			return 0, err
 		}
 
-		if gas, overflow = mathutil.SafeAdd(gas, config.LogGas); overflow {
+		if gas, overflow = mathutil.SafeAdd(gas, evm.params().LogGas); overflow {
 			return 0, ErrGasUintOverflow
 		}
-		if gas, overflow = mathutil.SafeAdd(gas, n*config.LogTopicGas); overflow {
+		if gas, overflow = mathutil.SafeAdd(gas, n*evm.params().LogTopicGas); overflow {
 			return 0, ErrGasUintOverflow
 		}
 
 		var memorySizeGas uint64
-		if memorySizeGas, overflow = mathutil.SafeMul(requestedSize, config.LogDataGas); overflow {
+		if memorySizeGas, overflow = mathutil.SafeMul(requestedSize, evm.params().LogDataGas); overflow {
 			return 0, ErrGasUintOverflow
 		}
 		if gas, overflow = mathutil.SafeAdd(gas, memorySizeGas); overflow {
@@ -212,7 +213,7 @@ func makeGasLog(n uint64) gasFunc {
 }
 
 func gasKeccak256(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -220,7 +221,7 @@ func gasKeccak256(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memor
 	if overflow {
 		return 0, ErrGasUintOverflow
 	}
-	if wordGas, overflow = mathutil.SafeMul(toWordSize(wordGas), config.Keccak256WordGas); overflow {
+	if wordGas, overflow = mathutil.SafeMul(toWordSize(wordGas), evm.params().Keccak256WordGas); overflow {
 		return 0, ErrGasUintOverflow
 	}
 	if gas, overflow = mathutil.SafeAdd(gas, wordGas); overflow {
@@ -233,7 +234,7 @@ func gasKeccak256(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memor
 // static cost have a dynamic cost which is solely based on the memory
 // expansion
 func pureMemoryGascost(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return memoryGasCost(mem, memorySize)
+	return memoryGasCost(evm.params(), mem, memorySize)
 }
 
 var (
@@ -246,7 +247,7 @@ var (
 )
 
 func gasCreate2(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -254,7 +255,7 @@ func gasCreate2(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memoryS
 	if overflow {
 		return 0, ErrGasUintOverflow
 	}
-	if wordGas, overflow = mathutil.SafeMul(toWordSize(wordGas), config.Keccak256WordGas); overflow {
+	if wordGas, overflow = mathutil.SafeMul(toWordSize(wordGas), evm.params().Keccak256WordGas); overflow {
 		return 0, ErrGasUintOverflow
 	}
 	if gas, overflow = mathutil.SafeAdd(gas, wordGas); overflow {
@@ -267,10 +268,10 @@ func gasExpFrontier(evm *EVM, contract *Contract, stack *Stack, mem *Memory, mem
 	expByteLen := uint64((stack.data[stack.len()-2].BitLen() + 7) / 8)
 
 	var (
-		gas      = expByteLen * config.ExpByteFrontier // no overflow check required. Max is 256 * ExpByte gas
+		gas      = expByteLen * evm.params().ExpByteFrontier // no overflow check required. Max is 256 * ExpByte gas
 		overflow bool
 	)
-	if gas, overflow = mathutil.SafeAdd(gas, config.ExpGas); overflow {
+	if gas, overflow = mathutil.SafeAdd(gas, evm.params().ExpGas); overflow {
 		return 0, ErrGasUintOverflow
 	}
 	return gas, nil
@@ -280,10 +281,10 @@ func gasExpEIP158(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memor
 	expByteLen := uint64((stack.data[stack.len()-2].BitLen() + 7) / 8)
 
 	var (
-		gas      = expByteLen * config.ExpByteEIP158 // no overflow check required. Max is 256 * ExpByte gas
+		gas      = expByteLen * evm.params().ExpByteEIP158 // no overflow check required. Max is 256 * ExpByte gas
 		overflow bool
 	)
-	if gas, overflow = mathutil.SafeAdd(gas, config.ExpGas); overflow {
+	if gas, overflow = mathutil.SafeAdd(gas, evm.params().ExpGas); overflow {
 		return 0, ErrGasUintOverflow
 	}
 	return gas, nil
@@ -296,12 +297,12 @@ func gasCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize
 		address        = common.Address(stack.Back(1).Bytes20())
 	)
 	if !evm.StateDB.Exist(address) {
-		gas += config.CallNewAccountGas
+		gas += evm.params().CallNewAccountGas
 	}
 	if transfersValue {
-		gas += config.CallValueTransferGas
+		gas += evm.params().CallValueTransferGas
 	}
-	memoryGas, err := memoryGasCost(mem, memorySize)
+	memoryGas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -321,7 +322,7 @@ func gasCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize
 }
 
 func gasCallCode(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	memoryGas, err := memoryGasCost(mem, memorySize)
+	memoryGas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -330,7 +331,7 @@ func gasCallCode(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memory
 		overflow bool
 	)
 	if stack.Back(2).Sign() != 0 {
-		gas += config.CallValueTransferGas
+		gas += evm.params().CallValueTransferGas
 	}
 	if gas, overflow = mathutil.SafeAdd(gas, memoryGas); overflow {
 		return 0, ErrGasUintOverflow
@@ -346,7 +347,7 @@ func gasCallCode(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memory
 }
 
 func gasDelegateCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -362,7 +363,7 @@ func gasDelegateCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 }
 
 func gasStaticCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(evm.params(), mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -381,15 +382,15 @@ func gasSelfdestruct(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 	var gas uint64
 	// EIP150 homestead gas reprice fork:
 	if evm.chainRules.IsEIP150 {
-		gas = config.SelfdestructGasEIP150
+		gas = evm.params().SelfdestructGasEIP150
 		var address = common.Address(stack.Back(0).Bytes20())
 		if !evm.StateDB.Exist(address) {
-			gas += config.CreateBySelfdestructGas
+			gas += evm.params().CreateBySelfdestructGas
 		}
 	}
 
 	if !evm.StateDB.HasSuicided(contract.Address()) {
-		evm.StateDB.AddRefund(config.SelfdestructRefundGas)
+		evm.StateDB.AddRefund(evm.params().SelfdestructRefundGas)
 	}
 	return gas, nil
 }
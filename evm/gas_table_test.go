@@ -18,7 +18,7 @@ func TestMemoryGasCost(t *testing.T) {
 		{0x1fffffffe1, 0, true},
 	}
 	for i, tt := range tests {
-		v, err := memoryGasCost(&Memory{}, tt.size)
+		v, err := memoryGasCost(&config.DefaultProtocolParams, &Memory{}, tt.size)
 		if (err == ErrGasUintOverflow) != tt.overflow {
 			t.Errorf("test %d: overflow mismatch: have %v, want %v", i, err == ErrGasUintOverflow, tt.overflow)
 		}
@@ -0,0 +1,50 @@
+package evm
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"math/big"
+	"time"
+)
+
+// londonTestRules are the rules of the london fork, which most tests run at.
+var londonTestRules = config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}
+
+// newTestBlock returns the context of the block with the given number, in
+// which value transfers always succeed without moving any value.
+func newTestBlock(number int64) BlockContext {
+	return BlockContext{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(number),
+	}
+}
+
+// newTestEVM returns an EVM with the given configuration executing on the
+// state in the first block of a chain with the given rules.
+func newTestEVM(statedb StateDB, rules config.Rules, cfg EVMConfig) *EVM {
+	env := NewEVM(newTestBlock(0), TxContext{}, cfg)
+	env.StateDB = statedb
+	env.Context = env.BlockContext
+	env.Config = env.EVMConfig
+	env.chainRules = rules
+	env.interpreter = NewEVMInterpreter(env, env.EVMConfig)
+	return env
+}
+
+// noopLogger is an EVMLogger ignoring every event, embedded by the tracers of
+// the tests to implement the events they don't record.
+type noopLogger struct{}
+
+func (noopLogger) CaptureTxStart(gasLimit uint64) {}
+func (noopLogger) CaptureTxEnd(restGas uint64)    {}
+func (noopLogger) CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+func (noopLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {}
+func (noopLogger) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (noopLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (noopLogger) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+}
+func (noopLogger) CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+}
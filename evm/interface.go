@@ -32,6 +32,10 @@ type StateDB interface {
 
 	Suicide(common.Address) bool
 	HasSuicided(common.Address) bool
+	// Suicide6780 is the EIP-6780 variant of Suicide: the account is only
+	// destructed if it was created (CreateAccount) within the current
+	// transaction, otherwise the call is a no-op.
+	Suicide6780(common.Address)
 
 	// Exist reports whether the given account exists in state.
 	// Notably this should also return true for suicided accounts.
@@ -1,8 +1,10 @@
 package evm
 
 import (
+	"context"
 	"github.com/entropyio/go-evm/common"
 	"github.com/entropyio/go-evm/common/mathutil"
+	"github.com/entropyio/go-evm/config"
 	"hash"
 )
 
@@ -14,6 +16,34 @@ type EVMConfig struct {
 	EnablePreimageRecording bool       // Enables recording of SHA3/keccak preimages
 	JumpTable               *JumpTable // VM instruction table, automatically populated if unset
 	ExtraEips               []int      // Additional EIPS that are to be enabled
+
+	// Precompiles are additional precompiled contracts made available to the
+	// EVM. They take precedence over the built-in contract at the same
+	// address, if any.
+	Precompiles map[common.Address]PrecompiledContract
+
+	// Policy restricts contract creation and the instructions available,
+	// nothing is restricted if unset.
+	Policy Policy
+
+	// Ctx aborts the execution with ErrExecutionAborted once done, like
+	// EVM.Cancel. MaxSteps bounds the number of instructions executed by the
+	// EVM across all call frames, MaxMemory the memory size of a call frame
+	// in bytes. Zero values don't limit the execution.
+	Ctx       context.Context
+	MaxSteps  uint64
+	MaxMemory uint64
+
+	// PreDecode executes legacy code from a cached pre-decoded form, with
+	// PUSH immediates parsed and common instruction sequences fused. Results,
+	// gas usage, tracer callbacks, stack traces and denied instructions are
+	// those of the plain interpreter, every instruction of a fused sequence
+	// being checked and traced on its own.
+	PreDecode bool
+
+	// StackTraces wraps the error of executions failing in the interpreter
+	// in an *ExecutionError, recording the failing frames.
+	StackTraces bool
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
@@ -22,6 +52,19 @@ type ScopeContext struct {
 	Memory   *Memory
 	Stack    *Stack
 	Contract *Contract
+
+	ReturnStack []*ReturnContext // EOF function return stack
+}
+
+// stepState records the instruction being executed by the interpreter, for
+// the deferred EVMLogger and stack traces.
+type stepState struct {
+	op     OpCode      // current opcode
+	pc     uint64      // needed for the deferred EVMLogger
+	gas    uint64      // for EVMLogger to log gas remaining before execution
+	cost   uint64      // gas charged for the instruction so far
+	logged bool        // deferred EVMLogger should ignore already logged steps
+	frame  *traceFrame // location of the call frame, kept up to date for stack traces
 }
 
 // keccakState wraps sha3.state. In addition to the usual hash methods, it also supports
@@ -34,38 +77,91 @@ type keccakState interface {
 
 // VMInterpreter represents an VM interpreter
 type EVMInterpreter struct {
-	evm *EVM
-	cfg EVMConfig
+	evm      *EVM
+	cfg      EVMConfig
+	eofTable *JumpTable // Instruction table of EOF code, nil if EOF is not enabled
+	denied   *[256]bool // Instructions disabled by the policy, nil if none
 
 	hasher    keccakState // Keccak256 hasher instance shared across opcodes
 	hasherBuf common.Hash // Keccak256 hasher result array shared aross opcodes
 
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
+	steps      uint64 // Number of instructions executed, counted if limited
 }
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
 func NewEVMInterpreter(evm *EVM, cfg EVMConfig) *EVMInterpreter {
+	// Chains with custom protocol parameters get instruction sets of their
+	// own, the shared ones are priced with the defaults.
+	params := evm.params()
+	custom := params != &config.DefaultProtocolParams
+
 	// If jump table was not initialised we set the default one.
 	if cfg.JumpTable == nil {
-		cfg.JumpTable = &homesteadInstructionSet
+		switch {
+		case custom:
+			jt := newDefaultInstructionSet(evm.chainRules, params)
+			cfg.JumpTable = &jt
+		case evm.chainRules.IsCancun:
+			cfg.JumpTable = &homestead6780InstructionSet
+		default:
+			cfg.JumpTable = &homesteadInstructionSet
+		}
 		for i, eip := range cfg.ExtraEips {
 			copyObj := *cfg.JumpTable
-			if err := EnableEIP(eip, &copyObj); err != nil {
+			if err := enableEIP(eip, &copyObj, params); err != nil {
 				// Disable it, so caller can check if it's activated or not
 				cfg.ExtraEips = append(cfg.ExtraEips[:i], cfg.ExtraEips[i+1:]...)
 				log.Error("EIP activation failed", "eip", eip, "error", err)
 			}
 			cfg.JumpTable = &copyObj
 		}
+		if custom {
+			setStackLimit(cfg.JumpTable, params.StackLimit)
+		}
 	}
 
+	var eofTable *JumpTable
+	if evm.chainRules.IsOsaka {
+		eofTable = &eofInstructionSet
+		if custom {
+			jt := newEOFInstructionSet(params)
+			setStackLimit(&jt, params.StackLimit)
+			eofTable = &jt
+		}
+	}
+	var denied *[256]bool
+	if cfg.Policy != nil {
+		for op := 0; op < 256; op++ {
+			if cfg.Policy.DenyOpCode(OpCode(op)) {
+				if denied == nil {
+					denied = new([256]bool)
+				}
+				denied[op] = true
+			}
+		}
+	}
 	return &EVMInterpreter{
-		evm: evm,
-		cfg: cfg,
+		evm:      evm,
+		cfg:      cfg,
+		eofTable: eofTable,
+		denied:   denied,
 	}
 }
 
+// EVM returns the EVM the interpreter runs in, giving custom instructions
+// access to the block context and the state.
+func (in *EVMInterpreter) EVM() *EVM {
+	return in.evm
+}
+
+// ReadOnly returns whether the interpreter is executing a static call, in
+// which case instructions must not modify the state.
+func (in *EVMInterpreter) ReadOnly() bool {
+	return in.readOnly
+}
+
 // Run loops and evaluates the contract's code with the given input data and returns
 // the return byte-slice and an error if one occurred.
 //
@@ -73,6 +169,14 @@ func NewEVMInterpreter(evm *EVM, cfg EVMConfig) *EVMInterpreter {
 // considered a revert-and-consume-all-gas operation except for
 // ErrExecutionReverted which means revert-and-keep-gas-left.
 func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	// Cancellation is polled on jumps, which loops can't do without, and on
+	// entering a call frame.
+	if in.evm.depth == 0 && in.cfg.Ctx != nil {
+		defer in.evm.watchContext(in.cfg.Ctx)()
+	}
+	if in.evm.Cancelled() {
+		return nil, ErrExecutionAborted
+	}
 
 	// Increment the call depth which is restricted to 1024
 	in.evm.depth++
@@ -93,9 +197,26 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	if len(contract.Code) == 0 {
 		return nil, nil
 	}
+	// EOF code was validated upon deployment, so it only needs to be decoded
+	// here. Containers are executed with their own instruction table.
+	if contract.Container == nil && in.eofTable != nil && hasEOFMagic(contract.Code) {
+		container, err := contract.loadContainer()
+		if err != nil {
+			return nil, err
+		}
+		contract.setContainer(container)
+	}
+	jumpTable := in.cfg.JumpTable
+	if contract.Container != nil {
+		jumpTable = in.eofTable
+	}
+	// Only code with a hash is pre-decoded, as the program is cached by it.
+	var prog *program
+	if in.cfg.PreDecode && contract.Container == nil && contract.CodeHash != (common.Hash{}) {
+		prog = contract.loadProgram()
+	}
 
 	var (
-		op          OpCode        // current opcode
 		mem         = NewMemory() // bound memory
 		stack       = newstack()  // local stack
 		callContext = &ScopeContext{
@@ -106,29 +227,31 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// For optimisation reason we're using uint64 as the program counter.
 		// It's theoretically possible to go above 2^64. The YP defines the PC
 		// to be uint256. Practically much less so feasible.
-		pc   = uint64(0) // program counter
-		cost uint64
-		// copies used by tracer
-		pcCopy  uint64 // needed for the deferred EVMLogger
-		gasCopy uint64 // for EVMLogger to log gas remaining before execution
-		logged  bool   // deferred EVMLogger should ignore already logged steps
-		res     []byte // result of the opcode execution function
+		pc  = uint64(0) // program counter
+		st  stepState   // current instruction, used by tracer
+		res []byte      // result of the opcode execution function
 	)
 	// Don't move this deferred function, it's placed before the capturestate-deferred method,
-	// so that it get's executed _after_: the capturestate needs the stacks before
-	// they are returned to the pools
+	// so that it get's executed _after_: the capturestate needs the stacks and memory
+	// before they are returned to the pools
 	defer func() {
 		returnStack(stack)
+		returnMemory(mem)
 	}()
 	contract.Input = input
 
+	// The location of the frame is kept up to date for stack traces
+	if n := len(in.evm.traceFrames); in.cfg.StackTraces && n > 0 {
+		st.frame = in.evm.traceFrames[n-1]
+	}
+
 	if in.cfg.Debug {
 		defer func() {
 			if err != nil {
-				if !logged {
-					in.cfg.Tracer.CaptureState(pcCopy, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
+				if !st.logged {
+					in.cfg.Tracer.CaptureState(st.pc, st.op, st.gas, st.cost, callContext, in.returnData, in.evm.depth, err)
 				} else {
-					in.cfg.Tracer.CaptureFault(pcCopy, op, gasCopy, cost, callContext, in.evm.depth, err)
+					in.cfg.Tracer.CaptureFault(st.pc, st.op, st.gas, st.cost, callContext, in.evm.depth, err)
 				}
 			}
 		}()
@@ -138,15 +261,39 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	// the execution of one of the operations or until the done flag is set by the
 	// parent context.
 	for {
+		if prog != nil && pc < uint64(len(prog.ops)) {
+			if d := &prog.ops[pc]; d.kind != insPlain {
+				if err = in.execDecoded(&st, d, prog, &pc, jumpTable, callContext); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
 		if in.cfg.Debug {
 			// Capture pre-execution values for tracing.
-			logged, pcCopy, gasCopy = false, pc, contract.Gas
+			st.logged, st.pc, st.gas = false, pc, contract.Gas
 		}
 		// Get the operation from the jump table and validate the stack to ensure there are
 		// enough stack items available to perform the operation.
-		op = contract.GetOp(pc)
-		operation := in.cfg.JumpTable[op]
-		cost = operation.constantGas // For tracing
+		op := contract.GetOp(pc)
+		st.op = op
+		if st.frame != nil {
+			st.frame.PC, st.frame.Op, st.frame.Gas = pc, op, contract.Gas
+		}
+		if in.cfg.MaxSteps != 0 {
+			if in.steps++; in.steps > in.cfg.MaxSteps {
+				st.cost = 0
+				return nil, ErrStepLimit
+			}
+		}
+		if in.denied != nil && in.denied[op] {
+			st.cost, err = 0, &ErrOpCodeDenied{opcode: op}
+			in.evm.capturePolicyDenial(op, contract.Address(), err)
+			return nil, err
+		}
+		operation := jumpTable[op]
+		cost := operation.constantGas
+		st.cost = cost // For tracing
 		// Validate stack
 		if sLen := stack.len(); sLen < operation.minStack {
 			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
@@ -173,26 +320,30 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 				if memorySize, overflow = mathutil.SafeMul(toWordSize(memSize), 32); overflow {
 					return nil, ErrGasUintOverflow
 				}
+				if in.cfg.MaxMemory != 0 && memorySize > in.cfg.MaxMemory {
+					return nil, ErrMemoryLimit
+				}
 			}
 			// Consume the gas and return an error if not enough gas is available.
 			// cost is explicitly set so that the capture state defer method can get the proper cost
 			var dynamicCost uint64
 			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
-			cost += dynamicCost // for tracing
+			cost += dynamicCost
+			st.cost = cost // for tracing
 			if err != nil || !contract.UseGas(dynamicCost) {
 				return nil, ErrOutOfGas
 			}
 			// Do tracing before memory expansion
 			if in.cfg.Debug {
-				in.cfg.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-				logged = true
+				in.cfg.Tracer.CaptureState(pc, op, st.gas, cost, callContext, in.returnData, in.evm.depth, err)
+				st.logged = true
 			}
 			if memorySize > 0 {
 				mem.Resize(memorySize)
 			}
 		} else if in.cfg.Debug {
-			in.cfg.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-			logged = true
+			in.cfg.Tracer.CaptureState(pc, op, st.gas, cost, callContext, in.returnData, in.evm.depth, err)
+			st.logged = true
 		}
 		// execute the operation
 		res, err = operation.execute(&pc, in, callContext)
@@ -0,0 +1,67 @@
+package evm
+
+import (
+	"context"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// runLimited executes the code with the given configuration and unlimited gas.
+func runLimited(code []byte, cfg EVMConfig, cancel bool) error {
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		contract = common.BytesToAddress([]byte("contract"))
+		statedb  = state.New()
+	)
+	statedb.SetCode(contract, code)
+	env := newTestEVM(statedb, config.Rules{}, cfg)
+	if cancel {
+		env.Cancel()
+	}
+	_, _, err := env.Call(AccountRef(caller), contract, nil, math.MaxUint64, new(big.Int))
+	return err
+}
+
+func TestExecutionLimits(t *testing.T) {
+	var (
+		// infinite loop using JUMP: push(2) jumpdest dup1 jump
+		loop = common.Hex2Bytes("60025b8056")
+		// infinite loop using JUMPI: push(1) push(4) jumpdest dup2 dup2 jumpi
+		loopi = common.Hex2Bytes("600160045b818157")
+		// mstore(0x10000, 1), followed by the implicit stop
+		expand = common.Hex2Bytes("600162010000" + "52")
+	)
+	if err := runLimited(loop, EVMConfig{}, true); err != ErrExecutionAborted {
+		t.Errorf("cancelled: have %v, want %v", err, ErrExecutionAborted)
+	}
+	for i, code := range [][]byte{loop, loopi} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		errc := make(chan error, 1)
+		go func() { errc <- runLimited(code, EVMConfig{Ctx: ctx}, false) }()
+
+		select {
+		case err := <-errc:
+			if err != ErrExecutionAborted {
+				t.Errorf("loop %d deadline: have %v, want %v", i, err, ErrExecutionAborted)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("loop %d deadline: timed out", i)
+		}
+		cancel()
+
+		if err := runLimited(code, EVMConfig{MaxSteps: 1000}, false); err != ErrStepLimit {
+			t.Errorf("loop %d steps: have %v, want %v", i, err, ErrStepLimit)
+		}
+	}
+	if err := runLimited(expand, EVMConfig{MaxMemory: 0x10000}, false); err != ErrMemoryLimit {
+		t.Errorf("memory: have %v, want %v", err, ErrMemoryLimit)
+	}
+	if err := runLimited(expand, EVMConfig{MaxMemory: 0x10020, MaxSteps: 4}, false); err != nil {
+		t.Errorf("within limits: have %v, want nil", err)
+	}
+}
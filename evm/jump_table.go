@@ -25,19 +25,26 @@ type operation struct {
 
 	// memorySize returns the memory size required for the operation
 	memorySize memorySizeFunc
+
+	// undefined denotes if the instruction is not officially defined in the jump table
+	undefined bool
 }
 
 var (
-	frontierInstructionSet         = newFrontierInstructionSet()
-	homesteadInstructionSet        = newHomesteadInstructionSet()
-	tangerineWhistleInstructionSet = newTangerineWhistleInstructionSet()
-	spuriousDragonInstructionSet   = newSpuriousDragonInstructionSet()
-	byzantiumInstructionSet        = newByzantiumInstructionSet()
-	constantinopleInstructionSet   = newConstantinopleInstructionSet()
-	istanbulInstructionSet         = newIstanbulInstructionSet()
-	berlinInstructionSet           = newBerlinInstructionSet()
-	londonInstructionSet           = newLondonInstructionSet()
-	mergeInstructionSet            = newMergeInstructionSet()
+	frontierInstructionSet         = newFrontierInstructionSet(&config.DefaultProtocolParams)
+	homesteadInstructionSet        = newHomesteadInstructionSet(&config.DefaultProtocolParams)
+	homestead6780InstructionSet    = newDefaultInstructionSet(config.Rules{IsCancun: true}, &config.DefaultProtocolParams)
+	tangerineWhistleInstructionSet = newTangerineWhistleInstructionSet(&config.DefaultProtocolParams)
+	spuriousDragonInstructionSet   = newSpuriousDragonInstructionSet(&config.DefaultProtocolParams)
+	byzantiumInstructionSet        = newByzantiumInstructionSet(&config.DefaultProtocolParams)
+	constantinopleInstructionSet   = newConstantinopleInstructionSet(&config.DefaultProtocolParams)
+	istanbulInstructionSet         = newIstanbulInstructionSet(&config.DefaultProtocolParams)
+	berlinInstructionSet           = newBerlinInstructionSet(&config.DefaultProtocolParams)
+	londonInstructionSet           = newLondonInstructionSet(&config.DefaultProtocolParams)
+	mergeInstructionSet            = newMergeInstructionSet(&config.DefaultProtocolParams)
+	cancunInstructionSet           = newCancunInstructionSet(&config.DefaultProtocolParams)
+	pragueInstructionSet           = newPragueInstructionSet(&config.DefaultProtocolParams)
+	eofInstructionSet              = newEOFInstructionSet(&config.DefaultProtocolParams)
 )
 
 // JumpTable contains the EVM opcodes supported at a given fork.
@@ -45,24 +52,163 @@ type JumpTable [256]*operation
 
 func validate(jt JumpTable) JumpTable {
 	for i, op := range jt {
-		if op == nil {
-			panic(fmt.Sprintf("op 0x%x is not set", i))
-		}
-		// The interpreter has an assumption that if the memorySize function is
-		// set, then the dynamicGas function is also set. This is a somewhat
-		// arbitrary assumption, and can be removed if we need to -- but it
-		// allows us to avoid a condition check. As long as we have that assumption
-		// in there, this little sanity check prevents us from merging in a
-		// change which violates it.
-		if op.memorySize != nil && op.dynamicGas == nil {
-			panic(fmt.Sprintf("op %v has dynamic memory but not dynamic gas", OpCode(i).String()))
+		if err := validateOperation(OpCode(i), op); err != nil {
+			panic(err.Error())
 		}
 	}
 	return jt
 }
 
-func newMergeInstructionSet() JumpTable {
-	instructionSet := newLondonInstructionSet()
+// validateOperation checks the assumptions the interpreter makes about an
+// instruction.
+func validateOperation(code OpCode, op *operation) error {
+	if op == nil {
+		return fmt.Errorf("op 0x%x is not set", int(code))
+	}
+	// The interpreter has an assumption that if the memorySize function is
+	// set, then the dynamicGas function is also set. This is a somewhat
+	// arbitrary assumption, and can be removed if we need to -- but it
+	// allows us to avoid a condition check. As long as we have that assumption
+	// in there, this little sanity check prevents us from merging in a
+	// change which violates it.
+	if op.memorySize != nil && op.dynamicGas == nil {
+		return fmt.Errorf("op %v has dynamic memory but not dynamic gas", code.String())
+	}
+	return nil
+}
+
+// NewJumpTable returns a copy of the legacy instruction set of the fork
+// enabled by the given rules, priced and stack bounded with the given protocol
+// parameters, to be extended with custom instructions and passed to the
+// interpreter through EVMConfig.JumpTable. A nil params stands for the default
+// protocol parameters, chains with custom ones should pass
+// ChainConfig.Params().
+func NewJumpTable(rules config.Rules, params *config.ProtocolParams) JumpTable {
+	if params == nil {
+		params = &config.DefaultProtocolParams
+	}
+	jt := newInstructionSet(rules, params)
+	setStackLimit(&jt, params.StackLimit)
+	return jt
+}
+
+// Operation describes a custom instruction to be added to a jump table.
+type Operation struct {
+	Execute     ExecutionFunc  // Implementation of the instruction
+	ConstantGas uint64         // Gas charged before execution
+	DynamicGas  GasFunc        // Computes the gas charged on top of the constant gas, optional
+	MemorySize  MemorySizeFunc // Computes the memory the instruction touches, requires DynamicGas
+	Pops        int            // Number of stack items consumed
+	Pushes      int            // Number of stack items produced
+}
+
+type (
+	// ExecutionFunc executes an instruction, operating on the stack, memory
+	// and contract of the scope. It returns the output of halting instructions.
+	ExecutionFunc = executionFunc
+	// GasFunc computes the dynamic gas of an instruction, given the memory
+	// size it requires.
+	GasFunc = gasFunc
+	// MemorySizeFunc computes the memory size an instruction requires.
+	MemorySizeFunc = memorySizeFunc
+)
+
+// Define adds the instruction to the jump table under the given opcode. Only
+// opcodes undefined in the table can be defined, as the built-in instructions
+// are relied upon by the rest of the EVM. The stack bounds of the instruction
+// follow the stack limit the table was built for.
+func (jt *JumpTable) Define(code OpCode, op Operation) error {
+	if current := jt[code]; current != nil && !current.undefined {
+		return fmt.Errorf("op %v is already defined", code.String())
+	}
+	if op.Execute == nil {
+		return fmt.Errorf("op 0x%x has no implementation", int(code))
+	}
+	if op.Pops < 0 || op.Pushes < 0 {
+		return fmt.Errorf("op 0x%x has negative stack effects", int(code))
+	}
+	defined := &operation{
+		execute:     op.Execute,
+		constantGas: op.ConstantGas,
+		dynamicGas:  op.DynamicGas,
+		minStack:    minStack(op.Pops, op.Pushes),
+		maxStack:    jt[STOP].maxStack + op.Pops - op.Pushes,
+		memorySize:  op.MemorySize,
+	}
+	if err := validateOperation(code, defined); err != nil {
+		return err
+	}
+	jt[code] = defined
+	return nil
+}
+
+// newInstructionSet returns the legacy instruction set of the fork enabled by
+// the given rules, priced with the given protocol parameters.
+func newInstructionSet(rules config.Rules, p *config.ProtocolParams) JumpTable {
+	switch {
+	case rules.IsPrague:
+		return newPragueInstructionSet(p)
+	case rules.IsCancun:
+		return newCancunInstructionSet(p)
+	case rules.IsMerge:
+		return newMergeInstructionSet(p)
+	case rules.IsLondon:
+		return newLondonInstructionSet(p)
+	case rules.IsEIP150:
+		return newTangerineWhistleInstructionSet(p)
+	default:
+		return newHomesteadInstructionSet(p)
+	}
+}
+
+// newDefaultInstructionSet returns the instruction set the interpreter runs
+// when none is configured: the homestead instructions, whatever the fork, with
+// PUSH0 and the SELFDESTRUCT semantics of EIP-6780 from the cancun fork on.
+// PUSH0 is needed by the EIP-4788 and EIP-2935 system contracts. The gas of
+// the instructions is left unchanged, fork accurate instruction sets are
+// returned by NewJumpTable.
+func newDefaultInstructionSet(rules config.Rules, p *config.ProtocolParams) JumpTable {
+	instructionSet := newHomesteadInstructionSet(p)
+	if rules.IsCancun {
+		enable3855(&instructionSet, p)
+		selfdestruct := *instructionSet[SELFDESTRUCT]
+		selfdestruct.execute = opSelfdestruct6780
+		instructionSet[SELFDESTRUCT] = &selfdestruct
+	}
+	return validate(instructionSet)
+}
+
+// newEOFInstructionSet returns the instructions available to EOF code from
+// the osaka fork on. It is used instead of the fork's legacy jump table when
+// executing an EOF container.
+func newEOFInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newPragueInstructionSet(p)
+	enableEOF(&instructionSet, p) // EOF instructions https://eips.entropy.org/EIPS/eip-3540
+	return validate(instructionSet)
+}
+
+// newPragueInstructionSet returns the frontier, homestead, byzantium,
+// contantinople, istanbul, petersburg, berlin, london, merge, cancun and prague instructions.
+func newPragueInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newCancunInstructionSet(p)
+	enable7702(&instructionSet, p) // EIP-7702 Set code transactions https://eips.entropy.org/EIPS/eip-7702
+	return validate(instructionSet)
+}
+
+// newCancunInstructionSet returns the frontier, homestead, byzantium,
+// contantinople, istanbul, petersburg, berlin, london, merge and cancun instructions.
+// PUSH0 was introduced by shanghai, which has no rules of its own here, so it is
+// enabled from cancun on, as required by the EIP-4788 and EIP-2935 system
+// contracts compiled with it.
+func newCancunInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newMergeInstructionSet(p)
+	enable3855(&instructionSet, p) // PUSH0 instruction https://eips.entropy.org/EIPS/eip-3855
+	enable6780(&instructionSet, p) // EIP-6780 SELFDESTRUCT only in same transaction https://eips.entropy.org/EIPS/eip-6780
+	return validate(instructionSet)
+}
+
+func newMergeInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newLondonInstructionSet(p)
 	instructionSet[RANDOM] = &operation{
 		execute:     opRandom,
 		constantGas: GasQuickStep,
@@ -74,37 +220,37 @@ func newMergeInstructionSet() JumpTable {
 
 // newLondonInstructionSet returns the frontier, homestead, byzantium,
 // contantinople, istanbul, petersburg, berlin and london instructions.
-func newLondonInstructionSet() JumpTable {
-	instructionSet := newBerlinInstructionSet()
-	enable3529(&instructionSet) // EIP-3529: Reduction in refunds https://eips.entropy.org/EIPS/eip-3529
-	enable3198(&instructionSet) // Base fee opcode https://eips.entropy.org/EIPS/eip-3198
+func newLondonInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newBerlinInstructionSet(p)
+	enable3529(&instructionSet, p) // EIP-3529: Reduction in refunds https://eips.entropy.org/EIPS/eip-3529
+	enable3198(&instructionSet, p) // Base fee opcode https://eips.entropy.org/EIPS/eip-3198
 	return validate(instructionSet)
 }
 
 // newBerlinInstructionSet returns the frontier, homestead, byzantium,
 // contantinople, istanbul, petersburg and berlin instructions.
-func newBerlinInstructionSet() JumpTable {
-	instructionSet := newIstanbulInstructionSet()
-	enable2929(&instructionSet) // Access lists for trie accesses https://eips.entropy.org/EIPS/eip-2929
+func newBerlinInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newIstanbulInstructionSet(p)
+	enable2929(&instructionSet, p) // Access lists for trie accesses https://eips.entropy.org/EIPS/eip-2929
 	return validate(instructionSet)
 }
 
 // newIstanbulInstructionSet returns the frontier, homestead, byzantium,
 // contantinople, istanbul and petersburg instructions.
-func newIstanbulInstructionSet() JumpTable {
-	instructionSet := newConstantinopleInstructionSet()
+func newIstanbulInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newConstantinopleInstructionSet(p)
 
-	enable1344(&instructionSet) // ChainID opcode - https://eips.entropy.org/EIPS/eip-1344
-	enable1884(&instructionSet) // Reprice reader opcodes - https://eips.entropy.org/EIPS/eip-1884
-	enable2200(&instructionSet) // Net metered SSTORE - https://eips.entropy.org/EIPS/eip-2200
+	enable1344(&instructionSet, p) // ChainID opcode - https://eips.entropy.org/EIPS/eip-1344
+	enable1884(&instructionSet, p) // Reprice reader opcodes - https://eips.entropy.org/EIPS/eip-1884
+	enable2200(&instructionSet, p) // Net metered SSTORE - https://eips.entropy.org/EIPS/eip-2200
 
 	return validate(instructionSet)
 }
 
 // newConstantinopleInstructionSet returns the frontier, homestead,
 // byzantium and contantinople instructions.
-func newConstantinopleInstructionSet() JumpTable {
-	instructionSet := newByzantiumInstructionSet()
+func newConstantinopleInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newByzantiumInstructionSet(p)
 	instructionSet[SHL] = &operation{
 		execute:     opSHL,
 		constantGas: GasFastestStep,
@@ -125,13 +271,13 @@ func newConstantinopleInstructionSet() JumpTable {
 	}
 	instructionSet[EXTCODEHASH] = &operation{
 		execute:     opExtCodeHash,
-		constantGas: config.ExtcodeHashGasConstantinople,
+		constantGas: p.ExtcodeHashGasConstantinople,
 		minStack:    minStack(1, 1),
 		maxStack:    maxStack(1, 1),
 	}
 	instructionSet[CREATE2] = &operation{
 		execute:     opCreate2,
-		constantGas: config.Create2Gas,
+		constantGas: p.Create2Gas,
 		dynamicGas:  gasCreate2,
 		minStack:    minStack(4, 1),
 		maxStack:    maxStack(4, 1),
@@ -142,11 +288,11 @@ func newConstantinopleInstructionSet() JumpTable {
 
 // newByzantiumInstructionSet returns the frontier, homestead and
 // byzantium instructions.
-func newByzantiumInstructionSet() JumpTable {
-	instructionSet := newSpuriousDragonInstructionSet()
+func newByzantiumInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newSpuriousDragonInstructionSet(p)
 	instructionSet[STATICCALL] = &operation{
 		execute:     opStaticCall,
-		constantGas: config.CallGasEIP150,
+		constantGas: p.CallGasEIP150,
 		dynamicGas:  gasStaticCall,
 		minStack:    minStack(6, 1),
 		maxStack:    maxStack(6, 1),
@@ -177,34 +323,34 @@ func newByzantiumInstructionSet() JumpTable {
 }
 
 // EIP 158 a.k.a Spurious Dragon
-func newSpuriousDragonInstructionSet() JumpTable {
-	instructionSet := newTangerineWhistleInstructionSet()
+func newSpuriousDragonInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newTangerineWhistleInstructionSet(p)
 	instructionSet[EXP].dynamicGas = gasExpEIP158
 	return validate(instructionSet)
 
 }
 
 // EIP 150 a.k.a Tangerine Whistle
-func newTangerineWhistleInstructionSet() JumpTable {
-	instructionSet := newHomesteadInstructionSet()
-	instructionSet[BALANCE].constantGas = config.BalanceGasEIP150
-	instructionSet[EXTCODESIZE].constantGas = config.ExtcodeSizeGasEIP150
-	instructionSet[SLOAD].constantGas = config.SloadGasEIP150
-	instructionSet[EXTCODECOPY].constantGas = config.ExtcodeCopyBaseEIP150
-	instructionSet[CALL].constantGas = config.CallGasEIP150
-	instructionSet[CALLCODE].constantGas = config.CallGasEIP150
-	instructionSet[DELEGATECALL].constantGas = config.CallGasEIP150
+func newTangerineWhistleInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newHomesteadInstructionSet(p)
+	instructionSet[BALANCE].constantGas = p.BalanceGasEIP150
+	instructionSet[EXTCODESIZE].constantGas = p.ExtcodeSizeGasEIP150
+	instructionSet[SLOAD].constantGas = p.SloadGasEIP150
+	instructionSet[EXTCODECOPY].constantGas = p.ExtcodeCopyBaseEIP150
+	instructionSet[CALL].constantGas = p.CallGasEIP150
+	instructionSet[CALLCODE].constantGas = p.CallGasEIP150
+	instructionSet[DELEGATECALL].constantGas = p.CallGasEIP150
 	return validate(instructionSet)
 }
 
 // newHomesteadInstructionSet returns the frontier and homestead
 // instructions that can be executed during the homestead phase.
-func newHomesteadInstructionSet() JumpTable {
-	instructionSet := newFrontierInstructionSet()
+func newHomesteadInstructionSet(p *config.ProtocolParams) JumpTable {
+	instructionSet := newFrontierInstructionSet(p)
 	instructionSet[DELEGATECALL] = &operation{
 		execute:     opDelegateCall,
 		dynamicGas:  gasDelegateCall,
-		constantGas: config.CallGasFrontier,
+		constantGas: p.CallGasFrontier,
 		minStack:    minStack(6, 1),
 		maxStack:    maxStack(6, 1),
 		memorySize:  memoryDelegateCall,
@@ -214,7 +360,7 @@ func newHomesteadInstructionSet() JumpTable {
 
 // newFrontierInstructionSet returns the frontier instructions
 // that can be executed during the frontier phase.
-func newFrontierInstructionSet() JumpTable {
+func newFrontierInstructionSet(p *config.ProtocolParams) JumpTable {
 	tbl := JumpTable{
 		STOP: {
 			execute:     opStop,
@@ -356,7 +502,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		KECCAK256: {
 			execute:     opKeccak256,
-			constantGas: config.Keccak256Gas,
+			constantGas: p.Keccak256Gas,
 			dynamicGas:  gasKeccak256,
 			minStack:    minStack(2, 1),
 			maxStack:    maxStack(2, 1),
@@ -370,7 +516,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		BALANCE: {
 			execute:     opBalance,
-			constantGas: config.BalanceGasFrontier,
+			constantGas: p.BalanceGasFrontier,
 			minStack:    minStack(1, 1),
 			maxStack:    maxStack(1, 1),
 		},
@@ -434,13 +580,13 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		EXTCODESIZE: {
 			execute:     opExtCodeSize,
-			constantGas: config.ExtcodeSizeGasFrontier,
+			constantGas: p.ExtcodeSizeGasFrontier,
 			minStack:    minStack(1, 1),
 			maxStack:    maxStack(1, 1),
 		},
 		EXTCODECOPY: {
 			execute:     opExtCodeCopy,
-			constantGas: config.ExtcodeCopyBaseFrontier,
+			constantGas: p.ExtcodeCopyBaseFrontier,
 			dynamicGas:  gasExtCodeCopy,
 			minStack:    minStack(4, 0),
 			maxStack:    maxStack(4, 0),
@@ -514,7 +660,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		SLOAD: {
 			execute:     opSload,
-			constantGas: config.SloadGasFrontier,
+			constantGas: p.SloadGasFrontier,
 			minStack:    minStack(1, 1),
 			maxStack:    maxStack(1, 1),
 		},
@@ -556,7 +702,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		JUMPDEST: {
 			execute:     opJumpdest,
-			constantGas: config.JumpdestGas,
+			constantGas: p.JumpdestGas,
 			minStack:    minStack(0, 0),
 			maxStack:    maxStack(0, 0),
 		},
@@ -981,7 +1127,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		CREATE: {
 			execute:     opCreate,
-			constantGas: config.CreateGas,
+			constantGas: p.CreateGas,
 			dynamicGas:  gasCreate,
 			minStack:    minStack(3, 1),
 			maxStack:    maxStack(3, 1),
@@ -989,7 +1135,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		CALL: {
 			execute:     opCall,
-			constantGas: config.CallGasFrontier,
+			constantGas: p.CallGasFrontier,
 			dynamicGas:  gasCall,
 			minStack:    minStack(7, 1),
 			maxStack:    maxStack(7, 1),
@@ -997,7 +1143,7 @@ func newFrontierInstructionSet() JumpTable {
 		},
 		CALLCODE: {
 			execute:     opCallCode,
-			constantGas: config.CallGasFrontier,
+			constantGas: p.CallGasFrontier,
 			dynamicGas:  gasCallCode,
 			minStack:    minStack(7, 1),
 			maxStack:    maxStack(7, 1),
@@ -1021,7 +1167,7 @@ func newFrontierInstructionSet() JumpTable {
 	// Fill all unassigned slots with opUndefined.
 	for i, entry := range tbl {
 		if entry == nil {
-			tbl[i] = &operation{execute: opUndefined, maxStack: maxStack(0, 0)}
+			tbl[i] = &operation{execute: opUndefined, maxStack: maxStack(0, 0), undefined: true}
 		}
 	}
 
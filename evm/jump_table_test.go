@@ -0,0 +1,141 @@
+package evm
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"github.com/holiman/uint256"
+	"math/big"
+	"testing"
+)
+
+func TestDefineOperation(t *testing.T) {
+	const l1Block = OpCode(0x0c)
+	jt := NewJumpTable(londonTestRules, nil)
+
+	// Built-in instructions and inconsistent ones are refused
+	opL1Block := func(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+		scope.Stack.Push(uint256.NewInt(interpreter.EVM().Context.BlockNumber.Uint64() + 1000))
+		return nil, nil
+	}
+	if err := jt.Define(ADD, Operation{Execute: opL1Block, Pushes: 1}); err == nil {
+		t.Errorf("redefined ADD")
+	}
+	if err := jt.Define(l1Block, Operation{Pushes: 1}); err == nil {
+		t.Errorf("defined instruction without implementation")
+	}
+	if err := jt.Define(l1Block, Operation{Execute: opL1Block, MemorySize: memoryMLoad}); err == nil {
+		t.Errorf("defined instruction with dynamic memory but no dynamic gas")
+	}
+	if err := jt.Define(l1Block, Operation{Execute: opL1Block, ConstantGas: 42, Pushes: 1}); err != nil {
+		t.Fatalf("failed to define instruction: %v", err)
+	}
+	if !londonInstructionSet[l1Block].undefined {
+		t.Fatalf("default instruction set modified")
+	}
+
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		contract = common.BytesToAddress([]byte("contract"))
+		statedb  = state.New()
+	)
+	// l1block push1 0 mstore push1 32 push1 0 return
+	statedb.SetCode(contract, []byte{byte(l1Block), 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3})
+	env := newTestEVM(statedb, londonTestRules, EVMConfig{JumpTable: &jt})
+	env.Context.BlockNumber = big.NewInt(7)
+
+	ret, gas, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if have := new(big.Int).SetBytes(ret); have.Uint64() != 1007 {
+		t.Errorf("output mismatch: have %v, want 1007", have)
+	}
+	// 42 for the custom instruction, 3 * 3 for the pushes, 3 + 3 for the mstore and its memory
+	if used := 100000 - gas; used != 42+9+6 {
+		t.Errorf("gas mismatch: have %d, want %d", used, 42+9+6)
+	}
+}
+
+func TestDefaultInstructionSet(t *testing.T) {
+	var (
+		caller      = common.BytesToAddress([]byte("caller"))
+		contract    = common.BytesToAddress([]byte("contract"))
+		beneficiary = common.BytesToAddress([]byte("beneficiary"))
+	)
+	// push20 beneficiary selfdestruct
+	code := append(append([]byte{byte(PUSH20)}, beneficiary.Bytes()...), byte(SELFDESTRUCT))
+
+	tests := []struct {
+		name     string
+		rules    config.Rules
+		suicided bool
+		push0    bool
+	}{
+		{"frontier", config.Rules{}, true, false},
+		{"homestead", config.Rules{IsHomestead: true}, true, false},
+		{"london", config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, true, false},
+		{"merge", config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true, IsMerge: true}, true, false},
+		{"cancun", config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true, IsMerge: true, IsCancun: true}, false, true},
+		{"prague", config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true, IsMerge: true, IsCancun: true, IsPrague: true}, false, true},
+	}
+	gasUsed := make(map[string]uint64)
+	for _, tt := range tests {
+		statedb := state.New()
+		statedb.SetCode(contract, code)
+		statedb.AddBalance(contract, big.NewInt(100))
+		statedb.Finalise()
+
+		env := newTestEVM(statedb, tt.rules, EVMConfig{})
+
+		// The default instruction set is homestead's whatever the fork, with
+		// PUSH0 from cancun on
+		jt := env.interpreter.cfg.JumpTable
+		if !jt[BASEFEE].undefined {
+			t.Errorf("%s: instructions of later forks defined", tt.name)
+		}
+		if defined := !jt[PUSH0].undefined; defined != tt.push0 {
+			t.Errorf("%s: PUSH0 defined %v, want %v", tt.name, defined, tt.push0)
+		}
+		_, gas, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("%s: call failed: %v", tt.name, err)
+		}
+		if have := statedb.HasSuicided(contract); have != tt.suicided {
+			t.Errorf("%s: suicided mismatch: have %v, want %v", tt.name, have, tt.suicided)
+		}
+		if have := statedb.GetBalance(beneficiary); have.Cmp(big.NewInt(100)) != 0 {
+			t.Errorf("%s: beneficiary balance mismatch: have %v, want 100", tt.name, have)
+		}
+		gasUsed[tt.name] = 100000 - gas
+	}
+	// Only the semantics of SELFDESTRUCT change, not its gas
+	for _, fork := range []string{"cancun", "prague"} {
+		if gasUsed[fork] != gasUsed["merge"] {
+			t.Errorf("%s: gas mismatch: have %d, want %d", fork, gasUsed[fork], gasUsed["merge"])
+		}
+	}
+}
+
+func TestNewJumpTablePush0(t *testing.T) {
+	merge := config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true, IsMerge: true}
+	cancun, prague := merge, merge
+	cancun.IsCancun = true
+	prague.IsCancun, prague.IsPrague = true, true
+
+	for _, tt := range []struct {
+		name  string
+		rules config.Rules
+		push0 bool
+	}{
+		{"london", londonTestRules, false},
+		{"merge", merge, false},
+		{"cancun", cancun, true},
+		{"prague", prague, true},
+	} {
+		jt := NewJumpTable(tt.rules, nil)
+		if defined := !jt[PUSH0].undefined; defined != tt.push0 {
+			t.Errorf("%s: PUSH0 defined %v, want %v", tt.name, defined, tt.push0)
+		}
+	}
+}
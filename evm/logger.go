@@ -11,6 +11,8 @@ import (
 // current VM state.
 // Note that reference types are actual VM data structures; make copies
 // if you need to retain them beyond the current call.
+// Call frames reverted by the REVERT instruction end with a *RevertError
+// holding the revert data.
 type EVMLogger interface {
 	// Transaction level
 	CaptureTxStart(gasLimit uint64)
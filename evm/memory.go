@@ -3,8 +3,20 @@ package evm
 import (
 	"fmt"
 	"github.com/holiman/uint256"
+	"sync"
 )
 
+// maxPooledMemory is the capacity above which memory is left to the garbage
+// collector instead of being pooled, so that the pool doesn't pin the memory
+// of the occasional expensive call.
+const maxPooledMemory = 64 * 1024
+
+var memoryPool = sync.Pool{
+	New: func() interface{} {
+		return new(Memory)
+	},
+}
+
 // Memory implements a simple memory model for the entropy virtual machine.
 type Memory struct {
 	store       []byte
@@ -13,7 +25,21 @@ type Memory struct {
 
 // NewMemory returns a new memory model.
 func NewMemory() *Memory {
-	return &Memory{}
+	return memoryPool.Get().(*Memory)
+}
+
+// returnMemory zeroes the memory and returns it to the pool. Neither the
+// memory nor slices of it may be used afterwards.
+func returnMemory(m *Memory) {
+	if cap(m.store) > maxPooledMemory {
+		return
+	}
+	for i := range m.store {
+		m.store[i] = 0
+	}
+	m.store = m.store[:0]
+	m.lastGasCost = 0
+	memoryPool.Put(m)
 }
 
 // Set sets offset + size to value
@@ -12,6 +12,10 @@ func memoryReturnDataCopy(stack *Stack) (uint64, bool) {
 	return calcMemSize64(stack.Back(0), stack.Back(2))
 }
 
+func memoryDataCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize64(stack.Back(0), stack.Back(2))
+}
+
 func memoryCodeCopy(stack *Stack) (uint64, bool) {
 	return calcMemSize64(stack.Back(0), stack.Back(2))
 }
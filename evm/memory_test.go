@@ -0,0 +1,123 @@
+package evm
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+func TestMemoryPoolZeroed(t *testing.T) {
+	m := NewMemory()
+	m.Resize(64)
+	m.Set(0, 64, bytes.Repeat([]byte{0xff}, 64))
+	returnMemory(m)
+
+	// Whichever memory the pool hands out, it is empty and expands zeroed
+	m = NewMemory()
+	if m.Len() != 0 || m.lastGasCost != 0 {
+		t.Fatalf("pooled memory not reset: len %d, last gas cost %d", m.Len(), m.lastGasCost)
+	}
+	m.Resize(64)
+	if !bytes.Equal(m.Data(), make([]byte, 64)) {
+		t.Fatalf("pooled memory not zeroed: %x", m.Data())
+	}
+}
+
+// newReuseTestEVM returns an EVM executing the given code at the returned
+// address.
+func newReuseTestEVM(code []byte) (*EVM, common.Address) {
+	contract := common.BytesToAddress([]byte("contract"))
+	statedb := state.New()
+	statedb.SetCode(contract, code)
+	return newTestEVM(statedb, londonTestRules, EVMConfig{JumpTable: &londonInstructionSet}), contract
+}
+
+func TestEVMReuse(t *testing.T) {
+	// mstore(0, add(number, sload(0))) return(0, 32)
+	code := common.Hex2Bytes("600054430160005260206000f3")
+	env, contract := newReuseTestEVM(code)
+	caller := common.BytesToAddress([]byte("caller"))
+
+	for i := int64(1); i <= 3; i++ {
+		statedb := state.New()
+		statedb.SetCode(contract, code)
+		statedb.SetState(contract, common.Hash{}, common.BigToHash(big.NewInt(100*i)))
+
+		env.ResetBlock(newTestBlock(i), TxContext{Origin: caller}, statedb)
+		ret, _, err := env.Call(AccountRef(caller), contract, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+		if have, want := new(big.Int).SetBytes(ret).Int64(), 101*i; have != want {
+			t.Errorf("call %d: have %d, want %d", i, have, want)
+		}
+		// A cancelled execution doesn't affect the next one
+		env.Cancel()
+	}
+}
+
+func TestReturnDataNotAliased(t *testing.T) {
+	// mstore8(0, 0xaa)
+	// staticcall(gas, 4, 0, 1, 0, 0)
+	// mstore8(0, 0xbb)
+	// returndatacopy(0, 0, 1) return(0, 1)
+	code := common.Hex2Bytes("60aa600053" + "600060006001600060045afa50" + "60bb600053" + "600160006000" + "3e" + "60016000f3")
+	env, contract := newReuseTestEVM(code)
+
+	ret, _, err := env.Call(AccountRef(common.Address{}), contract, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if !bytes.Equal(ret, []byte{0xaa}) {
+		t.Errorf("return data mismatch: have %x, want aa", ret)
+	}
+}
+
+// mstore(1024, 1) return(1024, 32)
+var memoryTestCode = common.Hex2Bytes("6001610400526020610400f3")
+
+func TestMemoryPoolAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("pooling is randomised under the race detector")
+	}
+	env, addr := newReuseTestEVM(memoryTestCode)
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+	contract.SetCallCode(&addr, common.Hash{}, memoryTestCode)
+
+	// The returned data, the scope context and the state captured by the
+	// tracing defer are allocated, but not the pooled memory of the frame
+	allocs := testing.AllocsPerRun(100, func() {
+		contract.Gas = 100000
+		if _, err := env.interpreter.Run(contract, nil, false); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+	})
+	if allocs > 3 {
+		t.Errorf("allocations mismatch: have %v, want at most 3", allocs)
+	}
+}
+
+func BenchmarkEVMCall(b *testing.B) {
+	caller := AccountRef(common.BytesToAddress([]byte("caller")))
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			env, contract := newReuseTestEVM(memoryTestCode)
+			env.Call(caller, contract, nil, 100000, new(big.Int))
+		}
+	})
+	b.Run("reused", func(b *testing.B) {
+		env, contract := newReuseTestEVM(memoryTestCode)
+		statedb := env.StateDB
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			env.Reset(TxContext{}, statedb)
+			env.Call(caller, contract, nil, 100000, new(big.Int))
+		}
+	})
+}
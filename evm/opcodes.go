@@ -2,6 +2,7 @@ package evm
 
 import (
 	"fmt"
+	"strings"
 )
 
 // OpCode is an EVM opcode
@@ -191,6 +192,23 @@ const (
 	LOG4
 )
 
+// 0xd0 range - EOF data section access.
+const (
+	DATALOAD  OpCode = 0xd0
+	DATALOADN OpCode = 0xd1
+	DATASIZE  OpCode = 0xd2
+	DATACOPY  OpCode = 0xd3
+)
+
+// 0xe0 range - EOF control flow.
+const (
+	RJUMP  OpCode = 0xe0
+	RJUMPI OpCode = 0xe1
+	RJUMPV OpCode = 0xe2
+	CALLF  OpCode = 0xe3
+	RETF   OpCode = 0xe4
+)
+
 // 0xf0 range - closures.
 const (
 	CREATE       OpCode = 0xf0
@@ -360,6 +378,19 @@ var opCodeToString = map[OpCode]string{
 	LOG3:   "LOG3",
 	LOG4:   "LOG4",
 
+	// 0xd0 range.
+	DATALOAD:  "DATALOAD",
+	DATALOADN: "DATALOADN",
+	DATASIZE:  "DATASIZE",
+	DATACOPY:  "DATACOPY",
+
+	// 0xe0 range.
+	RJUMP:  "RJUMP",
+	RJUMPI: "RJUMPI",
+	RJUMPV: "RJUMPV",
+	CALLF:  "CALLF",
+	RETF:   "RETF",
+
 	// 0xf0 range.
 	CREATE:       "CREATE",
 	CALL:         "CALL",
@@ -519,6 +550,15 @@ var stringToOp = map[string]OpCode{
 	"LOG2":           LOG2,
 	"LOG3":           LOG3,
 	"LOG4":           LOG4,
+	"DATALOAD":       DATALOAD,
+	"DATALOADN":      DATALOADN,
+	"DATASIZE":       DATASIZE,
+	"DATACOPY":       DATACOPY,
+	"RJUMP":          RJUMP,
+	"RJUMPI":         RJUMPI,
+	"RJUMPV":         RJUMPV,
+	"CALLF":          CALLF,
+	"RETF":           RETF,
 	"CREATE":         CREATE,
 	"CREATE2":        CREATE2,
 	"CALL":           CALL,
@@ -533,3 +573,25 @@ var stringToOp = map[string]OpCode{
 func StringToOp(str string) OpCode {
 	return stringToOp[str]
 }
+
+// RegisterOpCode names a custom opcode, making it known to StringToOp and
+// OpCode.String and thereby to the assembler, disassembler and tracers.
+// Opcodes and names already in use can't be registered. Registration is not
+// safe for concurrent use, it is meant to happen on startup.
+func RegisterOpCode(op OpCode, name string) error {
+	if name == "" {
+		return fmt.Errorf("opcode 0x%x has no name", int(op))
+	}
+	if name != strings.ToUpper(name) {
+		return fmt.Errorf("opcode name %s is not upper case", name)
+	}
+	if str, ok := opCodeToString[op]; ok {
+		return fmt.Errorf("opcode 0x%x is already named %s", int(op), str)
+	}
+	if _, ok := stringToOp[name]; ok {
+		return fmt.Errorf("opcode name %s is already in use", name)
+	}
+	opCodeToString[op] = name
+	stringToOp[name] = op
+	return nil
+}
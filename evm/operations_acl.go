@@ -5,12 +5,14 @@ import (
 	"github.com/entropyio/go-evm/common"
 	"github.com/entropyio/go-evm/common/mathutil"
 	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/model"
 )
 
-func makeGasSStoreFunc(clearingRefund uint64) gasFunc {
+func makeGasSStoreFunc(clearingRefundFn func(*config.ProtocolParams) uint64) gasFunc {
 	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		clearingRefund := clearingRefundFn(evm.params())
 		// If we fail the minimum gas availability invariant, fail (0)
-		if contract.Gas <= config.SstoreSentryGasEIP2200 {
+		if contract.Gas <= evm.params().SstoreSentryGasEIP2200 {
 			return 0, errors.New("not enough gas for reentrancy sentry")
 		}
 		// Gas sentry honoured, do the actual gas calculation based on the stored value
@@ -23,19 +25,19 @@ func makeGasSStoreFunc(clearingRefund uint64) gasFunc {
 
 		value := common.Hash(y.Bytes32())
 		if current == value {
-			return cost + config.WarmStorageReadCostEIP2929, nil // SLOAD_GAS
+			return cost + evm.params().WarmStorageReadCostEIP2929, nil // SLOAD_GAS
 		}
 		original := evm.StateDB.GetCommittedState(contract.Address(), x.Bytes32())
 		if original == current {
 			if original == (common.Hash{}) { // create slot (2.1.1)
-				return cost + config.SstoreSetGasEIP2200, nil
+				return cost + evm.params().SstoreSetGasEIP2200, nil
 			}
 			if value == (common.Hash{}) { // delete slot (2.1.2b)
 				evm.StateDB.AddRefund(clearingRefund)
 			}
 			// EIP-2200 original clause:
 			//		return config.SstoreResetGasEIP2200, nil // write existing slot (2.1.2)
-			return cost + (config.SstoreResetGasEIP2200 - config.ColdSloadCostEIP2929), nil // write existing slot (2.1.2)
+			return cost + (evm.params().SstoreResetGasEIP2200 - evm.params().ColdSloadCostEIP2929), nil // write existing slot (2.1.2)
 		}
 		if original != (common.Hash{}) {
 			if current == (common.Hash{}) { // recreate slot (2.2.1.1)
@@ -48,19 +50,19 @@ func makeGasSStoreFunc(clearingRefund uint64) gasFunc {
 			if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
 				// EIP 2200 Original clause:
 				//evm.StateDB.AddRefund(config.SstoreSetGasEIP2200 - config.SloadGasEIP2200)
-				evm.StateDB.AddRefund(config.SstoreSetGasEIP2200 - config.WarmStorageReadCostEIP2929)
+				evm.StateDB.AddRefund(evm.params().SstoreSetGasEIP2200 - evm.params().WarmStorageReadCostEIP2929)
 			} else { // reset to original existing slot (2.2.2.2)
 				// EIP 2200 Original clause:
 				//	evm.StateDB.AddRefund(config.SstoreResetGasEIP2200 - config.SloadGasEIP2200)
 				// - SSTORE_RESET_GAS redefined as (5000 - COLD_SLOAD_COST)
 				// - SLOAD_GAS redefined as WARM_STORAGE_READ_COST
 				// Final: (5000 - COLD_SLOAD_COST) - WARM_STORAGE_READ_COST
-				evm.StateDB.AddRefund((config.SstoreResetGasEIP2200 - config.ColdSloadCostEIP2929) - config.WarmStorageReadCostEIP2929)
+				evm.StateDB.AddRefund((evm.params().SstoreResetGasEIP2200 - evm.params().ColdSloadCostEIP2929) - evm.params().WarmStorageReadCostEIP2929)
 			}
 		}
 		// EIP-2200 original clause:
 		//return config.SloadGasEIP2200, nil // dirty update (2.2)
-		return cost + config.WarmStorageReadCostEIP2929, nil // dirty update (2.2)
+		return cost + evm.params().WarmStorageReadCostEIP2929, nil // dirty update (2.2)
 	}
 }
 
@@ -77,9 +79,9 @@ func gasSLoadEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 		// If the caller cannot afford the cost, this change will be rolled back
 		// If he does afford it, we can skip checking the same thing later on, during execution
 		evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
-		return config.ColdSloadCostEIP2929, nil
+		return evm.params().ColdSloadCostEIP2929, nil
 	}
-	return config.WarmStorageReadCostEIP2929, nil
+	return evm.params().WarmStorageReadCostEIP2929, nil
 }
 
 // gasExtCodeCopyEIP2929 implements extcodecopy according to EIP-2929
@@ -87,6 +89,8 @@ func gasSLoadEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 // > If the target is not in accessed_addresses,
 // > charge COLD_ACCOUNT_ACCESS_COST gas, and add the address to accessed_addresses.
 // > Otherwise, charge WARM_STORAGE_READ_COST gas.
+// The delegation target of an account delegating its code (EIP-7702) is not
+// charged for, as the delegation is not followed.
 func gasExtCodeCopyEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	// memory expansion first (dynamic part of pre-2929 implementation)
 	gas, err := gasExtCodeCopy(evm, contract, stack, mem, memorySize)
@@ -99,7 +103,7 @@ func gasExtCodeCopyEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memo
 		evm.StateDB.AddAddressToAccessList(addr)
 		var overflow bool
 		// We charge (cold-warm), since 'warm' is already charged as constantGas
-		if gas, overflow = mathutil.SafeAdd(gas, config.ColdAccountAccessCostEIP2929-config.WarmStorageReadCostEIP2929); overflow {
+		if gas, overflow = mathutil.SafeAdd(gas, evm.params().ColdAccountAccessCostEIP2929-evm.params().WarmStorageReadCostEIP2929); overflow {
 			return 0, ErrGasUintOverflow
 		}
 		return gas, nil
@@ -114,6 +118,8 @@ func gasExtCodeCopyEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memo
 // - extcodehash,
 // - extcodesize,
 // - (ext) balance
+// Like for gasExtCodeCopyEIP2929, the delegation target of an account
+// delegating its code (EIP-7702) is not accessed, hence not charged for.
 func gasEip2929AccountCheck(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	addr := common.Address(stack.peek().Bytes20())
 	// Check slot presence in the access list
@@ -121,7 +127,7 @@ func gasEip2929AccountCheck(evm *EVM, contract *Contract, stack *Stack, mem *Mem
 		// If the caller cannot afford the cost, this change will be rolled back
 		evm.StateDB.AddAddressToAccessList(addr)
 		// The warm storage read cost is already charged as constantGas
-		return config.ColdAccountAccessCostEIP2929 - config.WarmStorageReadCostEIP2929, nil
+		return evm.params().ColdAccountAccessCostEIP2929 - evm.params().WarmStorageReadCostEIP2929, nil
 	}
 	return 0, nil
 }
@@ -133,7 +139,7 @@ func makeCallVariantGasCallEIP2929(oldCalculator gasFunc) gasFunc {
 		warmAccess := evm.StateDB.AddressInAccessList(addr)
 		// The WarmStorageReadCostEIP2929 (100) is already deducted in the form of a constant cost, so
 		// the cost to charge for cold access, if any, is Cold - Warm
-		coldCost := config.ColdAccountAccessCostEIP2929 - config.WarmStorageReadCostEIP2929
+		coldCost := evm.params().ColdAccountAccessCostEIP2929 - evm.params().WarmStorageReadCostEIP2929
 		if !warmAccess {
 			evm.StateDB.AddAddressToAccessList(addr)
 			// Charge the remaining difference here already, to correctly calculate available
@@ -165,6 +171,10 @@ var (
 	gasDelegateCallEIP2929 = makeCallVariantGasCallEIP2929(gasDelegateCall)
 	gasStaticCallEIP2929   = makeCallVariantGasCallEIP2929(gasStaticCall)
 	gasCallCodeEIP2929     = makeCallVariantGasCallEIP2929(gasCallCode)
+	gasCallEIP7702         = makeCallVariantGasCallEIP7702(gasCall)
+	gasDelegateCallEIP7702 = makeCallVariantGasCallEIP7702(gasDelegateCall)
+	gasStaticCallEIP7702   = makeCallVariantGasCallEIP7702(gasStaticCall)
+	gasCallCodeEIP7702     = makeCallVariantGasCallEIP7702(gasCallCode)
 	gasSelfdestructEIP2929 = makeSelfdestructGasFn(true)
 	// gasSelfdestructEIP3529 implements the changes in EIP-2539 (no refunds)
 	gasSelfdestructEIP3529 = makeSelfdestructGasFn(false)
@@ -181,11 +191,11 @@ var (
 	//
 	//The other parameters defined in EIP 2200 are unchanged.
 	// see gasSStoreEIP2200(...) in core/vm/gas_table.go for more info about how EIP 2200 is specified
-	gasSStoreEIP2929 = makeGasSStoreFunc(config.SstoreClearsScheduleRefundEIP2200)
+	gasSStoreEIP2929 = makeGasSStoreFunc(func(p *config.ProtocolParams) uint64 { return p.SstoreClearsScheduleRefundEIP2200 })
 
 	// gasSStoreEIP2539 implements gas cost for SSTORE according to EIP-2539
 	// Replace `SSTORE_CLEARS_SCHEDULE` with `SSTORE_RESET_GAS + ACCESS_LIST_STORAGE_KEY_COST` (4,800)
-	gasSStoreEIP3529 = makeGasSStoreFunc(config.SstoreClearsScheduleRefundEIP3529)
+	gasSStoreEIP3529 = makeGasSStoreFunc(func(p *config.ProtocolParams) uint64 { return p.SstoreClearsScheduleRefundEIP3529 })
 )
 
 // makeSelfdestructGasFn can create the selfdestruct dynamic gas function for EIP-2929 and EIP-2539
@@ -198,16 +208,76 @@ func makeSelfdestructGasFn(refundsEnabled bool) gasFunc {
 		if !evm.StateDB.AddressInAccessList(address) {
 			// If the caller cannot afford the cost, this change will be rolled back
 			evm.StateDB.AddAddressToAccessList(address)
-			gas = config.ColdAccountAccessCostEIP2929
+			gas = evm.params().ColdAccountAccessCostEIP2929
 		}
 		// if empty and transfers value
 		if evm.StateDB.Empty(address) && evm.StateDB.GetBalance(contract.Address()).Sign() != 0 {
-			gas += config.CreateBySelfdestructGas
+			gas += evm.params().CreateBySelfdestructGas
 		}
 		if refundsEnabled && !evm.StateDB.HasSuicided(contract.Address()) {
-			evm.StateDB.AddRefund(config.SelfdestructRefundGas)
+			evm.StateDB.AddRefund(evm.params().SelfdestructRefundGas)
 		}
 		return gas, nil
 	}
 	return gasFunc
 }
+
+// makeCallVariantGasCallEIP7702 extends the EIP-2929 call gas calculation with
+// the cost of resolving a delegation designator (EIP-7702). If the callee code
+// is a delegation, the delegated-to account is charged like any other account
+// access: warm if already in the access list, cold otherwise.
+func makeCallVariantGasCallEIP7702(oldCalculator gasFunc) gasFunc {
+	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		var (
+			total uint64 // total dynamic gas used
+			addr  = common.Address(stack.Back(1).Bytes20())
+		)
+		// Check slot presence in the access list
+		if !evm.StateDB.AddressInAccessList(addr) {
+			evm.StateDB.AddAddressToAccessList(addr)
+			// The WarmStorageReadCostEIP2929 (100) is already deducted in the form of a constant cost, so
+			// the cost to charge for cold access, if any, is Cold - Warm
+			coldCost := evm.params().ColdAccountAccessCostEIP2929 - evm.params().WarmStorageReadCostEIP2929
+			// Charge the remaining difference here already, to correctly calculate available
+			// gas for call
+			if !contract.UseGas(coldCost) {
+				return 0, ErrOutOfGas
+			}
+			total += coldCost
+		}
+		// Check if code is a delegation and if so, charge for resolution.
+		if target, ok := model.ParseDelegation(evm.StateDB.GetCode(addr)); ok {
+			var cost uint64
+			if evm.StateDB.AddressInAccessList(target) {
+				cost = evm.params().WarmStorageReadCostEIP2929
+			} else {
+				evm.StateDB.AddAddressToAccessList(target)
+				cost = evm.params().ColdAccountAccessCostEIP2929
+			}
+			if !contract.UseGas(cost) {
+				return 0, ErrOutOfGas
+			}
+			total += cost
+		}
+		// Now call the old calculator, which takes into account
+		// - create new account
+		// - transfer value
+		// - memory expansion
+		// - 63/64ths rule
+		old, err := oldCalculator(evm, contract, stack, mem, memorySize)
+		if err != nil {
+			return old, err
+		}
+		// Temporarily add the gas charge back to the contract and return value. By
+		// adding it to the return, it will be charged outside of this function, as
+		// part of the dynamic gas. This will ensure it is correctly reported to
+		// tracers.
+		contract.Gas += total
+
+		var overflow bool
+		if total, overflow = mathutil.SafeAdd(old, total); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return total, nil
+	}
+}
@@ -0,0 +1,67 @@
+package evm
+
+import (
+	"github.com/entropyio/go-evm/common"
+)
+
+// Policy restricts the execution of permissioned chains. It is consulted on
+// every contract creation, denied creations fail with ErrCreateDenied. The
+// denied instructions are looked up once when the interpreter is created,
+// executing one of them fails with ErrOpCodeDenied.
+type Policy interface {
+	// AllowCreate reports whether caller may deploy a contract within a
+	// transaction sent by origin.
+	AllowCreate(origin, caller common.Address) bool
+	// DenyOpCode reports whether the instruction is disabled.
+	DenyOpCode(op OpCode) bool
+}
+
+// PolicyLogger is an optional extension of EVMLogger. Tracers implementing
+// it are notified of the contract creations and instructions denied by the
+// policy.
+type PolicyLogger interface {
+	CapturePolicyDenial(op OpCode, caller common.Address, err error)
+}
+
+// AllowlistPolicy is a Policy restricting contract deployment to approved
+// accounts and disabling a set of instructions.
+type AllowlistPolicy struct {
+	// Deployers are the transaction senders allowed to deploy contracts,
+	// directly or through other contracts.
+	Deployers map[common.Address]bool
+	// Creators are the accounts allowed to deploy contracts regardless of
+	// the transaction sender, such as factory contracts.
+	Creators map[common.Address]bool
+	// DeniedOpCodes are the disabled instructions.
+	DeniedOpCodes []OpCode
+}
+
+// AllowCreate implements Policy. Deployment is unrestricted if neither
+// deployers nor creators are set.
+func (p *AllowlistPolicy) AllowCreate(origin, caller common.Address) bool {
+	if p.Deployers == nil && p.Creators == nil {
+		return true
+	}
+	return p.Deployers[origin] || p.Creators[caller]
+}
+
+// DenyOpCode implements Policy.
+func (p *AllowlistPolicy) DenyOpCode(op OpCode) bool {
+	for _, denied := range p.DeniedOpCodes {
+		if op == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// capturePolicyDenial notifies the tracer of a decision of the policy, if it
+// is interested in them.
+func (evm *EVM) capturePolicyDenial(op OpCode, caller common.Address, err error) {
+	if !evm.Config.Debug {
+		return
+	}
+	if tracer, ok := evm.Config.Tracer.(PolicyLogger); ok {
+		tracer.CapturePolicyDenial(op, caller, err)
+	}
+}
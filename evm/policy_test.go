@@ -0,0 +1,79 @@
+package evm
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"testing"
+)
+
+// policyTracer records the policy denials and the failed steps of an execution.
+type policyTracer struct {
+	noopLogger
+
+	denials []OpCode
+	faults  []error
+}
+
+func (t *policyTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		t.faults = append(t.faults, err)
+	}
+}
+
+func (t *policyTracer) CapturePolicyDenial(op OpCode, caller common.Address, err error) {
+	t.denials = append(t.denials, op)
+}
+
+func TestPolicy(t *testing.T) {
+	var (
+		deployer = common.BytesToAddress([]byte("deployer"))
+		stranger = common.BytesToAddress([]byte("stranger"))
+		contract = common.BytesToAddress([]byte("contract"))
+		statedb  = state.New()
+		tracer   = new(policyTracer)
+	)
+	// push1 0 selfdestruct
+	statedb.SetCode(contract, []byte{byte(PUSH1), 0, byte(SELFDESTRUCT)})
+
+	env := newTestEVM(statedb, config.Rules{}, EVMConfig{
+		Debug:  true,
+		Tracer: tracer,
+		Policy: &AllowlistPolicy{
+			Deployers:     map[common.Address]bool{deployer: true},
+			DeniedOpCodes: []OpCode{SELFDESTRUCT, CALLCODE},
+		},
+	})
+
+	// Only approved accounts may deploy contracts
+	env.Origin = stranger
+	if _, _, gas, err := env.Create(AccountRef(stranger), []byte{byte(STOP)}, 100000, new(big.Int)); err != ErrCreateDenied || gas != 100000 {
+		t.Errorf("stranger deployment: have (%d, %v), want (100000, %v)", gas, err, ErrCreateDenied)
+	}
+	if nonce := statedb.GetNonce(stranger); nonce != 0 {
+		t.Errorf("denied deployment bumped nonce to %d", nonce)
+	}
+	env.Origin = deployer
+	if _, _, _, err := env.Create(AccountRef(deployer), []byte{byte(STOP)}, 100000, new(big.Int)); err != nil {
+		t.Errorf("deployer deployment failed: %v", err)
+	}
+	// Denied instructions fail the execution
+	env.Origin = stranger
+	_, _, err := env.Call(AccountRef(stranger), contract, nil, 100000, new(big.Int))
+	var denied *ErrOpCodeDenied
+	if !errors.As(err, &denied) || denied.opcode != SELFDESTRUCT {
+		t.Errorf("selfdestruct: have %v, want denied opcode", err)
+	}
+	if statedb.HasSuicided(contract) {
+		t.Errorf("contract self-destructed")
+	}
+	// Tracers see the denials
+	if len(tracer.denials) != 2 || tracer.denials[0] != CREATE || tracer.denials[1] != SELFDESTRUCT {
+		t.Errorf("traced denials mismatch: %v", tracer.denials)
+	}
+	if len(tracer.faults) != 1 || !errors.As(tracer.faults[0], &denied) {
+		t.Errorf("traced faults mismatch: %v", tracer.faults)
+	}
+}
@@ -0,0 +1,220 @@
+package evm
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/holiman/uint256"
+)
+
+// defaultProgramCacheSize is the memory allowance of the pre-decoded program
+// cache, enough for a few hundred maximum sized contracts.
+const defaultProgramCacheSize = 64 * 1024 * 1024
+
+// programCache holds the pre-decoded code of the contracts executed by all
+// EVMs of the process with EVMConfig.PreDecode set.
+var programCache = newLRUCache(defaultProgramCacheSize)
+
+// Kinds of pre-decoded instructions. Superinstructions execute a sequence of
+// instructions at once.
+const (
+	insPlain     uint8 = iota // Executed through the jump table
+	insPush                   // PUSHn with a pre-parsed immediate
+	insPushJump               // PUSHn JUMP to a valid destination
+	insPushJumpi              // PUSHn JUMPI to a valid destination
+	insDupSwap                // DUPn SWAPm
+	insSwapPop                // SWAPn POP
+)
+
+// decodedOp is the pre-decoded instruction at a position of the code.
+type decodedOp struct {
+	kind uint8
+	op   OpCode // First instruction
+	next OpCode // Second instruction of a superinstruction
+	imm  uint32 // Index of the PUSHn immediate in the program
+}
+
+// program is legacy code decoded into instructions indexed by their position
+// in the code, with PUSHn immediates parsed and static jumps validated.
+type program struct {
+	ops  []decodedOp
+	imms []uint256.Int
+}
+
+// size approximates the memory used by the program in bytes.
+func (p *program) size() int {
+	return 8*len(p.ops) + 32*len(p.imms)
+}
+
+// decodeProgram decodes the legacy code, using its JUMPDEST analysis to
+// validate static jumps. The analysis is computed if nil.
+func decodeProgram(code []byte, analysis bitvec) *program {
+	if analysis == nil {
+		analysis = codeBitmap(code)
+	}
+	var (
+		codeLen = len(code)
+		prog    = &program{ops: make([]decodedOp, codeLen)}
+	)
+	for pc := 0; pc < codeLen; {
+		var (
+			op   = OpCode(code[pc])
+			d    = &prog.ops[pc]
+			size = 1
+		)
+		d.op = op
+		switch {
+		case op >= PUSH1 && op <= PUSH32:
+			n := int(op-PUSH1) + 1
+			start, end := pc+1, pc+1+n
+			if end > codeLen {
+				end = codeLen
+			}
+			var imm uint256.Int
+			imm.SetBytes(common.RightPadBytes(code[start:end], n))
+
+			d.kind, d.imm = insPush, uint32(len(prog.imms))
+			prog.imms = append(prog.imms, imm)
+			size += n
+
+			if pc+size < codeLen && validStaticJump(code, analysis, &imm) {
+				switch next := OpCode(code[pc+size]); next {
+				case JUMP:
+					d.kind, d.next = insPushJump, next
+				case JUMPI:
+					d.kind, d.next = insPushJumpi, next
+				}
+			}
+		case op >= DUP1 && op <= DUP16:
+			if pc+1 < codeLen {
+				if next := OpCode(code[pc+1]); next >= SWAP1 && next <= SWAP16 {
+					d.kind, d.next = insDupSwap, next
+				}
+			}
+		case op >= SWAP1 && op <= SWAP16:
+			if pc+1 < codeLen && OpCode(code[pc+1]) == POP {
+				d.kind, d.next = insSwapPop, POP
+			}
+		}
+		pc += size
+	}
+	return prog
+}
+
+// validStaticJump returns whether the destination is a JUMPDEST of the code.
+func validStaticJump(code []byte, analysis bitvec, dest *uint256.Int) bool {
+	udest, overflow := dest.Uint64WithOverflow()
+	if overflow || udest >= uint64(len(code)) {
+		return false
+	}
+	return OpCode(code[udest]) == JUMPDEST && analysis.codeSegment(udest)
+}
+
+// step performs the checks and charges of the main interpreter loop for an
+// instruction of a superinstruction, which has no dynamic gas, and records
+// and traces it the same way.
+func (in *EVMInterpreter) step(st *stepState, pc uint64, op OpCode, jumpTable *JumpTable, scope *ScopeContext) error {
+	contract := scope.Contract
+	if in.cfg.Debug {
+		st.logged, st.pc, st.gas = false, pc, contract.Gas
+	}
+	st.op = op
+	if st.frame != nil {
+		st.frame.PC, st.frame.Op, st.frame.Gas = pc, op, contract.Gas
+	}
+	if in.cfg.MaxSteps != 0 {
+		if in.steps++; in.steps > in.cfg.MaxSteps {
+			st.cost = 0
+			return ErrStepLimit
+		}
+	}
+	if in.denied != nil && in.denied[op] {
+		st.cost = 0
+		err := &ErrOpCodeDenied{opcode: op}
+		in.evm.capturePolicyDenial(op, contract.Address(), err)
+		return err
+	}
+	operation := jumpTable[op]
+	st.cost = operation.constantGas
+	if sLen := scope.Stack.len(); sLen < operation.minStack {
+		return &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
+	} else if sLen > operation.maxStack {
+		return &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
+	}
+	if !contract.UseGas(operation.constantGas) {
+		return ErrOutOfGas
+	}
+	if in.cfg.Debug {
+		in.cfg.Tracer.CaptureState(pc, op, st.gas, st.cost, scope, in.returnData, in.evm.depth, nil)
+		st.logged = true
+	}
+	return nil
+}
+
+// execDecoded executes the pre-decoded instruction at pc and advances pc past
+// it. Every instruction covered is checked, charged and traced as if executed
+// by the main loop, so that results, gas usage and tracer callbacks are the
+// same.
+func (in *EVMInterpreter) execDecoded(st *stepState, d *decodedOp, prog *program, pc *uint64, jumpTable *JumpTable, scope *ScopeContext) error {
+	stack := scope.Stack
+	if err := in.step(st, *pc, d.op, jumpTable, scope); err != nil {
+		return err
+	}
+	switch d.kind {
+	case insPush:
+		stack.push(&prog.imms[d.imm])
+		*pc += uint64(d.op-PUSH1) + 2
+
+	case insPushJump:
+		stack.push(&prog.imms[d.imm])
+		if err := in.step(st, *pc+uint64(d.op-PUSH1)+2, JUMP, jumpTable, scope); err != nil {
+			return err
+		}
+		if in.evm.Cancelled() {
+			return ErrExecutionAborted
+		}
+		stack.pop()
+		*pc = prog.imms[d.imm].Uint64()
+
+	case insPushJumpi:
+		stack.push(&prog.imms[d.imm])
+		if err := in.step(st, *pc+uint64(d.op-PUSH1)+2, JUMPI, jumpTable, scope); err != nil {
+			return err
+		}
+		if in.evm.Cancelled() {
+			return ErrExecutionAborted
+		}
+		stack.pop()
+		if cond := stack.pop(); !cond.IsZero() {
+			*pc = prog.imms[d.imm].Uint64()
+		} else {
+			*pc += uint64(d.op-PUSH1) + 3
+		}
+
+	case insDupSwap:
+		stack.dup(int(d.op-DUP1) + 1)
+		if err := in.step(st, *pc+1, d.next, jumpTable, scope); err != nil {
+			return err
+		}
+		stack.swap(int(d.next-SWAP1) + 2)
+		*pc += 2
+
+	case insSwapPop:
+		stack.swap(int(d.op-SWAP1) + 2)
+		if err := in.step(st, *pc+1, POP, jumpTable, scope); err != nil {
+			return err
+		}
+		stack.pop()
+		*pc += 2
+	}
+	return nil
+}
+
+// loadProgram returns the pre-decoded code of the contract, which must be
+// legacy code with a hash, decoding it if it isn't cached.
+func (c *Contract) loadProgram() *program {
+	if value, ok := programCache.get(c.CodeHash); ok {
+		return value.(*program)
+	}
+	prog := decodeProgram(c.Code, c.analysis)
+	programCache.add(c.CodeHash, prog, prog.size())
+	return prog
+}
@@ -0,0 +1,189 @@
+package evm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// preDecodeLoop jumps over an invalid instruction, counts down from 10 and
+// returns 0xff, using every kind of superinstruction:
+//
+//	0:  push1 4, jump, invalid
+//	4:  jumpdest, push1 10
+//	7:  jumpdest, push1 1, swap1, sub
+//	12: dup1, swap1, dup1, push1 7, jumpi
+//	18: push1 0xff, swap1, pop
+//	22: mstore(0, 0xff) return(0, 32)
+var preDecodeLoop = common.Hex2Bytes("600456fe" + "5b600a" + "5b60019003" + "8090806007" + "57" + "60ff9050" + "600052" + "60206000f3")
+
+func TestDecodeProgram(t *testing.T) {
+	prog := decodeProgram(preDecodeLoop, nil)
+	kinds := map[int]uint8{
+		0: insPushJump, 5: insPush, 8: insPush, 10: insPlain, 12: insDupSwap,
+		14: insPlain, 15: insPushJumpi, 18: insPush, 20: insSwapPop,
+	}
+	for pc, kind := range kinds {
+		if have := prog.ops[pc].kind; have != kind {
+			t.Errorf("pc %d: kind mismatch: have %d, want %d", pc, have, kind)
+		}
+	}
+	if have := prog.imms[prog.ops[15].imm].Uint64(); have != 7 {
+		t.Errorf("jumpi destination mismatch: have %d, want 7", have)
+	}
+	// Jumps to invalid destinations or into immediates are left to the
+	// interpreter, truncated immediates are padded
+	prog = decodeProgram(common.Hex2Bytes("600356"+"00"+"600856"+"60"+"5b"+"6101"), nil)
+	for _, pc := range []int{0, 4} {
+		if have := prog.ops[pc].kind; have != insPush {
+			t.Errorf("pc %d: kind mismatch: have %d, want %d", pc, have, insPush)
+		}
+	}
+	if have := prog.imms[prog.ops[9].imm].Uint64(); have != 0x0100 {
+		t.Errorf("truncated immediate mismatch: have %#x, want 0x100", have)
+	}
+}
+
+// runPreDecode executes the code with the given gas and returns the output,
+// the gas left and the error.
+func runPreDecode(code []byte, gas uint64, cfg EVMConfig) ([]byte, uint64, error) {
+	addr := common.BytesToAddress([]byte("contract"))
+
+	env := newTestEVM(state.New(), londonTestRules, cfg)
+
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), gas)
+	contract.SetCallCode(&addr, crypto.Keccak256Hash(code), code)
+	ret, err := env.interpreter.Run(contract, nil, false)
+	return ret, contract.Gas, err
+}
+
+func TestPreDecodeEquivalence(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		gas  uint64 // Gas to execute with, or swept up to exhaustion if zero
+	}{
+		{"loop", preDecodeLoop, 0},
+		{"invalid jump", common.Hex2Bytes("6003560000"), 0},
+		{"jump into immediate", common.Hex2Bytes("600556" + "00605b"), 0},
+		{"jumpi underflow", common.Hex2Bytes("600457005b"), 0},
+		{"dup underflow", common.Hex2Bytes("8090"), 0},
+		{"swap underflow", common.Hex2Bytes("600090" + "50"), 0},
+		{"truncated push", common.Hex2Bytes("7f01"), 0},
+		// jumpdest push1 1 push1 0 jump, overflowing the stack
+		{"stack overflow", common.Hex2Bytes("5b6001600056"), 100000},
+	}
+	for _, tt := range tests {
+		_, left, _ := runPreDecode(tt.code, 100000, EVMConfig{})
+		maxGas := 100000 - left + 5
+		minGas := uint64(0)
+		if tt.gas != 0 {
+			minGas, maxGas = tt.gas, tt.gas
+		}
+		for gas := minGas; gas <= maxGas; gas++ {
+			ret, left, err := runPreDecode(tt.code, gas, EVMConfig{})
+			decRet, decLeft, decErr := runPreDecode(tt.code, gas, EVMConfig{PreDecode: true})
+			if !bytes.Equal(ret, decRet) || left != decLeft || !reflect.DeepEqual(err, decErr) {
+				t.Fatalf("%s, gas %d: have (%x, %d, %v), want (%x, %d, %v)", tt.name, gas, decRet, decLeft, decErr, ret, left, err)
+			}
+		}
+	}
+	// Superinstructions count every instruction they cover
+	for steps := uint64(1); steps < 100; steps++ {
+		ret, left, err := runPreDecode(preDecodeLoop, 100000, EVMConfig{MaxSteps: steps})
+		decRet, decLeft, decErr := runPreDecode(preDecodeLoop, 100000, EVMConfig{MaxSteps: steps, PreDecode: true})
+		if !bytes.Equal(ret, decRet) || left != decLeft || err != decErr {
+			t.Fatalf("%d steps: have (%x, %d, %v), want (%x, %d, %v)", steps, decRet, decLeft, decErr, ret, left, err)
+		}
+	}
+}
+
+// stepTracer records the steps of an execution.
+type stepTracer struct {
+	noopLogger
+
+	steps []string
+}
+
+func (t *stepTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.steps = append(t.steps, fmt.Sprintf("state %d %v gas %d cost %d stack %v err %v", pc, op, gas, cost, scope.Stack.Data(), err))
+}
+
+func (t *stepTracer) CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+	t.steps = append(t.steps, fmt.Sprintf("fault %d %v gas %d cost %d stack %v err %v", pc, op, gas, cost, scope.Stack.Data(), err))
+}
+
+func (t *stepTracer) CapturePolicyDenial(op OpCode, caller common.Address, err error) {
+	t.steps = append(t.steps, fmt.Sprintf("denied %v", op))
+}
+
+func TestPreDecodeTracing(t *testing.T) {
+	codes := map[string][]byte{
+		"loop":           preDecodeLoop,
+		"dup underflow":  common.Hex2Bytes("8090"),
+		"stack overflow": common.Hex2Bytes("5b6001600056"),
+	}
+	policies := map[string]Policy{
+		"none":        nil,
+		"deny jump":   &AllowlistPolicy{DeniedOpCodes: []OpCode{JUMP}},
+		"deny jumpi":  &AllowlistPolicy{DeniedOpCodes: []OpCode{JUMPI}},
+		"deny swap1":  &AllowlistPolicy{DeniedOpCodes: []OpCode{SWAP1}},
+		"deny pop":    &AllowlistPolicy{DeniedOpCodes: []OpCode{POP}},
+		"deny push1":  &AllowlistPolicy{DeniedOpCodes: []OpCode{PUSH1}},
+		"deny dup1":   &AllowlistPolicy{DeniedOpCodes: []OpCode{DUP1}},
+		"deny return": &AllowlistPolicy{DeniedOpCodes: []OpCode{RETURN}},
+	}
+	for name, code := range codes {
+		for policyName, policy := range policies {
+			for _, gas := range []uint64{100000, 40, 10} {
+				var plain, decoded stepTracer
+				ret, left, err := runPreDecode(code, gas, EVMConfig{Debug: true, Tracer: &plain, Policy: policy})
+				decRet, decLeft, decErr := runPreDecode(code, gas, EVMConfig{Debug: true, Tracer: &decoded, Policy: policy, PreDecode: true})
+				if !bytes.Equal(ret, decRet) || left != decLeft || !reflect.DeepEqual(err, decErr) {
+					t.Fatalf("%s, %s, gas %d: have (%x, %d, %v), want (%x, %d, %v)", name, policyName, gas, decRet, decLeft, decErr, ret, left, err)
+				}
+				if !reflect.DeepEqual(plain.steps, decoded.steps) {
+					t.Fatalf("%s, %s, gas %d: steps mismatch:\nhave %v\nwant %v", name, policyName, gas, decoded.steps, plain.steps)
+				}
+			}
+		}
+	}
+	// Stack traces locate failures within superinstructions
+	for name, code := range codes {
+		var errs [2]error
+		for i, preDecode := range []bool{false, true} {
+			statedb := state.New()
+			addr := common.BytesToAddress([]byte("contract"))
+			statedb.SetCode(addr, code)
+			env := newTestEVM(statedb, londonTestRules, EVMConfig{JumpTable: &londonInstructionSet, StackTraces: true, PreDecode: preDecode})
+			_, _, errs[i] = env.Call(AccountRef(common.Address{}), addr, nil, 100000, new(big.Int))
+		}
+		if !reflect.DeepEqual(errs[0], errs[1]) {
+			t.Errorf("%s: stack trace mismatch: have %v, want %v", name, errs[1], errs[0])
+		}
+	}
+}
+
+func BenchmarkPreDecode(b *testing.B) {
+	// Count down from 0xffff: push2 0xffff, jumpdest, push1 1, swap1, sub,
+	// dup1, swap1, push1 3, jumpi
+	code := common.Hex2Bytes("61ffff" + "5b60019003" + "80906003" + "57")
+	for _, preDecode := range []bool{false, true} {
+		name := "plain"
+		if preDecode {
+			name = "predecoded"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := runPreDecode(code, 10000000, EVMConfig{PreDecode: preDecode}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package evm
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/state"
+	"github.com/holiman/uint256"
+	"math/big"
+	"testing"
+)
+
+// newParamsTestEVM returns an EVM with the given configuration at the London
+// fork of a chain with the given protocol parameters.
+func newParamsTestEVM(params *config.ProtocolParams, cfg EVMConfig) *EVM {
+	env := newTestEVM(state.New(), londonTestRules, cfg)
+	env.chainConfig = &config.ChainConfig{ProtocolParams: params}
+	env.interpreter = NewEVMInterpreter(env, env.EVMConfig)
+	return env
+}
+
+func TestLoadProtocolParams(t *testing.T) {
+	params, err := config.LoadProtocolParams([]byte(`{"jumpdestGas": 7, "stackLimit": 3}`))
+	if err != nil {
+		t.Fatalf("failed to load params: %v", err)
+	}
+	if params.JumpdestGas != 7 || params.StackLimit != 3 {
+		t.Errorf("custom params not applied: jumpdest %d, stack limit %d", params.JumpdestGas, params.StackLimit)
+	}
+	if params.EcrecoverGas != config.EcrecoverGas || params.CallCreateDepth != config.CallCreateDepth {
+		t.Errorf("unspecified params not defaulted: %+v", params)
+	}
+	if _, err := config.LoadProtocolParams([]byte(`{"quadCoeffDiv": 0}`)); err == nil {
+		t.Errorf("zero memory divisor accepted")
+	}
+}
+
+func TestCustomProtocolParams(t *testing.T) {
+	params := config.DefaultProtocolParams
+	params.JumpdestGas = 7
+	params.StackLimit = 2
+	params.EcrecoverGas = 1000
+	env := newParamsTestEVM(&params, EVMConfig{})
+
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		jumper = common.BytesToAddress([]byte("jumper"))
+		pusher = common.BytesToAddress([]byte("pusher"))
+	)
+	env.StateDB.SetCode(jumper, []byte{byte(JUMPDEST), byte(STOP)})
+	env.StateDB.SetCode(pusher, []byte{byte(PUSH1), 1, byte(PUSH1), 1, byte(PUSH1), 1})
+
+	// Instructions are priced with the custom parameters
+	if _, gas, err := env.Call(AccountRef(caller), jumper, nil, 100, new(big.Int)); err != nil || gas != 100-7 {
+		t.Errorf("jumpdest: have (%d, %v), want (%d, nil)", gas, err, 100-7)
+	}
+	// The stack is bounded by the custom limit
+	if _, _, err := env.Call(AccountRef(caller), pusher, nil, 100, new(big.Int)); !errors.As(err, new(*ErrStackOverflow)) {
+		t.Errorf("stack limit: have %v, want stack overflow", err)
+	}
+	// Precompiled contracts are priced with the custom parameters
+	ecrecoverAddr := common.BytesToAddress([]byte{1})
+	if _, gas, err := env.Call(AccountRef(caller), ecrecoverAddr, nil, 5000, new(big.Int)); err != nil || gas != 4000 {
+		t.Errorf("ecrecover: have (%d, %v), want (4000, nil)", gas, err)
+	}
+	// Chains without custom parameters keep sharing the default tables
+	if def := newParamsTestEVM(nil, EVMConfig{}); def.interpreter.cfg.JumpTable != &homesteadInstructionSet {
+		t.Errorf("default chain got a custom instruction set")
+	}
+	if homesteadInstructionSet[JUMPDEST].constantGas != config.JumpdestGas {
+		t.Errorf("default instruction set modified")
+	}
+}
+
+func TestCustomProtocolParamsJumpTable(t *testing.T) {
+	params := config.DefaultProtocolParams
+	params.JumpdestGas = 7
+	params.StackLimit = 2
+	jt := NewJumpTable(londonTestRules, &params)
+
+	// push two items at once
+	const pushPair = OpCode(0x0c)
+	opPushPair := func(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+		scope.Stack.Push(uint256.NewInt(1))
+		scope.Stack.Push(uint256.NewInt(2))
+		return nil, nil
+	}
+	if err := jt.Define(pushPair, Operation{Execute: opPushPair, ConstantGas: 5, Pushes: 2}); err != nil {
+		t.Fatalf("failed to define instruction: %v", err)
+	}
+	env := newParamsTestEVM(&params, EVMConfig{JumpTable: &jt})
+
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		pair     = common.BytesToAddress([]byte("pair"))
+		overflow = common.BytesToAddress([]byte("overflow"))
+	)
+	env.StateDB.SetCode(pair, []byte{byte(JUMPDEST), byte(pushPair), byte(STOP)})
+	env.StateDB.SetCode(overflow, []byte{byte(PUSH1), 1, byte(pushPair)})
+
+	// Built-in and custom instructions are priced as configured
+	if _, gas, err := env.Call(AccountRef(caller), pair, nil, 100, new(big.Int)); err != nil || gas != 100-7-5 {
+		t.Errorf("pair: have (%d, %v), want (%d, nil)", gas, err, 100-7-5)
+	}
+	// The custom instruction is bounded by the custom stack limit
+	if _, _, err := env.Call(AccountRef(caller), overflow, nil, 100, new(big.Int)); !errors.As(err, new(*ErrStackOverflow)) {
+		t.Errorf("stack limit: have %v, want stack overflow", err)
+	}
+	if londonInstructionSet[JUMPDEST].constantGas != config.JumpdestGas || londonInstructionSet[STOP].maxStack != int(config.StackLimit) {
+		t.Errorf("default instruction set modified")
+	}
+}
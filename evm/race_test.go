@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package evm
+
+// raceEnabled is set when the race detector is on, which makes sync.Pool drop
+// pooled objects at random.
+const raceEnabled = true
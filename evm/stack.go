@@ -48,6 +48,22 @@ func (st *Stack) len() int {
 	return len(st.data)
 }
 
+// Push pushes a value onto the stack. Instructions must only push as many
+// values as they declare, the stack limit is checked before execution.
+func (st *Stack) Push(d *uint256.Int) {
+	st.push(d)
+}
+
+// Pop removes the top value from the stack and returns it.
+func (st *Stack) Pop() uint256.Int {
+	return st.pop()
+}
+
+// Len returns the number of values on the stack.
+func (st *Stack) Len() int {
+	return st.len()
+}
+
 func (st *Stack) swap(n int) {
 	st.data[st.len()-n], st.data[st.len()-1] = st.data[st.len()-1], st.data[st.len()-n]
 }
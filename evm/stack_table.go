@@ -18,6 +18,23 @@ func maxDupStack(n int) int {
 	return maxStack(n, n+1)
 }
 
+// setStackLimit adjusts the stack bounds of an instruction set, which are
+// computed for the default stack limit, to the given limit. It must only be
+// applied once to a set.
+func setStackLimit(jt *JumpTable, limit uint64) {
+	delta := int(limit) - int(config.StackLimit)
+	if delta == 0 {
+		return
+	}
+	adjusted := make(map[*operation]bool)
+	for _, op := range jt {
+		if !adjusted[op] {
+			op.maxStack += delta
+			adjusted[op] = true
+		}
+	}
+}
+
 func maxStack(pop, push int) int {
 	return int(config.StackLimit) + pop - push
 }
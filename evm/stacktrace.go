@@ -0,0 +1,110 @@
+package evm
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"strings"
+)
+
+// Frame is a call frame of the stack trace of a failed execution.
+type Frame struct {
+	Address  common.Address // Address of the executing contract
+	CallType OpCode         // CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or CREATE2
+	Depth    int            // Call depth of the frame, 1 for the top-level one
+
+	// PC is the failing instruction of the innermost frame, the call
+	// instruction creating the next frame of the others. Gas is the gas left
+	// before the instruction.
+	PC  uint64
+	Op  OpCode
+	Gas uint64
+
+	Err error // Error the frame failed with
+}
+
+func (f *Frame) String() string {
+	return fmt.Sprintf("%v %s: pc %d %v (gas %d, depth %d)", f.CallType, f.Address.Hex(), f.PC, f.Op, f.Gas, f.Depth)
+}
+
+// ExecutionError is returned by the top-level call or creation of an
+// execution failing in the interpreter if EVMConfig.StackTraces is set. It
+// wraps the error of the execution, which errors.Is and errors.As match, and
+// holds the stack of the frames leading to the failure.
+//
+// Reverts bubbling up a failed call are traced into the call, so that the
+// innermost frame is where the failure originated.
+type ExecutionError struct {
+	Err    error
+	Frames []Frame // Failing frames, the top-level one first
+}
+
+func (e *ExecutionError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	for i := len(e.Frames) - 1; i >= 0; i-- {
+		f := &e.Frames[i]
+		fmt.Fprintf(&b, "\n\tat %v", f)
+		if i == len(e.Frames)-1 && f.Err != nil && f.Err != e.Err {
+			fmt.Fprintf(&b, ": %v", f.Err)
+		}
+	}
+	return b.String()
+}
+
+func (e *ExecutionError) Unwrap() error { return e.Err }
+
+// traceFrame is an executing frame tracked for stack traces.
+type traceFrame struct {
+	Frame
+	callSite Frame   // Frame as of its last call
+	failed   []Frame // Failing frames of the last call, nil if it succeeded
+}
+
+// run executes the contract in the interpreter, tracking the frame if
+// stack traces are enabled.
+func (evm *EVM) run(typ OpCode, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
+	if !evm.Config.StackTraces {
+		return evm.interpreter.Run(contract, input, readOnly)
+	}
+	frame := &traceFrame{Frame: Frame{Address: contract.Address(), CallType: typ, Depth: evm.depth + 1}}
+	if n := len(evm.traceFrames); n > 0 {
+		parent := evm.traceFrames[n-1]
+		parent.callSite, parent.failed = parent.Frame, nil
+	}
+	evm.traceFrames = append(evm.traceFrames, frame)
+	ret, err := evm.interpreter.Run(contract, input, readOnly)
+	evm.traceFrames = evm.traceFrames[:len(evm.traceFrames)-1]
+
+	if err == nil {
+		return ret, nil
+	}
+	var frames []Frame
+	if err == ErrExecutionReverted && frame.failed != nil {
+		frame.callSite.Err = err
+		frames = append([]Frame{frame.callSite}, frame.failed...)
+	} else {
+		frame.Err = err
+		frames = []Frame{frame.Frame}
+	}
+	if n := len(evm.traceFrames); n > 0 {
+		evm.traceFrames[n-1].failed = frames
+	} else {
+		evm.failedFrames = frames
+	}
+	return ret, err
+}
+
+// stackTrace returns the error of the top-level call or creation, wrapped
+// in an *ExecutionError if it failed in the interpreter with stack traces
+// enabled.
+func (evm *EVM) stackTrace(err error) error {
+	if evm.depth != 0 || evm.failedFrames == nil {
+		return err
+	}
+	frames := evm.failedFrames
+	evm.failedFrames = nil
+	if err == nil {
+		return nil
+	}
+	return &ExecutionError{Err: err, Frames: frames}
+}
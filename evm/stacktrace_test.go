@@ -0,0 +1,86 @@
+package evm
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/state"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestStackTraces(t *testing.T) {
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		invalid  = common.BytesToAddress([]byte("invalid"))
+		bubbling = common.BytesToAddress([]byte("bubbling"))
+		catching = common.BytesToAddress([]byte("catching"))
+		statedb  = state.New()
+	)
+	// jump(4)
+	statedb.SetCode(invalid, common.Hex2Bytes("600456"))
+	// call(gas, invalid, 0, 0, 0, 0, 0), then revert(0, 0) or stop
+	call := "60006000600060006000" + "73" + common.Bytes2Hex(invalid[:]) + "5af1"
+	statedb.SetCode(bubbling, common.Hex2Bytes(call+"60006000fd"))
+	statedb.SetCode(catching, common.Hex2Bytes(call+"00"))
+
+	env := newTestEVM(statedb, londonTestRules, EVMConfig{JumpTable: &londonInstructionSet, StackTraces: true})
+
+	// Failures of the top-level frame
+	_, _, err := env.Call(AccountRef(caller), invalid, nil, 100000, new(big.Int))
+	var execErr *ExecutionError
+	if !errors.As(err, &execErr) || !errors.Is(err, ErrInvalidJump) {
+		t.Fatalf("error mismatch: %v", err)
+	}
+	want := Frame{Address: invalid, CallType: CALL, Depth: 1, PC: 2, Op: JUMP, Gas: 100000 - 3, Err: ErrInvalidJump}
+	if len(execErr.Frames) != 1 || execErr.Frames[0] != want {
+		t.Fatalf("frames mismatch: have %+v, want %+v", execErr.Frames, want)
+	}
+
+	// Reverts bubbling up failures are traced into the failed call
+	_, _, err = env.Call(AccountRef(caller), bubbling, nil, 100000, new(big.Int))
+	if !errors.As(err, &execErr) || !errors.Is(err, ErrExecutionReverted) {
+		t.Fatalf("error mismatch: %v", err)
+	}
+	if len(execErr.Frames) != 2 {
+		t.Fatalf("frame count mismatch: %+v", execErr.Frames)
+	}
+	outer, inner := execErr.Frames[0], execErr.Frames[1]
+	if outer.Address != bubbling || outer.PC != 32 || outer.Op != CALL || outer.Depth != 1 || outer.Err != ErrExecutionReverted {
+		t.Errorf("outer frame mismatch: %+v", outer)
+	}
+	if inner.Address != invalid || inner.CallType != CALL || inner.PC != 2 || inner.Op != JUMP || inner.Depth != 2 || inner.Err != ErrInvalidJump {
+		t.Errorf("inner frame mismatch: %+v", inner)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "execution reverted\n\tat CALL") || !strings.Contains(msg, "pc 2 JUMP") || !strings.HasSuffix(msg, "depth 1)") {
+		t.Errorf("error message mismatch: %q", msg)
+	}
+
+	// Failures of nested frames the caller recovers from are not reported
+	if _, _, err := env.Call(AccountRef(caller), catching, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	// Errors are not wrapped unless enabled
+	env = newTestEVM(statedb, londonTestRules, EVMConfig{JumpTable: &londonInstructionSet})
+	if _, _, err := env.Call(AccountRef(caller), invalid, nil, 100000, new(big.Int)); err != ErrInvalidJump {
+		t.Errorf("error mismatch: %v", err)
+	}
+}
+
+func TestStackTracesCreate(t *testing.T) {
+	env := newTestEVM(state.New(), londonTestRules, EVMConfig{JumpTable: &londonInstructionSet, StackTraces: true})
+
+	// Stack underflow in the creation code
+	_, _, _, err := env.Create(AccountRef(common.BytesToAddress([]byte("caller"))), common.Hex2Bytes("600101"), 100000, new(big.Int))
+	var (
+		execErr   *ExecutionError
+		underflow *ErrStackUnderflow
+	)
+	if !errors.As(err, &execErr) || !errors.As(err, &underflow) {
+		t.Fatalf("error mismatch: %v", err)
+	}
+	if len(execErr.Frames) != 1 || execErr.Frames[0].CallType != CREATE || execErr.Frames[0].PC != 2 || execErr.Frames[0].Op != ADD {
+		t.Errorf("frames mismatch: %+v", execErr.Frames)
+	}
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// The helpers below implement the small subset of the RLP encoding needed to
+// compute signing hashes. They are not a general purpose RLP codec.
+
+// rlpString encodes b as an RLP string.
+func rlpString(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(0x80, uint64(len(b))), b...)
+}
+
+// rlpUint encodes i as an RLP integer.
+func rlpUint(i uint64) []byte {
+	if i == 0 {
+		return []byte{0x80}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], i)
+	n := 0
+	for n < len(buf) && buf[n] == 0 {
+		n++
+	}
+	return rlpString(buf[n:])
+}
+
+// rlpBig encodes a non-negative big integer. A nil value encodes as zero.
+func rlpBig(i *big.Int) []byte {
+	if i == nil {
+		return []byte{0x80}
+	}
+	return rlpString(i.Bytes())
+}
+
+// rlpList wraps the already encoded items into an RLP list.
+func rlpList(items ...[]byte) []byte {
+	var size uint64
+	for _, item := range items {
+		size += uint64(len(item))
+	}
+	out := rlpHeader(0xc0, size)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// rlpHeader returns the header of a string (offset 0x80) or list (offset 0xc0)
+// of the given payload size.
+func rlpHeader(offset byte, size uint64) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], size)
+	n := 0
+	for buf[n] == 0 {
+		n++
+	}
+	return append([]byte{offset + 55 + byte(8-n)}, buf[n:]...)
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"math/big"
+)
+
+// SetCodeTxType is the EIP-7702 set code transaction type.
+const SetCodeTxType = 0x04
+
+// DelegationPrefix is used by code to denote the account is delegating to
+// another account.
+var DelegationPrefix = []byte{0xef, 0x01, 0x00}
+
+// setCodeAuthMagic is prepended to the RLP encoding of an authorization when
+// computing its signing hash.
+const setCodeAuthMagic = 0x05
+
+var (
+	ErrAuthorizationInvalidSignature = errors.New("invalid authorization signature")
+	ErrInvalidTxSignature            = errors.New("invalid transaction signature")
+)
+
+// ParseDelegation tries to parse the address from a delegation slice.
+func ParseDelegation(b []byte) (common.Address, bool) {
+	if len(b) != 23 || b[0] != DelegationPrefix[0] || b[1] != DelegationPrefix[1] || b[2] != DelegationPrefix[2] {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(b[len(DelegationPrefix):]), true
+}
+
+// AddressToDelegation adds the delegation prefix to the specified address.
+func AddressToDelegation(addr common.Address) []byte {
+	return append(common.CopyBytes(DelegationPrefix), addr.Bytes()...)
+}
+
+// SetCodeTx implements the EIP-7702 transaction type which temporarily installs
+// the code at the signer's address.
+type SetCodeTx struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int // a.k.a. maxPriorityFeePerGas
+	GasFeeCap  *big.Int // a.k.a. maxFeePerGas
+	Gas        uint64
+	To         common.Address // set code transactions cannot create contracts
+	Value      *big.Int
+	Data       []byte
+	AccessList AccessList
+	AuthList   []SetCodeAuthorization
+
+	// Signature values
+	V, R, S *big.Int
+}
+
+// accessors for innerTx.
+func (tx *SetCodeTx) txType() byte           { return SetCodeTxType }
+func (tx *SetCodeTx) chainID() *big.Int      { return tx.ChainID }
+func (tx *SetCodeTx) accessList() AccessList { return tx.AccessList }
+func (tx *SetCodeTx) data() []byte           { return tx.Data }
+func (tx *SetCodeTx) gas() uint64            { return tx.Gas }
+func (tx *SetCodeTx) gasFeeCap() *big.Int    { return tx.GasFeeCap }
+func (tx *SetCodeTx) gasTipCap() *big.Int    { return tx.GasTipCap }
+func (tx *SetCodeTx) gasPrice() *big.Int     { return tx.GasFeeCap }
+func (tx *SetCodeTx) value() *big.Int        { return tx.Value }
+func (tx *SetCodeTx) nonce() uint64          { return tx.Nonce }
+func (tx *SetCodeTx) to() *common.Address    { tmp := tx.To; return &tmp }
+
+func (tx *SetCodeTx) rawSignatureValues() (v, r, s *big.Int) {
+	return tx.V, tx.R, tx.S
+}
+
+func (tx *SetCodeTx) setSignatureValues(chainID, v, r, s *big.Int) {
+	tx.ChainID, tx.V, tx.R, tx.S = chainID, v, r, s
+}
+
+// SignSetCodeTx returns a copy of tx signed with prv.
+func SignSetCodeTx(prv *ecdsa.PrivateKey, tx *SetCodeTx) (*SetCodeTx, error) {
+	sighash := tx.SigHash()
+	sig, err := crypto.Sign(sighash[:], prv)
+	if err != nil {
+		return nil, err
+	}
+	cpy := *tx
+	cpy.setSignatureValues(tx.ChainID, new(big.Int).SetUint64(uint64(sig[64])), new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64]))
+	return &cpy, nil
+}
+
+// SigHash returns the hash of the transaction for signing,
+// keccak256(0x04 || rlp([chain_id, nonce, max_priority_fee_per_gas,
+// max_fee_per_gas, gas_limit, destination, value, data, access_list,
+// authorization_list])).
+func (tx *SetCodeTx) SigHash() common.Hash {
+	accessList := make([][]byte, len(tx.AccessList))
+	for i, tuple := range tx.AccessList {
+		keys := make([][]byte, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			keys[j] = rlpString(key.Bytes())
+		}
+		accessList[i] = rlpList(rlpString(tuple.Address.Bytes()), rlpList(keys...))
+	}
+	authList := make([][]byte, len(tx.AuthList))
+	for i, auth := range tx.AuthList {
+		authList[i] = rlpList(rlpBig(auth.ChainID), rlpString(auth.Address.Bytes()), rlpUint(auth.Nonce),
+			rlpUint(uint64(auth.V)), rlpBig(auth.R), rlpBig(auth.S))
+	}
+	payload := rlpList(rlpBig(tx.ChainID), rlpUint(tx.Nonce), rlpBig(tx.GasTipCap), rlpBig(tx.GasFeeCap),
+		rlpUint(tx.Gas), rlpString(tx.To.Bytes()), rlpBig(tx.Value), rlpString(tx.Data),
+		rlpList(accessList...), rlpList(authList...))
+	return crypto.Keccak256Hash([]byte{SetCodeTxType}, payload)
+}
+
+// Sender recovers the account which signed the transaction.
+func (tx *SetCodeTx) Sender() (common.Address, error) {
+	v, r, s := tx.rawSignatureValues()
+	if v == nil || !v.IsUint64() || v.Uint64() > 1 {
+		return common.Address{}, ErrInvalidTxSignature
+	}
+	return recoverAddress(tx.SigHash(), byte(v.Uint64()), r, s, ErrInvalidTxSignature)
+}
+
+// SetCodeAuthorization is an authorization from an account to deploy code at
+// its address. A zero ChainID makes the authorization valid on every chain.
+type SetCodeAuthorization struct {
+	ChainID *big.Int       `json:"chainId" gencodec:"required"`
+	Address common.Address `json:"address" gencodec:"required"`
+	Nonce   uint64         `json:"nonce" gencodec:"required"`
+	V       uint8          `json:"yParity" gencodec:"required"`
+	R       *big.Int       `json:"r" gencodec:"required"`
+	S       *big.Int       `json:"s" gencodec:"required"`
+}
+
+// SignSetCode creates a signed SetCode authorization.
+func SignSetCode(prv *ecdsa.PrivateKey, auth SetCodeAuthorization) (SetCodeAuthorization, error) {
+	sighash := auth.SigHash()
+	sig, err := crypto.Sign(sighash[:], prv)
+	if err != nil {
+		return SetCodeAuthorization{}, err
+	}
+	auth.R = new(big.Int).SetBytes(sig[:32])
+	auth.S = new(big.Int).SetBytes(sig[32:64])
+	auth.V = sig[64]
+	return auth, nil
+}
+
+// SigHash returns the hash of SetCodeAuthorization for signing,
+// keccak256(0x05 || rlp([chain_id, address, nonce])).
+func (a *SetCodeAuthorization) SigHash() common.Hash {
+	payload := rlpList(rlpBig(a.ChainID), rlpString(a.Address.Bytes()), rlpUint(a.Nonce))
+	return crypto.Keccak256Hash([]byte{setCodeAuthMagic}, payload)
+}
+
+// Authority recovers the authorizing account of an authorization.
+func (a *SetCodeAuthorization) Authority() (common.Address, error) {
+	return recoverAddress(a.SigHash(), a.V, a.R, a.S, ErrAuthorizationInvalidSignature)
+}
+
+// recoverAddress recovers the account which signed sighash, failing with
+// errInvalid if the signature values are invalid.
+func recoverAddress(sighash common.Hash, v byte, r, s *big.Int, errInvalid error) (common.Address, error) {
+	if r == nil || s == nil || r.BitLen() > 256 || s.BitLen() > 256 {
+		return common.Address{}, errInvalid
+	}
+	// Signatures with a high s value are malleable and rejected (EIP-2).
+	if !crypto.ValidateSignatureValues(v, r, s, true) {
+		return common.Address{}, errInvalid
+	}
+	// encode the signature in uncompressed format
+	var sig [crypto.SignatureLength]byte
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = v
+	// recover the public key from the signature
+	pub, err := crypto.Ecrecover(sighash[:], sig[:])
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(pub) == 0 || pub[0] != 4 {
+		return common.Address{}, errInvalid
+	}
+	var addr common.Address
+	copy(addr[:], crypto.Keccak256(pub[1:])[12:])
+	return addr, nil
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"bytes"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"math/big"
+	"testing"
+)
+
+func TestParseDelegation(t *testing.T) {
+	addr := common.Address{0x42}
+	for _, tt := range []struct {
+		val  []byte
+		want *common.Address
+	}{
+		{ // simple correct delegation
+			val:  append(common.FromHex("ef0100"), addr.Bytes()...),
+			want: &addr,
+		},
+		{ // wrong address size
+			val: append(common.FromHex("ef0100"), addr.Bytes()[0:19]...),
+		},
+		{ // short address
+			val: append(common.FromHex("ef0100"), 0x42),
+		},
+		{ // long address
+			val: append(append(common.FromHex("ef0100"), addr.Bytes()...), 0x42),
+		},
+		{ // wrong prefix size
+			val: append(common.FromHex("ef01"), addr.Bytes()...),
+		},
+		{ // wrong prefix
+			val: append(common.FromHex("ef0101"), addr.Bytes()...),
+		},
+		{ // wrong prefix
+			val: append(common.FromHex("ef0000"), addr.Bytes()...),
+		},
+		{ // no prefix
+			val: addr.Bytes(),
+		},
+		{ // no address
+			val: common.FromHex("ef0100"),
+		},
+	} {
+		got, ok := ParseDelegation(tt.val)
+		if ok && tt.want == nil {
+			t.Fatalf("expected fail, got %s", got.Hex())
+		}
+		if !ok && tt.want != nil {
+			t.Fatalf("failed to parse, want %s", tt.want.Hex())
+		}
+		if tt.want != nil && got != *tt.want {
+			t.Fatalf("parsed wrong address, have %s, want %s", got.Hex(), tt.want.Hex())
+		}
+	}
+	if have := AddressToDelegation(addr); !bytes.Equal(have, append(common.FromHex("ef0100"), addr.Bytes()...)) {
+		t.Fatalf("delegation designator mismatch: have %x", have)
+	}
+}
+
+func TestSetCodeAuthorityRecovery(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	auth, err := SignSetCode(key, SetCodeAuthorization{
+		ChainID: big.NewInt(1),
+		Address: common.Address{0x42},
+		Nonce:   7,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign authorization: %v", err)
+	}
+	authority, err := auth.Authority()
+	if err != nil {
+		t.Fatalf("failed to recover authority: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); authority != want {
+		t.Fatalf("authority mismatch: have %x, want %x", authority, want)
+	}
+	// Any change to the signed payload yields a different authority
+	auth.Nonce++
+	if other, err := auth.Authority(); err == nil && other == authority {
+		t.Fatalf("tampered authorization recovered to the original authority")
+	}
+	// Malleable (high s) signatures are rejected
+	auth.Nonce--
+	auth.S = new(big.Int).Sub(crypto.S256().Params().N, auth.S)
+	if _, err := auth.Authority(); err != ErrAuthorizationInvalidSignature {
+		t.Fatalf("high s signature accepted: %v", err)
+	}
+}
+
+func TestSetCodeTxSender(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	auth, err := SignSetCode(key, SetCodeAuthorization{ChainID: big.NewInt(1), Address: common.Address{0x42}})
+	if err != nil {
+		t.Fatalf("failed to sign authorization: %v", err)
+	}
+	tx, err := SignSetCodeTx(key, &SetCodeTx{
+		ChainID:    big.NewInt(1),
+		Nonce:      3,
+		GasTipCap:  big.NewInt(1),
+		GasFeeCap:  big.NewInt(2),
+		Gas:        100000,
+		To:         common.Address{0x01},
+		Value:      big.NewInt(5),
+		Data:       []byte{0xca, 0xfe},
+		AccessList: AccessList{{Address: common.Address{0x02}, StorageKeys: []common.Hash{{0x03}}}},
+		AuthList:   []SetCodeAuthorization{auth},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if tx.txType() != SetCodeTxType || *tx.to() != (common.Address{0x01}) {
+		t.Fatalf("accessor mismatch: type %d, to %x", tx.txType(), tx.to())
+	}
+	sender, err := tx.Sender()
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); sender != want {
+		t.Fatalf("sender mismatch: have %x, want %x", sender, want)
+	}
+	// Every field is covered by the signature, the authorizations included
+	tx.AuthList[0].Nonce++
+	if other, err := tx.Sender(); err == nil && other == sender {
+		t.Fatalf("tampered transaction recovered to the original sender")
+	}
+	tx.AuthList[0].Nonce--
+	tx.V = big.NewInt(27)
+	if _, err := tx.Sender(); err != ErrInvalidTxSignature {
+		t.Fatalf("invalid recovery id accepted: %v", err)
+	}
+}
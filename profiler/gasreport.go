@@ -0,0 +1,282 @@
+package profiler
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"io"
+	"math/big"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// GasStats are statistics of the gas used by calls.
+type GasStats struct {
+	Count uint64 `json:"count"`
+	Min   uint64 `json:"min"`
+	Max   uint64 `json:"max"`
+	Total uint64 `json:"total"`
+}
+
+// Avg returns the average gas used, rounded down.
+func (s GasStats) Avg() uint64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / s.Count
+}
+
+// add accounts for the gas used by a call.
+func (s *GasStats) add(gasUsed uint64) {
+	if s.Count == 0 || gasUsed < s.Min {
+		s.Min = gasUsed
+	}
+	if gasUsed > s.Max {
+		s.Max = gasUsed
+	}
+	s.Count++
+	s.Total += gasUsed
+}
+
+// merge accounts for the calls of other statistics.
+func (s *GasStats) merge(other GasStats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Total += other.Total
+}
+
+func (s GasStats) MarshalJSON() ([]byte, error) {
+	type stats GasStats
+	return json.Marshal(struct {
+		stats
+		Avg uint64 `json:"avg"`
+	}{stats(s), s.Avg()})
+}
+
+// MethodReport is the gas used by the calls of a method.
+type MethodReport struct {
+	Selector string   `json:"selector"` // Hex selector, empty for the fallback
+	Name     string   `json:"name"`     // Signature if known, else the selector
+	Gas      GasStats `json:"gas"`
+}
+
+// ContractReport is the gas used by a contract, or by all the contracts of
+// the same name.
+type ContractReport struct {
+	Name       string         `json:"name"` // Name if known, else the address
+	Deployment GasStats       `json:"deployment"`
+	CodeSize   int            `json:"codeSize"` // Size of the largest code deployed
+	Methods    []MethodReport `json:"methods"`
+}
+
+// contractStats are the statistics collected for an address.
+type contractStats struct {
+	deployment GasStats
+	codeSize   int
+	methods    map[string]*GasStats // By selector
+}
+
+// contractInfo is what's known of the contract at an address.
+type contractInfo struct {
+	name string
+	abi  *abi.ABI
+}
+
+// reportFrame is a call frame whose gas is collected.
+type reportFrame struct {
+	address  common.Address
+	create   bool
+	selector string
+	skip     bool // Call of an account without code
+}
+
+// GasReporter is an EVMLogger collecting the gas used by the successful
+// calls and deployments of contracts, per contract and method, across all
+// the executions it traces, top-level and internal. The gas used excludes
+// the intrinsic gas of transactions.
+//
+// The reporter must be set as tracer of the EVM with debugging enabled. It
+// is not thread safe.
+type GasReporter struct {
+	env       *evm.EVM
+	contracts map[common.Address]*contractStats
+	infos     map[common.Address]contractInfo
+	frames    []reportFrame
+}
+
+// NewGasReporter returns an empty gas reporter.
+func NewGasReporter() *GasReporter {
+	return &GasReporter{
+		contracts: make(map[common.Address]*contractStats),
+		infos:     make(map[common.Address]contractInfo),
+	}
+}
+
+// AddContract names the contract at an address, resolving the names of its
+// methods from its ABI if not nil. Contracts of the same name are reported
+// together. It may be called before or after the contract is used.
+func (r *GasReporter) AddContract(address common.Address, name string, contractABI *abi.ABI) {
+	r.infos[address] = contractInfo{name: name, abi: contractABI}
+}
+
+func (r *GasReporter) enter(address common.Address, create bool, input []byte) {
+	frame := reportFrame{address: address, create: create}
+	if !create {
+		if len(input) >= 4 {
+			frame.selector = hex.EncodeToString(input[:4])
+		}
+		frame.skip = r.env.StateDB.GetCodeSize(address) == 0
+	}
+	r.frames = append(r.frames, frame)
+}
+
+func (r *GasReporter) exit(output []byte, gasUsed uint64, err error) {
+	frame := r.frames[len(r.frames)-1]
+	r.frames = r.frames[:len(r.frames)-1]
+	if frame.skip || err != nil {
+		return
+	}
+	stats, ok := r.contracts[frame.address]
+	if !ok {
+		stats = &contractStats{methods: make(map[string]*GasStats)}
+		r.contracts[frame.address] = stats
+	}
+	if frame.create {
+		stats.deployment.add(gasUsed)
+		if len(output) > stats.codeSize {
+			stats.codeSize = len(output)
+		}
+		return
+	}
+	method, ok := stats.methods[frame.selector]
+	if !ok {
+		method = new(GasStats)
+		stats.methods[frame.selector] = method
+	}
+	method.add(gasUsed)
+}
+
+func (r *GasReporter) CaptureTxStart(gasLimit uint64) {}
+
+func (r *GasReporter) CaptureTxEnd(restGas uint64) {}
+
+func (r *GasReporter) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	r.env, r.frames = env, r.frames[:0]
+	r.enter(to, create, input)
+}
+
+func (r *GasReporter) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	if len(r.frames) > 0 {
+		r.exit(output, gasUsed, err)
+	}
+}
+
+func (r *GasReporter) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	r.enter(to, typ == evm.CREATE || typ == evm.CREATE2, input)
+}
+
+func (r *GasReporter) CaptureExit(output []byte, gasUsed uint64, err error) {
+	r.exit(output, gasUsed, err)
+}
+
+func (r *GasReporter) CaptureState(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+func (r *GasReporter) CaptureFault(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, depth int, err error) {
+}
+
+// methodName returns the name of a method, its signature if known.
+func methodName(contractABI *abi.ABI, selector string) string {
+	if selector == "" {
+		return "fallback"
+	}
+	if contractABI != nil {
+		if method, err := contractABI.MethodById(common.Hex2Bytes(selector)); err == nil {
+			return method.Sig
+		}
+	}
+	return "0x" + selector
+}
+
+// Report returns the gas used per contract, sorted by name, and per method,
+// sorted by name.
+func (r *GasReporter) Report() []ContractReport {
+	var (
+		reports = make(map[string]*ContractReport)
+		methods = make(map[string]map[string]*MethodReport)
+	)
+	for address, stats := range r.contracts {
+		info, ok := r.infos[address]
+		if !ok {
+			info.name = address.Hex()
+		}
+		report, ok := reports[info.name]
+		if !ok {
+			report = &ContractReport{Name: info.name}
+			reports[info.name] = report
+			methods[info.name] = make(map[string]*MethodReport)
+		}
+		report.Deployment.merge(stats.deployment)
+		if stats.codeSize > report.CodeSize {
+			report.CodeSize = stats.codeSize
+		}
+		for selector, gas := range stats.methods {
+			method, ok := methods[info.name][selector]
+			if !ok {
+				method = &MethodReport{Selector: selector, Name: methodName(info.abi, selector)}
+				methods[info.name][selector] = method
+			}
+			method.Gas.merge(*gas)
+		}
+	}
+	result := make([]ContractReport, 0, len(reports))
+	for name, report := range reports {
+		for _, method := range methods[name] {
+			report.Methods = append(report.Methods, *method)
+		}
+		sort.Slice(report.Methods, func(i, j int) bool {
+			return report.Methods[i].Name < report.Methods[j].Name
+		})
+		result = append(result, *report)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// WriteJSON writes the report as JSON.
+func (r *GasReporter) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Report())
+}
+
+// WriteTable writes the report as a text table, a row per method and per
+// deployed contract.
+func (r *GasReporter) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Contract\tMethod\tMin\tAvg\tMax\tCalls\tSize\t")
+	for _, report := range r.Report() {
+		for _, method := range report.Methods {
+			gas := method.Gas
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t\t\n", report.Name, method.Name, gas.Min, gas.Avg(), gas.Max, gas.Count)
+		}
+		if gas := report.Deployment; gas.Count > 0 {
+			fmt.Fprintf(tw, "%s\t(deployment)\t%d\t%d\t%d\t%d\t%d\t\n", report.Name, gas.Min, gas.Avg(), gas.Max, gas.Count, report.CodeSize)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,353 @@
+// Package profiler implements tracers profiling where the gas, or the time,
+// of executions goes, writing pprof profiles and gas reports.
+package profiler
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/sourcemap"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Weight is what the samples of a profile are weighted by.
+type Weight int
+
+const (
+	WeightGas  Weight = iota // Gas charged by the instructions
+	WeightTime               // Wall-clock time spent executing the instructions
+)
+
+// Config configures a profiler.
+type Config struct {
+	Weight Weight
+
+	// SourceMap returns the source map of the code of a contract, the
+	// creation code if create is set, nil if unknown. Instructions of code
+	// with a source map are located in the sources, the others by pc.
+	SourceMap func(address common.Address, create bool) *sourcemap.SourceMap
+}
+
+// frame is a call frame being profiled.
+type frame struct {
+	name      string // Synthetic function of the frame, address and selector
+	sourceMap *sourcemap.SourceMap
+	startGas  uint64
+
+	stepped   bool
+	pc        uint64
+	op        evm.OpCode
+	gas       uint64 // Gas before the current instruction
+	childUsed uint64 // Gas used by the calls of the current instruction
+}
+
+// sample is the weight of a call stack.
+type sample struct {
+	locations []uint64 // Locations of the stack, the leaf first
+	count     int64    // Instructions executed
+	weight    int64    // Gas or nanoseconds
+}
+
+// function and location identify the functions and locations of a profile.
+type function struct {
+	name string
+	file string
+}
+
+type location struct {
+	function
+	line int64
+}
+
+// Profiler is an EVMLogger attributing the gas, or the time, of executions
+// to synthetic call stacks of the call frames, each the contract address
+// and function selector executed, and of the instructions. Instructions are
+// located by pc, or by Solidity function and line given source maps.
+//
+// Every instruction is charged the gas its call frame spends on it, its
+// cost less the gas of the calls it makes, which is charged to the call
+// frames themselves. Samples accumulate across executions, until written.
+//
+// The profiler must be set as tracer of the EVM with debugging enabled. It
+// is not thread safe.
+type Profiler struct {
+	cfg    Config
+	frames []*frame
+
+	samples   map[string]*sample
+	functions map[function]uint64
+	locations map[location]uint64
+
+	// Time weighting: the stack and start of the current instruction
+	lastStack []uint64
+	lastTime  time.Time
+}
+
+// New returns a profiler.
+func New(cfg Config) *Profiler {
+	return &Profiler{
+		cfg:       cfg,
+		samples:   make(map[string]*sample),
+		functions: make(map[function]uint64),
+		locations: make(map[location]uint64),
+	}
+}
+
+// frameName returns the synthetic function of a call frame.
+func frameName(address common.Address, create bool, input []byte) string {
+	switch {
+	case create:
+		return fmt.Sprintf("%s.constructor", address.Hex())
+	case len(input) < 4:
+		return fmt.Sprintf("%s.fallback", address.Hex())
+	}
+	return fmt.Sprintf("%s.%#x", address.Hex(), input[:4])
+}
+
+// enter starts profiling a call frame.
+func (p *Profiler) enter(address common.Address, create bool, input []byte, gas uint64) {
+	f := &frame{name: frameName(address, create, input), startGas: gas}
+	if p.cfg.SourceMap != nil {
+		f.sourceMap = p.cfg.SourceMap(address, create)
+	}
+	p.frames = append(p.frames, f)
+}
+
+// exit ends profiling the current call frame, charging what's left of the
+// gas it used to its last instruction, or to itself if it executed none.
+func (p *Profiler) exit(gasUsed uint64) {
+	f := p.frames[len(p.frames)-1]
+	if p.cfg.Weight == WeightGas {
+		if f.stepped {
+			if left := f.startGas - gasUsed; f.gas > left+f.childUsed {
+				p.charge(p.stack(true), 0, int64(f.gas-left-f.childUsed))
+			}
+		} else if gasUsed > 0 {
+			p.charge(p.stack(false), 0, int64(gasUsed))
+		}
+	}
+	p.frames = p.frames[:len(p.frames)-1]
+	if n := len(p.frames); n > 0 {
+		p.frames[n-1].childUsed += gasUsed
+	}
+}
+
+// functionID returns the ID of a function of the profile.
+func (p *Profiler) functionID(fn function) uint64 {
+	id, ok := p.functions[fn]
+	if !ok {
+		id = uint64(len(p.functions) + 1)
+		p.functions[fn] = id
+	}
+	return id
+}
+
+// locationID returns the ID of a location of the profile.
+func (p *Profiler) locationID(loc location) uint64 {
+	id, ok := p.locations[loc]
+	if !ok {
+		id = uint64(len(p.locations) + 1)
+		p.locations[loc] = id
+		p.functionID(loc.function)
+	}
+	return id
+}
+
+// frameLocation returns the location of the current instruction of a frame.
+func (p *Profiler) frameLocation(f *frame) uint64 {
+	if !f.stepped {
+		return p.locationID(location{function: function{name: f.name}})
+	}
+	if f.sourceMap != nil {
+		if sf, ok := f.sourceMap.Frame(f.pc); ok {
+			name := f.name
+			if sf.Function != nil {
+				name = sf.Function.String()
+			} else if sf.Contract != "" {
+				name = sf.Contract
+			}
+			return p.locationID(location{function: function{name: name, file: sf.Position.File}, line: int64(sf.Position.Line)})
+		}
+	}
+	return p.locationID(location{function: function{name: f.name}, line: int64(f.pc)})
+}
+
+// stack returns the locations of the current call stack, the leaf first,
+// including the current instruction if set.
+func (p *Profiler) stack(instruction bool) []uint64 {
+	locations := make([]uint64, 0, len(p.frames)+1)
+	if instruction {
+		top := p.frames[len(p.frames)-1]
+		locations = append(locations, p.locationID(location{function: function{name: top.op.String()}}))
+	}
+	for i := len(p.frames) - 1; i >= 0; i-- {
+		locations = append(locations, p.frameLocation(p.frames[i]))
+	}
+	return locations
+}
+
+// charge adds to the sample of a call stack.
+func (p *Profiler) charge(locations []uint64, count int64, weight int64) {
+	key := make([]byte, 8*len(locations))
+	for i, id := range locations {
+		binary.BigEndian.PutUint64(key[8*i:], id)
+	}
+	s, ok := p.samples[string(key)]
+	if !ok {
+		s = &sample{locations: locations}
+		p.samples[string(key)] = s
+	}
+	s.count += count
+	s.weight += weight
+}
+
+// chargeTime charges the time since the start of the last instruction to
+// its stack.
+func (p *Profiler) chargeTime(now time.Time) {
+	if p.lastStack != nil {
+		p.charge(p.lastStack, 0, int64(now.Sub(p.lastTime)))
+	}
+	p.lastStack, p.lastTime = nil, now
+}
+
+func (p *Profiler) CaptureTxStart(gasLimit uint64) {}
+
+func (p *Profiler) CaptureTxEnd(restGas uint64) {}
+
+func (p *Profiler) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	p.frames = p.frames[:0]
+	p.enter(to, create, input, gas)
+}
+
+func (p *Profiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	if p.cfg.Weight == WeightTime {
+		p.chargeTime(time.Now())
+	}
+	if len(p.frames) > 0 {
+		p.exit(gasUsed)
+	}
+}
+
+func (p *Profiler) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	p.enter(to, typ == evm.CREATE || typ == evm.CREATE2, input, gas)
+}
+
+func (p *Profiler) CaptureExit(output []byte, gasUsed uint64, err error) {
+	p.exit(gasUsed)
+}
+
+func (p *Profiler) CaptureState(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, rData []byte, depth int, err error) {
+	var now time.Time
+	if p.cfg.Weight == WeightTime {
+		now = time.Now()
+		p.chargeTime(now)
+	}
+	f := p.frames[len(p.frames)-1]
+	if p.cfg.Weight == WeightGas && f.stepped && f.gas > gas+f.childUsed {
+		p.charge(p.stack(true), 0, int64(f.gas-gas-f.childUsed))
+	}
+	f.stepped, f.pc, f.op, f.gas, f.childUsed = true, pc, op, gas, 0
+
+	stack := p.stack(true)
+	p.charge(stack, 1, 0)
+	if p.cfg.Weight == WeightTime {
+		p.lastStack, p.lastTime = stack, now
+	}
+}
+
+// CaptureFault is called for instructions failing once traced by
+// CaptureState, the gas they burn is charged on exit.
+func (p *Profiler) CaptureFault(pc uint64, op evm.OpCode, gas, cost uint64, scope *evm.ScopeContext, depth int, err error) {
+}
+
+// WriteProfile writes the profile of the executions traced, as a gzipped
+// pprof protocol buffer, and resets the profile.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	var (
+		b       protoBuffer
+		strings = map[string]int64{"": 0}
+		table   = []string{""}
+	)
+	str := func(s string) int64 {
+		i, ok := strings[s]
+		if !ok {
+			i = int64(len(table))
+			strings[s] = i
+			table = append(table, s)
+		}
+		return i
+	}
+	valueType := func(tag int, typ, unit string) {
+		b.message(tag, func(b *protoBuffer) {
+			b.int64(1, str(typ))
+			b.int64(2, str(unit))
+		})
+	}
+	weight, unit := "gas", "gas"
+	if p.cfg.Weight == WeightTime {
+		weight, unit = "wall", "nanoseconds"
+	}
+	valueType(1, "instructions", "count")
+	valueType(1, weight, unit)
+
+	// Samples, in a stable order
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := p.samples[key]
+		b.message(2, func(b *protoBuffer) {
+			b.packed(1, s.locations)
+			b.packed(2, []uint64{uint64(s.count), uint64(s.weight)})
+		})
+	}
+	// Locations and functions, by ID
+	locations := make([]location, len(p.locations))
+	for loc, id := range p.locations {
+		locations[id-1] = loc
+	}
+	for i, loc := range locations {
+		b.message(4, func(b *protoBuffer) {
+			b.uint64(1, uint64(i+1))
+			b.message(4, func(b *protoBuffer) {
+				b.uint64(1, p.functions[loc.function])
+				b.int64(2, loc.line)
+			})
+		})
+	}
+	functions := make([]function, len(p.functions))
+	for fn, id := range p.functions {
+		functions[id-1] = fn
+	}
+	for i, fn := range functions {
+		b.message(5, func(b *protoBuffer) {
+			b.uint64(1, uint64(i+1))
+			b.int64(2, str(fn.name))
+			b.int64(3, str(fn.name))
+			b.int64(4, str(fn.file))
+		})
+	}
+	b.int64(14, str(weight)) // Default sample type
+
+	for _, s := range table {
+		b.string(6, s)
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	p.samples = make(map[string]*sample)
+	p.functions = make(map[function]uint64)
+	p.locations = make(map[location]uint64)
+	return nil
+}
@@ -0,0 +1,331 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/runtime"
+	"github.com/entropyio/go-evm/state"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var (
+	caller = common.BytesToAddress([]byte("caller"))
+	callee = common.BytesToAddress([]byte("callee"))
+
+	// sstore(0, 42), call(0xffff, callee, 0, 0, 0, 0, 0), pop, stop. The
+	// call is at pc 39.
+	callerCode = common.Hex2Bytes("602a600055" + "60006000600060006000" + "73" + common.Bytes2Hex(callee[:]) + "61fffff1" + "5000")
+	// add(1, 1), pop, stop. The add is at pc 4.
+	calleeCode = common.Hex2Bytes("600160010150" + "00")
+)
+
+// profile executes callerCode with a profiler, returning the gas used.
+func profile(t *testing.T, p *Profiler) uint64 {
+	t.Helper()
+	statedb := state.New()
+	statedb.SetCode(caller, callerCode)
+	statedb.SetCode(callee, calleeCode)
+
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	cfg := &runtime.Config{
+		GasLimit:  100000,
+		State:     statedb,
+		EVMConfig: evm.EVMConfig{Debug: true, Tracer: p, JumpTable: &jt},
+	}
+	_, left, err := runtime.Call(caller, common.Hex2Bytes("12345678"), cfg)
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	return cfg.GasLimit - left
+}
+
+// protoFields decodes the fields of a protocol buffer message, varints as
+// uint64 and length-delimited fields as []byte.
+func protoFields(t *testing.T, data []byte) map[int][]interface{} {
+	t.Helper()
+	fields := make(map[int][]interface{})
+	varint := func() uint64 {
+		var x uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatalf("truncated varint")
+			}
+			b := data[0]
+			data = data[1:]
+			x |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return x
+			}
+		}
+	}
+	for len(data) > 0 {
+		key := varint()
+		switch key & 7 {
+		case 0:
+			fields[int(key>>3)] = append(fields[int(key>>3)], varint())
+		case 2:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// decodedSample is a sample of a decoded profile, its stack rendered leaf
+// first.
+type decodedSample struct {
+	stack  string
+	values []uint64
+}
+
+// decodeProfile decodes a profile written by the profiler, returning its
+// sample types and samples.
+func decodeProfile(t *testing.T, data []byte) ([]string, []decodedSample) {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	profile := protoFields(t, raw)
+
+	var table []string
+	for _, s := range profile[6] {
+		table = append(table, string(s.([]byte)))
+	}
+	str := func(fields map[int][]interface{}, tag int) string {
+		if len(fields[tag]) == 0 {
+			return table[0]
+		}
+		return table[fields[tag][0].(uint64)]
+	}
+	num := func(fields map[int][]interface{}, tag int) uint64 {
+		if len(fields[tag]) == 0 {
+			return 0
+		}
+		return fields[tag][0].(uint64)
+	}
+	packed := func(fields map[int][]interface{}, tag int) []uint64 {
+		var (
+			data = fields[tag][0].([]byte)
+			xs   []uint64
+		)
+		for len(data) > 0 {
+			x, n := binary.Uvarint(data)
+			xs, data = append(xs, x), data[n:]
+		}
+		return xs
+	}
+	var types []string
+	for _, vt := range profile[1] {
+		fields := protoFields(t, vt.([]byte))
+		types = append(types, str(fields, 1)+"/"+str(fields, 2))
+	}
+	types = append(types, "default "+str(profile, 14))
+
+	functions := make(map[uint64]string)
+	for _, fn := range profile[5] {
+		fields := protoFields(t, fn.([]byte))
+		functions[num(fields, 1)] = str(fields, 2)
+		if file := str(fields, 4); file != "" {
+			functions[num(fields, 1)] += " " + file
+		}
+	}
+	locations := make(map[uint64]string)
+	for _, loc := range profile[4] {
+		fields := protoFields(t, loc.([]byte))
+		line := protoFields(t, fields[4][0].([]byte))
+		locations[num(fields, 1)] = functions[num(line, 1)]
+		if n := num(line, 2); n != 0 {
+			locations[num(fields, 1)] += fmt.Sprintf(":%d", n)
+		}
+	}
+	var samples []decodedSample
+	for _, s := range profile[2] {
+		var (
+			fields = protoFields(t, s.([]byte))
+			stack  []string
+		)
+		for _, id := range packed(fields, 1) {
+			stack = append(stack, locations[id])
+		}
+		samples = append(samples, decodedSample{stack: strings.Join(stack, " < "), values: packed(fields, 2)})
+	}
+	return types, samples
+}
+
+func TestGasProfile(t *testing.T) {
+	p := New(Config{})
+	gasUsed := profile(t, p)
+
+	var buf bytes.Buffer
+	if err := p.WriteProfile(&buf); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	types, samples := decodeProfile(t, buf.Bytes())
+	if have, want := strings.Join(types, ","), "instructions/count,gas/gas,default gas"; have != want {
+		t.Errorf("sample types mismatch: have %s, want %s", have, want)
+	}
+	var (
+		callerFrame = caller.Hex() + ".0x12345678"
+		calleeFrame = callee.Hex() + ".fallback"
+		total       uint64
+		instrs      uint64
+		found       = make(map[string][]uint64)
+	)
+	for _, s := range samples {
+		instrs += s.values[0]
+		total += s.values[1]
+		found[s.stack] = s.values
+	}
+	// Gas is charged once, to the instructions spending it
+	if total != gasUsed {
+		t.Errorf("total gas mismatch: have %d, want %d", total, gasUsed)
+	}
+	if instrs != 13+5 {
+		t.Errorf("instruction count mismatch: have %d, want %d", instrs, 13+5)
+	}
+	add := fmt.Sprintf("ADD < %s:4 < %s:39", calleeFrame, callerFrame)
+	if values := found[add]; len(values) != 2 || values[0] != 1 || values[1] != 3 {
+		t.Errorf("sample %q mismatch: %v\n%v", add, values, samples)
+	}
+	// The call is charged its own cost, not the gas forwarded
+	call := fmt.Sprintf("CALL < %s:39", callerFrame)
+	if values := found[call]; len(values) != 2 || values[1] == 0 || values[1] >= 0xffff {
+		t.Errorf("sample %q mismatch: %v", call, values)
+	}
+	// Writing resets the profile
+	buf.Reset()
+	p.WriteProfile(&buf)
+	if _, samples := decodeProfile(t, buf.Bytes()); len(samples) != 0 {
+		t.Errorf("profile not reset: %v", samples)
+	}
+}
+
+func TestTimeProfile(t *testing.T) {
+	p := New(Config{Weight: WeightTime})
+	profile(t, p)
+
+	var buf bytes.Buffer
+	if err := p.WriteProfile(&buf); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	types, samples := decodeProfile(t, buf.Bytes())
+	if have, want := strings.Join(types, ","), "instructions/count,wall/nanoseconds,default wall"; have != want {
+		t.Errorf("sample types mismatch: have %s, want %s", have, want)
+	}
+	var instrs uint64
+	for _, s := range samples {
+		instrs += s.values[0]
+	}
+	if instrs != 13+5 {
+		t.Errorf("instruction count mismatch: have %d, want %d", instrs, 13+5)
+	}
+}
+
+func TestProtoBuffer(t *testing.T) {
+	var b protoBuffer
+	b.uint64(1, 150)
+	b.int64(2, 0)
+	b.string(3, "ab")
+	b.packed(4, []uint64{1, 300})
+	if have, want := common.Bytes2Hex(b.data), "089601"+"1a026162"+"2203"+"01ac02"; have != want {
+		t.Errorf("encoding mismatch: have %s, want %s", have, want)
+	}
+}
+
+func TestGasReport(t *testing.T) {
+	statedb := state.New()
+	statedb.SetCode(callee, calleeCode)
+
+	r := NewGasReporter()
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	cfg := &runtime.Config{
+		GasLimit:  100000,
+		State:     statedb,
+		EVMConfig: evm.EVMConfig{Debug: true, Tracer: r, JumpTable: &jt},
+	}
+	// codecopy(0, 12, len), return(0, len), followed by callerCode
+	initCode := append(common.Hex2Bytes(fmt.Sprintf("60%02x600c600039"+"60%02x6000f3", len(callerCode), len(callerCode))), callerCode...)
+	_, address, _, err := runtime.Create(initCode, cfg)
+	if err != nil {
+		t.Fatalf("deployment failed: %v", err)
+	}
+	contractABI, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"ping","inputs":[],"outputs":[]}]`))
+	if err != nil {
+		t.Fatalf("invalid abi: %v", err)
+	}
+	r.AddContract(address, "Caller", &contractABI)
+
+	ping := contractABI.Methods["ping"].ID
+	var used []uint64
+	for _, input := range [][]byte{ping, ping, common.Hex2Bytes("12345678")} {
+		_, left, err := runtime.Call(address, input, cfg)
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		used = append(used, cfg.GasLimit-left)
+	}
+	// Failed calls are not reported
+	runtime.Call(address, ping, &runtime.Config{GasLimit: 100, State: statedb, EVMConfig: cfg.EVMConfig})
+
+	report := r.Report()
+	// Unnamed contracts are named by address, sorting first
+	if len(report) != 2 || report[0].Name != callee.Hex() || report[1].Name != "Caller" {
+		t.Fatalf("contracts mismatch: %+v", report)
+	}
+	caller := report[1]
+	if caller.Deployment.Count != 1 || caller.Deployment.Min == 0 || caller.CodeSize != len(callerCode) {
+		t.Errorf("deployment mismatch: %+v, size %d", caller.Deployment, caller.CodeSize)
+	}
+	if len(caller.Methods) != 2 {
+		t.Fatalf("methods mismatch: %+v", caller.Methods)
+	}
+	// The unknown selector is named by its hex, sorting first
+	if m := caller.Methods[0]; m.Name != "0x12345678" || m.Gas != (GasStats{Count: 1, Min: used[2], Max: used[2], Total: used[2]}) {
+		t.Errorf("method mismatch: %+v", m)
+	}
+	want := GasStats{Count: 2, Min: used[1], Max: used[0], Total: used[0] + used[1]}
+	if m := caller.Methods[1]; m.Name != "ping()" || m.Gas != want || used[0] <= used[1] {
+		t.Errorf("method mismatch: %+v, want %+v", m, want)
+	}
+	if m := report[0].Methods; len(m) != 1 || m[0].Name != "fallback" || m[0].Gas.Count != 3 {
+		t.Errorf("callee methods mismatch: %+v", m)
+	}
+
+	var table, js bytes.Buffer
+	if err := r.WriteTable(&table); err != nil {
+		t.Fatalf("failed to write table: %v", err)
+	}
+	for _, want := range []string{"Contract", "Caller", "ping()", "(deployment)", "fallback"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table missing %q:\n%s", want, table.String())
+		}
+	}
+	if err := r.WriteJSON(&js); err != nil {
+		t.Fatalf("failed to write json: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	methods := decoded[1]["methods"].([]interface{})
+	if gas := methods[1].(map[string]interface{})["gas"].(map[string]interface{}); gas["avg"] != float64(want.Avg()) {
+		t.Errorf("json mismatch: %s", js.String())
+	}
+}
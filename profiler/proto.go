@@ -0,0 +1,60 @@
+package profiler
+
+// protoBuffer encodes protocol buffer messages, of the few field types the
+// pprof profile format uses.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(tag int, wireType int) {
+	b.varint(uint64(tag)<<3 | uint64(wireType))
+}
+
+// uint64 encodes a varint field, omitted if zero.
+func (b *protoBuffer) uint64(tag int, x uint64) {
+	if x != 0 {
+		b.key(tag, 0)
+		b.varint(x)
+	}
+}
+
+// int64 encodes a varint field, omitted if zero.
+func (b *protoBuffer) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+func (b *protoBuffer) bytes(tag int, data []byte) {
+	b.key(tag, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// string encodes a string field, even if empty as it's used for the
+// repeated string table.
+func (b *protoBuffer) string(tag int, s string) {
+	b.bytes(tag, []byte(s))
+}
+
+// packed encodes a packed repeated varint field.
+func (b *protoBuffer) packed(tag int, xs []uint64) {
+	var inner protoBuffer
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.bytes(tag, inner.data)
+}
+
+// message encodes a nested message field.
+func (b *protoBuffer) message(tag int, encode func(b *protoBuffer)) {
+	var inner protoBuffer
+	encode(&inner)
+	b.bytes(tag, inner.data)
+}
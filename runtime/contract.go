@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"errors"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/model"
+)
+
+// Event is a log emitted by an execution, decoded with the ABI of the
+// contract if it's one of its events.
+type Event struct {
+	Name   string                 // Name of the event, empty if unknown to the ABI
+	Fields map[string]interface{} // Inputs of the event by name, indexed ones included
+	Log    *model.Log
+}
+
+// Result is the outcome of the deployment of a contract, or of a call or
+// transaction to one of its methods.
+type Result struct {
+	Outputs    []interface{} // Return values of the method, decoded with the ABI
+	ReturnData []byte        // Raw return data, or revert data
+	GasUsed    uint64        // Gas used by the execution, excluding intrinsic gas
+	Events     []Event       // Events emitted by transactions
+}
+
+// BoundContract is a contract deployed in the state of a configuration,
+// whose methods are called by name through its ABI. Calls and transactions
+// execute in the environment of the configuration, as sent by its origin.
+//
+// A BoundContract is not thread safe, nor is the configuration it shares
+// with the other contracts of the state.
+type BoundContract struct {
+	Address common.Address
+	ABI     abi.ABI
+
+	cfg *Config
+}
+
+// NewBoundContract returns a handle of the contract deployed at address in
+// the state of the configuration.
+func NewBoundContract(address common.Address, contractABI abi.ABI, cfg *Config) *BoundContract {
+	setDefaults(cfg)
+	return &BoundContract{Address: address, ABI: contractABI, cfg: cfg}
+}
+
+// Deploy deploys a contract given its ABI and creation bytecode, passing the
+// arguments to its constructor, and returns a handle of it. If the
+// configuration has no state, the contract is deployed in a new one, which
+// is kept in the configuration.
+//
+// The result of the deployment is returned even if it failed. Reverts are
+// reported as *evm.RevertError.
+func Deploy(contractABI abi.ABI, bytecode []byte, cfg *Config, args ...interface{}) (*BoundContract, *Result, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	setDefaults(cfg)
+
+	input, err := contractABI.Pack("", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		vmenv  = NewEnv(cfg)
+		sender = evm.AccountRef(cfg.Origin)
+		logs   = len(cfg.State.Logs())
+	)
+	ret, address, leftOverGas, err := vmenv.Create(sender, append(common.CopyBytes(bytecode), input...), cfg.GasLimit, cfg.Value)
+
+	contract := &BoundContract{Address: address, ABI: contractABI, cfg: cfg}
+	res := &Result{ReturnData: ret, GasUsed: cfg.GasLimit - leftOverGas}
+	res.Events = contract.decodeEvents(cfg.State.Logs()[logs:])
+	cfg.State.Finalise()
+
+	if err != nil {
+		return nil, res, wrapRevert(err, ret)
+	}
+	return contract, res, nil
+}
+
+// Call executes a method of the contract without modifying the state, as a
+// static call, and returns its decoded outputs.
+//
+// The result of the call is returned even if it failed. Reverts are reported
+// as *evm.RevertError.
+func (c *BoundContract) Call(method string, args ...interface{}) (*Result, error) {
+	input, err := c.ABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		vmenv    = NewEnv(c.cfg)
+		sender   = evm.AccountRef(c.cfg.Origin)
+		snapshot = c.cfg.State.Snapshot()
+	)
+	ret, leftOverGas, err := vmenv.StaticCall(sender, c.Address, input, c.cfg.GasLimit)
+	c.cfg.State.RevertToSnapshot(snapshot)
+
+	return c.result(method, ret, c.cfg.GasLimit-leftOverGas, nil, err)
+}
+
+// Transact executes a method of the contract, sending the value of the
+// configuration, and commits its changes to the state. It returns the
+// decoded outputs and the events emitted.
+//
+// The result of the transaction is returned even if it failed. Reverts are
+// reported as *evm.RevertError.
+func (c *BoundContract) Transact(method string, args ...interface{}) (*Result, error) {
+	input, err := c.ABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		vmenv  = NewEnv(c.cfg)
+		sender = evm.AccountRef(c.cfg.Origin)
+		logs   = len(c.cfg.State.Logs())
+	)
+	ret, leftOverGas, err := vmenv.Call(sender, c.Address, input, c.cfg.GasLimit, c.cfg.Value)
+	events := c.decodeEvents(c.cfg.State.Logs()[logs:])
+	c.cfg.State.Finalise()
+
+	return c.result(method, ret, c.cfg.GasLimit-leftOverGas, events, err)
+}
+
+// result returns the result of an execution of a method, decoding its
+// outputs if it succeeded.
+func (c *BoundContract) result(method string, ret []byte, gasUsed uint64, events []Event, err error) (*Result, error) {
+	res := &Result{ReturnData: ret, GasUsed: gasUsed, Events: events}
+	if err != nil {
+		return res, wrapRevert(err, ret)
+	}
+	if len(c.ABI.Methods[method].Outputs) > 0 {
+		if res.Outputs, err = c.ABI.Unpack(method, ret); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// decodeEvents decodes the logs of the events of the contract ABI, from any
+// emitter. Other logs are returned undecoded.
+func (c *BoundContract) decodeEvents(logs []*model.Log) []Event {
+	var events []Event
+	for _, log := range logs {
+		event := Event{Log: log}
+		if len(log.Topics) > 0 {
+			if e, err := c.ABI.EventByID(log.Topics[0]); err == nil {
+				fields := make(map[string]interface{})
+				if c.ABI.UnpackLogIntoMap(fields, e.Name, *log) == nil {
+					event.Name, event.Fields = e.Name, fields
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// wrapRevert returns the error of an execution, as a *evm.RevertError
+// decoding the revert data if it reverted. Stack traces are kept.
+func wrapRevert(err error, ret []byte) error {
+	if e, ok := err.(*evm.ExecutionError); ok {
+		return &evm.ExecutionError{Err: wrapRevert(e.Err, ret), Frames: e.Frames}
+	}
+	if errors.Is(err, evm.ErrExecutionReverted) {
+		return evm.NewRevertError(ret)
+	}
+	return err
+}
@@ -0,0 +1,280 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/abi"
+	"github.com/entropyio/go-evm/asm"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const storeABI = `[
+	{"type": "constructor", "inputs": [{"name": "initial", "type": "uint256"}]},
+	{"type": "function", "name": "get", "stateMutability": "view", "inputs": [], "outputs": [{"name": "", "type": "uint256"}]},
+	{"type": "function", "name": "set", "inputs": [{"name": "value", "type": "uint256"}], "outputs": []},
+	{"type": "function", "name": "fail", "stateMutability": "pure", "inputs": [], "outputs": []},
+	{"type": "event", "name": "Set", "inputs": [{"name": "who", "type": "address", "indexed": true}, {"name": "value", "type": "uint256", "indexed": false}]}
+]`
+
+// storeInitCode stores the constructor argument in slot 0 and deploys the
+// runtime code following it.
+const storeInitCode = `
+	PUSH 32
+	DUP1
+	CODESIZE
+	SUB
+	PUSH 0
+	CODECOPY
+	PUSH 0
+	MLOAD
+	PUSH 0
+	SSTORE
+	PUSH %d
+	DUP1
+	PUSH @runtime
+	PUSH 1
+	ADD
+	PUSH 0
+	CODECOPY
+	PUSH 0
+	RETURN
+runtime:
+`
+
+// storeCode implements the methods of storeABI: get returns slot 0, set
+// updates it and emits Set, fail reverts with Error("nope").
+const storeCode = `
+	PUSH 0
+	CALLDATALOAD
+	PUSH 0xe0
+	SHR
+	DUP1
+	PUSH 0x%x
+	EQ
+	JUMPI @get
+	DUP1
+	PUSH 0x%x
+	EQ
+	JUMPI @set
+	DUP1
+	PUSH 0x%x
+	EQ
+	JUMPI @fail
+	PUSH 0
+	DUP1
+	REVERT
+get:
+	PUSH 0
+	SLOAD
+	PUSH 0
+	MSTORE
+	PUSH 32
+	PUSH 0
+	RETURN
+set:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	PUSH 0
+	SSTORE
+	PUSH 0
+	MSTORE
+	CALLER
+	PUSH 0x%x
+	PUSH 32
+	PUSH 0
+	LOG2
+	STOP
+fail:
+	PUSH 0x08c379a0
+	PUSH 0xe0
+	SHL
+	PUSH 0
+	MSTORE
+	PUSH 32
+	PUSH 4
+	MSTORE
+	PUSH 4
+	PUSH 36
+	MSTORE
+	PUSH 0x6e6f706500000000000000000000000000000000000000000000000000000000
+	PUSH 68
+	MSTORE
+	PUSH 100
+	PUSH 0
+	REVERT
+`
+
+// compile assembles the source, failing the test on errors.
+func compile(t testing.TB, source string) []byte {
+	t.Helper()
+	c := asm.NewCompiler(false)
+	c.Feed(asm.Lex([]byte(source), false))
+	code, errs := c.Compile()
+	if len(errs) != 0 {
+		t.Fatalf("failed to compile: %v", errs)
+	}
+	return common.Hex2Bytes(code)
+}
+
+// newStoreContract returns the ABI and creation bytecode of the store
+// contract.
+func newStoreContract(t testing.TB) (abi.ABI, []byte) {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(storeABI))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	runtime := compile(t, fmt.Sprintf(storeCode,
+		parsed.Methods["get"].ID, parsed.Methods["set"].ID, parsed.Methods["fail"].ID, parsed.Events["Set"].ID))
+	return parsed, append(compile(t, fmt.Sprintf(storeInitCode, len(runtime))), runtime...)
+}
+
+// newTestConfig returns a configuration executing the London instruction set.
+func newTestConfig() *Config {
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	return &Config{
+		Origin:    common.BytesToAddress([]byte("origin")),
+		GasLimit:  10000000,
+		EVMConfig: evm.EVMConfig{JumpTable: &jt},
+	}
+}
+
+func TestBoundContract(t *testing.T) {
+	var (
+		parsed, bytecode = newStoreContract(t)
+		cfg              = newTestConfig()
+	)
+	contract, res, err := Deploy(parsed, bytecode, cfg, big.NewInt(7))
+	if err != nil {
+		t.Fatalf("failed to deploy: %v", err)
+	}
+	if res.GasUsed == 0 || len(cfg.State.GetCode(contract.Address)) == 0 {
+		t.Fatalf("deployment mismatch: %+v", res)
+	}
+	res, err = contract.Call("get")
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(res.Outputs) != 1 || res.Outputs[0].(*big.Int).Int64() != 7 || res.GasUsed == 0 {
+		t.Errorf("call result mismatch: %+v", res)
+	}
+
+	// Transactions change the state and emit events
+	res, err = contract.Transact("set", big.NewInt(42))
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if len(res.Outputs) != 0 || len(res.Events) != 1 {
+		t.Fatalf("transaction result mismatch: %+v", res)
+	}
+	event := res.Events[0]
+	if event.Name != "Set" || event.Fields["who"] != cfg.Origin || event.Fields["value"].(*big.Int).Int64() != 42 || event.Log.Address != contract.Address {
+		t.Errorf("event mismatch: %+v", event)
+	}
+	if res, err = contract.Call("get"); err != nil || res.Outputs[0].(*big.Int).Int64() != 42 {
+		t.Errorf("state not updated: %v, %v", res, err)
+	}
+
+	// Calls can't change the state
+	if _, err = contract.Call("set", big.NewInt(1)); !errors.Is(err, evm.ErrWriteProtection) {
+		t.Errorf("static call error mismatch: %v", err)
+	}
+	if res, err = contract.Call("get"); err != nil || res.Outputs[0].(*big.Int).Int64() != 42 {
+		t.Errorf("state changed by call: %v, %v", res, err)
+	}
+
+	// Reverts are reported with their data
+	res, err = contract.Transact("fail")
+	var revert *evm.RevertError
+	if !errors.As(err, &revert) || !errors.Is(err, evm.ErrExecutionReverted) {
+		t.Fatalf("revert error mismatch: %v", err)
+	}
+	if len(revert.Data) != 100 || revert.Reason != "nope" || res.GasUsed == 0 {
+		t.Errorf("revert data mismatch: %x", revert.Data)
+	}
+	if _, err = contract.Call("unknown"); err == nil {
+		t.Errorf("expected error calling unknown method")
+	}
+
+	// Handles of deployed contracts share the state
+	bound := NewBoundContract(contract.Address, parsed, cfg)
+	if res, err = bound.Call("get"); err != nil || res.Outputs[0].(*big.Int).Int64() != 42 {
+		t.Errorf("bound contract mismatch: %v, %v", res, err)
+	}
+}
+
+func TestDeployRevert(t *testing.T) {
+	parsed, _ := newStoreContract(t)
+	cfg := newTestConfig()
+
+	// Creation code reverting with "nope"
+	code := compile(t, `
+	PUSH 0x6e6f7065
+	PUSH 0
+	MSTORE
+	PUSH 4
+	PUSH 28
+	REVERT
+`)
+	_, res, err := Deploy(parsed, code, cfg, big.NewInt(1))
+	var revert *evm.RevertError
+	if !errors.As(err, &revert) || string(revert.Data) != "nope" || string(res.ReturnData) != "nope" {
+		t.Fatalf("revert mismatch: %v, %+v", err, res)
+	}
+	if _, _, err := Deploy(parsed, code, cfg); err == nil {
+		t.Errorf("expected error deploying without constructor arguments")
+	}
+}
+
+func TestExecuteRevert(t *testing.T) {
+	// revert(Panic(0x12))
+	code := compile(t, `
+	PUSH 0x4e487b71
+	PUSH 0xe0
+	SHL
+	PUSH 0
+	MSTORE
+	PUSH 0x12
+	PUSH 4
+	MSTORE
+	PUSH 36
+	PUSH 0
+	REVERT
+`)
+	_, err := Execute(code, nil, newTestConfig())
+	var revert *evm.RevertError
+	if !errors.As(err, &revert) || revert.Reason != "division or modulo by zero" {
+		t.Fatalf("revert mismatch: %v", err)
+	}
+	if have, want := err.Error(), "execution reverted: panic: division or modulo by zero (0x12)"; have != want {
+		t.Errorf("error message mismatch: have %q, want %q", have, want)
+	}
+}
+
+func TestStackTraceRevert(t *testing.T) {
+	parsed, bytecode := newStoreContract(t)
+	cfg := newTestConfig()
+	cfg.EVMConfig.StackTraces = true
+
+	contract, _, err := Deploy(parsed, bytecode, cfg, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to deploy: %v", err)
+	}
+	_, err = contract.Transact("fail")
+	var (
+		execErr *evm.ExecutionError
+		revert  *evm.RevertError
+	)
+	if !errors.As(err, &execErr) || !errors.As(err, &revert) || revert.Reason != "nope" {
+		t.Fatalf("error mismatch: %v", err)
+	}
+	if len(execErr.Frames) != 1 || execErr.Frames[0].Address != contract.Address || execErr.Frames[0].Op != evm.REVERT {
+		t.Errorf("frames mismatch: %+v", execErr.Frames)
+	}
+}
@@ -20,7 +20,22 @@ func NewEnv(cfg *Config) *evm.EVM {
 		Difficulty:  cfg.Difficulty,
 		GasLimit:    cfg.GasLimit,
 		BaseFee:     cfg.BaseFee,
+		BeaconRoot:  cfg.BeaconRoot,
 	}
 
-	return evm.NewEVM(blockContext, txContext, cfg.EVMConfig)
+	vmConfig := cfg.EVMConfig
+	if cfg.Context != nil {
+		vmConfig.Ctx = cfg.Context
+	}
+	if cfg.MaxSteps != 0 {
+		vmConfig.MaxSteps = cfg.MaxSteps
+	}
+	if cfg.MaxMemory != 0 {
+		vmConfig.MaxMemory = cfg.MaxMemory
+	}
+	vmenv := evm.NewEVM(blockContext, txContext, vmConfig)
+	vmenv.Context = blockContext
+	vmenv.Config = vmConfig
+	vmenv.StateDB = cfg.State
+	return vmenv
 }
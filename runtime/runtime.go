@@ -1,11 +1,12 @@
 package runtime
 
 import (
+	"context"
 	"github.com/entropyio/go-evm/common"
-	"github.com/entropyio/go-evm/common/crypto"
 	"github.com/entropyio/go-evm/config"
 	"github.com/entropyio/go-evm/evm"
 	"github.com/entropyio/go-evm/logger"
+	"github.com/entropyio/go-evm/state"
 	"math"
 	"math/big"
 	"time"
@@ -28,9 +29,15 @@ type Config struct {
 	Debug       bool
 	EVMConfig   evm.EVMConfig
 	BaseFee     *big.Int
+	BeaconRoot  *common.Hash
 
 	State     *state.StateDB
-	GetHashFn func(n uint64) common.Hash
+	GetHashFn func(n uint64) common.Hash // Ancestor block hashes for BLOCKHASH, zero hashes if unset
+
+	// Execution limits, overriding those of EVMConfig if set
+	Context   context.Context // Aborts the execution once done
+	MaxSteps  uint64          // Maximum number of instructions executed
+	MaxMemory uint64          // Maximum memory size of a call frame in bytes
 }
 
 // sets defaults on the config
@@ -63,18 +70,17 @@ func setDefaults(cfg *Config) {
 	if cfg.BlockNumber == nil {
 		cfg.BlockNumber = new(big.Int)
 	}
-	if cfg.GetHashFn == nil {
-		cfg.GetHashFn = func(n uint64) common.Hash {
-			return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
-		}
-	}
 	if cfg.BaseFee == nil {
 		cfg.BaseFee = big.NewInt(config.InitialBaseFee)
 	}
+	if cfg.State == nil {
+		cfg.State = state.New()
+	}
 }
 
 // Execute executes the code using the input as call data during the execution.
-// It returns the EVM's return value, the new state and an error if it failed.
+// It returns the EVM's return value and an error if it failed, a
+// *evm.RevertError if it reverted.
 //
 // Execute sets up an in-memory, temporary, environment for the execution of
 // the given code. It makes sure that it's restored to its original state afterwards.
@@ -84,9 +90,6 @@ func Execute(code, input []byte, cfg *Config) ([]byte, error) {
 	}
 	setDefaults(cfg)
 
-	//if cfg.State == nil {
-	//	cfg.State, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
-	//}
 	var (
 		address = common.BytesToAddress([]byte("contract"))
 		vmenv   = NewEnv(cfg)
@@ -95,9 +98,9 @@ func Execute(code, input []byte, cfg *Config) ([]byte, error) {
 	//if rules := cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil); rules.IsBerlin {
 	//	cfg.State.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(rules), nil)
 	//}
-	//cfg.State.CreateAccount(address)
+	cfg.State.CreateAccount(address)
 	// set the receiver's (the executing contract) code for execution.
-	//cfg.State.SetCode(address, code)
+	cfg.State.SetCode(address, code)
 	log.Debugf("execute address:%x, code:%+v, input:%+v", address, code, input)
 
 	// Call the code with the given configuration.
@@ -109,19 +112,17 @@ func Execute(code, input []byte, cfg *Config) ([]byte, error) {
 		cfg.Value,
 	)
 
-	return ret, err
+	return ret, wrapRevert(err, ret)
 }
 
-// Create executes the code using the EVM create method
+// Create executes the code using the EVM create method. Reverts are reported
+// as *evm.RevertError.
 func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 	if cfg == nil {
 		cfg = new(Config)
 	}
 	setDefaults(cfg)
 
-	//if cfg.State == nil {
-	//	cfg.State, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
-	//}
 	var (
 		vmenv  = NewEnv(cfg)
 		sender = evm.AccountRef(cfg.Origin)
@@ -136,14 +137,15 @@ func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 		cfg.GasLimit,
 		cfg.Value,
 	)
-	return code, address, leftOverGas, err
+	return code, address, leftOverGas, wrapRevert(err, code)
 }
 
 // Call executes the code given by the contract's address. It will return the
-// EVM's return value or an error if it failed.
+// EVM's return value or an error if it failed, a *evm.RevertError if it
+// reverted.
 //
-// Call, unlike Execute, requires a config and also requires the State field to
-// be set.
+// Call, unlike Execute, requires a config, and executes the code deployed at
+// the address in the State.
 func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, error) {
 	setDefaults(cfg)
 
@@ -164,5 +166,5 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 		cfg.GasLimit,
 		cfg.Value,
 	)
-	return ret, leftOverGas, err
+	return ret, leftOverGas, wrapRevert(err, ret)
 }
@@ -0,0 +1,305 @@
+// Package sourcemap maps EVM bytecode to the Solidity sources it was compiled
+// from, using the source maps emitted by the solc compiler.
+package sourcemap
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/asm"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JumpType is the jump marker of an instruction in a source map.
+type JumpType byte
+
+const (
+	JumpNone JumpType = '-' // Regular jump, or not a jump
+	JumpIn   JumpType = 'i' // Jump into a function
+	JumpOut  JumpType = 'o' // Return from a function
+)
+
+// Location is an entry of a source map: the source range an instruction was
+// compiled from.
+type Location struct {
+	Start  int // Byte offset of the range in the source
+	Length int // Byte length of the range
+	File   int // Index of the source, -1 for code generated by the compiler
+	Jump   JumpType
+
+	ModifierDepth int
+}
+
+// Source is a source file of a compilation.
+type Source struct {
+	Name    string
+	Content string
+
+	lines     []int         // Offsets of the line starts
+	contracts []declaration // Contract declarations by offset
+}
+
+// declaration is a contract, library or interface declared in a source.
+type declaration struct {
+	offset int
+	name   string
+}
+
+var (
+	contractRegexp = regexp.MustCompile(`\b(?:contract|library|interface)\s+(\w+)`)
+	functionRegexp = regexp.MustCompile(`^(?:function\s+(\w+)|modifier\s+(\w+)|(constructor|fallback|receive)\b)`)
+)
+
+// NewSource returns a source file given its name and content.
+func NewSource(name, content string) *Source {
+	s := &Source{Name: name, Content: content, lines: []int{0}}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	for _, m := range contractRegexp.FindAllStringSubmatchIndex(content, -1) {
+		s.contracts = append(s.contracts, declaration{offset: m[0], name: content[m[2]:m[3]]})
+	}
+	return s
+}
+
+// position returns the line and column, both starting at 1, of an offset.
+func (s *Source) position(offset int) (int, int) {
+	line := sort.SearchInts(s.lines, offset+1) - 1
+	return line + 1, offset - s.lines[line] + 1
+}
+
+// contract returns the name of the last contract declared at or before the
+// offset, empty if none.
+func (s *Source) contract(offset int) string {
+	i := sort.Search(len(s.contracts), func(i int) bool { return s.contracts[i].offset > offset })
+	if i == 0 {
+		return ""
+	}
+	return s.contracts[i-1].name
+}
+
+// Position is the location of an instruction in its source file.
+type Position struct {
+	File   string
+	Line   int // Line of the start of the range, starting at 1
+	Column int // Byte column of the start of the range, starting at 1
+	Location
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Function is a function, modifier, constructor, fallback or receive
+// function defined in the sources.
+type Function struct {
+	Contract string // Contract declaring the function, empty if unknown
+	Name     string // Name of the function, or constructor, fallback or receive
+	Location        // Source range of the definition
+}
+
+func (f *Function) String() string {
+	if f.Contract == "" {
+		return f.Name
+	}
+	return f.Contract + "." + f.Name
+}
+
+// SourceMap maps the instructions of deployed or creation bytecode to the
+// source ranges they were compiled from.
+type SourceMap struct {
+	locations []Location  // Locations by instruction
+	index     []int       // Instruction index by pc, -1 for immediates
+	sources   []*Source   // Sources by index
+	functions []*Function // Function definitions, in source order
+}
+
+// New returns the source map of the bytecode given the compressed source map
+// emitted by solc for it, and its sources ordered by index, as the source
+// list of the compilation. Sources may be nil if unavailable, the positions
+// of their instructions are then unknown.
+//
+// Data following the code, such as the metadata appended by solc, is not
+// mapped.
+func New(code []byte, sourceMap string, sources []*Source) (*SourceMap, error) {
+	locations, err := parseSourceMap(sourceMap)
+	if err != nil {
+		return nil, err
+	}
+	m := &SourceMap{
+		locations: locations,
+		index:     make([]int, len(code)),
+		sources:   sources,
+	}
+	for pc := range m.index {
+		m.index[pc] = -1
+	}
+	it := asm.NewInstructionIterator(code)
+	for n := 0; it.Next(); n++ {
+		m.index[it.PC()] = n
+	}
+	m.functions = m.findFunctions()
+	return m, nil
+}
+
+// parseSourceMap decompresses a source map. Entries are separated by
+// semicolons, their fields by colons, and empty or missing fields are those
+// of the previous entry.
+func parseSourceMap(sourceMap string) ([]Location, error) {
+	if sourceMap == "" {
+		return nil, nil
+	}
+	var (
+		entries   = strings.Split(sourceMap, ";")
+		locations = make([]Location, 0, len(entries))
+		loc       = Location{File: -1, Jump: JumpNone}
+	)
+	for i, entry := range entries {
+		fields := strings.Split(entry, ":")
+		if len(fields) > 5 {
+			return nil, fmt.Errorf("invalid source map entry %d: %q", i, entry)
+		}
+		for j, field := range fields {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				switch jump := JumpType(field[0]); {
+				case len(field) == 1 && (jump == JumpNone || jump == JumpIn || jump == JumpOut):
+					loc.Jump = jump
+				default:
+					return nil, fmt.Errorf("invalid jump type in source map entry %d: %q", i, entry)
+				}
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d: %q", i, entry)
+			}
+			switch j {
+			case 0:
+				loc.Start = n
+			case 1:
+				loc.Length = n
+			case 2:
+				loc.File = n
+			case 4:
+				loc.ModifierDepth = n
+			}
+		}
+		locations = append(locations, loc)
+	}
+	return locations, nil
+}
+
+// source returns the source text of a location, if available.
+func (m *SourceMap) source(loc Location) (*Source, string, bool) {
+	if loc.File < 0 || loc.File >= len(m.sources) || m.sources[loc.File] == nil {
+		return nil, "", false
+	}
+	src := m.sources[loc.File]
+	if loc.Start < 0 || loc.Length < 0 || loc.Start+loc.Length > len(src.Content) {
+		return nil, "", false
+	}
+	return src, src.Content[loc.Start : loc.Start+loc.Length], true
+}
+
+// findFunctions returns the function definitions the instructions are
+// mapped to, the entries of the functions being mapped to their whole
+// definition.
+func (m *SourceMap) findFunctions() []*Function {
+	var (
+		functions []*Function
+		seen      = make(map[Location]bool)
+	)
+	for _, loc := range m.locations {
+		def := Location{Start: loc.Start, Length: loc.Length, File: loc.File}
+		if seen[def] {
+			continue
+		}
+		seen[def] = true
+
+		src, text, ok := m.source(def)
+		if !ok {
+			continue
+		}
+		if match := functionRegexp.FindStringSubmatch(text); match != nil {
+			name := match[1] + match[2] + match[3]
+			functions = append(functions, &Function{Contract: src.contract(def.Start), Name: name, Location: def})
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		a, b := functions[i].Location, functions[j].Location
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Start < b.Start
+	})
+	return functions
+}
+
+// Location returns the source range of the instruction at pc. It reports
+// false if the pc is not the one of an instruction of the map.
+func (m *SourceMap) Location(pc uint64) (Location, bool) {
+	if pc >= uint64(len(m.index)) {
+		return Location{}, false
+	}
+	n := m.index[pc]
+	if n < 0 || n >= len(m.locations) {
+		return Location{}, false
+	}
+	return m.locations[n], true
+}
+
+// Position returns the position of the instruction at pc. It reports false
+// if the instruction is not mapped to an available source, as is code
+// generated by the compiler.
+func (m *SourceMap) Position(pc uint64) (Position, bool) {
+	loc, ok := m.Location(pc)
+	if !ok {
+		return Position{}, false
+	}
+	src, _, ok := m.source(loc)
+	if !ok {
+		return Position{}, false
+	}
+	line, column := src.position(loc.Start)
+	return Position{File: src.Name, Line: line, Column: column, Location: loc}, true
+}
+
+// Function returns the innermost function whose definition contains the
+// instruction at pc. It reports false if the instruction is not within a
+// function, like the dispatcher of a contract.
+func (m *SourceMap) Function(pc uint64) (*Function, bool) {
+	loc, ok := m.Location(pc)
+	if !ok {
+		return nil, false
+	}
+	var found *Function
+	for _, f := range m.functions {
+		if f.File == loc.File && f.Start <= loc.Start && loc.Start+loc.Length <= f.Start+f.Length {
+			found = f // Nested definitions follow the enclosing ones
+		}
+	}
+	return found, found != nil
+}
+
+// Contract returns the name of the contract the instruction at pc was
+// compiled from, empty if unknown.
+func (m *SourceMap) Contract(pc uint64) string {
+	if f, ok := m.Function(pc); ok {
+		return f.Contract
+	}
+	loc, ok := m.Location(pc)
+	if !ok {
+		return ""
+	}
+	src, _, ok := m.source(loc)
+	if !ok {
+		return ""
+	}
+	return src.contract(loc.Start)
+}
@@ -0,0 +1,176 @@
+package sourcemap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/config"
+	"github.com/entropyio/go-evm/evm"
+	"github.com/entropyio/go-evm/runtime"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const tokenSource = `pragma solidity ^0.8.0;
+
+contract Token {
+    function transfer(uint256 amount) public {
+        require(amount > 0);
+        check(amount);
+    }
+
+    function check(uint256 amount) internal {
+        assert(amount < 10);
+    }
+}
+`
+
+// tokenCode jumps from transfer into check, which fails:
+//
+//	0 PUSH1 0x80, 2 PUSH1 0x07, 4 JUMP, 5 STOP, 6 STOP, 7 JUMPDEST, 8 INVALID
+var tokenCode = common.Hex2Bytes("608060075600005bfe")
+
+// newTokenSourceMap returns the source map of tokenCode, compressed as solc
+// does.
+func newTokenSourceMap(t *testing.T) *SourceMap {
+	t.Helper()
+	rng := func(text string) string {
+		start := strings.Index(tokenSource, text)
+		if start < 0 {
+			t.Fatalf("missing source text %q", text)
+		}
+		return fmt.Sprintf("%d:%d", start, len(text))
+	}
+	var (
+		contract = rng(tokenSource[strings.Index(tokenSource, "contract") : strings.LastIndex(tokenSource, "}")+1])
+		transfer = rng(tokenSource[strings.Index(tokenSource, "function transfer") : strings.Index(tokenSource, "    function check")-2])
+		check    = rng(tokenSource[strings.Index(tokenSource, "function check") : strings.LastIndex(tokenSource, "}")-2])
+	)
+	sourceMap := strings.Join([]string{
+		contract + ":0:-:0",
+		rng("check(amount)"),
+		":::i",
+		transfer + "::-",
+		"",
+		check,
+		rng("assert(amount < 10)"),
+	}, ";")
+	m, err := New(tokenCode, sourceMap, []*Source{NewSource("Token.sol", tokenSource)})
+	if err != nil {
+		t.Fatalf("failed to parse source map: %v", err)
+	}
+	return m
+}
+
+func TestParseSourceMap(t *testing.T) {
+	locations, err := parseSourceMap("1:2:1;:9;2:1:2:i;;-1:::o:1;:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Location{
+		{Start: 1, Length: 2, File: 1, Jump: JumpNone},
+		{Start: 1, Length: 9, File: 1, Jump: JumpNone},
+		{Start: 2, Length: 1, File: 2, Jump: JumpIn},
+		{Start: 2, Length: 1, File: 2, Jump: JumpIn},
+		{Start: -1, Length: 1, File: 2, Jump: JumpOut, ModifierDepth: 1},
+		{Start: -1, Length: 1, File: 2, Jump: JumpOut, ModifierDepth: 1},
+	}
+	if !reflect.DeepEqual(locations, want) {
+		t.Errorf("locations mismatch:\nhave %+v\nwant %+v", locations, want)
+	}
+	for _, invalid := range []string{"1:2:x", "1:2:0:j", "1:2:0:-:0:0"} {
+		if _, err := parseSourceMap(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	m := newTokenSourceMap(t)
+
+	tests := []struct {
+		pc       uint64
+		line     int
+		column   int
+		function string
+		contract string
+	}{
+		{0, 3, 1, "", "Token"},
+		{2, 6, 9, "Token.transfer", "Token"},
+		{4, 6, 9, "Token.transfer", "Token"},
+		{5, 4, 5, "Token.transfer", "Token"},
+		{6, 4, 5, "Token.transfer", "Token"},
+		{7, 9, 5, "Token.check", "Token"},
+		{8, 10, 9, "Token.check", "Token"},
+	}
+	for _, tt := range tests {
+		pos, ok := m.Position(tt.pc)
+		if !ok || pos.File != "Token.sol" || pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("pc %d: position mismatch: have %v, want Token.sol:%d:%d", tt.pc, pos, tt.line, tt.column)
+		}
+		f, ok := m.Function(tt.pc)
+		if (tt.function == "") == ok || (ok && f.String() != tt.function) {
+			t.Errorf("pc %d: function mismatch: have %v, want %q", tt.pc, f, tt.function)
+		}
+		if contract := m.Contract(tt.pc); contract != tt.contract {
+			t.Errorf("pc %d: contract mismatch: have %q, want %q", tt.pc, contract, tt.contract)
+		}
+	}
+	// Immediates and data past the code are not mapped
+	if _, ok := m.Position(1); ok {
+		t.Errorf("immediate mapped")
+	}
+	if _, ok := m.Position(uint64(len(tokenCode))); ok {
+		t.Errorf("pc past the code mapped")
+	}
+	if loc, _ := m.Location(4); loc.Jump != JumpIn {
+		t.Errorf("jump marker mismatch: %c", loc.Jump)
+	}
+}
+
+func TestCallStack(t *testing.T) {
+	m := newTokenSourceMap(t)
+
+	stack := m.NewCallStack()
+	for _, step := range []struct {
+		pc uint64
+		op evm.OpCode
+	}{{0, evm.PUSH1}, {2, evm.PUSH1}, {4, evm.JUMP}, {7, evm.JUMPDEST}, {8, evm.INVALID}} {
+		stack.Step(step.pc, step.op)
+	}
+	if stack.Depth() != 1 {
+		t.Fatalf("depth mismatch: have %d, want 1", stack.Depth())
+	}
+	var frames []string
+	for _, frame := range stack.Frames(8) {
+		frames = append(frames, frame.String())
+	}
+	want := []string{"Token.check (Token.sol:10)", "Token.transfer (Token.sol:6)"}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("frames mismatch: have %v, want %v", frames, want)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	m := newTokenSourceMap(t)
+
+	jt := evm.NewJumpTable(config.Rules{IsHomestead: true, IsEIP150: true, IsLondon: true}, nil)
+	_, err := runtime.Execute(tokenCode, nil, &runtime.Config{
+		GasLimit:  100000,
+		EVMConfig: evm.EVMConfig{JumpTable: &jt, StackTraces: true},
+	})
+	var execErr *evm.ExecutionError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("error mismatch: %v", err)
+	}
+	trace := Trace(execErr, func(evm.Frame) *SourceMap { return m })
+	if want := execErr.Err.Error() + "\n\tat Token.check (Token.sol:10)"; trace != want {
+		t.Errorf("trace mismatch: have %q, want %q", trace, want)
+	}
+	// Frames without source map are rendered at the bytecode level
+	trace = Trace(execErr, func(evm.Frame) *SourceMap { return nil })
+	if !strings.HasSuffix(trace, "pc 8 INVALID (gas 99985, depth 1)") {
+		t.Errorf("bytecode trace mismatch: %q", trace)
+	}
+}
@@ -0,0 +1,115 @@
+package sourcemap
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/evm"
+	"strings"
+)
+
+// StackFrame is a frame of a source level stack trace.
+type StackFrame struct {
+	PC       uint64
+	Contract string    // Contract of the instruction, empty if unknown
+	Function *Function // Function of the instruction, nil if outside of one
+	Position Position  // Position of the instruction, if known
+}
+
+// Frame returns the stack frame of the instruction at pc. It reports false
+// if the instruction is not mapped to an available source.
+func (m *SourceMap) Frame(pc uint64) (StackFrame, bool) {
+	pos, ok := m.Position(pc)
+	if !ok {
+		return StackFrame{PC: pc}, false
+	}
+	frame := StackFrame{PC: pc, Contract: m.Contract(pc), Position: pos}
+	frame.Function, _ = m.Function(pc)
+	return frame, true
+}
+
+// String renders the frame as Contract.function (File.sol:line).
+func (f StackFrame) String() string {
+	name := f.Contract
+	if f.Function != nil {
+		name = f.Function.String()
+	}
+	if name == "" {
+		name = "<unknown>"
+	}
+	if f.Position.File == "" {
+		return fmt.Sprintf("%s (pc %d)", name, f.PC)
+	}
+	return fmt.Sprintf("%s (%s:%d)", name, f.Position.File, f.Position.Line)
+}
+
+// CallStack tracks the internal function calls of an execution of the code
+// of a source map, following the jump markers of its instructions.
+type CallStack struct {
+	m     *SourceMap
+	calls []uint64 // Instructions jumping into the functions being executed
+}
+
+// NewCallStack returns a call stack tracking an execution of the code of the
+// source map, from its start.
+func (m *SourceMap) NewCallStack() *CallStack {
+	return &CallStack{m: m}
+}
+
+// Step records the execution of the instruction at pc. It must be called for
+// every instruction executed, before its execution, like in the CaptureState
+// method of a tracer.
+func (s *CallStack) Step(pc uint64, op evm.OpCode) {
+	if op != evm.JUMP {
+		return
+	}
+	loc, ok := s.m.Location(pc)
+	if !ok {
+		return
+	}
+	switch loc.Jump {
+	case JumpIn:
+		s.calls = append(s.calls, pc)
+	case JumpOut:
+		if len(s.calls) > 0 {
+			s.calls = s.calls[:len(s.calls)-1]
+		}
+	}
+}
+
+// Depth returns the number of internal function calls being executed.
+func (s *CallStack) Depth() int {
+	return len(s.calls)
+}
+
+// Frames returns the stack trace at the instruction at pc, the innermost
+// frame first followed by the call sites of the functions being executed.
+func (s *CallStack) Frames(pc uint64) []StackFrame {
+	frames := make([]StackFrame, 0, len(s.calls)+1)
+	frame, _ := s.m.Frame(pc)
+	frames = append(frames, frame)
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		frame, _ = s.m.Frame(s.calls[i])
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// Trace renders the stack trace of an execution error at the source level,
+// innermost frame first. The source map of the code executed by a frame is
+// returned by lookup, creation frames executing creation bytecode. Frames
+// without source map, or whose instruction isn't mapped to a source, are
+// rendered at the bytecode level.
+func Trace(err *evm.ExecutionError, lookup func(frame evm.Frame) *SourceMap) string {
+	var b strings.Builder
+	b.WriteString(err.Err.Error())
+	for i := len(err.Frames) - 1; i >= 0; i-- {
+		f := &err.Frames[i]
+		if m := lookup(*f); m != nil {
+			if frame, ok := m.Frame(f.PC); ok {
+				fmt.Fprintf(&b, "\n\tat %v", frame)
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "\n\tat %v", f)
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package state
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+)
+
+type Storage map[common.Hash]common.Hash
+
+// account is the in-memory representation of an account in the state.
+type account struct {
+	nonce    uint64
+	balance  *big.Int
+	code     []byte
+	codeHash common.Hash
+
+	originStorage Storage // Storage as of the start of the current transaction
+	dirtyStorage  Storage // Storage entries modified in the current transaction
+
+	// Flag whether the account was marked as suicided. The account is
+	// removed from the state when the transaction is finalised.
+	suicided bool
+	// Flag whether the account was created in the current transaction.
+	created bool
+	// Flag whether the account replaced any previous one since the last
+	// finalisation, discarding its storage.
+	reset bool
+	// Flag whether storage slots missing from originStorage are to be loaded
+	// from the reader of the state.
+	lazy bool
+}
+
+func newAccount() *account {
+	return &account{
+		balance:       new(big.Int),
+		codeHash:      emptyCodeHash,
+		originStorage: make(Storage),
+		dirtyStorage:  make(Storage),
+	}
+}
+
+// empty returns whether the account is considered empty.
+func (a *account) empty() bool {
+	return a.nonce == 0 && a.balance.Sign() == 0 && a.codeHash == emptyCodeHash
+}
+
+// finalise moves all dirty storage slots into the committed storage and
+// clears the transaction scoped flags.
+func (a *account) finalise() {
+	for key, value := range a.dirtyStorage {
+		// Cleared slots of lazy accounts are kept, so as not to be reloaded
+		if value == (common.Hash{}) && !a.lazy {
+			delete(a.originStorage, key)
+		} else {
+			a.originStorage[key] = value
+		}
+	}
+	if len(a.dirtyStorage) > 0 {
+		a.dirtyStorage = make(Storage)
+	}
+	a.created = false
+	a.reset = false
+}
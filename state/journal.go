@@ -0,0 +1,169 @@
+package state
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+)
+
+// journalEntry is a modification entry in the state change journal that can be
+// reverted on demand.
+type journalEntry interface {
+	// revert undoes the changes introduced by this journal entry.
+	revert(*StateDB)
+
+	// dirtied returns the account modified by this journal entry, if any.
+	dirtied() *common.Address
+}
+
+// journal contains the list of state modifications applied since the last state
+// commit. These are tracked to be able to be reverted in the case of an execution
+// exception or request for reversal.
+type journal struct {
+	entries []journalEntry
+}
+
+// newJournal creates a new initialized journal.
+func newJournal() *journal {
+	return &journal{}
+}
+
+// append inserts a new modification entry to the end of the change journal.
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+// revert undoes a batch of journalled modifications.
+func (j *journal) revert(statedb *StateDB, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		j.entries[i].revert(statedb)
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+// length returns the current number of entries in the journal.
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+type (
+	// Changes to the account trie.
+	createAccountChange struct {
+		account common.Address
+		prev    *account
+	}
+	suicideChange struct {
+		account     common.Address
+		prev        bool // whether account had already suicided
+		prevBalance *big.Int
+	}
+
+	// Changes to individual accounts.
+	balanceChange struct {
+		account common.Address
+		prev    *big.Int
+	}
+	nonceChange struct {
+		account common.Address
+		prev    uint64
+	}
+	storageChange struct {
+		account   common.Address
+		key       common.Hash
+		prev      common.Hash
+		prevDirty bool
+	}
+	codeChange struct {
+		account  common.Address
+		prevCode []byte
+		prevHash common.Hash
+	}
+
+	// Changes to other state values.
+	refundChange struct {
+		prev uint64
+	}
+	addLogChange struct{}
+
+	// Changes to the access list
+	accessListAddAccountChange struct {
+		address common.Address
+	}
+	accessListAddSlotChange struct {
+		address common.Address
+		slot    common.Hash
+	}
+)
+
+func (ch createAccountChange) revert(s *StateDB) {
+	if ch.prev == nil {
+		delete(s.accounts, ch.account)
+	} else {
+		s.accounts[ch.account] = ch.prev
+	}
+}
+
+func (ch suicideChange) revert(s *StateDB) {
+	if obj := s.getAccount(ch.account); obj != nil {
+		obj.suicided = ch.prev
+		obj.balance = ch.prevBalance
+	}
+}
+
+func (ch balanceChange) revert(s *StateDB) {
+	s.getAccount(ch.account).balance = ch.prev
+}
+
+func (ch nonceChange) revert(s *StateDB) {
+	s.getAccount(ch.account).nonce = ch.prev
+}
+
+func (ch storageChange) revert(s *StateDB) {
+	obj := s.getAccount(ch.account)
+	if ch.prevDirty {
+		obj.dirtyStorage[ch.key] = ch.prev
+	} else {
+		delete(obj.dirtyStorage, ch.key)
+	}
+}
+
+func (ch codeChange) revert(s *StateDB) {
+	obj := s.getAccount(ch.account)
+	obj.code = ch.prevCode
+	obj.codeHash = ch.prevHash
+}
+
+func (ch refundChange) revert(s *StateDB) {
+	s.refund = ch.prev
+}
+
+func (ch addLogChange) revert(s *StateDB) {
+	s.logs = s.logs[:len(s.logs)-1]
+}
+
+func (ch accessListAddAccountChange) revert(s *StateDB) {
+	/*
+		One important invariant here, is that whenever a (addr, slot) is added, if the
+		addr is not already present, the add causes two journal entries:
+		- one for the address,
+		- one for the (address,slot)
+		Therefore, when unrolling the change, we can always blindly delete the
+		(addr) at this point, since no storage adds can remain when come upon
+		a single (addr) change.
+	*/
+	s.accessList.DeleteAddress(ch.address)
+}
+
+func (ch accessListAddSlotChange) revert(s *StateDB) {
+	s.accessList.DeleteSlot(ch.address, ch.slot)
+}
+
+func (ch createAccountChange) dirtied() *common.Address        { return &ch.account }
+func (ch suicideChange) dirtied() *common.Address              { return &ch.account }
+func (ch balanceChange) dirtied() *common.Address              { return &ch.account }
+func (ch nonceChange) dirtied() *common.Address                { return &ch.account }
+func (ch storageChange) dirtied() *common.Address              { return &ch.account }
+func (ch codeChange) dirtied() *common.Address                 { return &ch.account }
+func (ch refundChange) dirtied() *common.Address               { return nil }
+func (ch addLogChange) dirtied() *common.Address               { return nil }
+func (ch accessListAddAccountChange) dirtied() *common.Address { return nil }
+func (ch accessListAddSlotChange) dirtied() *common.Address    { return nil }
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+)
+
+// Account is the content of an account, as provided by a Reader.
+type Account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Code     []byte
+	CodeHash common.Hash
+}
+
+// Reader provides the state a StateDB is layered on. It must return the same
+// values for the lifetime of the StateDB.
+type Reader interface {
+	// Account returns the account at addr, or nil if it does not exist. The
+	// returned account is not modified by the StateDB.
+	Account(addr common.Address) *Account
+	// Storage returns the value of a storage slot of an existing account.
+	Storage(addr common.Address, key common.Hash) common.Hash
+}
+
+// AccountDiff is the change a transaction made to an account.
+type AccountDiff struct {
+	Account // Account after the transaction, unless deleted
+
+	Deleted  bool    // Whether the account doesn't exist after the transaction
+	Suicided bool    // Whether the account was deleted by a self-destruct
+	Reset    bool    // Whether the account was recreated, discarding its storage
+	Storage  Storage // Storage slots modified by the transaction
+}
+
+// NewWithReader creates a state layered on the given reader. Accounts and
+// storage slots are loaded from the reader on first access, the changes are
+// kept in the StateDB.
+func NewWithReader(reader Reader) *StateDB {
+	s := New()
+	s.reader = reader
+	s.loaded = make(map[common.Address]struct{})
+	return s
+}
+
+// loadAccount loads the account at addr from the reader, unless it was looked
+// up before.
+func (s *StateDB) loadAccount(addr common.Address) *account {
+	if _, ok := s.loaded[addr]; ok {
+		return nil
+	}
+	s.loaded[addr] = struct{}{}
+
+	data := s.reader.Account(addr)
+	if data == nil {
+		return nil
+	}
+	obj := newAccount()
+	obj.nonce = data.Nonce
+	obj.balance = new(big.Int).Set(data.Balance)
+	obj.code = data.Code
+	obj.codeHash = data.CodeHash
+	obj.lazy = true
+	s.accounts[addr] = obj
+	return obj
+}
+
+// committedState returns a slot of the committed storage of the account at
+// addr, loading it from the reader if needed.
+func (s *StateDB) committedState(addr common.Address, obj *account, key common.Hash) common.Hash {
+	value, ok := obj.originStorage[key]
+	if !ok && obj.lazy {
+		value = s.reader.Storage(addr, key)
+		obj.originStorage[key] = value
+	}
+	return value
+}
+
+// Diff returns the changes made to the accounts since the last Finalise, as
+// Finalise would commit them.
+func (s *StateDB) Diff() map[common.Address]*AccountDiff {
+	diffs := make(map[common.Address]*AccountDiff)
+	for _, entry := range s.journal.entries {
+		addr := entry.dirtied()
+		if addr == nil {
+			continue
+		}
+		if _, ok := diffs[*addr]; ok {
+			continue
+		}
+		diff := new(AccountDiff)
+		if obj := s.accounts[*addr]; obj == nil || obj.suicided {
+			diff.Deleted = true
+			diff.Suicided = obj != nil
+		} else {
+			diff.Account = Account{
+				Nonce:    obj.nonce,
+				Balance:  new(big.Int).Set(obj.balance),
+				Code:     obj.code,
+				CodeHash: obj.codeHash,
+			}
+			diff.Reset = obj.reset
+			diff.Storage = make(Storage, len(obj.dirtyStorage))
+			for key, value := range obj.dirtyStorage {
+				diff.Storage[key] = value
+			}
+		}
+		diffs[*addr] = diff
+	}
+	return diffs
+}
+
+// ApplyDiff applies the changes of a transaction, as returned by Diff, to the
+// state. The state must be finalised.
+func (s *StateDB) ApplyDiff(diffs map[common.Address]*AccountDiff) {
+	for addr, diff := range diffs {
+		if diff.Deleted {
+			delete(s.accounts, addr)
+			if s.reader != nil {
+				s.loaded[addr] = struct{}{}
+			}
+			continue
+		}
+		obj := s.getAccount(addr)
+		if obj == nil || diff.Reset {
+			obj = newAccount()
+			s.accounts[addr] = obj
+		}
+		obj.nonce = diff.Nonce
+		obj.balance = new(big.Int).Set(diff.Balance)
+		obj.code = diff.Code
+		obj.codeHash = diff.CodeHash
+		for key, value := range diff.Storage {
+			if value == (common.Hash{}) && !obj.lazy {
+				delete(obj.originStorage, key)
+			} else {
+				obj.originStorage[key] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"math/big"
+	"testing"
+)
+
+// testReader provides the accounts and storage of a StateDB, counting the
+// lookups.
+type testReader struct {
+	s       *StateDB
+	lookups int
+}
+
+func (r *testReader) Account(addr common.Address) *Account {
+	r.lookups++
+	if !r.s.Exist(addr) {
+		return nil
+	}
+	return &Account{
+		Nonce:    r.s.GetNonce(addr),
+		Balance:  r.s.GetBalance(addr),
+		Code:     r.s.GetCode(addr),
+		CodeHash: r.s.GetCodeHash(addr),
+	}
+}
+
+func (r *testReader) Storage(addr common.Address, key common.Hash) common.Hash {
+	r.lookups++
+	return r.s.GetState(addr, key)
+}
+
+func TestReaderDiff(t *testing.T) {
+	var (
+		base    = New()
+		addr    = common.BytesToAddress([]byte("addr"))
+		doomed  = common.BytesToAddress([]byte("doomed"))
+		created = common.BytesToAddress([]byte("created"))
+		one     = common.BytesToHash([]byte{1})
+		two     = common.BytesToHash([]byte{2})
+	)
+	base.AddBalance(addr, big.NewInt(42))
+	base.SetState(addr, one, one)
+	base.SetState(addr, two, two)
+	base.AddBalance(doomed, big.NewInt(1))
+	base.Finalise()
+
+	reader := &testReader{s: base}
+	s := NewWithReader(reader)
+	if have := s.GetState(addr, one); have != one {
+		t.Fatalf("storage mismatch: have %x, want %x", have, one)
+	}
+	s.SetState(addr, one, two)
+	s.SetState(addr, two, common.Hash{})
+	if have := s.GetCommittedState(addr, one); have != one {
+		t.Errorf("committed storage mismatch: have %x, want %x", have, one)
+	}
+	s.AddBalance(addr, big.NewInt(8))
+	s.Suicide(doomed)
+	s.CreateAccount(created)
+	s.SetState(created, one, one)
+
+	// Reverted changes are not part of the diff
+	snap := s.Snapshot()
+	s.SetNonce(common.BytesToAddress([]byte("reverted")), 1)
+	s.RevertToSnapshot(snap)
+
+	// Every account and slot is only looked up once
+	s.GetBalance(addr)
+	s.GetState(addr, one)
+	if reader.lookups != 5 {
+		t.Errorf("lookup count mismatch: have %d, want 5", reader.lookups)
+	}
+	diffs := s.Diff()
+	if len(diffs) != 3 {
+		t.Fatalf("diff size mismatch: have %d, want 3", len(diffs))
+	}
+	if diff := diffs[addr]; diff.Deleted || diff.Reset || diff.Balance.Cmp(big.NewInt(50)) != 0 || len(diff.Storage) != 2 {
+		t.Errorf("modified account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[doomed]; !diff.Deleted || !diff.Suicided {
+		t.Errorf("destructed account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[created]; diff.Deleted || !diff.Reset {
+		t.Errorf("created account diff mismatch: %+v", diff)
+	}
+	// Applying the diff is equivalent to finalising the transaction
+	base.ApplyDiff(diffs)
+	s.Finalise()
+	for _, a := range []common.Address{addr, doomed, created} {
+		if base.Exist(a) != s.Exist(a) || base.GetBalance(a).Cmp(s.GetBalance(a)) != 0 {
+			t.Errorf("account %x mismatch after applying diff", a)
+		}
+		for _, key := range []common.Hash{one, two} {
+			if have, want := base.GetState(a, key), s.GetState(a, key); have != want {
+				t.Errorf("account %x slot %x mismatch: have %x, want %x", a, key, have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Package state provides an in-memory implementation of the EVM state database.
+package state
+
+import (
+	"fmt"
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/common/crypto"
+	"github.com/entropyio/go-evm/model"
+	"math/big"
+	"sort"
+)
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// StateDB is an in-memory, journaled implementation of evm.StateDB. It keeps
+// the whole world state in maps and is meant for tests, simulations and other
+// environments where no persistent trie is required.
+//
+// A StateDB is scoped to transactions: Finalise must be called between two
+// transactions to commit the dirty storage, delete destructed accounts and
+// reset all transaction scoped data (refund, access list, created flags).
+type StateDB struct {
+	accounts map[common.Address]*account
+
+	refund     uint64
+	logs       []*model.Log
+	preimages  map[common.Hash][]byte
+	accessList *accessList
+
+	// Source of the accounts missing from the state, if any, and the
+	// addresses already looked up in it
+	reader Reader
+	loaded map[common.Address]struct{}
+
+	journal        *journal
+	validRevisions []revision
+	nextRevisionId int
+}
+
+// New creates a new, empty state.
+func New() *StateDB {
+	return &StateDB{
+		accounts:   make(map[common.Address]*account),
+		preimages:  make(map[common.Hash][]byte),
+		accessList: newAccessList(),
+		journal:    newJournal(),
+	}
+}
+
+// getAccount returns the live account at addr, or nil if it does not exist.
+func (s *StateDB) getAccount(addr common.Address) *account {
+	if obj := s.accounts[addr]; obj != nil {
+		return obj
+	}
+	if s.reader != nil {
+		return s.loadAccount(addr)
+	}
+	return nil
+}
+
+// getOrNewAccount returns the account at addr, creating an empty one if it
+// does not exist yet.
+func (s *StateDB) getOrNewAccount(addr common.Address) *account {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj
+	}
+	return s.createAccount(addr)
+}
+
+// createAccount creates a fresh account, replacing any existing one.
+func (s *StateDB) createAccount(addr common.Address) *account {
+	prev := s.accounts[addr]
+	s.journal.append(createAccountChange{account: addr, prev: prev})
+	obj := newAccount()
+	obj.reset = true
+	s.accounts[addr] = obj
+	return obj
+}
+
+// CreateAccount explicitly creates a state object. If a state object with the
+// address already exists the balance is carried over to the new account.
+//
+// The account is flagged as created within the current transaction, which is
+// what EIP-6780 uses to decide whether SELFDESTRUCT may delete it.
+func (s *StateDB) CreateAccount(addr common.Address) {
+	prev := s.getAccount(addr)
+	obj := s.createAccount(addr)
+	if prev != nil {
+		obj.balance.Set(prev.balance)
+	}
+	obj.created = true
+}
+
+// CreatedInTx reports whether the account was created within the current
+// transaction.
+func (s *StateDB) CreatedInTx(addr common.Address) bool {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj.created
+	}
+	return false
+}
+
+// SubBalance subtracts amount from the account associated with addr.
+func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		s.touch(addr)
+		return
+	}
+	obj := s.getOrNewAccount(addr)
+	s.setBalance(addr, obj, new(big.Int).Sub(obj.balance, amount))
+}
+
+// AddBalance adds amount to the account associated with addr.
+func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		s.touch(addr)
+		return
+	}
+	obj := s.getOrNewAccount(addr)
+	s.setBalance(addr, obj, new(big.Int).Add(obj.balance, amount))
+}
+
+// SetBalance sets the balance of the account associated with addr.
+func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
+	s.setBalance(addr, s.getOrNewAccount(addr), new(big.Int).Set(amount))
+}
+
+func (s *StateDB) setBalance(addr common.Address, obj *account, amount *big.Int) {
+	s.journal.append(balanceChange{account: addr, prev: obj.balance})
+	obj.balance = amount
+}
+
+// touch makes sure the account exists, mirroring the implicit account
+// creation of zero-value transfers.
+func (s *StateDB) touch(addr common.Address) {
+	s.getOrNewAccount(addr)
+}
+
+// GetBalance retrieves the balance from the given address or 0 if object not found.
+func (s *StateDB) GetBalance(addr common.Address) *big.Int {
+	if obj := s.getAccount(addr); obj != nil {
+		return new(big.Int).Set(obj.balance)
+	}
+	return new(big.Int)
+}
+
+// GetNonce retrieves the nonce from the given address or 0 if object not found.
+func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj.nonce
+	}
+	return 0
+}
+
+// SetNonce sets the nonce of the account associated with addr.
+func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	obj := s.getOrNewAccount(addr)
+	s.journal.append(nonceChange{account: addr, prev: obj.nonce})
+	obj.nonce = nonce
+}
+
+// GetCodeHash returns the code hash of the account, or the zero hash if the
+// account does not exist.
+func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj.codeHash
+	}
+	return common.Hash{}
+}
+
+// GetCode returns the code of the account associated with addr.
+func (s *StateDB) GetCode(addr common.Address) []byte {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj.code
+	}
+	return nil
+}
+
+// SetCode sets the code of the account associated with addr.
+func (s *StateDB) SetCode(addr common.Address, code []byte) {
+	obj := s.getOrNewAccount(addr)
+	s.journal.append(codeChange{account: addr, prevCode: obj.code, prevHash: obj.codeHash})
+	obj.code = code
+	obj.codeHash = crypto.Keccak256Hash(code)
+}
+
+// GetCodeSize returns the size of the code of the account associated with addr.
+func (s *StateDB) GetCodeSize(addr common.Address) int {
+	return len(s.GetCode(addr))
+}
+
+// AddRefund adds gas to the refund counter.
+func (s *StateDB) AddRefund(gas uint64) {
+	s.journal.append(refundChange{prev: s.refund})
+	s.refund += gas
+}
+
+// SubRefund removes gas from the refund counter.
+// This method will panic if the refund counter goes below zero
+func (s *StateDB) SubRefund(gas uint64) {
+	s.journal.append(refundChange{prev: s.refund})
+	if gas > s.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
+	}
+	s.refund -= gas
+}
+
+// GetRefund returns the current value of the refund counter.
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
+// GetCommittedState retrieves a value from the given account's committed
+// storage, i.e. the value at the start of the current transaction.
+func (s *StateDB) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	if obj := s.getAccount(addr); obj != nil {
+		return s.committedState(addr, obj, key)
+	}
+	return common.Hash{}
+}
+
+// GetState retrieves a value from the given account's storage.
+func (s *StateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	if obj := s.getAccount(addr); obj != nil {
+		if value, dirty := obj.dirtyStorage[key]; dirty {
+			return value
+		}
+		return s.committedState(addr, obj, key)
+	}
+	return common.Hash{}
+}
+
+// SetState sets a value in the given account's storage.
+func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
+	obj := s.getOrNewAccount(addr)
+	prev, dirty := obj.dirtyStorage[key]
+	s.journal.append(storageChange{account: addr, key: key, prev: prev, prevDirty: dirty})
+	obj.dirtyStorage[key] = value
+}
+
+// Suicide marks the given account as suicided.
+// This clears the account balance.
+//
+// The account's state object is still available until the state is committed,
+// getAccount will return a non-nil account after Suicide.
+func (s *StateDB) Suicide(addr common.Address) bool {
+	obj := s.getAccount(addr)
+	if obj == nil {
+		return false
+	}
+	s.journal.append(suicideChange{account: addr, prev: obj.suicided, prevBalance: obj.balance})
+	obj.suicided = true
+	obj.balance = new(big.Int)
+	return true
+}
+
+// Suicide6780 marks the given account as suicided, but only if it was created
+// within the current transaction (EIP-6780).
+func (s *StateDB) Suicide6780(addr common.Address) {
+	if obj := s.getAccount(addr); obj != nil && obj.created {
+		s.Suicide(addr)
+	}
+}
+
+// HasSuicided reports whether the account has been marked as suicided.
+func (s *StateDB) HasSuicided(addr common.Address) bool {
+	if obj := s.getAccount(addr); obj != nil {
+		return obj.suicided
+	}
+	return false
+}
+
+// Exist reports whether the given account address exists in the state.
+// Notably this also returns true for suicided accounts.
+func (s *StateDB) Exist(addr common.Address) bool {
+	return s.getAccount(addr) != nil
+}
+
+// Empty returns whether the state object is either non-existent
+// or empty according to the EIP161 specification (balance = nonce = code = 0)
+func (s *StateDB) Empty(addr common.Address) bool {
+	obj := s.getAccount(addr)
+	return obj == nil || obj.empty()
+}
+
+// PrepareAccessList handles the preparatory steps for executing a state transition with
+// regards to EIP-2929 and EIP-2930:
+//
+// - Add sender to access list (2929)
+// - Add destination to access list (2929)
+// - Add precompiles to access list (2929)
+// - Add the contents of the optional tx access list (2930)
+//
+// This method should only be called if Berlin/2929+2930 is applicable at the current number.
+func (s *StateDB) PrepareAccessList(sender common.Address, dest *common.Address, precompiles []common.Address, list model.AccessList) {
+	// Clear out any leftover from previous executions
+	s.accessList = newAccessList()
+
+	s.AddAddressToAccessList(sender)
+	if dest != nil {
+		s.AddAddressToAccessList(*dest)
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+	for _, el := range list {
+		s.AddAddressToAccessList(el.Address)
+		for _, key := range el.StorageKeys {
+			s.AddSlotToAccessList(el.Address, key)
+		}
+	}
+}
+
+// AddAddressToAccessList adds the given address to the access list
+func (s *StateDB) AddAddressToAccessList(addr common.Address) {
+	if s.accessList.AddAddress(addr) {
+		s.journal.append(accessListAddAccountChange{address: addr})
+	}
+}
+
+// AddSlotToAccessList adds the given (address, slot)-tuple to the access list
+func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	addrMod, slotMod := s.accessList.AddSlot(addr, slot)
+	if addrMod {
+		// In practice, this should not happen, since there is no way to enter the
+		// scope of 'address' without having the 'address' become already added
+		// to the access list (via call-variant, create, etc).
+		// Better safe than sorry, though
+		s.journal.append(accessListAddAccountChange{address: addr})
+	}
+	if slotMod {
+		s.journal.append(accessListAddSlotChange{address: addr, slot: slot})
+	}
+}
+
+// AddressInAccessList returns true if the given address is in the access list.
+func (s *StateDB) AddressInAccessList(addr common.Address) bool {
+	return s.accessList.ContainsAddress(addr)
+}
+
+// SlotInAccessList returns true if the given (address, slot)-tuple is in the access list.
+func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
+	return s.accessList.Contains(addr, slot)
+}
+
+// Snapshot returns an identifier for the current revision of the state.
+func (s *StateDB) Snapshot() int {
+	id := s.nextRevisionId
+	s.nextRevisionId++
+	s.validRevisions = append(s.validRevisions, revision{id, s.journal.length()})
+	return id
+}
+
+// RevertToSnapshot reverts all state changes made since the given revision.
+func (s *StateDB) RevertToSnapshot(revid int) {
+	// Find the snapshot in the stack of valid snapshots.
+	idx := sort.Search(len(s.validRevisions), func(i int) bool {
+		return s.validRevisions[i].id >= revid
+	})
+	if idx == len(s.validRevisions) || s.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	snapshot := s.validRevisions[idx].journalIndex
+
+	// Replay the journal to undo changes and remove invalidated snapshots
+	s.journal.revert(s, snapshot)
+	s.validRevisions = s.validRevisions[:idx]
+}
+
+// AddLog adds a log to the current transaction.
+func (s *StateDB) AddLog(log *model.Log) {
+	s.journal.append(addLogChange{})
+	log.Index = uint(len(s.logs))
+	s.logs = append(s.logs, log)
+}
+
+// Logs returns the logs emitted since the last call to Finalise.
+func (s *StateDB) Logs() []*model.Log {
+	return s.logs
+}
+
+// AddPreimage records a SHA3 preimage seen by the VM.
+func (s *StateDB) AddPreimage(hash common.Hash, preimage []byte) {
+	if _, ok := s.preimages[hash]; !ok {
+		s.preimages[hash] = common.CopyBytes(preimage)
+	}
+}
+
+// Preimages returns a list of SHA3 preimages that have been submitted.
+func (s *StateDB) Preimages() map[common.Hash][]byte {
+	return s.preimages
+}
+
+// ForEachStorage iterates over the storage of the account associated with
+// addr in no particular order, stopping when cb returns false. Of the storage
+// provided by the reader of the state, only the slots accessed are visited.
+func (s *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
+	obj := s.getAccount(addr)
+	if obj == nil {
+		return nil
+	}
+	for key, value := range obj.dirtyStorage {
+		if !cb(key, value) {
+			return nil
+		}
+	}
+	for key, value := range obj.originStorage {
+		if _, dirty := obj.dirtyStorage[key]; dirty || value == (common.Hash{}) {
+			continue
+		}
+		if !cb(key, value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Finalise finalises the state at the end of a transaction: suicided accounts
+// are removed, dirty storage becomes the committed storage, and all data scoped
+// to a single transaction (refund, logs, created flags, journal) is reset.
+func (s *StateDB) Finalise() {
+	for addr, obj := range s.accounts {
+		if obj.suicided {
+			delete(s.accounts, addr)
+			continue
+		}
+		obj.finalise()
+	}
+	s.refund = 0
+	s.logs = nil
+	s.accessList = newAccessList()
+	s.journal = newJournal()
+	s.validRevisions = s.validRevisions[:0]
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"github.com/entropyio/go-evm/common"
+	"github.com/entropyio/go-evm/model"
+	"math/big"
+	"testing"
+)
+
+func TestSnapshotRevert(t *testing.T) {
+	var (
+		s    = New()
+		addr = common.BytesToAddress([]byte("addr"))
+		key  = common.BytesToHash([]byte("key"))
+	)
+	s.AddBalance(addr, big.NewInt(42))
+	s.SetState(addr, key, common.BytesToHash([]byte{1}))
+
+	snap := s.Snapshot()
+	s.AddBalance(addr, big.NewInt(8))
+	s.SetNonce(addr, 3)
+	s.SetState(addr, key, common.BytesToHash([]byte{2}))
+	s.SetCode(addr, []byte{0x60, 0x00})
+	s.AddRefund(100)
+	s.AddLog(&model.Log{Address: addr})
+	s.AddSlotToAccessList(addr, key)
+	s.RevertToSnapshot(snap)
+
+	if have := s.GetBalance(addr); have.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 42", have)
+	}
+	if have := s.GetNonce(addr); have != 0 {
+		t.Errorf("nonce mismatch: have %d, want 0", have)
+	}
+	if have := s.GetState(addr, key); have != common.BytesToHash([]byte{1}) {
+		t.Errorf("storage mismatch: have %x, want 01", have)
+	}
+	if have := s.GetCodeHash(addr); have != emptyCodeHash {
+		t.Errorf("code hash mismatch: have %x, want %x", have, emptyCodeHash)
+	}
+	if have := s.GetRefund(); have != 0 {
+		t.Errorf("refund mismatch: have %d, want 0", have)
+	}
+	if have := len(s.Logs()); have != 0 {
+		t.Errorf("log count mismatch: have %d, want 0", have)
+	}
+	if addrOk, slotOk := s.SlotInAccessList(addr, key); addrOk || slotOk {
+		t.Errorf("access list not reverted: address %v, slot %v", addrOk, slotOk)
+	}
+}
+
+func TestCommittedState(t *testing.T) {
+	var (
+		s    = New()
+		addr = common.BytesToAddress([]byte("addr"))
+		key  = common.BytesToHash([]byte("key"))
+		one  = common.BytesToHash([]byte{1})
+		two  = common.BytesToHash([]byte{2})
+	)
+	s.SetState(addr, key, one)
+	if have := s.GetCommittedState(addr, key); have != (common.Hash{}) {
+		t.Fatalf("dirty slot visible as committed: %x", have)
+	}
+	s.Finalise()
+	s.SetState(addr, key, two)
+	if have := s.GetCommittedState(addr, key); have != one {
+		t.Errorf("committed state mismatch: have %x, want %x", have, one)
+	}
+	if have := s.GetState(addr, key); have != two {
+		t.Errorf("current state mismatch: have %x, want %x", have, two)
+	}
+}
+
+func TestSuicide6780(t *testing.T) {
+	var (
+		s       = New()
+		old     = common.BytesToAddress([]byte("old"))
+		created = common.BytesToAddress([]byte("created"))
+	)
+	s.CreateAccount(old)
+	s.SetCode(old, []byte{0xff})
+	s.Finalise()
+
+	s.CreateAccount(created)
+	s.SetCode(created, []byte{0xff})
+	if !s.CreatedInTx(created) {
+		t.Fatalf("account not flagged as created in transaction")
+	}
+	if s.CreatedInTx(old) {
+		t.Fatalf("account from previous transaction flagged as created")
+	}
+	s.Suicide6780(old)
+	s.Suicide6780(created)
+	if s.HasSuicided(old) {
+		t.Errorf("pre-existing account destructed")
+	}
+	if !s.HasSuicided(created) {
+		t.Errorf("account created in transaction not destructed")
+	}
+	s.Finalise()
+	if !s.Exist(old) {
+		t.Errorf("pre-existing account removed")
+	}
+	if s.Exist(created) {
+		t.Errorf("destructed account still present")
+	}
+}